@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/atotto/clipboard"
+
+	"v1/malha"
+)
+
+// --- Área de Transferência (Copiar/Recortar/Colar) ---
+// A seleção é copiada como um documento de malha em JSON, de modo que pode ser
+// colada em outro arquivo ou em outra instância do editor.
+
+// copiarSelecao copia os elementos selecionados; com recortar, também os apaga.
+func (g *Game) copiarSelecao(recortar bool) {
+	selecionados := g.elementosSelecionados()
+	if len(selecionados) == 0 {
+		logln("Nada selecionado para copiar.")
+		return
+	}
+	if recortar {
+		ids := make([]int, len(selecionados))
+		for k, el := range selecionados {
+			ids[k] = el.ID
+		}
+		if g.travadoPorRota(ids...) { // Recortar sem poder apagar seria só copiar
+			return
+		}
+	}
+	var buf bytes.Buffer
+	if err := malha.SaveDocumento(&buf, malha.NewDocumento(selecionados)); err != nil {
+		logf("ERRO copiar: %v", err)
+		return
+	}
+	if err := clipboard.WriteAll(buf.String()); err != nil {
+		logf("ERRO área de transferência: %v", err)
+		return
+	}
+	logf("Copiados %d elementos.", len(selecionados))
+	if recortar {
+		g.apagarSelecao()
+	}
+}
+
+// colar insere os elementos da área de transferência centrados em (worldX,
+// worldY), com IDs novos, e os deixa selecionados.
+func (g *Game) colar(worldX, worldY float64) {
+	texto, err := clipboard.ReadAll()
+	if err != nil {
+		logf("ERRO área de transferência: %v", err)
+		return
+	}
+	doc, err := malha.LoadDocumento(strings.NewReader(texto))
+	if err != nil {
+		logf("Área de transferência não contém elementos da malha: %v", err)
+		return
+	}
+	if len(doc.Elementos) == 0 {
+		return
+	}
+	caixa := malha.CaixaDe(doc.Elementos)
+	novos, proxID := malha.RenumerarElementos(doc.Elementos, g.proximoElementoID, worldX-(caixa.MinX+caixa.MaxX)/2, worldY-(caixa.MinY+caixa.MaxY)/2)
+	for i := range novos { // Sinal copiado sem a sua via: prende à via sob ele, se houver
+		if novos[i].Tipo == malha.ElementoSinal && novos[i].ViaID == 0 {
+			malha.AnexarSinal(slices.Concat(g.elementos, novos), &novos[i], snapRaioTela/g.cameraZoom)
+		}
+	}
+	lote := &cmdLote{descricao: fmt.Sprintf("Colar %d elementos", len(novos))}
+	for _, el := range novos {
+		lote.comandos = append(lote.comandos, &cmdAdicionar{el: el})
+	}
+	g.proximoElementoID = proxID
+	g.executar(lote)
+	g.selecao = map[int]bool{}
+	for _, el := range novos {
+		g.selecao[el.ID] = true
+	}
+	logf("Colados %d elementos (IDs %d-%d).", len(novos), novos[0].ID, proxID-1)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"v1/malha"
+)
+
+// --- Linha de Comando ---
+// O editor abre opcionalmente já com um arquivo de malha:
+//
+//	editor [-historico N] [ARQUIVO.json]
+//
+// Validar, exportar, importar e resumir malhas sem janela é com o comando
+// malha (cmd/malha), que não depende de cgo nem de GPU.
+
+const (
+	saidaOK   = 0
+	saidaErro = 2
+)
+
+const usoCLI = `Uso: %[1]s [-historico N] [ARQUIVO.json]
+  Abre o editor (opcionalmente com a malha).
+  -historico: passos de desfazer guardados (0: sem limite)
+Para validate, export, import e stats, use o comando malha (go run ./cmd/malha).
+`
+
+// opcoesEditor são as opções de abertura do editor.
+type opcoesEditor struct {
+	Arquivo   string // Malha a abrir (vazio: malha nova)
+	Historico int    // Passos de desfazer guardados (0: sem limite)
+}
+
+// executarCLI interpreta os argumentos. Se abrirJanela for true, o editor deve
+// ser aberto com as opções dadas; senão o processo termina com codigo.
+func executarCLI(args []string, saida, erros io.Writer) (editor opcoesEditor, codigo int, abrirJanela bool) {
+	nome := filepath.Base(os.Args[0])
+	editor.Historico = historicoProfundidadePadrao
+	if len(args) > 0 {
+		switch args[0] {
+		case "validate", "export", "import", "stats":
+			fmt.Fprintf(erros, "%s: o subcomando '%s' está no comando malha (go run ./cmd/malha %s ...)\n", nome, args[0], args[0])
+			return editor, saidaErro, false
+		case "-h", "-help", "--help", "help":
+			fmt.Fprintf(saida, usoCLI, nome)
+			return editor, saidaOK, false
+		}
+	}
+	fs := flag.NewFlagSet(nome, flag.ContinueOnError)
+	fs.SetOutput(erros)
+	fs.Usage = func() { fmt.Fprintf(erros, usoCLI, nome) }
+	fs.IntVar(&editor.Historico, "historico", historicoProfundidadePadrao, "Passos de desfazer guardados (0: sem limite)")
+	if err := fs.Parse(args); err != nil {
+		return editor, saidaErro, false
+	}
+	if fs.NArg() > 1 || editor.Historico < 0 {
+		fs.Usage()
+		return editor, saidaErro, false
+	}
+	editor.Arquivo = fs.Arg(0)
+	return editor, saidaOK, true
+}
+
+// abrirArquivo carrega a malha passada na linha de comando ao iniciar o editor.
+func (g *Game) abrirArquivo(caminho string) {
+	if g.modificado {
+		logf("Malha recuperada mantida; '%s' não foi aberto.", caminho)
+		return
+	}
+	doc, err := malha.LoadDocumentoFile(caminho)
+	if err != nil {
+		logf("ERRO carregar '%s': %v", caminho, err)
+		fmt.Fprintf(os.Stderr, "%s: %v\n", caminho, err)
+		return
+	}
+	g.abrirDocumento(doc, "Abrir "+caminho)
+	g.marcarSalvo()
+	logf("Malha aberta: '%s' (%d elementos)", caminho, len(doc.Elementos))
+}
@@ -0,0 +1,218 @@
+// Comando malha valida, exporta, importa e resume malhas sem abrir janela,
+// para uso em scripts, hooks do git e integração contínua. Depende só do
+// pacote malha (sem cgo nem GPU):
+//
+//	malha validate [-estrito] ARQUIVO.json...
+//	malha export [-largura N] [-altura N] [-escala PX/M] [-margem N] [-fundo #RRGGBB] [-unidade M] ARQUIVO.json SAIDA.(png|svg|dxf|railml|csv|html)
+//	malha import [-unidade M] [-camada NOME] [-bitola N] ENTRADA.(dxf|railml) ARQUIVO.json
+//	malha stats ARQUIVO.json
+//
+// Códigos de saída: 0 sucesso, 1 problemas encontrados, 2 uso ou E/S inválidos.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"strings"
+
+	"v1/malha"
+)
+
+const (
+	saidaOK        = 0
+	saidaProblemas = 1
+	saidaErro      = 2
+)
+
+const nomeComando = "malha"
+
+const uso = `Uso:
+  malha validate [-estrito] ARQUIVO... Valida as malhas; sai com 1 se houver erros
+  malha export [opções] ARQUIVO SAIDA  Exporta a malha (formato pela extensão: .png, .svg, .dxf, .railml;
+                                       .csv e .html: tabela de rotas)
+  malha import [opções] ENTRADA SAIDA  Converte um DXF ou railML 2.x em malha
+  malha stats ARQUIVO                  Mostra contagens e comprimento de via
+`
+
+func main() {
+	os.Exit(executar(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// executar roda o subcomando dos argumentos e devolve o código de saída.
+func executar(args []string, saida, erros io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(erros, uso)
+		return saidaErro
+	}
+	switch args[0] {
+	case "validate":
+		return cliValidar(args[1:], saida, erros)
+	case "export":
+		return cliExportar(args[1:], saida, erros)
+	case "import":
+		return cliImportar(args[1:], saida, erros)
+	case "stats":
+		return cliEstatisticas(args[1:], saida, erros)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(saida, uso)
+		return saidaOK
+	}
+	fmt.Fprintf(erros, "subcomando '%s' desconhecido\n%s", args[0], uso)
+	return saidaErro
+}
+
+// novoFlagSet cria o conjunto de opções de um subcomando com a mensagem de uso dada.
+func novoFlagSet(subcomando, argumentos string, erros io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(subcomando, flag.ContinueOnError)
+	fs.SetOutput(erros)
+	fs.Usage = func() {
+		fmt.Fprintf(erros, "Uso: %s %s %s\n", nomeComando, subcomando, argumentos)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func cliValidar(args []string, saida, erros io.Writer) int {
+	fs := novoFlagSet("validate", "[-estrito] ARQUIVO.json...", erros)
+	estrito := fs.Bool("estrito", false, "Avisos também fazem o comando falhar")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		if err == nil {
+			fs.Usage()
+		}
+		return saidaErro
+	}
+	codigo := saidaOK
+	for _, caminho := range fs.Args() {
+		doc, err := malha.LoadDocumentoFile(caminho)
+		if err != nil {
+			fmt.Fprintf(erros, "%s: %v\n", caminho, err)
+			codigo = saidaErro
+			continue
+		}
+		problemas := malha.Validar(doc.Elementos)
+		for _, p := range problemas {
+			fmt.Fprintf(saida, "%s: %s [%s] %s (IDs %v)\n", caminho, p.Severidade, p.Regra, p.Mensagem, p.IDs)
+		}
+		nErros := malha.ContarErros(problemas)
+		fmt.Fprintf(saida, "%s: %d elemento(s), %d erro(s), %d aviso(s)\n", caminho, len(doc.Elementos), nErros, len(problemas)-nErros)
+		if (nErros > 0 || (*estrito && len(problemas) > 0)) && codigo == saidaOK {
+			codigo = saidaProblemas
+		}
+	}
+	return codigo
+}
+
+func cliExportar(args []string, saida, erros io.Writer) int {
+	fs := novoFlagSet("export", "[opções] ARQUIVO.json SAIDA.(png|svg|dxf|railml|csv|html)", erros)
+	largura := fs.Int("largura", 0, "Largura da imagem em pixels (padrão 1920 sem -altura e -escala)")
+	altura := fs.Int("altura", 0, "Altura da imagem em pixels (0: proporcional ao conteúdo)")
+	escala := fs.Float64("escala", 0, "Pixels por metro (0: ajustar ao tamanho)")
+	margem := fs.Int("margem", malha.ImagemMargemPadrao, "Margem em volta do conteúdo (pixels)")
+	fundo := fs.String("fundo", "", "Cor de fundo #RRGGBB (padrão: a cor salva no arquivo)")
+	unidade := fs.Float64("unidade", 1, "DXF: metros por unidade do desenho (0.001 = milímetros)")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 2 {
+		if err == nil {
+			fs.Usage()
+		}
+		return saidaErro
+	}
+	entrada, destino := fs.Arg(0), fs.Arg(1)
+	doc, err := malha.LoadDocumentoFile(entrada)
+	if err != nil {
+		fmt.Fprintf(erros, "%s: %v\n", entrada, err)
+		return saidaErro
+	}
+	op := malha.OpcoesExportacao{
+		Imagem: malha.OpcoesImagem{Largura: *largura, Altura: *altura, Escala: *escala, Margem: *margem, Fundo: doc.CorFundo},
+		DXF:    malha.OpcoesDXF{MetrosPorUnidade: *unidade},
+	}
+	if *fundo != "" {
+		if op.Imagem.Fundo, err = lerCorHex(*fundo); err != nil {
+			fmt.Fprintf(erros, "-fundo: %v\n", err)
+			return saidaErro
+		}
+	}
+	if op.Imagem.Largura <= 0 && op.Imagem.Altura <= 0 && op.Imagem.Escala <= 0 {
+		op.Imagem.Largura = 1920
+	}
+	if err := malha.ExportarArquivo(destino, doc.Elementos, op); err != nil {
+		fmt.Fprintf(erros, "%s: %v\n", destino, err)
+		return saidaErro
+	}
+	fmt.Fprintf(saida, "%s: %d elemento(s) exportado(s) para %s\n", entrada, len(doc.Elementos), destino)
+	return saidaOK
+}
+
+func cliImportar(args []string, saida, erros io.Writer) int {
+	fs := novoFlagSet("import", "[-unidade M] [-camada NOME] [-bitola N] ENTRADA.(dxf|railml) ARQUIVO.json", erros)
+	unidade := fs.Float64("unidade", 0, "DXF: metros por unidade do desenho (0: $INSUNITS do arquivo, ou metros)")
+	camada := fs.String("camada", "", "DXF: importar só as entidades desta camada")
+	bitola := fs.Float64("bitola", malha.ChaveBitolaPadrao, "DXF: bitola das vias criadas (Unid. Mundo)")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 2 {
+		if err == nil {
+			fs.Usage()
+		}
+		return saidaErro
+	}
+	entrada, destino := fs.Arg(0), fs.Arg(1)
+	branco := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	elementos, resumo, err := malha.ImportarArquivo(entrada, 1, malha.OpcoesDXF{MetrosPorUnidade: *unidade, Camada: *camada, Espessura: *bitola, CorPadrao: branco}, branco)
+	if err != nil {
+		fmt.Fprintf(erros, "%s: %v\n", entrada, err)
+		return saidaErro
+	}
+	malha.ApplyConexoes(elementos, malha.BuildTopologia(elementos))
+	doc := malha.NewDocumento(elementos)
+	caixa := malha.CaixaDe(elementos)
+	doc.Camera.X, doc.Camera.Y = (caixa.MinX+caixa.MaxX)/2, (caixa.MinY+caixa.MaxY)/2
+	if err := malha.SaveDocumentoFile(destino, doc); err != nil {
+		fmt.Fprintf(erros, "%s: %v\n", destino, err)
+		return saidaErro
+	}
+	fmt.Fprintf(saida, "%s: %d elemento(s) importado(s) para %s (%s)\n", entrada, len(elementos), destino, resumo)
+	return saidaOK
+}
+
+func cliEstatisticas(args []string, saida, erros io.Writer) int {
+	fs := novoFlagSet("stats", "ARQUIVO.json", erros)
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		if err == nil {
+			fs.Usage()
+		}
+		return saidaErro
+	}
+	doc, err := malha.LoadDocumentoFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(erros, "%s: %v\n", fs.Arg(0), err)
+		return saidaErro
+	}
+	contagem := map[malha.ElementType]int{}
+	comprimentoVia := 0.0
+	for _, el := range doc.Elementos {
+		contagem[el.Tipo]++
+		if el.Tipo.EhVia() {
+			comprimentoVia += el.Comprimento
+		}
+	}
+	topologia := malha.BuildTopologia(doc.Elementos)
+	fmt.Fprintf(saida, "Arquivo: %s (versão %d, autor '%s', modificado %s)\n", fs.Arg(0), doc.Versao, doc.Autor, doc.Modificado.Format("02/01/2006 15:04"))
+	fmt.Fprintf(saida, "Elementos: %d\n", len(doc.Elementos))
+	for _, t := range []malha.ElementType{malha.ElementoViaReta, malha.ElementoViaCurva, malha.ElementoViaTransicao, malha.ElementoCircuitoVia, malha.ElementoChaveSimples, malha.ElementoSinal} {
+		fmt.Fprintf(saida, "  %-14s %d\n", malha.NomeTipo(t)+":", contagem[t])
+	}
+	fmt.Fprintf(saida, "Comprimento de via: %.1f m\n", comprimentoVia)
+	fmt.Fprintf(saida, "Nós: %d | Componentes conexas: %d | Seções: %d\n", len(topologia.Nos), len(topologia.ConnectedComponents()), len(malha.BuildSecoes(doc.Elementos, topologia).Lista))
+	return saidaOK
+}
+
+// lerCorHex interpreta uma cor #RRGGBB (opaca).
+func lerCorHex(texto string) (color.RGBA, error) {
+	var r, g, b uint8
+	if n, _ := fmt.Sscanf(strings.TrimSpace(texto), "#%02x%02x%02x", &r, &g, &b); n != 3 {
+		return color.RGBA{}, fmt.Errorf("cor '%s' inválida, use #RRGGBB", texto)
+	}
+	return color.RGBA{R: r, G: g, B: b, A: 255}, nil
+}
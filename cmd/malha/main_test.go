@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"v1/malha"
+)
+
+// gravarMalha salva os elementos num documento temporário e devolve o caminho.
+func gravarMalha(t *testing.T, elementos []malha.Elemento) string {
+	t.Helper()
+	caminho := filepath.Join(t.TempDir(), "malha.json")
+	if err := malha.SaveDocumentoFile(caminho, malha.NewDocumento(elementos)); err != nil {
+		t.Fatal(err)
+	}
+	return caminho
+}
+
+func via(id int, x, y, comprimento float64) malha.Elemento {
+	return malha.Elemento{Tipo: malha.ElementoViaReta, ID: id, X: x, Y: y, Comprimento: comprimento, Espessura: 2}
+}
+
+func TestExecutar(t *testing.T) {
+	ligadas := gravarMalha(t, []malha.Elemento{via(1, 0, 0, 1000), via(2, 10, 0, 1000)})
+	transicao := malha.Elemento{Tipo: malha.ElementoViaTransicao, ID: 3, X: 20, Comprimento: 500, Raio: 1000, Varredura: malha.VarreduraTransicao(500, 0, 1000), Espessura: 2}
+	comTransicao := gravarMalha(t, []malha.Elemento{via(1, 0, 0, 1000), via(2, 10, 0, 1000), transicao})
+	sobrepostas := gravarMalha(t, []malha.Elemento{via(1, 0, 0, 1000), via(2, 0, 0, 1000)})
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		nome   string
+		args   []string
+		codigo int
+		saida  string // Trecho esperado na saída padrão
+	}{
+		{nome: "validate com avisos", args: []string{"validate", ligadas}, codigo: saidaOK, saida: "0 erro(s), 2 aviso(s)"},
+		{nome: "validate estrito", args: []string{"validate", "-estrito", ligadas}, codigo: saidaProblemas},
+		{nome: "validate com erros", args: []string{"validate", sobrepostas}, codigo: saidaProblemas, saida: "[vias-sobrepostas]"},
+		{nome: "validate sem arquivo", args: []string{"validate", filepath.Join(dir, "nada.json")}, codigo: saidaErro},
+		{nome: "export svg", args: []string{"export", "-largura", "200", ligadas, filepath.Join(dir, "malha.svg")}, codigo: saidaOK, saida: "2 elemento(s) exportado(s)"},
+		{nome: "export dxf", args: []string{"export", ligadas, filepath.Join(dir, "malha.dxf")}, codigo: saidaOK},
+		{nome: "export formato desconhecido", args: []string{"export", ligadas, filepath.Join(dir, "malha.bmp")}, codigo: saidaErro},
+		{nome: "export fundo inválido", args: []string{"export", "-fundo", "azul", ligadas, filepath.Join(dir, "malha.png")}, codigo: saidaErro},
+		{nome: "stats", args: []string{"stats", ligadas}, codigo: saidaOK, saida: "Comprimento de via: 2000.0 m"},
+		{nome: "stats com transição", args: []string{"stats", comTransicao}, codigo: saidaOK, saida: "Via Transicao: 1\n"},
+		{nome: "subcomando desconhecido", args: []string{"desenhar"}, codigo: saidaErro},
+		{nome: "sem argumentos", codigo: saidaErro},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			var saida, erros bytes.Buffer
+			if codigo := executar(tc.args, &saida, &erros); codigo != tc.codigo {
+				t.Fatalf("código %d, quer %d\nsaída: %s\nerros: %s", codigo, tc.codigo, saida.String(), erros.String())
+			}
+			if !strings.Contains(saida.String(), tc.saida) {
+				t.Errorf("saída %q sem %q", saida.String(), tc.saida)
+			}
+		})
+	}
+}
+
+func TestExecutarImportar(t *testing.T) {
+	dir := t.TempDir()
+	dxf, importada := filepath.Join(dir, "malha.dxf"), filepath.Join(dir, "importada.json")
+	if err := malha.ExportarArquivo(dxf, []malha.Elemento{via(1, 0, 0, 1000), via(2, 10, 0, 1000)}, malha.OpcoesExportacao{DXF: malha.OpcoesDXF{MetrosPorUnidade: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	var saida, erros bytes.Buffer
+	if codigo := executar([]string{"import", dxf, importada}, &saida, &erros); codigo != saidaOK {
+		t.Fatalf("código %d: %s", codigo, erros.String())
+	}
+	doc, err := malha.LoadDocumentoFile(importada)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Elementos) != 2 || doc.Elementos[0].Conexoes == nil || doc.Camera.X != 10 {
+		t.Errorf("importados %+v com câmera em %v, quer as duas vias ligadas e a câmera no centro", doc.Elementos, doc.Camera.X)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"v1/malha"
+)
+
+// --- Desenho de Vias (Retas, Curvas e Transições) ---
+// Uma curva parte tangente ao rumo da via em cuja ponta começa (ou rumo 0° se
+// começar solta) e termina no ponto solto. Uma transição parte também com a
+// curvatura dessa ponta, variando-a até chegar ao ponto. Uma reta que parte da
+// ponta de uma curva ou transição é atraída para a tangente dela.
+
+// iniciarDesenhoVia registra o início do desenho e, para curvas e transições,
+// o rumo e a curvatura iniciais.
+func (g *Game) iniciarDesenhoVia(x, y float64) {
+	g.startX, g.startY = g.snapPoint(x, y, -1)
+	g.snapInicio, g.snapInicioAtivo = g.snapAtual, g.snapAtivo
+	g.rumoInicioCurva, g.curvaturaInicio = 0, 0
+	if r, ok := g.rumoSaindoDe(g.snapInicio); ok && g.snapInicioAtivo {
+		g.rumoInicioCurva = r
+		g.curvaturaInicio, _ = g.curvaturaSaindoDe(g.snapInicio)
+	}
+	g.drawingVia = true
+}
+
+// fimDesenho devolve o ponto final do desenho em curso para o cursor em
+// (x, y), considerando o snap calculado no frame.
+func (g *Game) fimDesenho(x, y float64) (float64, float64) {
+	if g.snapAtivo {
+		return g.snapAtual.X, g.snapAtual.Y
+	}
+	if tx, ty, ok := g.projetarNaTangente(x, y); ok {
+		return tx, ty
+	}
+	return g.fimNaGrade(x, y)
+}
+
+// projetarNaTangente restringe o fim de uma reta que parte da ponta de uma
+// curva ou transição à tangente dela, evitando uma quebra de rumo. Alt
+// desativa; ok é false quando a restrição não se aplica.
+func (g *Game) projetarNaTangente(x, y float64) (float64, float64, bool) {
+	if g.elementoAtualTipo != malha.ElementoViaReta || !g.snapInicioAtivo || ebiten.IsKeyPressed(ebiten.KeyAlt) {
+		return x, y, false
+	}
+	if i := g.indexOfID(g.snapInicio.ElementoID); i == -1 || (g.elementos[i].Tipo != malha.ElementoViaCurva && g.elementos[i].Tipo != malha.ElementoViaTransicao) {
+		return x, y, false
+	}
+	rumo, ok := g.rumoSaindoDe(g.snapInicio)
+	if !ok {
+		return x, y, false
+	}
+	dx, dy := math.Cos(rumo*math.Pi/180), math.Sin(rumo*math.Pi/180)
+	d := (x-g.startX)*dx + (y-g.startY)*dy
+	if d <= 0 {
+		return x, y, false
+	}
+	return g.startX + dx*d, g.startY + dy*d, true
+}
+
+// viaDesenhada monta a via (reta, curva ou transição) do desenho em curso até
+// (x, y). ok é false se o traçado for curto demais ou se a curva ou transição
+// não puder ser definida (ponto final alinhado ao rumo inicial ou atrás dele).
+func (g *Game) viaDesenhada(x, y float64) (malha.Elemento, bool) {
+	if math.IsNaN(g.startX) || math.IsNaN(g.startY) || math.Hypot(x-g.startX, y-g.startY)*g.cameraZoom <= 1.0 {
+		return malha.Elemento{}, false
+	}
+	el := malha.Elemento{Tipo: malha.ElementoViaReta, ID: g.proximoElementoID, X: g.startX, Y: g.startY, Cor: g.currentColor, Espessura: g.thickness, ModoCheio: g.viaCheiaDefault}
+	if g.elementoAtualTipo == malha.ElementoViaTransicao {
+		comprimento, raioInicial, raio, varredura, ok := malha.TransicaoTangente(g.startX, g.startY, g.rumoInicioCurva, g.curvaturaInicio, x, y)
+		el.Tipo = malha.ElementoViaTransicao
+		el.Rotacao, el.Comprimento, el.RaioInicial, el.Raio, el.Varredura = g.rumoInicioCurva, comprimento, raioInicial, raio, varredura
+		return el, ok
+	}
+	if g.elementoAtualTipo != malha.ElementoViaCurva {
+		el.Comprimento = malha.CalculateLengthMeters(g.startX, g.startY, x, y)
+		el.Rotacao = math.Atan2(y-g.startY, x-g.startX) * 180 / math.Pi
+		return el, !math.IsNaN(el.Comprimento)
+	}
+	raio, varredura, ok := malha.CurvaTangente(g.startX, g.startY, g.rumoInicioCurva, x, y)
+	el.Tipo = malha.ElementoViaCurva
+	el.Rotacao, el.Raio, el.Varredura = g.rumoInicioCurva, raio, varredura
+	el.Comprimento = malha.ComprimentoArco(raio, varredura)
+	return el, ok
+}
+
+// drawFaixaVia desenha uma via ao longo da polilinha (Unid. Mundo) no estilo
+// da ViaReta: dois trilhos afastados meia bitola na vertical da tela, ou a
+// faixa preenchida no modo cheio.
+func (g *Game) drawFaixaVia(screen *ebiten.Image, pontos []malha.Ponto, espessura float64, cheio bool, cor color.RGBA) {
+	if len(pontos) < 2 {
+		return
+	}
+	meiaBitola := float32(math.Max(espessura*g.cameraZoom, 1.0)) / 2.0
+	traco := float32(math.Max(railStrokeWidth*g.cameraZoom, 0.5))
+	tela := make([][2]float32, len(pontos))
+	for k, p := range pontos {
+		tela[k][0], tela[k][1] = g.worldToScreen(p.X, p.Y)
+	}
+	if cheio {
+		r, gVal, b, a := cor.RGBA()
+		colorR, colorG, colorB, colorA := float32(r)/65535.0, float32(gVal)/65535.0, float32(b)/65535.0, float32(a)/65535.0
+		vertices := make([]ebiten.Vertex, 0, 2*len(tela))
+		indices := make([]uint16, 0, 6*len(tela))
+		for k, p := range tela {
+			vertices = append(vertices,
+				ebiten.Vertex{DstX: p[0], DstY: p[1] - meiaBitola, ColorR: colorR, ColorG: colorG, ColorB: colorB, ColorA: colorA},
+				ebiten.Vertex{DstX: p[0], DstY: p[1] + meiaBitola, ColorR: colorR, ColorG: colorG, ColorB: colorB, ColorA: colorA})
+			if k > 0 {
+				base := uint16(2 * k)
+				indices = append(indices, base-2, base-1, base+1, base-2, base+1, base)
+			}
+		}
+		screen.DrawTriangles(vertices, indices, g.whitePixel, &ebiten.DrawTrianglesOptions{AntiAlias: true})
+		return
+	}
+	for k := 1; k < len(tela); k++ {
+		a, b := tela[k-1], tela[k]
+		vector.StrokeLine(screen, a[0], a[1]-meiaBitola, b[0], b[1]-meiaBitola, traco, cor, true)
+		vector.StrokeLine(screen, a[0], a[1]+meiaBitola, b[0], b[1]+meiaBitola, traco, cor, true)
+	}
+	for _, p := range [][2]float32{tela[0], tela[len(tela)-1]} {
+		vector.StrokeLine(screen, p[0], p[1]-meiaBitola, p[0], p[1]+meiaBitola, traco, cor, true)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/sqweek/dialog"
+
+	"v1/malha"
+)
+
+// --- Exportação e Importação ---
+// Diálogos do editor sobre malha.ExportarArquivo e malha.ImportarArquivo,
+// que escolhem o formato pela extensão.
+
+// exportarMalha pede o destino e exporta a malha inteira com a cor de fundo
+// atual, enquadrada em uma imagem do tamanho da janela (PNG por padrão). O
+// DXF é gravado em metros; CSV e HTML gravam a tabela de rotas.
+func (g *Game) exportarMalha() {
+	destino, err := dialog.File().Filter("Imagem PNG", "png").Filter("Imagem SVG", "svg").Filter("Desenho DXF", "dxf").Filter("Infraestrutura railML 2.4", "railml").Filter("Tabela de Rotas CSV", "csv").Filter("Tabela de Rotas HTML", "html").Title("Exportar Malha").Save()
+	if err != nil {
+		if err != dialog.ErrCancelled {
+			logf("ERRO diálogo exportar: %v", err)
+		}
+		return
+	}
+	if filepath.Ext(destino) == "" {
+		destino += ".png"
+	}
+	op := malha.OpcoesExportacao{
+		Imagem: malha.OpcoesImagem{Largura: g.screenWidth, Altura: g.screenHeight, Margem: malha.ImagemMargemPadrao, Fundo: g.backgroundColor},
+		DXF:    malha.OpcoesDXF{MetrosPorUnidade: 1},
+	}
+	if err := malha.ExportarArquivo(destino, g.elementos, op); err != nil {
+		logf("ERRO exportar '%s': %v", destino, err)
+		dialog.Message("Não foi possível exportar: %v", err).Title("Exportar Malha").Error()
+		return
+	}
+	logf("Exportado: '%s' (%d elementos)", destino, len(g.elementos))
+}
+
+// importarMalha pede um arquivo DXF ou railML e acrescenta os elementos à
+// malha em um único passo do histórico (DXF na unidade de $INSUNITS, ou
+// metros). Os elementos ficam selecionados e a câmera é centrada neles.
+func (g *Game) importarMalha() {
+	origem, err := dialog.File().Filter("Desenho DXF", "dxf").Filter("Infraestrutura railML 2.x", "railml", "xml").Title("Importar").Load()
+	if err != nil {
+		if err != dialog.ErrCancelled {
+			logf("ERRO diálogo importar: %v", err)
+		}
+		return
+	}
+	novos, resumo, err := malha.ImportarArquivo(origem, g.proximoElementoID, malha.OpcoesDXF{Espessura: g.thickness, CorPadrao: g.currentColor}, g.currentColor)
+	if err != nil {
+		logf("ERRO importar '%s': %v", origem, err)
+		dialog.Message("Não foi possível importar: %v", err).Title("Importar").Error()
+		return
+	}
+	lote := &cmdLote{descricao: fmt.Sprintf("Importar %s", filepath.Base(origem))}
+	for _, el := range novos {
+		lote.comandos = append(lote.comandos, &cmdAdicionar{el: el})
+	}
+	g.proximoElementoID = novos[len(novos)-1].ID + 1
+	g.executar(lote)
+	g.selecao = map[int]bool{}
+	for _, el := range novos {
+		g.selecao[el.ID] = true
+	}
+	caixa := malha.CaixaDe(novos)
+	g.cameraOffsetX, g.cameraOffsetY = (caixa.MinX+caixa.MaxX)/2, (caixa.MinY+caixa.MaxY)/2
+	logf("Importado '%s': %d elementos (%s).", origem, len(novos), resumo)
+}
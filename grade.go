@@ -0,0 +1,107 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"v1/malha"
+)
+
+// --- Grade e Snap na Grade ---
+// Grade em coordenadas de mundo com passo em metros na sequência 1-2-5,
+// escolhido conforme o zoom para que as linhas menores fiquem a pelo menos
+// gradeMinimoTela pixels. Cada gradeMaiorCada linhas uma é maior e rotulada.
+// Com o snap na grade ligado (e a grade visível), pontos soltos vão para a
+// interseção mais próxima e retas desenhadas têm rumo em múltiplos de
+// gradePassoAngulo e comprimento em múltiplos do passo. O snap em elementos
+// tem prioridade; Alt desativa ambos.
+
+const (
+	gradeMinimoTela  = 12.0 // Espaço mínimo entre linhas menores (pixels)
+	gradeMaiorCada   = 5    // Uma linha maior a cada tantas linhas menores
+	gradePassoAngulo = 15.0 // Graus
+)
+
+// passoGradeMetros devolve o passo das linhas menores (metros) para o zoom dado.
+func passoGradeMetros(zoom float64) float64 {
+	minimo := gradeMinimoTela / (zoom * malha.PixelsPerMeter)
+	base := math.Pow(10, math.Floor(math.Log10(minimo)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if base*m >= minimo {
+			return base * m
+		}
+	}
+	return base * 10
+}
+
+// snapGradeAtivo indica se pontos soltos devem ser atraídos para a grade neste frame.
+func (g *Game) snapGradeAtivo() bool {
+	return g.gradeVisivel && g.snapGrade && !ebiten.IsKeyPressed(ebiten.KeyAlt)
+}
+
+// pontoNaGrade devolve a interseção da grade mais próxima de (x, y), ou o
+// próprio ponto com o snap na grade desligado.
+func (g *Game) pontoNaGrade(x, y float64) (float64, float64) {
+	if !g.snapGradeAtivo() {
+		return x, y
+	}
+	passo := passoGradeMetros(g.cameraZoom) * malha.PixelsPerMeter
+	return math.Round(x/passo) * passo, math.Round(y/passo) * passo
+}
+
+// fimNaGrade ajusta o fim de uma via em desenho: retas ficam com rumo em
+// múltiplos de gradePassoAngulo e comprimento em múltiplos do passo; curvas
+// terminam numa interseção da grade.
+func (g *Game) fimNaGrade(x, y float64) (float64, float64) {
+	if !g.snapGradeAtivo() {
+		return x, y
+	}
+	if g.elementoAtualTipo != malha.ElementoViaReta {
+		return g.pontoNaGrade(x, y)
+	}
+	passo := passoGradeMetros(g.cameraZoom) * malha.PixelsPerMeter
+	rumo := math.Round(math.Atan2(y-g.startY, x-g.startX)*180/math.Pi/gradePassoAngulo) * gradePassoAngulo * math.Pi / 180
+	d := math.Round(math.Hypot(x-g.startX, y-g.startY)/passo) * passo
+	return g.startX + d*math.Cos(rumo), g.startY + d*math.Sin(rumo)
+}
+
+// drawGrade desenha as linhas da grade visíveis na tela, com rótulos em metros nas maiores.
+func (g *Game) drawGrade(screen *ebiten.Image) {
+	if !g.gradeVisivel {
+		return
+	}
+	passoMetros := passoGradeMetros(g.cameraZoom)
+	passo := passoMetros * malha.PixelsPerMeter
+	minX, minY := g.screenToWorld(0, 0)
+	maxX, maxY := g.screenToWorld(g.screenWidth, g.screenHeight)
+	r, gr, b, _ := g.backgroundColor.RGBA()
+	// Branco translúcido (alfa pré-multiplicado); sobre fundo claro, preto translúcido
+	menor, maior := color.RGBA{R: 24, G: 24, B: 24, A: 24}, color.RGBA{R: 64, G: 64, B: 64, A: 64}
+	if (r+gr+b)/3 > 0x8000 {
+		menor, maior = color.RGBA{A: 24}, color.RGBA{A: 64}
+	}
+	rotulo := color.RGBA{R: 150, G: 150, B: 150, A: 255}
+	h, w := float32(g.screenHeight), float32(g.screenWidth)
+	for k := math.Ceil(minX / passo); k*passo <= maxX; k++ {
+		sx, _ := g.worldToScreen(k*passo, 0)
+		if int(math.Mod(math.Abs(k), gradeMaiorCada)) == 0 {
+			vector.StrokeLine(screen, sx, 0, sx, h, 1, maior, false)
+			text.Draw(screen, formatarNumero(k*passoMetros)+"m", g.helpTextFace, int(sx)+2, g.screenHeight-4, rotulo)
+		} else {
+			vector.StrokeLine(screen, sx, 0, sx, h, 1, menor, false)
+		}
+	}
+	for k := math.Ceil(minY / passo); k*passo <= maxY; k++ {
+		_, sy := g.worldToScreen(0, k*passo)
+		if int(math.Mod(math.Abs(k), gradeMaiorCada)) == 0 {
+			vector.StrokeLine(screen, 0, sy, w, sy, 1, maior, false)
+			text.Draw(screen, formatarNumero(k*passoMetros)+"m", g.helpTextFace, 2, int(sy)-2, rotulo)
+		} else {
+			vector.StrokeLine(screen, 0, sy, w, sy, 1, menor, false)
+		}
+	}
+}
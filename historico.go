@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+
+	"v1/malha"
+)
+
+// --- Histórico Desfazer/Refazer ---
+// Toda mutação de g.elementos passa por um Comando. Comandos já aplicados
+// (ex.: arrasto, que altera o elemento a cada frame) são apenas registrados.
+// Cada comando mantém o índice espacial em dia com o que altera.
+
+const historicoProfundidadePadrao = 200 // Passos guardados sem a opção -historico da linha de comando
+
+// Comando é uma operação reversível sobre os elementos.
+type Comando interface {
+	Executar(g *Game)
+	Desfazer(g *Game)
+	Descricao() string
+}
+
+// Historico mantém as pilhas de desfazer/refazer.
+type Historico struct {
+	desfazer, refazer []Comando
+	Limite            int
+}
+
+func (g *Game) indexOfID(id int) int {
+	for i, el := range g.elementos {
+		if el.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// executar aplica o comando e o registra no histórico.
+func (g *Game) executar(c Comando) {
+	c.Executar(g)
+	g.registrar(c)
+}
+
+// registrar empilha um comando que já foi aplicado.
+func (g *Game) registrar(c Comando) {
+	if lote, ok := c.(*cmdLote); ok && len(lote.comandos) == 0 {
+		return
+	}
+	h := &g.historico
+	h.desfazer = append(h.desfazer, c)
+	if h.Limite > 0 && len(h.desfazer) > h.Limite {
+		h.desfazer = h.desfazer[len(h.desfazer)-h.Limite:]
+	}
+	h.refazer = nil
+	g.aposMutacao()
+}
+
+func (g *Game) desfazer() {
+	h := &g.historico
+	if len(h.desfazer) == 0 {
+		logln("Nada para desfazer.")
+		return
+	}
+	c := h.desfazer[len(h.desfazer)-1]
+	h.desfazer = h.desfazer[:len(h.desfazer)-1]
+	c.Desfazer(g)
+	h.refazer = append(h.refazer, c)
+	logf("Desfeito: %s", c.Descricao())
+	g.aposMutacao()
+}
+
+func (g *Game) refazer() {
+	h := &g.historico
+	if len(h.refazer) == 0 {
+		logln("Nada para refazer.")
+		return
+	}
+	c := h.refazer[len(h.refazer)-1]
+	h.refazer = h.refazer[:len(h.refazer)-1]
+	c.Executar(g)
+	h.desfazer = append(h.desfazer, c)
+	logf("Refeito: %s", c.Descricao())
+	g.aposMutacao()
+}
+
+// aposMutacao limpa referências por índice e recalcula dados derivados.
+func (g *Game) aposMutacao() {
+	g.selectedElementIndex = -1
+	g.hoveredElementIndex = -1
+	g.movingElementIndex = -1
+	g.popupVisible = false
+	g.rebuildTopology()
+	g.reconciliarSessao()
+	g.podarSelecao()
+	g.marcarModificado()
+}
+
+// rebuildTopology recalcula a topologia, grava as conexões em cada via e
+// refaz a divisão em seções de via. A prévia do inspetor usa só esta parte.
+func (g *Game) rebuildTopology() {
+	g.topologia = malha.BuildTopologia(g.elementos)
+	malha.ApplyConexoes(g.elementos, g.topologia)
+	g.secoes = malha.BuildSecoes(g.elementos, g.topologia)
+	g.problemasPendentes = true
+}
+
+// reconciliarSessao ajusta à malha editada o estado da sessão que depende
+// dela (rotas, trens, trajeto medido). Roda uma vez por comando, não a cada
+// valor digitado no inspetor, para Esc poder devolver tudo como estava.
+func (g *Game) reconciliarSessao() {
+	for _, nome := range g.intertravamento.Atualizar(g.elementos, g.topologia, g.secoes) {
+		logf("Rota %s desfeita pela edição da malha", nome)
+	}
+	if g.simulacao != nil {
+		if n := g.simulacao.Atualizar(g.elementos, g.topologia); n > 0 {
+			logf("Simulação: %d trem(ns) removido(s) pela edição da malha", n)
+		}
+	}
+	if g.modoMedicao && len(g.medicaoPontos) == 2 {
+		g.medirTrajeto()
+	}
+}
+
+// reiniciarSessao descarta o estado da sessão preso à malha anterior quando
+// ela é trocada inteira (carregar, limpar, ou desfazer/refazer isso): trens,
+// rotas travadas e medição não fazem sentido na malha nova.
+func (g *Game) reiniciarSessao() {
+	if g.simulacao != nil {
+		g.simulacao.Reiniciar()
+	}
+	g.simulacaoAcumulado = 0
+	g.intertravamento = malha.Intertravamento{}
+	g.rotaOrigemID, g.mensagemRota = 0, ""
+	g.medicaoPontos, g.trajeto, g.mensagemMedicao = nil, nil, ""
+}
+
+// --- Comandos ---
+
+type cmdAdicionar struct{ el malha.Elemento }
+
+func (c *cmdAdicionar) Executar(g *Game) {
+	g.elementos = append(g.elementos, c.el)
+	g.indice.Adicionar(g.elementos, len(g.elementos)-1)
+}
+func (c *cmdAdicionar) Desfazer(g *Game) {
+	if i := g.indexOfID(c.el.ID); i != -1 {
+		g.elementos = append(g.elementos[:i], g.elementos[i+1:]...)
+		g.indice.Remover(i)
+	}
+}
+func (c *cmdAdicionar) Descricao() string { return fmt.Sprintf("Adicionar ID %d", c.el.ID) }
+
+type cmdRemover struct {
+	el    malha.Elemento
+	index int
+}
+
+func (c *cmdRemover) Executar(g *Game) {
+	if i := g.indexOfID(c.el.ID); i != -1 {
+		c.index = i
+		g.elementos = append(g.elementos[:i], g.elementos[i+1:]...)
+		g.indice.Remover(i)
+	}
+}
+func (c *cmdRemover) Desfazer(g *Game) {
+	i := c.index
+	if i < 0 || i > len(g.elementos) {
+		i = len(g.elementos)
+	}
+	g.elementos = append(g.elementos[:i], append([]malha.Elemento{c.el}, g.elementos[i:]...)...)
+	g.indice.Adicionar(g.elementos, i)
+}
+func (c *cmdRemover) Descricao() string { return fmt.Sprintf("Apagar ID %d", c.el.ID) }
+
+// cmdAlterar substitui o estado de um elemento (mover, cor, orientação...).
+type cmdAlterar struct {
+	antes, depois malha.Elemento
+	descricao     string
+}
+
+func (c *cmdAlterar) Executar(g *Game) {
+	if i := g.indexOfID(c.depois.ID); i != -1 {
+		g.elementos[i] = c.depois
+		g.indice.Atualizar(g.elementos, i)
+	}
+}
+func (c *cmdAlterar) Desfazer(g *Game) {
+	if i := g.indexOfID(c.antes.ID); i != -1 {
+		g.elementos[i] = c.antes
+		g.indice.Atualizar(g.elementos, i)
+	}
+}
+func (c *cmdAlterar) Descricao() string { return fmt.Sprintf("%s ID %d", c.descricao, c.depois.ID) }
+
+// cmdSubstituirTudo troca a malha inteira (limpar, carregar) e reinicia a sessão.
+type cmdSubstituirTudo struct {
+	antes, depois             []malha.Elemento
+	proxIDAntes, proxIDDepois int
+	descricao                 string
+}
+
+func (c *cmdSubstituirTudo) Executar(g *Game) {
+	g.elementos = append([]malha.Elemento{}, c.depois...)
+	g.indice = malha.NewIndiceEspacial(g.elementos, malha.IndiceCelulaPadrao)
+	g.proximoElementoID = c.proxIDDepois
+	g.reiniciarSessao()
+}
+func (c *cmdSubstituirTudo) Desfazer(g *Game) {
+	g.elementos = append([]malha.Elemento{}, c.antes...)
+	g.indice = malha.NewIndiceEspacial(g.elementos, malha.IndiceCelulaPadrao)
+	g.proximoElementoID = c.proxIDAntes
+	g.reiniciarSessao()
+}
+func (c *cmdSubstituirTudo) Descricao() string { return c.descricao }
+
+// cmdLote agrupa comandos que formam um único passo do histórico.
+type cmdLote struct {
+	comandos  []Comando
+	descricao string
+}
+
+// aplicar executa o comando imediatamente e o inclui no lote (nil é ignorado).
+func (l *cmdLote) aplicar(g *Game, c Comando) {
+	if c == nil {
+		return
+	}
+	c.Executar(g)
+	l.comandos = append(l.comandos, c)
+}
+func (l *cmdLote) Executar(g *Game) {
+	for _, c := range l.comandos {
+		c.Executar(g)
+	}
+}
+func (l *cmdLote) Desfazer(g *Game) {
+	for i := len(l.comandos) - 1; i >= 0; i-- {
+		l.comandos[i].Desfazer(g)
+	}
+}
+func (l *cmdLote) Descricao() string { return l.descricao }
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"v1/malha"
+)
+
+// --- Inspetor de Propriedades ---
+// Painel fixo à direita com os campos do último elemento clicado. Clique num
+// valor para editá-lo: a mudança aparece ao vivo a cada tecla e vira um único
+// passo do histórico ao confirmar (Enter, Tab ou clique fora); Esc cancela.
+// Campos de opções alternam a cada clique.
+
+const (
+	inspetorLargura     = 300
+	inspetorTopo        = 40 // Abaixo da barra de status
+	inspetorLinha       = 18
+	inspetorColunaValor = 140
+)
+
+type campoInspetor struct {
+	rotulo string
+	ler    func(el malha.Elemento) string
+	gravar func(el *malha.Elemento, texto string) error // nil: somente leitura
+	opcoes func(el malha.Elemento) []string             // Campo de opções: alterna a cada clique
+}
+
+// edicaoCampo é o estado do campo em edição; antes é o elemento ao iniciar.
+type edicaoCampo struct {
+	campo int
+	texto string
+	antes malha.Elemento
+	erro  bool
+}
+
+// lerNumero aceita vírgula ou ponto como separador decimal.
+func lerNumero(texto string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(texto), ",", "."), 64)
+	if err == nil && (math.IsNaN(v) || math.IsInf(v, 0)) {
+		err = fmt.Errorf("valor inválido")
+	}
+	return v, err
+}
+
+func formatarNumero(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e4)/1e4, 'f', -1, 64)
+}
+
+// campoNumero liga um campo numérico ao valor apontado por valor, limitado a [minimo, maximo].
+func campoNumero(rotulo string, valor func(*malha.Elemento) *float64, minimo, maximo float64) campoInspetor {
+	return campoInspetor{
+		rotulo: rotulo,
+		ler:    func(el malha.Elemento) string { return formatarNumero(*valor(&el)) },
+		gravar: func(el *malha.Elemento, texto string) error {
+			v, err := lerNumero(texto)
+			if err != nil {
+				return err
+			}
+			if v < minimo || v > maximo {
+				return fmt.Errorf("fora de [%g, %g]", minimo, maximo)
+			}
+			*valor(el) = v
+			return nil
+		},
+	}
+}
+
+func campoSomenteLeitura(rotulo string, ler func(malha.Elemento) string) campoInspetor {
+	return campoInspetor{rotulo: rotulo, ler: ler}
+}
+
+// campoOpcoes liga um campo de opções ao texto apontado por valor; vazio é exibido como a primeira opção.
+func campoOpcoes(rotulo string, valor func(*malha.Elemento) *string, opcoes func(malha.Elemento) []string) campoInspetor {
+	return campoInspetor{
+		rotulo: rotulo,
+		ler: func(el malha.Elemento) string {
+			if v := *valor(&el); v != "" {
+				return v
+			}
+			return opcoes(el)[0]
+		},
+		gravar: func(el *malha.Elemento, texto string) error { *valor(el) = texto; return nil },
+		opcoes: opcoes,
+	}
+}
+
+func opcoesFixas(opcoes ...string) func(malha.Elemento) []string {
+	return func(malha.Elemento) []string { return opcoes }
+}
+
+// camposInspetor devolve os campos exibidos para o tipo do elemento.
+func camposInspetor(tipo malha.ElementType) []campoInspetor {
+	const ilimitado = math.MaxFloat64
+	campos := []campoInspetor{
+		campoSomenteLeitura("ID", func(el malha.Elemento) string { return strconv.Itoa(el.ID) }),
+		campoSomenteLeitura("Tipo", func(el malha.Elemento) string { return malha.NomeTipo(el.Tipo) }),
+		{rotulo: "Nome", ler: func(el malha.Elemento) string { return el.Nome }, gravar: func(el *malha.Elemento, texto string) error { el.Nome = strings.TrimSpace(texto); return nil }},
+	}
+	if tipo == malha.ElementoSinal { // A posição do sinal vem da via e da distância
+		campos = append(campos,
+			campoSomenteLeitura("X (WU)", func(el malha.Elemento) string { return formatarNumero(el.X) }),
+			campoSomenteLeitura("Y (WU)", func(el malha.Elemento) string { return formatarNumero(el.Y) }))
+	} else {
+		campos = append(campos,
+			campoNumero("X (WU)", func(el *malha.Elemento) *float64 { return &el.X }, -ilimitado, ilimitado),
+			campoNumero("Y (WU)", func(el *malha.Elemento) *float64 { return &el.Y }, -ilimitado, ilimitado))
+	}
+	modoCheio := campoInspetor{
+		rotulo: "Modo",
+		ler:    func(el malha.Elemento) string { return map[bool]string{true: "Cheia", false: "Vazada"}[el.ModoCheio] },
+		gravar: func(el *malha.Elemento, texto string) error { el.ModoCheio = texto == "Cheia"; return nil },
+		opcoes: opcoesFixas("Vazada", "Cheia"),
+	}
+	switch tipo {
+	case malha.ElementoViaReta:
+		campos = append(campos,
+			campoNumero("Comprimento (m)", func(el *malha.Elemento) *float64 { return &el.Comprimento }, 0.01, ilimitado),
+			campoNumero("Rotacao (graus)", func(el *malha.Elemento) *float64 { return &el.Rotacao }, -360, 360),
+			campoNumero("Bitola (WU)", func(el *malha.Elemento) *float64 { return &el.Espessura }, 0.1, 1000),
+			modoCheio)
+	case malha.ElementoViaCurva:
+		campos = append(campos,
+			campoNumero("Rumo Inicial (graus)", func(el *malha.Elemento) *float64 { return &el.Rotacao }, -360, 360),
+			campoNumero("Raio (m)", func(el *malha.Elemento) *float64 { return &el.Raio }, 0.01, ilimitado),
+			campoInspetor{
+				rotulo: "Varredura (graus)",
+				ler:    func(el malha.Elemento) string { return formatarNumero(el.Varredura) },
+				gravar: func(el *malha.Elemento, texto string) error {
+					v, err := lerNumero(texto)
+					if err == nil && (math.Abs(v) < malha.CurvaVarreduraMinima || math.Abs(v) > malha.CurvaVarreduraMaxima) {
+						err = fmt.Errorf("|varredura| fora de [%g, %g]", malha.CurvaVarreduraMinima, malha.CurvaVarreduraMaxima)
+					}
+					if err != nil {
+						return err
+					}
+					el.Varredura = v
+					return nil
+				},
+			},
+			campoSomenteLeitura("Comprimento (m)", func(el malha.Elemento) string { return formatarNumero(el.Comprimento) }),
+			campoNumero("Bitola (WU)", func(el *malha.Elemento) *float64 { return &el.Espessura }, 0.1, 1000),
+			modoCheio)
+	case malha.ElementoViaTransicao:
+		campos = append(campos,
+			campoNumero("Rumo Inicial (graus)", func(el *malha.Elemento) *float64 { return &el.Rotacao }, -360, 360),
+			campoNumero("Comprimento (m)", func(el *malha.Elemento) *float64 { return &el.Comprimento }, 0.01, ilimitado),
+			campoNumero("Raio Inicial (m)", func(el *malha.Elemento) *float64 { return &el.RaioInicial }, 0, ilimitado),
+			campoNumero("Raio Final (m)", func(el *malha.Elemento) *float64 { return &el.Raio }, 0, ilimitado),
+			campoInspetor{
+				rotulo: "Lado",
+				ler: func(el malha.Elemento) string {
+					return map[bool]string{true: "Esquerda", false: "Direita"}[math.Signbit(el.Varredura)]
+				},
+				gravar: func(el *malha.Elemento, texto string) error {
+					el.Varredura = math.Copysign(el.Varredura, map[bool]float64{true: -1, false: 1}[texto == "Esquerda"])
+					return nil
+				},
+				opcoes: opcoesFixas("Direita", "Esquerda"),
+			},
+			campoSomenteLeitura("Varredura (graus)", func(el malha.Elemento) string { return formatarNumero(el.Varredura) }),
+			campoNumero("Bitola (WU)", func(el *malha.Elemento) *float64 { return &el.Espessura }, 0.1, 1000),
+			modoCheio)
+	case malha.ElementoCircuitoVia:
+		campos = append(campos,
+			campoNumero("Largura (WU)", func(el *malha.Elemento) *float64 { return &el.Largura }, 0.1, 1000),
+			campoNumero("Traco (WU)", func(el *malha.Elemento) *float64 { return &el.Espessura }, 0.1, 1000),
+			campoOpcoes("Orientacao", func(el *malha.Elemento) *string { return &el.OrientacaoTC }, opcoesFixas("Normal", "Invertido")))
+	case malha.ElementoChaveSimples:
+		campos = append(campos,
+			campoNumero("Rotacao (graus)", func(el *malha.Elemento) *float64 { return &el.Rotacao }, -360, 360),
+			campoNumero("Comprimento (m)", func(el *malha.Elemento) *float64 { return &el.Comprimento }, 0.01, ilimitado),
+			campoNumero("Desvio (graus)", func(el *malha.Elemento) *float64 { return &el.AnguloDesvio }, -89, 89),
+			campoNumero("Bitola (WU)", func(el *malha.Elemento) *float64 { return &el.Largura }, 0.1, 1000),
+			campoNumero("Raio Ponta (WU)", func(el *malha.Elemento) *float64 { return &el.Espessura }, 0.1, 1000),
+			campoOpcoes("Posicao", func(el *malha.Elemento) *string { return &el.PosicaoChave }, opcoesFixas(malha.PosicaoNormal, malha.PosicaoReversa)))
+	case malha.ElementoSinal:
+		campos = append(campos,
+			campoSomenteLeitura("Via ID", func(el malha.Elemento) string { return strconv.Itoa(el.ViaID) }),
+			campoNumero("Distancia (m)", func(el *malha.Elemento) *float64 { return &el.Distancia }, 0, ilimitado),
+			campoInspetor{
+				rotulo: "Sentido",
+				ler:    func(el malha.Elemento) string { return el.Sentido },
+				gravar: func(el *malha.Elemento, texto string) error {
+					if texto != el.Sentido {
+						el.Rotacao = math.Mod(el.Rotacao+180, 360)
+					}
+					el.Sentido = texto
+					return nil
+				},
+				opcoes: opcoesFixas(malha.SentidoCrescente, malha.SentidoDecrescente),
+			},
+			campoOpcoes("Tipo Sinal", func(el *malha.Elemento) *string { return &el.TipoSinal }, func(malha.Elemento) []string { return malha.TiposSinal }),
+			campoOpcoes("Aspecto", func(el *malha.Elemento) *string { return &el.Aspecto }, func(el malha.Elemento) []string { return malha.AspectosPermitidos(el.TipoSinalAtual()) }),
+			campoNumero("Raio Lampada (WU)", func(el *malha.Elemento) *float64 { return &el.Espessura }, 0.1, 100))
+	}
+	if tipo != malha.ElementoSinal {
+		campos = append(campos, campoInspetor{
+			rotulo: "Estado",
+			ler:    func(el malha.Elemento) string { return el.EstadoNormalizado() },
+			gravar: func(el *malha.Elemento, texto string) error { el.Estado = texto; return nil },
+			opcoes: opcoesFixas(malha.EstadoLivre, malha.EstadoOcupado, malha.EstadoFalha),
+		})
+	}
+	return append(campos,
+		campoInspetor{
+			rotulo: "Cor (#RRGGBB)",
+			ler:    func(el malha.Elemento) string { return fmt.Sprintf("#%02X%02X%02X", el.Cor.R, el.Cor.G, el.Cor.B) },
+			gravar: func(el *malha.Elemento, texto string) error {
+				var r, gr, b uint8
+				if n, _ := fmt.Sscanf(strings.TrimSpace(texto), "#%02x%02x%02x", &r, &gr, &b); n != 3 {
+					return fmt.Errorf("use #RRGGBB")
+				}
+				el.Cor = color.RGBA{R: r, G: gr, B: b, A: el.Cor.A}
+				return nil
+			},
+		},
+		campoSomenteLeitura("Conexoes", func(el malha.Elemento) string { return fmt.Sprint(el.Conexoes) }))
+}
+
+// normalizarElemento recalcula os valores derivados após uma edição.
+func (g *Game) normalizarElemento(el *malha.Elemento) {
+	switch el.Tipo {
+	case malha.ElementoViaCurva:
+		el.Comprimento = malha.ComprimentoArco(el.Raio, el.Varredura)
+	case malha.ElementoViaTransicao: // Varredura só guarda o lado
+		el.Varredura = math.Copysign(malha.VarreduraTransicao(el.Comprimento, el.RaioInicial, el.Raio), el.Varredura)
+	case malha.ElementoSinal:
+		if permitidos := malha.AspectosPermitidos(el.TipoSinalAtual()); !slices.Contains(permitidos, el.Aspecto) {
+			el.Aspecto = permitidos[0]
+		}
+		if i := g.indexOfID(el.ViaID); el.ViaID != 0 && i != -1 {
+			el.Distancia = math.Min(el.Distancia, g.elementos[i].Comprimento)
+			malha.ReposicionarSinal(g.elementos[i], el)
+		}
+	}
+}
+
+// indiceInspecionado devolve o índice do elemento no inspetor, ou -1.
+func (g *Game) indiceInspecionado() int {
+	if g.inspecionadoID == 0 {
+		return -1
+	}
+	return g.indexOfID(g.inspecionadoID)
+}
+
+// confirmarInspetor registra a alteração feita pelo inspetor como um passo do histórico.
+func (g *Game) confirmarInspetor(antes, depois malha.Elemento, rotulo string) {
+	if reflect.DeepEqual(antes, depois) {
+		return
+	}
+	lote := &cmdLote{descricao: fmt.Sprintf("%s ID %d", rotulo, depois.ID)}
+	if depois.Tipo.EhVia() {
+		g.registrarAlteracao(lote, antes, depois, rotulo) // Sinais presos acompanham a via
+	} else {
+		lote.aplicar(g, &cmdAlterar{antes: antes, depois: depois, descricao: rotulo})
+	}
+	g.registrar(lote)
+	logf("Inspetor: %s ID %d", rotulo, depois.ID)
+}
+
+func (g *Game) iniciarEdicao(campo int) {
+	i := g.indiceInspecionado()
+	if i == -1 {
+		return
+	}
+	el := g.elementos[i]
+	if g.travadoPorRota(el.ID) {
+		return
+	}
+	g.edicao = &edicaoCampo{campo: campo, texto: camposInspetor(el.Tipo)[campo].ler(el), antes: el}
+}
+
+// editarProximo inicia a edição do próximo campo de texto a partir de inicio (Tab).
+func (g *Game) editarProximo(inicio int) {
+	i := g.indiceInspecionado()
+	if i == -1 {
+		return
+	}
+	campos := camposInspetor(g.elementos[i].Tipo)
+	for k := range campos {
+		c := (inicio + k) % len(campos)
+		if campos[c].gravar != nil && campos[c].opcoes == nil {
+			g.iniciarEdicao(c)
+			return
+		}
+	}
+}
+
+// aplicarEdicaoAoVivo grava o texto em edição no elemento, sem histórico, se for válido.
+func (g *Game) aplicarEdicaoAoVivo() {
+	i := g.indexOfID(g.edicao.antes.ID)
+	if i == -1 {
+		g.edicao = nil
+		return
+	}
+	el := g.edicao.antes
+	if err := camposInspetor(el.Tipo)[g.edicao.campo].gravar(&el, g.edicao.texto); err != nil {
+		g.edicao.erro = true
+		return
+	}
+	g.edicao.erro = false
+	g.normalizarElemento(&el)
+	g.elementos[i] = el
+	g.indice.Atualizar(g.elementos, i)
+	g.rebuildTopology()
+}
+
+// concluirEdicao registra o último valor válido digitado.
+func (g *Game) concluirEdicao() {
+	e := g.edicao
+	g.edicao = nil
+	if i := g.indexOfID(e.antes.ID); i != -1 {
+		g.confirmarInspetor(e.antes, g.elementos[i], camposInspetor(e.antes.Tipo)[e.campo].rotulo)
+	}
+}
+
+func (g *Game) cancelarEdicao() {
+	e := g.edicao
+	g.edicao = nil
+	if i := g.indexOfID(e.antes.ID); i != -1 {
+		g.elementos[i] = e.antes
+		g.indice.Atualizar(g.elementos, i)
+		g.rebuildTopology()
+	}
+}
+
+// atualizarEdicao trata teclado e mouse enquanto um campo está em edição.
+func (g *Game) atualizarEdicao() {
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		g.cancelarEdicao()
+		return
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadEnter):
+		g.concluirEdicao()
+		return
+	case inpututil.IsKeyJustPressed(ebiten.KeyTab):
+		proximo := g.edicao.campo + 1
+		g.concluirEdicao()
+		g.editarProximo(proximo)
+		return
+	case inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft):
+		g.concluirEdicao()
+		g.cliqueInspetor()
+		return
+	}
+	mudou := false
+	if d := inpututil.KeyPressDuration(ebiten.KeyBackspace); (d == 1 || (d > 30 && d%3 == 0)) && g.edicao.texto != "" {
+		_, tam := utf8.DecodeLastRuneInString(g.edicao.texto)
+		g.edicao.texto = g.edicao.texto[:len(g.edicao.texto)-tam]
+		mudou = true
+	}
+	if digitado := ebiten.AppendInputChars(nil); len(digitado) > 0 {
+		g.edicao.texto += string(digitado)
+		mudou = true
+	}
+	if mudou {
+		g.aplicarEdicaoAoVivo()
+	}
+}
+
+// cliqueInspetor trata um clique no painel; devolve true se o clique foi nele.
+func (g *Game) cliqueInspetor() bool {
+	i := g.indiceInspecionado()
+	if i == -1 || !inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		return false
+	}
+	cursorX, cursorY := ebiten.CursorPosition()
+	el := g.elementos[i]
+	campos := camposInspetor(el.Tipo)
+	painelX := g.screenWidth - inspetorLargura
+	if cursorX < painelX || cursorY < inspetorTopo || cursorY > inspetorTopo+24+len(campos)*inspetorLinha+8 {
+		return false
+	}
+	if c := (cursorY - inspetorTopo - 24) / inspetorLinha; cursorY >= inspetorTopo+24 && c < len(campos) && cursorX >= painelX+inspetorColunaValor {
+		switch campo := campos[c]; {
+		case campo.opcoes != nil:
+			if g.travadoPorRota(el.ID) {
+				break
+			}
+			opcoes := campo.opcoes(el)
+			atual, proxima := campo.ler(el), opcoes[0]
+			for k, o := range opcoes {
+				if o == atual {
+					proxima = opcoes[(k+1)%len(opcoes)]
+				}
+			}
+			depois := el
+			campo.gravar(&depois, proxima)
+			g.normalizarElemento(&depois)
+			g.confirmarInspetor(el, depois, campo.rotulo)
+		case campo.gravar != nil:
+			g.iniciarEdicao(c)
+		}
+	}
+	return true
+}
+
+// drawInspetor desenha o painel com os campos do elemento inspecionado.
+func (g *Game) drawInspetor(screen *ebiten.Image) {
+	i := g.indiceInspecionado()
+	if i == -1 {
+		return
+	}
+	el := g.elementos[i]
+	campos := camposInspetor(el.Tipo)
+	x := g.screenWidth - inspetorLargura
+	altura := 24 + len(campos)*inspetorLinha + 8
+	vector.DrawFilledRect(screen, float32(x), inspetorTopo, inspetorLargura, float32(altura), color.RGBA{R: 30, G: 30, B: 30, A: 220}, false)
+	vector.StrokeRect(screen, float32(x), inspetorTopo, inspetorLargura, float32(altura), 1, color.RGBA{R: 90, G: 90, B: 90, A: 255}, false)
+	text.Draw(screen, fmt.Sprintf("Inspetor: %s ID %d", malha.NomeTipo(el.Tipo), el.ID), g.helpTextFace, x+8, inspetorTopo+16, color.White)
+	cinza := color.RGBA{R: 150, G: 150, B: 150, A: 255}
+	for c, campo := range campos {
+		y := inspetorTopo + 24 + c*inspetorLinha
+		text.Draw(screen, campo.rotulo, g.helpTextFace, x+8, y+13, cinza)
+		caixaX, caixaL := float32(x+inspetorColunaValor), float32(inspetorLargura-inspetorColunaValor-8)
+		valor, corValor := campo.ler(el), color.Color(color.White)
+		switch {
+		case g.edicao != nil && g.edicao.antes.ID == el.ID && g.edicao.campo == c:
+			vector.DrawFilledRect(screen, caixaX, float32(y+1), caixaL, inspetorLinha-2, color.RGBA{R: 10, G: 10, B: 10, A: 255}, false)
+			vector.StrokeRect(screen, caixaX, float32(y+1), caixaL, inspetorLinha-2, 1, corSelecao, false)
+			valor = g.edicao.texto + "_"
+			if g.edicao.erro {
+				corValor = color.RGBA{R: 255, G: 80, B: 80, A: 255}
+			}
+		case campo.opcoes != nil:
+			valor = "[" + valor + "]"
+		case campo.gravar != nil:
+			vector.StrokeRect(screen, caixaX, float32(y+1), caixaL, inspetorLinha-2, 1, color.RGBA{R: 70, G: 70, B: 70, A: 255}, false)
+		default:
+			corValor = cinza
+		}
+		text.Draw(screen, valor, g.helpTextFace, x+inspetorColunaValor+4, y+13, corValor)
+	}
+}
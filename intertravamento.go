@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"v1/malha"
+)
+
+// --- Rotas (Intertravamento) ---
+// R liga/desliga o modo rota. Nele, o primeiro clique escolhe a origem (sinal
+// ou via) e o segundo o destino (sinal ou via); a rota é verificada, as chaves
+// são movidas num único passo do histórico e o percurso fica travado (verde).
+// Clicar na origem de uma rota estabelecida a cancela, se o trem ainda não
+// entrou nela. Elementos travados recusam qualquer edição. A ocupação vem do estado das seções e dos trens do modo
+// simulação; a liberação por seção roda a cada quadro.
+
+var corRotaTravada = color.RGBA{R: 0, G: 220, B: 90, A: 255}
+
+// elementosComTrem devolve os IDs das vias e chaves sob trens (modo simulação).
+func (g *Game) elementosComTrem() map[int]bool {
+	if !g.modoSimulacao || g.simulacao == nil {
+		return map[int]bool{}
+	}
+	return g.simulacao.ElementosOcupados()
+}
+
+// travadoPorRota avisa e devolve true se algum dos elementos está travado por
+// uma rota estabelecida: até a rota ser cancelada ou liberada eles não podem
+// ser movidos, apagados, divididos nem editados.
+func (g *Game) travadoPorRota(ids ...int) bool {
+	travados := g.intertravamento.Travados()
+	for _, id := range ids {
+		if nome, ok := travados[id]; ok {
+			g.avisoRota(fmt.Sprintf("ID %d travado pela rota %s: cancele a rota ou aguarde a liberação", id, nome))
+			return true
+		}
+	}
+	return false
+}
+
+// atualizarIntertravamento libera as seções já percorridas pelos trens.
+func (g *Game) atualizarIntertravamento() {
+	if len(g.intertravamento.Rotas) == 0 {
+		return
+	}
+	for _, nome := range g.intertravamento.Liberar(g.secoes, g.elementosComTrem()) {
+		logf("Rota %s liberada", nome)
+	}
+}
+
+// alternarModoRota entra ou sai do modo rota.
+func (g *Game) alternarModoRota() {
+	g.modoRota = !g.modoRota
+	if g.modoRota && g.modoMedicao {
+		g.alternarModoMedicao()
+	}
+	g.rotaOrigemID = 0
+	g.drawingVia, g.selecionandoRet = false, false
+	logf("Modo Rota: %s", map[bool]string{true: "Ligado", false: "Desligado"}[g.modoRota])
+}
+
+// cliqueRota escolhe a origem ou o destino de uma rota.
+func (g *Game) cliqueRota(worldX, worldY float64) {
+	idx := g.findClosestElement(worldX, worldY)
+	if idx == -1 {
+		g.rotaOrigemID = 0
+		return
+	}
+	el := g.elementos[idx]
+	if el.Tipo != malha.ElementoSinal && !el.Tipo.EhVia() {
+		g.avisoRota("Origem e destino devem ser sinais ou vias")
+		return
+	}
+	if g.rotaOrigemID == 0 {
+		if i := g.intertravamento.RotaDaOrigem(el.ID); i != -1 {
+			nome := g.intertravamento.Rotas[i].Nome
+			if err := g.intertravamento.Cancelar(i); err != nil {
+				g.avisoRota(err.Error())
+			} else {
+				g.avisoRota("Rota " + nome + " cancelada")
+			}
+			return
+		}
+		g.rotaOrigemID = el.ID
+		g.avisoRota("")
+		return
+	}
+	origemID := g.rotaOrigemID
+	g.rotaOrigemID = 0
+	g.estabelecerRota(origemID, el.ID)
+}
+
+// estabelecerRota calcula e verifica a rota, move as chaves e a trava.
+func (g *Game) estabelecerRota(origemID, destinoID int) {
+	rota, err := malha.CalcularRota(g.elementos, g.topologia, origemID, destinoID)
+	if err == nil {
+		err = g.intertravamento.Verificar(rota, g.secoes, g.elementosComTrem())
+	}
+	if err != nil {
+		g.avisoRota(err.Error())
+		return
+	}
+	lote := &cmdLote{descricao: "Rota " + rota.Nome}
+	for _, c := range rota.Chaves {
+		if i := g.indexOfID(c.ChaveID); i != -1 && g.elementos[i].PosicaoAtual() != c.Posicao {
+			depois := g.elementos[i]
+			depois.PosicaoChave = c.Posicao
+			lote.comandos = append(lote.comandos, &cmdAlterar{antes: g.elementos[i], depois: depois, descricao: "Posição"})
+		}
+	}
+	if len(lote.comandos) > 0 {
+		g.executar(lote)
+	}
+	g.intertravamento.Travar(rota, g.secoes)
+	g.avisoRota(fmt.Sprintf("Rota %s estabelecida (%.0f m, %d chave(s) movida(s))", rota.Nome, rota.Comprimento, len(lote.comandos)))
+}
+
+// avisoRota mostra a mensagem na barra do modo rota e no log.
+func (g *Game) avisoRota(mensagem string) {
+	g.mensagemRota = mensagem
+	if mensagem != "" {
+		logln(mensagem)
+	}
+}
+
+// comAspectoDeRota devolve o sinal com o aspecto imposto pelo intertravamento, se houver.
+func (g *Game) comAspectoDeRota(el malha.Elemento) malha.Elemento {
+	if aspecto, ok := g.intertravamento.AspectoRota(el); ok {
+		el.Aspecto = aspecto
+	}
+	return el
+}
+
+// drawRotas desenha a barra do modo rota com as rotas estabelecidas.
+func (g *Game) drawRotas(screen *ebiten.Image) {
+	if !g.modoRota {
+		return
+	}
+	etapa := "Clique na origem (sinal ou via)"
+	if i := g.indexOfID(g.rotaOrigemID); i != -1 {
+		etapa = fmt.Sprintf("Origem %s: clique no destino", g.elementos[i].Rotulo())
+		x, y := g.worldToScreen(g.elementos[i].X, g.elementos[i].Y)
+		vector.StrokeCircle(screen, x, y, 12, 2, corRotaTravada, true)
+	}
+	rotas := []string{}
+	for _, r := range g.intertravamento.Rotas {
+		rotas = append(rotas, fmt.Sprintf("%s (%d/%d)", r.Nome, r.Liberados, len(r.Grupos)))
+	}
+	barra := fmt.Sprintf("ROTA[R] | %s | Rotas: %s", etapa, strings.Join(rotas, ", "))
+	if len(rotas) == 0 {
+		barra += "nenhuma"
+	}
+	y := g.screenHeight - 42
+	if g.modoSimulacao {
+		y -= 24 // Acima da barra da simulação
+	}
+	vector.DrawFilledRect(screen, 0, float32(y), float32(g.screenWidth), 42, color.RGBA{R: 30, G: 30, B: 30, A: 220}, false)
+	text.Draw(screen, barra, g.helpTextFace, 8, y+16, corRotaTravada)
+	text.Draw(screen, g.mensagemRota, g.helpTextFace, 8, y+34, color.White)
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"image"
 	"image/color"
@@ -9,6 +8,7 @@ import (
 	"log"
 	"math"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -21,6 +21,8 @@ import (
 	"github.com/hajimehoshi/ebiten/v2/text" // text.Draw agora precisa de text.Face
 	"github.com/hajimehoshi/ebiten/v2/vector"
 	"github.com/sqweek/dialog"
+
+	"v1/malha"
 	// Removido import de golang.org/x/image/font/basicfont diretamente, pois text.Face espera um font.Face
 )
 
@@ -29,14 +31,13 @@ var fileLogger *log.Logger
 
 // --- Constantes Globais ---
 const (
-	pixelsPerMeter       = 0.01
 	cameraScrollSpeed    = 5.0
 	popupWidth           = 150
 	popupOptionHeight    = 20
 	popupPadding         = 5
 	popupColorSquareSize = 16
 	hitThreshold         = 8.0
-	railStrokeWidth      = 1.0
+	railStrokeWidth      = malha.TracoTrilho
 	tooltipPadding       = 4
 	minZoom              = 0.1
 	maxZoom              = 10.0
@@ -44,31 +45,6 @@ const (
 	helpLineSpacingFactor = 1.5 // Fator para aumentar o espaçamento entre linhas
 )
 
-// --- Tipos de Elementos ---
-type ElementType int
-
-const (
-	ElementoViaReta ElementType = iota
-	ElementoCircuitoVia
-	ElementoChaveSimples
-)
-
-// --- Estrutura Elemento ---
-type Elemento struct {
-	Tipo         ElementType `json:"tipo"`
-	ID           int         `json:"id"`
-	X            float64     `json:"x"`
-	Y            float64     `json:"y"`
-	Comprimento  float64     `json:"comprimento"`
-	Largura      float64     `json:"largura"`
-	Rotacao      float64     `json:"rotacao"`
-	Cor          color.RGBA  `json:"cor"`
-	Espessura    float64     `json:"espessura"`
-	ModoCheio    bool        `json:"modoCheio,omitempty"`
-	Estado       string      `json:"estado,omitempty"`
-	OrientacaoTC string      `json:"orientacaoTC,omitempty"`
-}
-
 // --- Estrutura PopupOption ---
 type PopupOption struct {
 	Label  string
@@ -79,9 +55,9 @@ type PopupOption struct {
 
 // --- Estrutura Game ---
 type Game struct {
-	elementos           []Elemento
+	elementos           []malha.Elemento
 	proximoElementoID   int
-	elementoAtualTipo   ElementType
+	elementoAtualTipo   malha.ElementType
 	startX, startY      float64
 	drawingVia          bool
 	currentColor        color.RGBA
@@ -101,6 +77,49 @@ type Game struct {
 	hoveredElementIndex, selectedElementIndex, movingElementIndex int
 	movingElementOffsetX, movingElementOffsetY float64
 	helpTextFace        font.Face // Face para o texto de ajuda
+	topologia           *malha.Topologia
+	secoes              *malha.Secoes
+	snapAtual, snapInicio malha.AlvoSnap
+	snapAtivo, snapInicioAtivo bool
+	rumoInicioCurva     float64 // Rumo (graus) da tangente inicial da curva em desenho
+	curvaturaInicio     float64 // Curvatura (1/m, com sinal) no início da transição em desenho
+	indice              *malha.IndiceEspacial // Por índice em g.elementos; refeito a cada mutação
+	visiveis            int                   // Elementos desenhados no último frame
+	selecao             map[int]bool          // IDs selecionados (seleção múltipla)
+	selecionandoRet     bool
+	retInicioX, retInicioY float64
+	grupoAntes          []malha.Elemento // Estado dos demais selecionados ao mover um grupo
+	inspecionadoID      int          // Elemento exibido no inspetor (0: nenhum)
+	edicao              *edicaoCampo // Campo do inspetor em edição
+	gradeVisivel        bool
+	snapGrade           bool // Snap na grade e de ângulo (com a grade visível)
+	modificado          bool      // Há alterações não salvas
+	autosavePendente    bool      // Há alterações desde a última gravação da recuperação
+	ultimoAutosave      time.Time
+	historico           Historico
+	movimentoAntes      malha.Elemento // Estado do elemento no início do arrasto (um passo no histórico)
+	autor               string    // Gravado no documento ao salvar
+	criado              time.Time // Data de criação do documento carregado/salvo
+	problemas           []malha.Problema // Resultado da última validação
+	problemasPendentes  bool             // A malha mudou desde a última validação
+	painelProblemas     bool             // Painel e marcadores de problemas visíveis
+	problemaFoco        int              // Problema clicado no painel (-1: nenhum)
+	simulacao           *malha.Simulacao // Criada ao entrar no modo simulação
+	modoSimulacao       bool
+	simulacaoRodando    bool
+	simulacaoVelocidade float64   // Multiplicador do tempo real
+	simulacaoAcumulado  float64   // Segundos simulados ainda não consumidos em passos
+	ultimoQuadro        time.Time // Instante do quadro anterior
+	modeloTrem          int       // Índice em malha.ModelosTrem do próximo trem
+	intertravamento     malha.Intertravamento // Rotas estabelecidas (não salvas)
+	modoRota            bool
+	rotaOrigemID        int    // Origem escolhida no modo rota (0: nenhuma)
+	mensagemRota        string // Resultado do último comando de rota
+	modoMedicao         bool
+	medicaoRespeitar    bool           // Medição só pelos ramos posicionados das chaves
+	medicaoPontos       []malha.Ponto  // Pontos marcados no modo medição (0 a 2)
+	trajeto             *malha.Trajeto // Último trajeto medido (nil: nenhum)
+	mensagemMedicao     string
 }
 
 // --- Funções de Inicialização e Logger ---
@@ -111,7 +130,7 @@ func NewGame() *Game {
 	} else {
 		monitorWidth, monitorHeight = int(float64(monitorWidth)*0.9), int(float64(monitorHeight)*0.9)
 	}
-	fmt.Printf("Tamanho: %dx%d | Escala Base: 1 pixel (world unit) = %.0f metros (zoom 1.0x)\n", monitorWidth, monitorHeight, 1.0/pixelsPerMeter)
+	fmt.Printf("Tamanho: %dx%d | Escala Base: 1 pixel (world unit) = %.0f metros (zoom 1.0x)\n", monitorWidth, monitorHeight, 1.0/malha.PixelsPerMeter)
 	logFile, err := os.OpenFile("game.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_TRUNC, 0660)
 	var logOutput io.Writer
 	if err == nil {
@@ -147,16 +166,19 @@ func NewGame() *Game {
 	// A forma mais simples é iterar pelas linhas do helpText.
 
 	return &Game{
-		elementos:         []Elemento{}, proximoElementoID: 1, elementoAtualTipo: ElementoViaReta,
+		elementos:         []malha.Elemento{}, topologia: malha.BuildTopologia(nil), secoes: malha.BuildSecoes(nil, malha.BuildTopologia(nil)), indice: malha.NewIndiceEspacial(nil, malha.IndiceCelulaPadrao), selecao: map[int]bool{}, proximoElementoID: 1, elementoAtualTipo: malha.ElementoViaReta,
 		currentColor:      palette[ebiten.Key1], thickness: 8.0,
 		screenWidth:       monitorWidth, screenHeight: monitorHeight, whitePixel: whiteImg,
 		colorPalette:      palette, colorNames: names,
 		cameraOffsetX:     0.0, cameraOffsetY: 0.0, cameraZoom: 1.0,
-		backgroundColor:   color.RGBA{R: 0, G: 0, B: 0, A: 255}, showHelp: false, viaCheiaDefault: false,
-		popupVisible:      false, selectedElementIndex: -1, hoveredElementIndex: -1, movingElementIndex: -1,
+		backgroundColor:   color.RGBA{R: 0, G: 0, B: 0, A: 255}, showHelp: false, viaCheiaDefault: false, snapGrade: true,
+		popupVisible:      false, selectedElementIndex: -1, hoveredElementIndex: -1, movingElementIndex: -1, problemaFoco: -1, simulacaoVelocidade: 1,
 		helpTextFace:      basicfont.Face7x13, // Usaremos a face padrão, mas controlaremos o espaçamento
+		historico:         Historico{Limite: historicoProfundidadePadrao},
+		autor:             autorPadrao(),
 	}
 }
+func autorPadrao() string { if u := os.Getenv("USER"); u != "" { return u }; return os.Getenv("USERNAME") }
 func logf(format string, v ...interface{}) { if fileLogger != nil { now := time.Now(); dateStr := now.Format("01/02/2006"); fileLogger.Output(2, fmt.Sprintf(dateStr+" "+format, v...)) } }
 func logln(v ...interface{}) { if fileLogger != nil { now := time.Now(); dateStr := now.Format("01/02/2006"); fileLogger.Output(2, dateStr+" "+strings.TrimRight(fmt.Sprintln(v...), "\n")) } }
 
@@ -169,68 +191,408 @@ func (g *Game) worldToScreen(worldX, worldY float64) (float32, float32) {
 	rwX := worldX - g.cameraOffsetX; rwY := worldY - g.cameraOffsetY
 	return float32(rwX*g.cameraZoom + float64(g.screenWidth)/2.0), float32(rwY*g.cameraZoom + float64(g.screenHeight)/2.0)
 }
-func calculateLengthMeters(x1,y1,x2,y2 float64) float64 {
-	dx:=x2-x1; dy:=y2-y1
-	worldUnitsLen:=math.Sqrt(dx*dx+dy*dy)
-	if pixelsPerMeter<=0 {return worldUnitsLen}
-	return worldUnitsLen / pixelsPerMeter
-}
-
 // --- Salvar/Carregar Elementos ---
-func (g *Game) saveElements() error { savePath, err := dialog.File().Filter("JSON Malha", "json").Title("Salvar Malha").Save(); if err != nil { if err == dialog.ErrCancelled { logln("Salvar cancelado."); return nil }; logf("ERRO diálogo salvar: %v", err); return err }; if len(savePath) == 0 { logln("Salvar cancelado (caminho vazio)."); return nil }; if !strings.HasSuffix(strings.ToLower(savePath), ".json") { savePath += ".json" }; file, err := os.Create(savePath); if err != nil { logf("ERRO criar '%s': %v", savePath, err); return err }; defer file.Close(); encoder := json.NewEncoder(file); encoder.SetIndent("", "  "); if err = encoder.Encode(g.elementos); err != nil { logf("ERRO codificar Elementos JSON '%s': %v", savePath, err); return err }; logf("Salvo: '%s' (%d elementos)", savePath, len(g.elementos)); return nil }
-func (g *Game) loadElements() error { loadPath, err := dialog.File().Filter("JSON Malha", "json").Title("Carregar Malha").Load(); if err != nil { if err == dialog.ErrCancelled { logln("Carregar cancelado."); return nil }; logf("ERRO diálogo carregar: %v", err); return err }; if len(loadPath) == 0 { logln("Carregar cancelado (caminho vazio)."); return nil }; file, err := os.Open(loadPath); if err != nil { logf("ERRO abrir '%s': %v", loadPath, err); return err }; defer file.Close(); var loadedElements []Elemento; decoder := json.NewDecoder(file); if err = decoder.Decode(&loadedElements); err != nil { logf("ERRO decodificar Elementos JSON '%s': %v", loadPath, err); return err }; logf("Decodificação JSON OK. %d elementos lidos.", len(loadedElements)); g.elementos = loadedElements; g.proximoElementoID = 0; for _, el := range g.elementos { if el.ID >= g.proximoElementoID { g.proximoElementoID = el.ID + 1 } }; if g.proximoElementoID == 0 { g.proximoElementoID = 1 }; g.cameraOffsetX = 0; g.cameraOffsetY = 0; g.cameraZoom = 1.0; g.popupVisible = false; g.selectedElementIndex = -1; g.movingElementIndex = -1; g.hoveredElementIndex = -1; logf("Malha carregada, ID=%d, câmera resetada: '%s'", g.proximoElementoID, loadPath); return nil }
+func (g *Game) saveElements() error { savePath, err := dialog.File().Filter("JSON Malha", "json").Title("Salvar Malha").Save(); if err != nil { if err == dialog.ErrCancelled { logln("Salvar cancelado."); return nil }; logf("ERRO diálogo salvar: %v", err); return err }; if len(savePath) == 0 { logln("Salvar cancelado (caminho vazio)."); return nil }; if !strings.HasSuffix(strings.ToLower(savePath), ".json") { savePath += ".json" }; doc := malha.NewDocumento(g.elementos); doc.Camera = malha.Camera{X: g.cameraOffsetX, Y: g.cameraOffsetY, Zoom: g.cameraZoom}; doc.CorFundo = g.backgroundColor; doc.Autor = g.autor; if !g.criado.IsZero() { doc.Criado = g.criado }; if err = malha.SaveDocumentoFile(savePath, doc); err != nil { logf("ERRO salvar '%s': %v", savePath, err); return err }; g.criado = doc.Criado; g.marcarSalvo(); logf("Salvo: '%s' (v%d, %d elementos)", savePath, doc.Versao, len(g.elementos)); return nil }
+func (g *Game) abrirDocumento(doc *malha.Documento, descricao string) { g.executar(&cmdSubstituirTudo{antes: g.elementos, depois: doc.Elementos, proxIDAntes: g.proximoElementoID, proxIDDepois: malha.NextID(doc.Elementos), descricao: descricao}); g.cameraOffsetX = doc.Camera.X; g.cameraOffsetY = doc.Camera.Y; g.cameraZoom = math.Max(minZoom, math.Min(doc.Camera.Zoom, maxZoom)); g.backgroundColor = doc.CorFundo; g.criado = doc.Criado }
+func (g *Game) loadElements() error { loadPath, err := dialog.File().Filter("JSON Malha", "json").Title("Carregar Malha").Load(); if err != nil { if err == dialog.ErrCancelled { logln("Carregar cancelado."); return nil }; logf("ERRO diálogo carregar: %v", err); return err }; if len(loadPath) == 0 { logln("Carregar cancelado (caminho vazio)."); return nil }; doc, err := malha.LoadDocumentoFile(loadPath); if err != nil { logf("ERRO carregar '%s': %v", loadPath, err); return err }; logf("Decodificação JSON OK. %d elementos lidos (autor '%s', modificado %s).", len(doc.Elementos), doc.Autor, doc.Modificado.Format(time.RFC3339)); g.abrirDocumento(doc, "Carregar "+loadPath); g.marcarSalvo(); logf("Malha carregada, ID=%d, câmera (%.0f,%.0f Z:%.2f): '%s'", g.proximoElementoID, g.cameraOffsetX, g.cameraOffsetY, g.cameraZoom, loadPath); return nil }
 
 // --- Hit Testing ---
-func pointSegmentDistance(px,py,ax,ay,bx,by float64) float64 { dx, dy := bx-ax, by-ay; lengthSq := dx*dx + dy*dy; if lengthSq == 0 { return math.Sqrt(math.Pow(px-ax, 2) + math.Pow(py-ay, 2)) }; t := ((px-ax)*dx + (py-ay)*dy) / lengthSq; t = math.Max(0, math.Min(1, t)); closestX := ax + t*dx; closestY := ay + t*dy; return math.Sqrt(math.Pow(px-closestX, 2) + math.Pow(py-closestY, 2)) }
 func (g *Game) findClosestElement(worldX, worldY float64) int {
-	closestIndex := -1
-	minDistScreen := hitThreshold
+	return malha.FindClosestElementIndexado(g.elementos, g.indice, worldX, worldY, hitThreshold/g.cameraZoom)
+}
 
-	for i := len(g.elementos) - 1; i >= 0; i-- {
-		el := g.elementos[i]
-		var distToEdgeWorld float64 = math.MaxFloat64
+// elementosVisiveis devolve, na ordem de desenho, os índices dos elementos que
+// tocam a área visível da tela.
+func (g *Game) elementosVisiveis() []int {
+	x0, y0 := g.screenToWorld(0, 0)
+	x1, y1 := g.screenToWorld(g.screenWidth, g.screenHeight)
+	margem := hitThreshold / g.cameraZoom
+	return g.indice.Consultar(malha.Caixa{MinX: x0 - margem, MinY: y0 - margem, MaxX: x1 + margem, MaxY: y1 + margem})
+}
 
-		switch el.Tipo {
-		case ElementoViaReta:
-			comprimentoWorldUnits := el.Comprimento * pixelsPerMeter
-			rad := el.Rotacao * math.Pi / 180.0
-			endX := el.X + comprimentoWorldUnits*math.Cos(rad)
-			endY := el.Y + comprimentoWorldUnits*math.Sin(rad)
-			distToCenterlineWorld := pointSegmentDistance(worldX, worldY, el.X, el.Y, endX, endY)
-			distToEdgeWorld = distToCenterlineWorld - (el.Espessura / 2.0)
-		case ElementoCircuitoVia:
-			vertBarLenWorld := el.Largura
-			horizStemLenWorld := el.Largura / 2.0
-			strokeWidthWorld := el.Espessura
-			vBarX1, vBarY1 := el.X, el.Y - vertBarLenWorld / 2.0
-			vBarX2, vBarY2 := el.X, el.Y + vertBarLenWorld / 2.0
-			distToVertBarCenterlineWorld := pointSegmentDistance(worldX, worldY, vBarX1, vBarY1, vBarX2, vBarY2)
-			hStemOriginX, hStemOriginY := el.X, el.Y
-			var hStemEndX, hStemEndY float64
-			if el.OrientacaoTC == "Invertido" {
-				hStemEndX, hStemEndY = el.X - horizStemLenWorld, el.Y
+// --- Update ---
+func (g *Game) Update() error {
+	defer g.salvarEmPanico()
+	if ebiten.IsWindowBeingClosed() && g.confirmarDescarte("Sair") {
+		g.removerRecuperacao()
+		logln("Janela fechada.")
+		return ebiten.Termination
+	}
+	g.autosave()
+	if g.problemasPendentes {
+		g.revalidar()
+	}
+	g.atualizarSimulacao()
+	g.atualizarIntertravamento()
+	if inpututil.IsKeyJustPressed(ebiten.KeyF1) {
+		g.showHelp = !g.showHelp
+	}
+	if g.showHelp && inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.showHelp = false
+		return nil
+	}
+	popupClicked := false
+	if g.popupVisible {
+		cursorX, cursorY := ebiten.CursorPosition()
+		clickPoint := image.Pt(cursorX, cursorY)
+		popupDrawX, popupDrawY := g.calculatePopupDrawPosition()
+		if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+			clickedOnOption := false
+			for _, option := range g.popupOptions {
+				optionDrawRect := option.Rect.Add(image.Pt(popupDrawX-g.popupX, popupDrawY-g.popupY))
+				if clickPoint.In(optionDrawRect) {
+					option.Action()
+					g.popupVisible = false
+					popupClicked = true
+					clickedOnOption = true
+					break
+				}
+			}
+			if !clickedOnOption {
+				g.popupVisible = false
+				popupClicked = true
+			}
+		}
+		if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight) {
+			g.popupVisible = false
+			popupClicked = true
+		}
+	}
+	if g.edicao != nil && !g.showHelp { // Teclado reservado ao campo em edição
+		g.atualizarEdicao()
+		return nil
+	}
+	inspetorClicado := !g.showHelp && !popupClicked && (g.cliqueInspetor() || g.cliqueProblemas())
+	if !g.showHelp && !popupClicked && !inspetorClicado {
+		cursorX, cursorY := ebiten.CursorPosition()
+		worldCursorX, worldCursorY := g.screenToWorld(cursorX, cursorY)
+		if g.movingElementIndex == -1 && !g.drawingVia && !g.popupVisible && !g.selecionandoRet {
+			g.hoveredElementIndex = g.findClosestElement(worldCursorX, worldCursorY)
+		} else {
+			g.hoveredElementIndex = -1
+		}
+		if !inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) {
+			g.snapAtivo = false
+		}
+		if g.elementoAtualTipo.EhVia() && !g.drawingVia && g.movingElementIndex == -1 && !g.popupVisible && !ebiten.IsKeyPressed(ebiten.KeyShift) && (g.hoveredElementIndex == -1 || ebiten.IsKeyPressed(ebiten.KeyControl)) {
+			g.snapPoint(worldCursorX, worldCursorY, -1) // Apenas para exibir o indicador do ponto inicial
+		}
+		_, wheelY := ebiten.Wheel()
+		if wheelY != 0 {
+			worldMouseXBefore, worldMouseYBefore := g.screenToWorld(cursorX, cursorY)
+			zoomFactor := 1.1
+			if wheelY < 0 {
+				g.cameraZoom /= zoomFactor
+			} else {
+				g.cameraZoom *= zoomFactor
+			}
+			g.cameraZoom = math.Max(minZoom, math.Min(g.cameraZoom, maxZoom))
+			worldMouseXAfter, worldMouseYAfter := g.screenToWorld(cursorX, cursorY)
+			g.cameraOffsetX += (worldMouseXBefore - worldMouseXAfter)
+			g.cameraOffsetY += (worldMouseYBefore - worldMouseYAfter)
+		}
+		if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight) && g.movingElementIndex == -1 && !(g.modoSimulacao && g.removerTremEm(worldCursorX, worldCursorY)) {
+			clickedIndex := g.findClosestElement(worldCursorX, worldCursorY)
+			if clickedIndex != -1 {
+				g.selectedElementIndex = clickedIndex
+				g.inspecionadoID = g.elementos[clickedIndex].ID
+				g.popupVisible = true
+				g.popupX, g.popupY = cursorX, cursorY
+				g.generatePopupOptions()
+				g.hoveredElementIndex = -1
+			} else {
+				g.popupVisible = false
+			}
+		}
+		ctrl := ebiten.IsKeyPressed(ebiten.KeyControl) || ebiten.IsKeyPressed(ebiten.KeyMeta)
+		if inpututil.IsKeyJustPressed(ebiten.KeyT) {
+			g.elementoAtualTipo = malha.ElementoViaReta
+			logln("Sel: Via Reta")
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyK) {
+			g.elementoAtualTipo = malha.ElementoChaveSimples
+			logln("Sel: Chave Simples")
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyI) && !ctrl {
+			g.elementoAtualTipo = malha.ElementoCircuitoVia
+			logln("Sel: Circuito de Via")
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyA) && ebiten.IsKeyPressed(ebiten.KeyShift) {
+			g.elementoAtualTipo = malha.ElementoViaTransicao
+			logln("Sel: Via Transicao")
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyA) {
+			g.elementoAtualTipo = malha.ElementoViaCurva
+			logln("Sel: Via Curva")
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyN) {
+			g.elementoAtualTipo = malha.ElementoSinal
+			logln("Sel: Sinal")
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyR) {
+			g.alternarModoRota()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyM) {
+			g.alternarModoSimulacao()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyD) && ebiten.IsKeyPressed(ebiten.KeyShift) {
+			g.alternarMedicaoRespeitar()
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyD) {
+			g.alternarModoMedicao()
+		}
+		if g.modoSimulacao {
+			g.teclasSimulacao()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyE) {
+			g.painelProblemas = !g.painelProblemas
+			logf("Painel de Problemas: %s", map[bool]string{true: "Visível", false: "Oculto"}[g.painelProblemas])
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyG) && ebiten.IsKeyPressed(ebiten.KeyShift) {
+			g.snapGrade = !g.snapGrade
+			logf("Snap na Grade: %s", map[bool]string{true: "Ligado", false: "Desligado"}[g.snapGrade])
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyG) {
+			g.gradeVisivel = !g.gradeVisivel
+			logf("Grade: %s", map[bool]string{true: "Visível", false: "Oculta"}[g.gradeVisivel])
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyV) && !ctrl && len(g.selecao) > 0 {
+			g.alternarCheioSelecao()
+		} else if inpututil.IsKeyJustPressed(ebiten.KeyV) && !ctrl {
+			g.viaCheiaDefault = !g.viaCheiaDefault
+			logf("Próxima Via: %s", map[bool]string{true: "Cheia", false: "Vazada"}[g.viaCheiaDefault])
+		}
+		for key, clr := range g.colorPalette {
+			if inpututil.IsKeyJustPressed(key) {
+				if g.currentColor != clr {
+					g.currentColor = clr
+					logf("Cor Padrão: %s", g.colorNames[key])
+				}
+				break
+			}
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyF2) {
+			g.backgroundColor = color.RGBA{R: 50, G: 50, B: 50, A: 255}
+			logln("Fundo: Cinza Escuro")
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyF3) {
+			g.backgroundColor = color.RGBA{R: 100, G: 100, B: 120, A: 255}
+			logln("Fundo: Cinza Azulado")
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyF4) {
+			g.backgroundColor = color.RGBA{R: 240, G: 240, B: 240, A: 255}
+			logln("Fundo: Branco Gelo")
+		}
+		prevThickness := g.thickness
+		mais := inpututil.IsKeyJustPressed(ebiten.KeyEqual) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadAdd)
+		menos := inpututil.IsKeyJustPressed(ebiten.KeyMinus) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadSubtract)
+		if len(g.selecao) > 0 && (mais || menos) {
+			g.ajustarBitolaSelecao(map[bool]float64{true: 1, false: -1}[mais])
+		} else if mais {
+			g.thickness = math.Min(50, g.thickness+1.0)
+		} else if menos {
+			g.thickness = math.Max(1, g.thickness-1.0)
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyDelete) || inpututil.IsKeyJustPressed(ebiten.KeyBackspace) {
+			g.apagarSelecao()
+		}
+		if g.thickness != prevThickness {
+			logf("Espessura ViaReta Padrão (mundo): %.1f", g.thickness)
+		}
+		if ctrl && g.movingElementIndex == -1 && !g.drawingVia {
+			if inpututil.IsKeyJustPressed(ebiten.KeyZ) && !ebiten.IsKeyPressed(ebiten.KeyShift) {
+				g.desfazer()
+			} else if inpututil.IsKeyJustPressed(ebiten.KeyY) || (inpututil.IsKeyJustPressed(ebiten.KeyZ) && ebiten.IsKeyPressed(ebiten.KeyShift)) {
+				g.refazer()
+			} else if inpututil.IsKeyJustPressed(ebiten.KeyC) {
+				g.copiarSelecao(false)
+			} else if inpututil.IsKeyJustPressed(ebiten.KeyX) {
+				g.copiarSelecao(true)
+			} else if inpututil.IsKeyJustPressed(ebiten.KeyV) {
+				g.colar(worldCursorX, worldCursorY)
+			} else if inpututil.IsKeyJustPressed(ebiten.KeyI) {
+				g.importarMalha()
+			}
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyC) && !ctrl && g.confirmarDescarte("Limpar a malha") {
+			g.executar(&cmdSubstituirTudo{antes: g.elementos, depois: []malha.Elemento{}, proxIDAntes: g.proximoElementoID, proxIDDepois: 1, descricao: "Limpar malha"})
+			g.cameraOffsetX = 0
+			g.cameraOffsetY = 0
+			g.cameraZoom = 1.0
+			g.criado = time.Time{}
+			g.marcarSalvo() // Nada a perder numa malha vazia
+			logln("Malha limpa.")
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyP) {
+			g.exportarMalha()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyS) {
+			g.saveElements()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyL) && g.confirmarDescarte("Carregar outra malha") {
+			g.loadElements()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyEscape) && g.confirmarDescarte("Sair") {
+			g.removerRecuperacao()
+			logln("Saindo.")
+			return ebiten.Termination
+		}
+		if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) && g.modoMedicao {
+			g.popupVisible = false
+			g.cliqueMedicao(worldCursorX, worldCursorY)
+		} else if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) && g.modoRota {
+			g.popupVisible = false
+			g.cliqueRota(worldCursorX, worldCursorY)
+		} else if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) && g.modoSimulacao {
+			g.popupVisible = false
+			g.cliqueSimulacao(worldCursorX, worldCursorY)
+		} else if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+			g.popupVisible = false
+			clickedExistingElementIndex := g.findClosestElement(worldCursorX, worldCursorY)
+			forcarNovaVia := g.elementoAtualTipo.EhVia() && ctrl // Ctrl: iniciar via sobre elemento existente
+			if ebiten.IsKeyPressed(ebiten.KeyShift) && clickedExistingElementIndex != -1 {
+				g.alternarSelecao(g.elementos[clickedExistingElementIndex].ID)
+				g.inspecionadoID = g.elementos[clickedExistingElementIndex].ID
+			} else if ebiten.IsKeyPressed(ebiten.KeyShift) {
+				g.selecionandoRet = true
+				g.retInicioX, g.retInicioY = worldCursorX, worldCursorY
+			} else if clickedExistingElementIndex != -1 && !forcarNovaVia {
+				g.movingElementIndex = clickedExistingElementIndex
+				g.selectedElementIndex = clickedExistingElementIndex
+				el := g.elementos[g.movingElementIndex]
+				g.inspecionadoID = el.ID
+				if !g.selecao[el.ID] {
+					g.limparSelecao()
+				}
+				g.iniciarMovimentoGrupo(el)
+				g.movimentoAntes = el
+				g.movingElementOffsetX = worldCursorX - el.X
+				g.movingElementOffsetY = worldCursorY - el.Y
+				g.drawingVia = false
+				logf("Movendo ID %d", el.ID)
 			} else {
-				hStemEndX, hStemEndY = el.X + horizStemLenWorld, el.Y
+				g.limparSelecao()
+				g.inspecionadoID = 0
+				g.selectedElementIndex = -1
+				g.movingElementIndex = -1
+				switch g.elementoAtualTipo {
+				case malha.ElementoViaReta, malha.ElementoViaCurva, malha.ElementoViaTransicao:
+					g.iniciarDesenhoVia(worldCursorX, worldCursorY)
+				case malha.ElementoCircuitoVia:
+					juntaX, juntaY := g.snapPoint(worldCursorX, worldCursorY, -1)
+					novoEl := malha.Elemento{Tipo: malha.ElementoCircuitoVia, ID: g.proximoElementoID, X: juntaX, Y: juntaY, Largura: 30, Cor: g.currentColor, Espessura: 3, OrientacaoTC: "Normal"}
+					g.proximoElementoID++
+					lote := &cmdLote{descricao: fmt.Sprintf("Adicionar Circ.Via ID %d", novoEl.ID)}
+					lote.aplicar(g, &cmdAdicionar{el: novoEl})
+					if g.snapAtivo && g.snapAtual.Tipo == malha.SnapSobreVia {
+						g.dividirVia(lote, g.snapAtual.ElementoID, juntaX, juntaY) // Junta isolada no meio da via: divide a via
+					}
+					g.registrar(lote)
+					logf("Add Circ.Via ID %d (Vert.Bar:%.0f, Stroke:%.0f WU)", novoEl.ID, novoEl.Largura, novoEl.Espessura)
+				case malha.ElementoChaveSimples:
+					pontaX, pontaY := g.snapPoint(worldCursorX, worldCursorY, -1)
+					rumo := 0.0
+					if r, ok := g.rumoSaindoDe(g.snapAtual); ok && g.snapAtivo {
+						rumo = r
+					}
+					novoEl := malha.Elemento{Tipo: malha.ElementoChaveSimples, ID: g.proximoElementoID, X: pontaX, Y: pontaY, Rotacao: rumo, Comprimento: malha.ChaveComprimentoPadrao, Largura: g.thickness, AnguloDesvio: malha.ChaveAnguloDesvioPadrao, PosicaoChave: malha.PosicaoNormal, Cor: g.currentColor, Espessura: 10}
+					g.executar(&cmdAdicionar{el: novoEl})
+					g.proximoElementoID++
+					logf("Add Chave ID %d (R:%.0f WU, Ramos:%.0fm, Desvio:%.0f°, Rumo:%.0f°)", novoEl.ID, novoEl.Espessura, novoEl.Comprimento, novoEl.AnguloDesvio, novoEl.Rotacao)
+				case malha.ElementoSinal:
+					novoEl := malha.Elemento{Tipo: malha.ElementoSinal, ID: g.proximoElementoID, Nome: fmt.Sprintf("S%d", g.proximoElementoID), X: worldCursorX, Y: worldCursorY, Cor: g.currentColor, Espessura: malha.SinalRaioLampadaPadrao, Sentido: malha.SentidoCrescente, TipoSinal: malha.SinalPrincipal, Aspecto: malha.AspectoVermelho}
+					if !malha.AnexarSinal(g.elementos, &novoEl, snapRaioTela/g.cameraZoom) {
+						logln("Sinal deve ser posicionado sobre uma via.")
+						break
+					}
+					g.executar(&cmdAdicionar{el: novoEl})
+					g.proximoElementoID++
+					logf("Add Sinal ID %d (Via %d, %.0fm, %s)", novoEl.ID, novoEl.ViaID, novoEl.Distancia, novoEl.Sentido)
+				}
 			}
-			distToHorizStemCenterlineWorld := pointSegmentDistance(worldX, worldY, hStemOriginX, hStemOriginY, hStemEndX, hStemEndY)
-			minDistToCenterlineWorld := math.Min(distToVertBarCenterlineWorld, distToHorizStemCenterlineWorld)
-			distToEdgeWorld = minDistToCenterlineWorld - (strokeWidthWorld / 2.0)
-		case ElementoChaveSimples:
-			raioWorld := el.Espessura
-			distToCenterWorld := math.Sqrt(math.Pow(worldX-el.X, 2) + math.Pow(worldY-el.Y, 2))
-			distToEdgeWorld = distToCenterWorld - raioWorld
 		}
-		distToEdgeScreen := distToEdgeWorld * g.cameraZoom
-		if distToEdgeScreen < minDistScreen {
-			minDistScreen = distToEdgeScreen
-			closestIndex = i
+		if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+			if g.movingElementIndex != -1 && g.movimentoTravado(worldCursorX, worldCursorY) {
+				g.movingElementIndex, g.grupoAntes = -1, nil
+			} else if g.movingElementIndex != -1 {
+				el := &g.elementos[g.movingElementIndex]
+				el.X = worldCursorX - g.movingElementOffsetX
+				el.Y = worldCursorY - g.movingElementOffsetY
+				if len(g.grupoAntes) == 0 { // Grupo: sem snap, para não atrair o grupo para si mesmo
+					if el.Tipo.EhVia() || el.Tipo == malha.ElementoChaveSimples {
+						if g.snapMovingElement(g.movingElementIndex); !g.snapAtivo {
+							el.X, el.Y = g.pontoNaGrade(el.X, el.Y)
+						}
+					} else if el.Tipo == malha.ElementoCircuitoVia {
+						el.X, el.Y = g.snapPoint(el.X, el.Y, g.movingElementIndex)
+					}
+				}
+				g.indice.Atualizar(g.elementos, g.movingElementIndex)
+				g.moverGrupo(el.X-g.movimentoAntes.X, el.Y-g.movimentoAntes.Y)
+				g.selectedElementIndex = g.movingElementIndex
+				g.hoveredElementIndex = -1
+			} else if g.drawingVia {
+				g.snapPoint(worldCursorX, worldCursorY, -1)
+			}
+		}
+		if inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) {
+			if g.selecionandoRet {
+				g.selecionandoRet = false
+				g.selecionarRetangulo(g.retInicioX, g.retInicioY, worldCursorX, worldCursorY)
+			} else if g.movingElementIndex != -1 {
+				el := g.elementos[g.movingElementIndex]
+				g.movingElementIndex = -1
+				if el.X != g.movimentoAntes.X || el.Y != g.movimentoAntes.Y {
+					logf("ID %d movido (%.0f,%.0f) + %d selecionado(s)", el.ID, el.X, el.Y, len(g.grupoAntes))
+					lote := &cmdLote{descricao: fmt.Sprintf("Mover ID %d", el.ID)}
+					if len(g.grupoAntes) > 0 {
+						lote.descricao = fmt.Sprintf("Mover %d elementos", len(g.grupoAntes)+1)
+					}
+					g.registrarAlteracao(lote, g.movimentoAntes, el, "Mover")
+					for _, antes := range g.grupoAntes {
+						if i := g.indexOfID(antes.ID); i != -1 {
+							g.registrarAlteracao(lote, antes, g.elementos[i], "Mover")
+						}
+					}
+					if g.snapAtivo && g.snapAtual.Tipo == malha.SnapSobreVia {
+						g.dividirVia(lote, g.snapAtual.ElementoID, g.snapAtual.X, g.snapAtual.Y)
+					}
+					g.registrar(lote)
+				}
+				g.snapAtivo = false
+				g.grupoAntes = nil
+			} else if g.drawingVia {
+				g.snapPoint(worldCursorX, worldCursorY, -1)
+				endWorldX, endWorldY := g.fimDesenho(worldCursorX, worldCursorY)
+				if novoEl, ok := g.viaDesenhada(endWorldX, endWorldY); ok {
+					g.proximoElementoID++
+					nomeTipo := map[malha.ElementType]string{malha.ElementoViaReta: "ViaReta", malha.ElementoViaCurva: "ViaCurva", malha.ElementoViaTransicao: "ViaTransicao"}[novoEl.Tipo]
+					lote := &cmdLote{descricao: fmt.Sprintf("Adicionar %s ID %d", nomeTipo, novoEl.ID)}
+					lote.aplicar(g, &cmdAdicionar{el: novoEl})
+					if g.snapInicioAtivo && g.snapInicio.Tipo == malha.SnapSobreVia {
+						g.dividirVia(lote, g.snapInicio.ElementoID, g.startX, g.startY)
+					}
+					if g.snapAtivo && g.snapAtual.Tipo == malha.SnapSobreVia {
+						g.dividirVia(lote, g.snapAtual.ElementoID, endWorldX, endWorldY)
+					}
+					g.registrar(lote)
+					if novoEl.Tipo == malha.ElementoViaCurva {
+						logf("Add ViaCurva ID %d (R:%.0fm, Varredura:%.1f°, %.2fm, Conexoes:%v)", novoEl.ID, novoEl.Raio, novoEl.Varredura, novoEl.Comprimento, g.topologia.Neighbors(novoEl.ID))
+					} else if novoEl.Tipo == malha.ElementoViaTransicao {
+						logf("Add ViaTransicao ID %d (R:%.0fm->%.0fm, Varredura:%.1f°, %.2fm, Conexoes:%v)", novoEl.ID, novoEl.RaioInicial, novoEl.Raio, novoEl.Varredura, novoEl.Comprimento, g.topologia.Neighbors(novoEl.ID))
+					} else {
+						logf("Add ViaReta ID %d (%.2fm, E:%.0f WU, Conexoes:%v)", novoEl.ID, novoEl.Comprimento, novoEl.Espessura, g.topologia.Neighbors(novoEl.ID))
+					}
+				} else if g.elementoAtualTipo == malha.ElementoViaCurva {
+					logln("Curva indefinida: ponto final alinhado ao rumo inicial (use Via Reta).")
+				} else if g.elementoAtualTipo == malha.ElementoViaTransicao {
+					logln("Transicao indefinida: nenhuma clotoide de um so lado chega ao ponto final.")
+				}
+				g.drawingVia = false
+				g.snapAtivo, g.snapInicioAtivo = false, false
+				g.startX = math.NaN()
+				g.startY = math.NaN()
+				g.selectedElementIndex = -1
+			}
 		}
 	}
-	return closestIndex
-}
-
-// --- Update ---
-func (g *Game) Update() error { if inpututil.IsKeyJustPressed(ebiten.KeyF1) { g.showHelp = !g.showHelp }; if g.showHelp && inpututil.IsKeyJustPressed(ebiten.KeyEscape) { g.showHelp = false; return nil }; popupClicked := false; if g.popupVisible { cursorX, cursorY := ebiten.CursorPosition(); clickPoint := image.Pt(cursorX, cursorY); popupDrawX, popupDrawY := g.calculatePopupDrawPosition(); if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) { clickedOnOption := false; for _, option := range g.popupOptions { optionDrawRect := option.Rect.Add(image.Pt(popupDrawX-g.popupX, popupDrawY-g.popupY)); if clickPoint.In(optionDrawRect) { option.Action(); g.popupVisible = false; popupClicked = true; clickedOnOption = true; break } }; if !clickedOnOption { g.popupVisible = false; popupClicked = true } }; if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight) { g.popupVisible = false; popupClicked = true } }; if !g.showHelp && !popupClicked { cursorX, cursorY := ebiten.CursorPosition(); worldCursorX, worldCursorY := g.screenToWorld(cursorX, cursorY); if g.movingElementIndex == -1 && !g.drawingVia && !g.popupVisible { g.hoveredElementIndex = g.findClosestElement(worldCursorX, worldCursorY) } else { g.hoveredElementIndex = -1 }; _, wheelY := ebiten.Wheel(); if wheelY != 0 { worldMouseXBefore, worldMouseYBefore := g.screenToWorld(cursorX, cursorY); zoomFactor := 1.1; if wheelY < 0 { g.cameraZoom /= zoomFactor } else { g.cameraZoom *= zoomFactor }; g.cameraZoom = math.Max(minZoom, math.Min(g.cameraZoom, maxZoom)); worldMouseXAfter, worldMouseYAfter := g.screenToWorld(cursorX, cursorY); g.cameraOffsetX += (worldMouseXBefore - worldMouseXAfter); g.cameraOffsetY += (worldMouseYBefore - worldMouseYAfter) }; if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight) && g.movingElementIndex == -1 { clickedIndex := g.findClosestElement(worldCursorX, worldCursorY); if clickedIndex != -1 { g.selectedElementIndex = clickedIndex; g.popupVisible = true; g.popupX, g.popupY = cursorX, cursorY; g.generatePopupOptions(); g.hoveredElementIndex = -1 } else { g.popupVisible = false } }; if inpututil.IsKeyJustPressed(ebiten.KeyT) { g.elementoAtualTipo = ElementoViaReta; logln("Sel: Via Reta") }; if inpututil.IsKeyJustPressed(ebiten.KeyK) { g.elementoAtualTipo = ElementoChaveSimples; logln("Sel: Chave Simples") }; if inpututil.IsKeyJustPressed(ebiten.KeyI) { g.elementoAtualTipo = ElementoCircuitoVia; logln("Sel: Circuito de Via") }; if inpututil.IsKeyJustPressed(ebiten.KeyV) { g.viaCheiaDefault = !g.viaCheiaDefault; logf("Próxima Via: %s", map[bool]string{true: "Cheia", false: "Vazada"}[g.viaCheiaDefault]) }; for key, clr := range g.colorPalette { if inpututil.IsKeyJustPressed(key) { if g.currentColor != clr { g.currentColor = clr; logf("Cor Padrão: %s", g.colorNames[key]) }; break } }; if inpututil.IsKeyJustPressed(ebiten.KeyF2) { g.backgroundColor = color.RGBA{R: 50, G: 50, B: 50, A: 255}; logln("Fundo: Cinza Escuro") }; if inpututil.IsKeyJustPressed(ebiten.KeyF3) { g.backgroundColor = color.RGBA{R: 100, G: 100, B: 120, A: 255}; logln("Fundo: Cinza Azulado") }; if inpututil.IsKeyJustPressed(ebiten.KeyF4) { g.backgroundColor = color.RGBA{R: 240, G: 240, B: 240, A: 255}; logln("Fundo: Branco Gelo") }; prevThickness := g.thickness; if inpututil.IsKeyJustPressed(ebiten.KeyEqual) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadAdd) { g.thickness = math.Min(50, g.thickness+1.0) }; if inpututil.IsKeyJustPressed(ebiten.KeyMinus) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadSubtract) { g.thickness = math.Max(1, g.thickness-1.0) }; if g.thickness != prevThickness { logf("Espessura ViaReta Padrão (mundo): %.1f", g.thickness) }; if inpututil.IsKeyJustPressed(ebiten.KeyC) { g.elementos = []Elemento{}; g.cameraOffsetX = 0; g.cameraOffsetY = 0; g.cameraZoom = 1.0; g.proximoElementoID = 1; g.popupVisible = false; g.selectedElementIndex = -1; g.movingElementIndex = -1; g.hoveredElementIndex = -1; logln("Malha limpa.") }; if inpututil.IsKeyJustPressed(ebiten.KeyS) { g.saveElements() }; if inpututil.IsKeyJustPressed(ebiten.KeyL) { g.loadElements() }; if inpututil.IsKeyJustPressed(ebiten.KeyEscape) { logln("Saindo."); return ebiten.Termination }; if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) { g.popupVisible = false; clickedExistingElementIndex := g.findClosestElement(worldCursorX, worldCursorY); if clickedExistingElementIndex != -1 { g.movingElementIndex = clickedExistingElementIndex; g.selectedElementIndex = clickedExistingElementIndex; el := g.elementos[g.movingElementIndex]; g.movingElementOffsetX = worldCursorX - el.X; g.movingElementOffsetY = worldCursorY - el.Y; g.drawingVia = false; logf("Movendo ID %d", el.ID) } else { g.selectedElementIndex = -1; g.movingElementIndex = -1; switch g.elementoAtualTipo { case ElementoViaReta: g.startX, g.startY = worldCursorX, worldCursorY; g.drawingVia = true; case ElementoCircuitoVia: novoEl := Elemento{Tipo:ElementoCircuitoVia,ID:g.proximoElementoID,X:worldCursorX,Y:worldCursorY,Largura:30,Cor:g.currentColor,Espessura:3,OrientacaoTC:"Normal"}; g.elementos=append(g.elementos,novoEl); g.proximoElementoID++; logf("Add Circ.Via ID %d (Vert.Bar:%.0f, Stroke:%.0f WU)",novoEl.ID, novoEl.Largura, novoEl.Espessura); case ElementoChaveSimples: novoEl := Elemento{Tipo:ElementoChaveSimples,ID:g.proximoElementoID,X:worldCursorX,Y:worldCursorY,Cor:g.currentColor,Espessura:10}; g.elementos=append(g.elementos,novoEl); g.proximoElementoID++; logf("Add Chave ID %d (R:%.0f WU)",novoEl.ID, novoEl.Espessura) } } }; if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) { if g.movingElementIndex != -1 { el := &g.elementos[g.movingElementIndex]; el.X = worldCursorX - g.movingElementOffsetX; el.Y = worldCursorY - g.movingElementOffsetY; g.selectedElementIndex = g.movingElementIndex; g.hoveredElementIndex = -1 } }; if inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) { if g.movingElementIndex != -1 { el := g.elementos[g.movingElementIndex]; logf("ID %d movido (%.0f,%.0f)", el.ID, el.X, el.Y); g.selectedElementIndex = g.movingElementIndex; g.movingElementIndex = -1 } else if g.drawingVia { endWorldX, endWorldY := worldCursorX, worldCursorY; if !math.IsNaN(g.startX) && !math.IsNaN(g.startY) { worldPixelDist := math.Sqrt(math.Pow(endWorldX-g.startX,2)+math.Pow(endWorldY-g.startY,2)); if worldPixelDist*g.cameraZoom > 1.0 { lengthM := calculateLengthMeters(g.startX,g.startY,endWorldX,endWorldY); if !math.IsNaN(lengthM) { dx:=endWorldX-g.startX; dy:=endWorldY-g.startY; rot:=math.Atan2(dy,dx)*180/math.Pi; novoEl:=Elemento{Tipo:ElementoViaReta,ID:g.proximoElementoID,X:g.startX,Y:g.startY,Comprimento:lengthM,Rotacao:rot,Cor:g.currentColor,Espessura:g.thickness,ModoCheio:g.viaCheiaDefault}; g.elementos=append(g.elementos,novoEl); g.proximoElementoID++; logf("Add ViaReta ID %d (%.2fm, E:%.0f WU)", novoEl.ID, novoEl.Comprimento, novoEl.Espessura) } } }; g.drawingVia=false; g.startX=math.NaN(); g.startY=math.NaN(); g.selectedElementIndex=-1 } } }
 
 	currentCamScrollSpeed := cameraScrollSpeed / g.cameraZoom
 	if ebiten.IsKeyPressed(ebiten.KeyLeft) {
@@ -268,16 +630,21 @@ func (g *Game) generatePopupOptions() {
 			Action: func(capturedKey ebiten.Key, capturedColor color.RGBA) func() {
 				return func() {
 					idxToColor := g.selectedElementIndex
-					if idxToColor >= 0 && idxToColor < len(g.elementos) {
-						g.elementos[idxToColor].Cor = capturedColor
-						logf("Cor ID %d -> %s", g.elementos[idxToColor].ID, g.colorNames[capturedKey])
+					if idxToColor >= 0 && idxToColor < len(g.elementos) && g.selecao[g.elementos[idxToColor].ID] && len(g.selecao) > 1 {
+						g.alterarSelecao("Cor", func(el *malha.Elemento) bool { mudou := el.Cor != capturedColor; el.Cor = capturedColor; return mudou })
+					} else if idxToColor >= 0 && idxToColor < len(g.elementos) && !g.travadoPorRota(g.elementos[idxToColor].ID) {
+						antes := g.elementos[idxToColor]
+						depois := antes
+						depois.Cor = capturedColor
+						g.executar(&cmdAlterar{antes: antes, depois: depois, descricao: "Cor"})
+						logf("Cor ID %d -> %s", antes.ID, g.colorNames[capturedKey])
 					}
 				}
 			}(key, optColor),
 		})
 	}
 	currentPopupY += popupColorSquareSize + popupPadding
-	if g.elementos[g.selectedElementIndex].Tipo == ElementoCircuitoVia {
+	if g.elementos[g.selectedElementIndex].Tipo == malha.ElementoCircuitoVia {
 		toggleOrientacaoRect := image.Rect(g.popupX+popupPadding, currentPopupY, g.popupX+popupWidth-popupPadding, currentPopupY+popupOptionHeight)
 		currentOrientationDisplay := g.elementos[g.selectedElementIndex].OrientacaoTC
 		if currentOrientationDisplay == "" { currentOrientationDisplay = "Normal (ト)" } else
@@ -290,60 +657,180 @@ func (g *Game) generatePopupOptions() {
 			Action: func() {
 				idxToToggle := g.selectedElementIndex
 				if idxToToggle >= 0 && idxToToggle < len(g.elementos) {
-                    selEl := &g.elementos[idxToToggle]
+                    antes := g.elementos[idxToToggle]
+					selEl := antes
 					if selEl.OrientacaoTC == "Normal" || selEl.OrientacaoTC == "" {
 						selEl.OrientacaoTC = "Invertido"
 					} else {
 						selEl.OrientacaoTC = "Normal"
 					}
+					g.executar(&cmdAlterar{antes: antes, depois: selEl, descricao: "Orientação"})
 					logf("OrientacaoTC ID %d -> %s", selEl.ID, selEl.OrientacaoTC)
 				}
 			},
 		})
 		currentPopupY += popupOptionHeight + popupPadding
 	}
+	if g.elementos[g.selectedElementIndex].Tipo == malha.ElementoChaveSimples {
+		outraPosicao := malha.PosicaoReversa
+		if g.elementos[g.selectedElementIndex].PosicaoAtual() == malha.PosicaoReversa { outraPosicao = malha.PosicaoNormal }
+		chaveOpcoes := []struct { label, descricao string; alterar func(*malha.Elemento) }{
+			{"Mover p/ " + outraPosicao, "Posição", func(el *malha.Elemento) { el.PosicaoChave = outraPosicao }},
+			{"Espelhar Desvio", "Espelhar", func(el *malha.Elemento) { el.AnguloDesvio = -el.AnguloDesvio }},
+			{"Girar +45°", "Girar", func(el *malha.Elemento) { el.Rotacao = math.Mod(el.Rotacao+45, 360) }},
+		}
+		if rota := g.intertravamento.ChaveTravada(g.elementos[g.selectedElementIndex].ID); rota != "" { // Chave travada: nenhuma alteração até a rota liberar
+			optionRect := image.Rect(g.popupX+popupPadding, currentPopupY, g.popupX+popupWidth-popupPadding, currentPopupY+popupOptionHeight)
+			g.popupOptions = append(g.popupOptions, PopupOption{Label: "Travada: " + rota, Rect: optionRect, Action: func() { logf("Chave travada pela rota %s", rota) }})
+			currentPopupY += popupOptionHeight + popupPadding
+			chaveOpcoes = nil
+		}
+		for _, opcao := range chaveOpcoes {
+			optionRect := image.Rect(g.popupX+popupPadding, currentPopupY, g.popupX+popupWidth-popupPadding, currentPopupY+popupOptionHeight)
+			g.popupOptions = append(g.popupOptions, PopupOption{Label: opcao.label, Rect: optionRect, Action: g.popupAlterarAction(opcao.descricao, opcao.alterar)})
+			currentPopupY += popupOptionHeight + popupPadding
+		}
+	}
+	if sel := g.elementos[g.selectedElementIndex]; sel.Tipo == malha.ElementoSinal {
+		proxTipo := malha.TiposSinal[0]
+		for i, tipo := range malha.TiposSinal { if tipo == sel.TipoSinalAtual() { proxTipo = malha.TiposSinal[(i+1)%len(malha.TiposSinal)] } }
+		sinalOpcoes := []struct { label, descricao string; alterar func(*malha.Elemento) }{
+			{"Inverter Sentido", "Sentido", func(el *malha.Elemento) {
+				if el.Sentido == malha.SentidoDecrescente { el.Sentido = malha.SentidoCrescente } else { el.Sentido = malha.SentidoDecrescente }
+				el.Rotacao = math.Mod(el.Rotacao+180, 360)
+			}},
+			{"Tipo: " + proxTipo, "Tipo", func(el *malha.Elemento) {
+				el.TipoSinal = proxTipo
+				if permitidos := malha.AspectosPermitidos(proxTipo); !slices.Contains(permitidos, el.Aspecto) { el.Aspecto = permitidos[0] }
+			}},
+		}
+		for _, aspecto := range malha.AspectosPermitidos(sel.TipoSinalAtual()) {
+			if aspecto == sel.Aspecto { continue }
+			capturedAspecto := aspecto
+			sinalOpcoes = append(sinalOpcoes, struct { label, descricao string; alterar func(*malha.Elemento) }{"Aspecto: " + aspecto, "Aspecto", func(el *malha.Elemento) { el.Aspecto = capturedAspecto }})
+		}
+		for _, opcao := range sinalOpcoes {
+			optionRect := image.Rect(g.popupX+popupPadding, currentPopupY, g.popupX+popupWidth-popupPadding, currentPopupY+popupOptionHeight)
+			g.popupOptions = append(g.popupOptions, PopupOption{Label: opcao.label, Rect: optionRect, Action: g.popupAlterarAction(opcao.descricao, opcao.alterar)})
+			currentPopupY += popupOptionHeight + popupPadding
+		}
+	}
+	if idxSecao := g.secoes.SecaoDoElemento(g.elementos[g.selectedElementIndex].ID); idxSecao != -1 {
+		secao := g.secoes.Lista[idxSecao]
+		for _, estado := range []string{malha.EstadoLivre, malha.EstadoOcupado, malha.EstadoFalha} {
+			if estado == secao.Estado { continue }
+			optionRect := image.Rect(g.popupX+popupPadding, currentPopupY, g.popupX+popupWidth-popupPadding, currentPopupY+popupOptionHeight)
+			g.popupOptions = append(g.popupOptions, PopupOption{Label: fmt.Sprintf("%s: %s", secao.Nome, estado), Rect: optionRect, Action: func(capturedEstado string) func() { return func() { g.setEstadoSecao(idxSecao, capturedEstado) } }(estado)})
+			currentPopupY += popupOptionHeight + popupPadding
+		}
+	}
+	if g.selecao[g.elementos[g.selectedElementIndex].ID] && len(g.selecao) > 1 {
+		grupoOpcoes := []struct { label string; acao func() }{
+			{fmt.Sprintf("Selecao (%d): Cheia/Vazada", len(g.selecao)), g.alternarCheioSelecao},
+			{fmt.Sprintf("Apagar Selecao (%d)", len(g.selecao)), g.apagarSelecao},
+		}
+		for _, opcao := range grupoOpcoes {
+			optionRect := image.Rect(g.popupX+popupPadding, currentPopupY, g.popupX+popupWidth-popupPadding, currentPopupY+popupOptionHeight)
+			g.popupOptions = append(g.popupOptions, PopupOption{Label: opcao.label, Rect: optionRect, Action: opcao.acao})
+			currentPopupY += popupOptionHeight + popupPadding
+		}
+	}
 	deleteRect := image.Rect(g.popupX+popupPadding, currentPopupY, g.popupX+popupWidth-popupPadding, currentPopupY+popupOptionHeight)
 	g.popupOptions = append(g.popupOptions, PopupOption{
 		Label: "Apagar", Rect:  deleteRect,
 		Action: func() {
 			idxToDelete := g.selectedElementIndex
-			if idxToDelete >= 0 && idxToDelete < len(g.elementos) {
+			if idxToDelete >= 0 && idxToDelete < len(g.elementos) && !g.travadoPorRota(g.elementos[idxToDelete].ID) {
 				elID := g.elementos[idxToDelete].ID; elType := g.elementos[idxToDelete].Tipo
 				logf("Apagando ID %d (Tipo: %v)", elID, elType)
-				g.elementos = append(g.elementos[:idxToDelete], g.elementos[idxToDelete+1:]...)
-				g.selectedElementIndex = -1; g.hoveredElementIndex = -1; g.movingElementIndex = -1
+				g.executar(&cmdRemover{el: g.elementos[idxToDelete], index: idxToDelete})
 			}
 		},
 	})
 	if len(g.popupOptions) == 0 { g.popupVisible = false }
 }
 
+// setEstadoSecao grava o estado de ocupação em todos os elementos da seção (um passo no histórico).
+func (g *Game) setEstadoSecao(idxSecao int, estado string) {
+	if idxSecao < 0 || idxSecao >= len(g.secoes.Lista) { return }
+	secao := g.secoes.Lista[idxSecao]
+	lote := &cmdLote{descricao: fmt.Sprintf("Seção %s -> %s", secao.Nome, estado)}
+	for _, id := range secao.Elementos {
+		if i := g.indexOfID(id); i != -1 {
+			antes := g.elementos[i]
+			depois := antes
+			depois.Estado = estado
+			lote.aplicar(g, &cmdAlterar{antes: antes, depois: depois, descricao: "Estado"})
+		}
+	}
+	g.registrar(lote)
+	logf("Seção %s (%d elementos) -> %s", secao.Nome, len(secao.Elementos), estado)
+}
+
+// popupAlterarAction cria a ação de popup que altera o elemento selecionado via histórico.
+func (g *Game) popupAlterarAction(descricao string, alterar func(*malha.Elemento)) func() {
+	return func() {
+		idx := g.selectedElementIndex
+		if idx < 0 || idx >= len(g.elementos) || g.travadoPorRota(g.elementos[idx].ID) { return }
+		antes := g.elementos[idx]
+		depois := antes
+		alterar(&depois)
+		g.executar(&cmdAlterar{antes: antes, depois: depois, descricao: descricao})
+		logf("%s ID %d (Posição:%s Rotação:%.0f° Desvio:%.0f°)", descricao, depois.ID, depois.PosicaoAtual(), depois.Rotacao, depois.AnguloDesvio)
+	}
+}
+
 func (g *Game) calculatePopupDrawPosition() (int, int) { popupHeight := 0; if len(g.popupOptions) > 0 { maxY := 0; for _, opt := range g.popupOptions { if opt.Rect.Max.Y > maxY { maxY = opt.Rect.Max.Y } }; popupHeight = (maxY - g.popupY) + popupPadding } else { popupHeight = popupPadding*2 + popupColorSquareSize + popupOptionHeight + popupPadding }; drawPopupX := g.popupX; drawPopupY := g.popupY; if drawPopupX+popupWidth > g.screenWidth { drawPopupX = g.screenWidth - popupWidth }; if drawPopupY+popupHeight > g.screenHeight { drawPopupY = g.screenHeight - popupHeight }; if drawPopupX < 0 { drawPopupX = 0 }; if drawPopupY < 0 { drawPopupY = 0 }; return drawPopupX, drawPopupY }
 
 // --- Texto da Ajuda ---
 const helpText = ` = = = AJUDA (Pressione F1 ou ESC para fechar) = = =
 
 SELECAO DE ELEMENTO (Adicao):
- T: Via Reta | I: Circ. Via | K: Chave Simples
+ T: Via Reta | A: Via Curva | Shift+A: Via Transicao | I: Circ. Via
+ K: Chave Simples | N: Sinal
 
 ADICIONAR:
  - Via Reta: Clique esquerdo em area vazia, arraste e solte.
              Comprimento em metros, Bitola em Unid. Mundo.
+             Extremidades encaixam (snap) em pontas de vias, centro
+             de chaves ou sobre outra via (cria juncao).
+             Ctrl+Clique: iniciar via sobre elemento existente.
+             Partindo da ponta de uma curva, segue a tangente dela.
+             Alt (segurado): desativa o snap.
+ - Via Curva: Clique e arraste como na Via Reta. Partindo da ponta
+             de uma via, a curva sai tangente a ela (solta: rumo 0°);
+             o ponto final define raio e varredura.
+ - Via Transicao: Clique e arraste como na Via Curva. Clotoide que
+             sai com o rumo e a curvatura da ponta de origem (reta:
+             raio infinito) e chega ao ponto final; o comprimento e
+             o raio final saem do ponto. Da ponta de uma transicao,
+             uma curva ou reta segue a tangente dela.
  - Outros: Clique esquerdo em area vazia para posicionar.
    - Circ. Via: Desenha um símbolo ト (ou ┤ se invertido).
                 Comprimento da barra vertical e espessura do traço
                 em Unid. Mundo. Barra horizontal = 1/2 da vertical.
                 (Padrão: Barra Vert. L=30, Traço E=3 Unid. Mundo)
-   - Chave Simples: Desenha um circulo.
-                    Raio em Unid. Mundo.
-                    (Padrao: Raio R=10 Unid. Mundo)
+                E uma junta isolada: sobre a ponta de uma via (ou
+                sobre a via, que e dividida) separa as secoes de via.
+                Vias de secao Ocupada ficam vermelhas; Falha, magenta.
+   - Chave Simples: Ponta (circulo, raio R=10 Unid. Mundo) com ramo
+                    normal e ramo reverso (desvio padrao 20 graus).
+                    O ramo posicionado e desenhado cheio; o outro fino.
+                    Na ponta de uma via, a chave continua o rumo da via.
+   - Sinal: Clique sobre uma via (o sinal fica preso a ela).
+            Cabecote a direita do sentido de circulacao.
+            Principal: 3 lampadas | Manobra: 2 menores |
+            Distante: 2 lampadas e barra no mastro.
 
 MOVER ELEMENTO:
  - Clique esquerdo sobre um elemento e arraste.
 
 EDITAR/APAGAR ELEMENTOS:
  - Clique Direito sobre um elemento para abrir menu.
-   (Mudar cor, Inverter Orientacao ト/┤ para Circ.Via, Apagar)
+   (Mudar cor, Inverter Orientacao ト/┤ para Circ.Via,
+    Mover Chave Normal/Reversa, Espelhar Desvio, Girar,
+    Estado da Secao: Livre/Ocupado/Falha,
+    Sinal: Inverter Sentido, Tipo, Aspecto, Apagar)
  - Clique Esquerdo nas opcoes do menu.
 
 NAVEGACAO:
@@ -355,8 +842,49 @@ VIA RETA (Proximo a ser adicionado):
  +, - (Numpad): Aumentar/Diminuir Bitola Padrao (Unid. Mundo)
  V: Alternar Modo Padrao (Cheia / Vazada)
 
+GRADE: G: Mostrar/Ocultar Grade (passo em metros conforme o zoom)
+       Shift+G: Ligar/Desligar Snap na Grade (pontos na grade, retas a cada 15 graus)
+       Alt: Desativa o snap temporariamente
 COR DE FUNDO: F2: Cinza Escuro | F3: Cinza Azulado | F4: Branco Gelo
-ARQUIVO: S: Salvar | L: Carregar | C: Limpar Tudo
+ARQUIVO: S: Salvar | L: Carregar | C: Limpar Tudo | P: Exportar PNG/SVG/DXF/railML (malha inteira)
+         P com .csv ou .html: Tabela de Rotas (sinal a sinal: chaves, circuitos, flanco e conflitos)
+         Ctrl+I: Importar DXF (LINE, LWPOLYLINE e ARC viram vias; unidade de $INSUNITS ou metros)
+                 ou railML 2.x (trilhos, chaves, juntas e sinais em disposicao esquematica)
+         Alteracoes nao salvas: gravadas a cada 30s em malha.recuperacao.json (oferecida ao iniciar)
+         Sair, Limpar e Carregar pedem confirmacao se houver alteracoes nao salvas
+SELECAO: Shift+Clique: Adicionar/Remover elemento
+         Shift+Arrastar em area vazia: Selecionar por retangulo
+         Arrastar um selecionado: Mover o grupo (sem snap)
+         Com selecao: 1-5 no menu, +/-, V e Delete atuam no grupo
+         Clique em area vazia: Limpar selecao
+INSPETOR: Clique num elemento para exibir suas propriedades (painel a direita)
+          Clique num valor para editar (ao vivo) | Enter/Tab/Clique: Confirmar | Esc: Cancelar
+          Campos entre [ ] alternam a cada clique | Clique em area vazia: Fechar
+VALIDACAO: E: Mostrar/Ocultar painel de problemas e marcadores (vermelho: erro, amarelo: aviso)
+           Regras: IDs duplicados, geometria NaN/comprimento zero, circuito fora de no,
+           vias retas sobrepostas, chave sem ligacao na ponta/ramos, pontas soltas
+           Clique num problema: Selecionar os elementos e centrar a camera
+SIMULACAO: M: Entrar/Sair do modo simulacao (trens ocultos e parados fora dele)
+           Clique numa via/chave: Colocar trem (cabeca no ponto, no sentido da via)
+           Tab: Modelo do proximo trem (Carga, Passageiros, Manobra)
+           Clique num trem: Inverter sentido | Clique direito num trem: Remover
+           Espaco: Rodar/Pausar | [ e ]: Metade/Dobro da velocidade (0.25x a 256x)
+           Trens seguem a posicao das chaves (menu do clique direito) e freiam no fim da via livre
+           Secoes com trem ficam vermelhas (ocupadas)
+ROTAS: R: Entrar/Sair do modo rota
+       Clique na origem (sinal ou via) e depois no destino (sinal ou via): estabelece a rota
+       A rota exige secoes livres e nenhum elemento travado por outra rota; as chaves sao
+       movidas (um passo do historico) e o percurso fica travado (verde), com o sinal aberto
+       Clique na origem de uma rota: Cancelar (antes de o trem entrar)
+       A rota libera secao por secao conforme o trem (ou o estado da secao) as ocupa e desocupa
+       Elementos travados nao podem ser movidos, apagados, divididos nem editados
+MEDICAO: D: Entrar/Sair do modo medicao (sai do modo rota)
+         Clique numa via/chave: Ponto de partida; outro clique: Ponto de chegada (um terceiro recomeca)
+         Menor caminho pela via destacado, com o comprimento em metros e os elementos percorridos
+         Shift+D: Ignorar/Respeitar a posicao atual das chaves
+COPIAR/COLAR: Ctrl+C: Copiar selecao | Ctrl+X: Recortar | Ctrl+V: Colar no cursor
+HISTORICO: Ctrl+Z: Desfazer | Ctrl+Y (ou Ctrl+Shift+Z): Refazer
+           Passos guardados: opcao -historico N ao abrir o editor (padrao 200, 0: sem limite)
 SAIR: ESC: Fechar Ajuda / Sair do Programa
 `
 
@@ -364,23 +892,30 @@ SAIR: ESC: Fechar Ajuda / Sair do Programa
 func (g *Game) Draw(screen *ebiten.Image) {
 	if screen == nil || g.whitePixel == nil { logln("ERRO CRITICO: screen/whitePixel nil"); return }
 	screen.Fill(g.backgroundColor)
+	g.drawGrade(screen)
 	cursorX, cursorY := ebiten.CursorPosition()
 
-	for i, el := range g.elementos {
+	visiveis := g.elementosVisiveis()
+	g.visiveis = len(visiveis)
+	comTrem := g.secoesComTrem()
+	travados := g.intertravamento.Travados()
+	for _, i := range visiveis {
+		el := g.elementos[i]
 		var drawColor color.RGBA
 		isMoving := (i == g.movingElementIndex); isSelectedPopup := (g.popupVisible && i == g.selectedElementIndex && !isMoving)
 		isHovered := (i == g.hoveredElementIndex && !isMoving && !isSelectedPopup && !g.drawingVia && !g.popupVisible)
 		if isMoving { drawColor = color.RGBA{R: 255, G: 165, B: 0, A: 255} } else if isSelectedPopup { drawColor = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+		} else if g.selecao[el.ID] { drawColor = corSelecao
 		} else if isHovered { r, gr, b, a := el.Cor.RGBA(); drawColor = color.RGBA{uint8(math.Min(255, float64(r>>8)+60)), uint8(math.Min(255, float64(gr>>8)+60)), uint8(math.Min(255, float64(b>>8)+60)), uint8(a >> 8)}
-		} else { drawColor = el.Cor }
+		} else { drawColor = el.Cor; if idx := g.secoes.SecaoDoElemento(el.ID); idx != -1 { estado := g.secoes.Lista[idx].Estado; if comTrem[idx] && estado == malha.EstadoLivre { estado = malha.EstadoOcupado }; switch estado { case malha.EstadoOcupado: drawColor = malha.CorSecaoOcupada; case malha.EstadoFalha: drawColor = malha.CorSecaoFalha; default: if _, ok := travados[el.ID]; ok { drawColor = corRotaTravada } } } }
 		
 		screenDrawSizeElement := float32(el.Espessura * g.cameraZoom) 
 		currentRailStrokeWidthOnScreen := float32(railStrokeWidth * g.cameraZoom)
 		if currentRailStrokeWidthOnScreen < 0.5 { currentRailStrokeWidthOnScreen = 0.5 }
 
 		switch el.Tipo {
-		case ElementoViaReta:
-			worldUnitsLength := el.Comprimento * pixelsPerMeter
+		case malha.ElementoViaReta:
+			worldUnitsLength := el.Comprimento * malha.PixelsPerMeter
 			rad := el.Rotacao * math.Pi / 180.0
 			endWorldX := el.X + worldUnitsLength*math.Cos(rad); endWorldY := el.Y + worldUnitsLength*math.Sin(rad)
 			screenX1, screenY1 := g.worldToScreen(el.X, el.Y); screenX2, screenY2 := g.worldToScreen(endWorldX, endWorldY)
@@ -418,7 +953,7 @@ func (g *Game) Draw(screen *ebiten.Image) {
 				vector.StrokeLine(screen, screenX2, limitY2_upper, screenX2, limitY2_lower, currentRailStrokeWidthOnScreen, drawColor, true)
 			}
 
-		case ElementoCircuitoVia:
+		case malha.ElementoCircuitoVia:
 			screenX, screenY := g.worldToScreen(el.X, el.Y)
 			screenVertBarLen := float32(el.Largura * g.cameraZoom)
 			screenHorizStemLen := screenVertBarLen / 2.0
@@ -437,17 +972,33 @@ func (g *Game) Draw(screen *ebiten.Image) {
 				hStemEndX = screenX + screenHorizStemLen; hStemEndY = screenY
 			}
 			vector.StrokeLine(screen, hStemOriginX, hStemOriginY, hStemEndX, hStemEndY, screenStrokeWidthCV, drawColor, true)
-		case ElementoChaveSimples:
-			screenX, screenY := g.worldToScreen(el.X, el.Y)
+		case malha.ElementoChaveSimples:
+			ponta, ramoPosicionado, ramoLivre := el.PontasChave()
+			if el.PosicaoAtual() == malha.PosicaoReversa { ramoPosicionado, ramoLivre = ramoLivre, ramoPosicionado }
+			screenX, screenY := g.worldToScreen(ponta.X, ponta.Y)
+			screenRamo := float32(el.Largura * g.cameraZoom)
+			if screenRamo < 1.0 { screenRamo = 1.0 }
+			livreX, livreY := g.worldToScreen(ramoLivre.X, ramoLivre.Y)
+			vector.StrokeLine(screen, screenX, screenY, livreX, livreY, currentRailStrokeWidthOnScreen, malha.CorRamoLivre, true) // Ramo não posicionado: traço fino
+			posX, posY := g.worldToScreen(ramoPosicionado.X, ramoPosicionado.Y)
+			vector.StrokeLine(screen, screenX, screenY, posX, posY, screenRamo, drawColor, true)
 			screenRaio := screenDrawSizeElement 
 			if screenRaio < 1.0 { screenRaio = 1.0 }
 			vector.DrawFilledCircle(screen, screenX, screenY, screenRaio, drawColor, true)
+		case malha.ElementoViaCurva, malha.ElementoViaTransicao:
+			g.drawFaixaVia(screen, el.PolilinhaVia(), el.Espessura, el.ModoCheio, drawColor)
+		case malha.ElementoSinal:
+			g.drawSinal(screen, g.comAspectoDeRota(el), drawColor)
 		}
 	}
 
-	if g.drawingVia && !math.IsNaN(g.startX) && !math.IsNaN(g.startY) {
+	if g.drawingVia && (g.elementoAtualTipo == malha.ElementoViaCurva || g.elementoAtualTipo == malha.ElementoViaTransicao) {
+		if previa, ok := g.viaDesenhada(g.fimDesenho(g.screenToWorld(cursorX, cursorY))); ok {
+			g.drawFaixaVia(screen, previa.PolilinhaVia(), previa.Espessura, previa.ModoCheio, g.currentColor)
+		}
+	} else if g.drawingVia && !math.IsNaN(g.startX) && !math.IsNaN(g.startY) {
 		startScreenX, startScreenY := g.worldToScreen(g.startX, g.startY)
-		endScreenX, endScreenY := float32(cursorX), float32(cursorY)
+		endScreenX, endScreenY := g.worldToScreen(g.fimDesenho(g.screenToWorld(cursorX, cursorY)))
 		
 		screenThicknessTemp := float32(g.thickness * g.cameraZoom)
 		if screenThicknessTemp < 1.0 { screenThicknessTemp = 1.0 }
@@ -485,18 +1036,30 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		}
 	}
 
+	g.drawSimulacao(screen)
+	g.drawRotas(screen)
+	g.drawMedicao(screen)
+	g.drawSnapIndicator(screen)
+	g.drawSelecao(screen, cursorX, cursorY)
+	g.drawInspetor(screen)
+	g.drawProblemas(screen)
+
 	if g.popupVisible { drawPopupX, drawPopupY := g.calculatePopupDrawPosition(); popupDrawHeight := 0; if len(g.popupOptions) > 0 { maxYRel := 0; for _, opt := range g.popupOptions { relY := opt.Rect.Max.Y - g.popupY; if relY > maxYRel { maxYRel = relY } }; popupDrawHeight = maxYRel + popupPadding }; if popupDrawHeight > 0 { vector.DrawFilledRect(screen, float32(drawPopupX), float32(drawPopupY), float32(popupWidth), float32(popupDrawHeight), color.RGBA{R:50,G:50,B:50,A:220}, false) }; offsetX := drawPopupX - g.popupX; offsetY := drawPopupY - g.popupY; for _, option := range g.popupOptions { optionDrawRect := option.Rect.Add(image.Pt(offsetX, offsetY)); if option.Color != nil { vector.DrawFilledRect(screen, float32(optionDrawRect.Min.X), float32(optionDrawRect.Min.Y), float32(optionDrawRect.Dx()), float32(optionDrawRect.Dy()), *option.Color, false); vector.StrokeRect(screen, float32(optionDrawRect.Min.X), float32(optionDrawRect.Min.Y), float32(optionDrawRect.Dx()), float32(optionDrawRect.Dy()), 1, color.White, false) }; if option.Label != "" { tb := text.BoundString(g.helpTextFace, option.Label); tx := optionDrawRect.Min.X + (optionDrawRect.Dx()-tb.Dx())/2; ty := optionDrawRect.Min.Y + (optionDrawRect.Dy()+tb.Dy())/2 - 2; text.Draw(screen, option.Label, g.helpTextFace, tx, ty, color.White) } } }
 
 	elementTypeStr := ""
 	switch g.elementoAtualTipo {
-	case ElementoViaReta: elementTypeStr = "Via Reta[T]"
-	case ElementoCircuitoVia: elementTypeStr = "Circ.Via[I]"
-	case ElementoChaveSimples: elementTypeStr = "Chave[K]"
+	case malha.ElementoViaReta: elementTypeStr = "Via Reta[T]"
+	case malha.ElementoCircuitoVia: elementTypeStr = "Circ.Via[I]"
+	case malha.ElementoChaveSimples: elementTypeStr = "Chave[K]"
+	case malha.ElementoSinal: elementTypeStr = "Sinal[N]"
+	case malha.ElementoViaCurva: elementTypeStr = "Via Curva[A]"
+	case malha.ElementoViaTransicao: elementTypeStr = "Via Transicao[Shift+A]"
 	default: elementTypeStr = "Desconhecido"
 	}
 	viaModeStr:="Vazada"; if g.viaCheiaDefault{viaModeStr="Cheia"}
-	metersPerScreenPixel := (1.0/pixelsPerMeter)/g.cameraZoom
-	statusText := fmt.Sprintf("Cam:%.0f,%.0f(Z:%.2fx)|Esc:1px=%.1fm|Tipo:%s|Via[V]:%s\nFundo[F2-4]|Scroll[Setas]|+/-:BitolaVR(%.0f WU)|S/L:Arq|C:Limpar|ESC:Sair",g.cameraOffsetX,g.cameraOffsetY,g.cameraZoom,metersPerScreenPixel,elementTypeStr,viaModeStr,g.thickness)
+	metersPerScreenPixel := (1.0/malha.PixelsPerMeter)/g.cameraZoom
+	gradeStr := "Off"; if g.gradeVisivel { gradeStr = formatarNumero(passoGradeMetros(g.cameraZoom)) + "m"; if !g.snapGrade { gradeStr += " sem snap" } }
+	statusText := fmt.Sprintf("Cam:%.0f,%.0f(Z:%.2fx)|Esc:1px=%.1fm|Tipo:%s|Via[V]:%s|Nos:%d Comp.Conexas:%d Secoes:%d|Visiveis:%d/%d|Grade[G]:%s|Problemas[E]:%dE/%dA|%s\nFundo[F2-4]|Scroll[Setas]|+/-:BitolaVR(%.0f WU)|S/L:Arq|C:Limpar|ESC:Sair",g.cameraOffsetX,g.cameraOffsetY,g.cameraZoom,metersPerScreenPixel,elementTypeStr,viaModeStr,len(g.topologia.Nos),len(g.topologia.ConnectedComponents()),len(g.secoes.Lista),g.visiveis,len(g.elementos),gradeStr,malha.ContarErros(g.problemas),len(g.problemas)-malha.ContarErros(g.problemas),map[bool]string{true: "*Nao salvo", false: "Salvo"}[g.modificado],g.thickness)
 	ebitenutil.DebugPrint(screen,statusText) // Usa a fonte padrão do DebugPrint
 
 	if g.showHelp {
@@ -512,14 +1075,49 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		}
 
 
-		for _, line := range lines {
-			text.Draw(screen, line, g.helpTextFace, helpTextPadding, currentY, color.White)
-			currentY += lineHeight
+		porColuna := max(1, (g.screenHeight-helpTextPadding)/lineHeight) // Ajuda maior que a tela: continua numa segunda coluna
+		for i, line := range lines {
+			coluna := i / porColuna
+			text.Draw(screen, line, g.helpTextFace, helpTextPadding+coluna*g.screenWidth/2, currentY+(i%porColuna)*lineHeight, color.White)
 		}
 	}
 }
 
-// Layout
+// drawSinal desenha o mastro e o cabeçote do sinal com a lâmpada do aspecto acesa.
+func (g *Game) drawSinal(screen *ebiten.Image, el malha.Elemento, drawColor color.RGBA) {
+	base, cabecote, lampadas := el.GeometriaSinal()
+	baseX, baseY := g.worldToScreen(base.X, base.Y)
+	cabX, cabY := g.worldToScreen(cabecote.X, cabecote.Y)
+	traco := float32(railStrokeWidth * g.cameraZoom)
+	if traco < 1.0 { traco = 1.0 }
+	vector.StrokeLine(screen, baseX, baseY, cabX, cabY, traco, drawColor, true) // Mastro
+	tipo := el.TipoSinalAtual()
+	raioLampada := float32(el.Espessura * g.cameraZoom)
+	if tipo == malha.SinalManobra { raioLampada *= 0.75 }
+	if raioLampada < 1.5 { raioLampada = 1.5 }
+	if tipo == malha.SinalDistante { // Sinal distante: barra transversal no meio do mastro
+		rad := el.Rotacao * math.Pi / 180
+		meio := malha.Ponto{X: (base.X + cabecote.X) / 2, Y: (base.Y + cabecote.Y) / 2}
+		meia := el.Espessura
+		ax, ay := g.worldToScreen(meio.X-math.Cos(rad)*meia, meio.Y-math.Sin(rad)*meia)
+		bx, by := g.worldToScreen(meio.X+math.Cos(rad)*meia, meio.Y+math.Sin(rad)*meia)
+		vector.StrokeLine(screen, ax, ay, bx, by, traco, drawColor, true)
+	}
+	ultima := lampadas[len(lampadas)-1]
+	ultX, ultY := g.worldToScreen(ultima.X, ultima.Y)
+	vector.StrokeLine(screen, cabX, cabY, ultX, ultY, raioLampada*2.6, malha.CorCabecoteSinal, true) // Caixa do cabeçote
+	vector.DrawFilledCircle(screen, ultX, ultY, raioLampada*1.3, malha.CorCabecoteSinal, true)
+	acesa, piscante := malha.CorLampada(el.Aspecto)
+	apagadaAgora := piscante && (time.Now().UnixMilli()/500)%2 == 1
+	for k, cor := range malha.LampadasSinal(tipo) {
+		lx, ly := g.worldToScreen(lampadas[k].X, lampadas[k].Y)
+		preenchimento := malha.CorLampadaApagada
+		if cor == acesa && !apagadaAgora { preenchimento = malha.CorAspecto[cor] }
+		vector.DrawFilledCircle(screen, lx, ly, raioLampada, preenchimento, true)
+		vector.StrokeCircle(screen, lx, ly, raioLampada, 1, drawColor, true)
+	}
+}
+
 func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
 	logf("Layout START: oldW=%d, oldH=%d, newW=%d, newH=%d", g.screenWidth, g.screenHeight, outsideWidth, outsideHeight)
 	logf("Layout START: oldCamX=%.2f, oldCamY=%.2f", g.cameraOffsetX, g.cameraOffsetY)
@@ -569,10 +1167,16 @@ func drawThickLine(screen *ebiten.Image, whitePixel *ebiten.Image, x1, y1, x2, y
 
 // main
 func main() {
+	editor, codigo, abrirJanela := executarCLI(os.Args[1:], os.Stdout, os.Stderr)
+	if !abrirJanela { os.Exit(codigo) }
 	gameInstance := NewGame()
+	gameInstance.historico.Limite = editor.Historico
 	ebiten.SetWindowSize(gameInstance.screenWidth, gameInstance.screenHeight)
 	ebiten.SetWindowTitle("Editor de Vias (v9.17.11 - Help Text Spacing Increased)") // Version increment
 	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
+	ebiten.SetWindowClosingHandled(true) // Confirma antes de perder alterações não salvas
+	gameInstance.oferecerRecuperacao()
+	if editor.Arquivo != "" { gameInstance.abrirArquivo(editor.Arquivo) }
 	logln("Iniciando loop...")
 	if err := ebiten.RunGame(gameInstance); err != nil {
 		if err != ebiten.Termination { logf("Erro fatal: %v", err) } else { logln("Jogo terminado.") }
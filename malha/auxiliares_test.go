@@ -0,0 +1,85 @@
+package malha
+
+import (
+	"math"
+	"testing"
+)
+
+// --- Montagem de Malhas para os Testes ---
+// Coordenadas em Unid. Mundo e comprimentos em metros, como no editor
+// (1 Unid. Mundo = 100 m com PixelsPerMeter = 0.01).
+
+func viaReta(id int, x, y, comprimento, rotacao float64) Elemento {
+	return Elemento{Tipo: ElementoViaReta, ID: id, X: x, Y: y, Comprimento: comprimento, Rotacao: rotacao, Espessura: 2}
+}
+
+func viaCurva(id int, x, y, rotacao, raio, varredura float64) Elemento {
+	return Elemento{Tipo: ElementoViaCurva, ID: id, X: x, Y: y, Rotacao: rotacao, Raio: raio, Varredura: varredura, Comprimento: ComprimentoArco(raio, varredura), Espessura: 2}
+}
+
+// viaTransicao monta uma clotoide; lado é 1 (à direita) ou -1 (à esquerda).
+func viaTransicao(id int, x, y, rotacao, comprimento, raioInicial, raio, lado float64) Elemento {
+	return Elemento{Tipo: ElementoViaTransicao, ID: id, X: x, Y: y, Rotacao: rotacao, Comprimento: comprimento, RaioInicial: raioInicial, Raio: raio,
+		Varredura: lado * VarreduraTransicao(comprimento, raioInicial, raio), Espessura: 2}
+}
+
+func chave(id int, x, y, rotacao, comprimento float64, posicao, nome string) Elemento {
+	return Elemento{Tipo: ElementoChaveSimples, ID: id, X: x, Y: y, Rotacao: rotacao, Comprimento: comprimento, AnguloDesvio: 20, Largura: ChaveBitolaPadrao, PosicaoChave: posicao, Nome: nome}
+}
+
+func sinal(id, viaID int, distancia float64, sentido, nome string) Elemento {
+	return Elemento{Tipo: ElementoSinal, ID: id, ViaID: viaID, Distancia: distancia, Sentido: sentido, TipoSinal: SinalPrincipal, Nome: nome}
+}
+
+func circuito(id int, x, y float64) Elemento {
+	return Elemento{Tipo: ElementoCircuitoVia, ID: id, X: x, Y: y, Largura: 0.3, Espessura: 0.03, OrientacaoTC: "Normal"}
+}
+
+// elementoPorID devolve o elemento com o ID informado ou falha o teste.
+func elementoPorID(t *testing.T, elementos []Elemento, id int) Elemento {
+	t.Helper()
+	for _, el := range elementos {
+		if el.ID == id {
+			return el
+		}
+	}
+	t.Fatalf("elemento ID %d não encontrado", id)
+	return Elemento{}
+}
+
+// perto compara medidas com a tolerância dos testes.
+func perto(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+// pertoPonto compara pontos com a tolerância dos testes.
+func pertoPonto(a, b Ponto) bool {
+	return perto(a.X, b.X) && perto(a.Y, b.Y)
+}
+
+// malhaTravessao monta duas linhas paralelas ligadas por um travessão de duas
+// chaves: W1 (5) na linha de baixo, W2 (6) na de cima, com os ramos reversos
+// encontrando-se em (59.397, 3.42). Há juntas em volta de cada chave e no
+// meio do travessão. Sinais: S1 e S7 no sentido crescente antes das chaves,
+// S2 e S3 no fim das linhas, S5 e S6 no sentido decrescente.
+func malhaTravessao() []Elemento {
+	return []Elemento{
+		viaReta(1, 0, 0, 5000, 0),
+		viaReta(2, 60, 0, 6000, 0),
+		viaReta(3, 0, 6.84, 5879.4, 0),
+		viaReta(4, 68.794, 6.84, 5120.6, 0),
+		chave(5, 50, 0, 0, 1000, PosicaoNormal, "W1"),
+		chave(6, 68.794, 6.84, 180, 1000, PosicaoNormal, "W2"),
+		sinal(10, 1, 4900, SentidoCrescente, "S1"),
+		sinal(11, 2, 5900, SentidoCrescente, "S2"),
+		sinal(12, 4, 5000, SentidoCrescente, "S3"),
+		sinal(13, 3, 5800, SentidoCrescente, "S7"),
+		sinal(14, 2, 100, SentidoDecrescente, "S5"),
+		sinal(15, 1, 100, SentidoDecrescente, "S6"),
+		circuito(20, 50, 0),
+		circuito(21, 60, 0),
+		circuito(22, 68.794, 6.84),
+		circuito(23, 58.794, 6.84),
+		circuito(24, 59.397, 3.42),
+	}
+}
@@ -0,0 +1,42 @@
+package malha
+
+// --- Copiar/Colar ---
+// Elementos copiados viajam como um Documento comum (o mesmo JSON do arquivo),
+// o que traz versão, escala e migrações ao colar, inclusive entre arquivos.
+
+// RenumerarElementos devolve cópias dos elementos com IDs novos e distintos a
+// partir de proxID, deslocadas de (dx, dy). Referências entre os próprios
+// elementos (ViaID de sinais, Conexoes) são traduzidas; referências a
+// elementos de fora do grupo são descartadas. Se a origem repete um ID (área
+// de transferência editada à mão), cada cópia ganha o seu e as referências
+// vão para a primeira. Devolve também o próximo ID livre.
+func RenumerarElementos(elementos []Elemento, proxID int, dx, dy float64) ([]Elemento, int) {
+	novoID := make(map[int]int, len(elementos))
+	for i, el := range elementos {
+		if _, repetido := novoID[el.ID]; !repetido {
+			novoID[el.ID] = proxID + i
+		}
+	}
+	novos := make([]Elemento, 0, len(elementos))
+	for i, el := range elementos {
+		el.ID = proxID + i
+		el.X += dx
+		el.Y += dy
+		if el.ViaID != 0 {
+			if id, ok := novoID[el.ViaID]; ok {
+				el.ViaID = id
+			} else {
+				el.ViaID, el.Distancia = 0, 0
+			}
+		}
+		var conexoes []int
+		for _, c := range el.Conexoes {
+			if id, ok := novoID[c]; ok {
+				conexoes = append(conexoes, id)
+			}
+		}
+		el.Conexoes = conexoes
+		novos = append(novos, el)
+	}
+	return novos, proxID + len(elementos)
+}
@@ -0,0 +1,46 @@
+package malha
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRenumerarElementos(t *testing.T) {
+	via := viaReta(3, 0, 0, 1000, 0)
+	via.Conexoes = []int{4, 99}
+	outra := viaReta(4, 10, 0, 1000, 0)
+	outra.Conexoes = []int{3}
+	elementos := []Elemento{
+		via,
+		outra,
+		sinal(7, 3, 500, SentidoCrescente, "S1"),
+		sinal(8, 50, 500, SentidoCrescente, "S2"), // Via fora do grupo
+		circuito(3, 5, 0),                         // ID repetido
+	}
+	novos, prox := RenumerarElementos(elementos, 20, 1, -2)
+	if prox != 25 {
+		t.Errorf("próximo ID = %d, quer 25", prox)
+	}
+	ids := make([]int, len(novos))
+	for i, el := range novos {
+		ids[i] = el.ID
+		if el.X != elementos[i].X+1 || el.Y != elementos[i].Y-2 {
+			t.Errorf("elemento %d em (%v, %v), quer deslocado de (1, -2)", el.ID, el.X, el.Y)
+		}
+	}
+	if !slices.Equal(ids, []int{20, 21, 22, 23, 24}) {
+		t.Errorf("IDs = %v, quer [20 21 22 23 24]", ids)
+	}
+	if !slices.Equal(novos[0].Conexoes, []int{21}) || !slices.Equal(novos[1].Conexoes, []int{20}) {
+		t.Errorf("conexões = %v e %v, quer [21] e [20]", novos[0].Conexoes, novos[1].Conexoes)
+	}
+	if novos[2].ViaID != 20 || novos[2].Distancia != 500 {
+		t.Errorf("sinal preso à via %d a %v m, quer via 20 a 500 m", novos[2].ViaID, novos[2].Distancia)
+	}
+	if novos[3].ViaID != 0 || novos[3].Distancia != 0 {
+		t.Errorf("sinal de via fora do grupo preso à via %d a %v m, quer solto", novos[3].ViaID, novos[3].Distancia)
+	}
+	if elementos[0].ID != 3 || !slices.Equal(elementos[0].Conexoes, []int{4, 99}) {
+		t.Errorf("RenumerarElementos alterou a origem: %+v", elementos[0])
+	}
+}
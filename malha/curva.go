@@ -0,0 +1,136 @@
+package malha
+
+import "math"
+
+// --- Vias Curvas ---
+// Uma ViaCurva é um arco de circunferência que parte de (X, Y) com rumo
+// Rotacao, raio Raio (metros) e Varredura graus (positivo = curva para a
+// direita, com o rumo crescendo). Comprimento é derivado: Raio × |Varredura|.
+
+const (
+	CurvaVarreduraMinima = 0.5   // Graus; abaixo disso o traçado é tratado como reta
+	CurvaVarreduraMaxima = 359.0 // Graus
+	curvaPassoGraus      = 5.0   // Resolução da polilinha usada para desenho
+)
+
+// ComprimentoArco devolve o comprimento (metros) de um arco de raio (metros)
+// e varredura (graus).
+func ComprimentoArco(raio, varredura float64) float64 {
+	return raio * math.Abs(varredura) * math.Pi / 180.0
+}
+
+// EhVia indica se o tipo é um trecho de via corrida (reta, curva ou transição).
+func (t ElementType) EhVia() bool {
+	return t == ElementoViaReta || t == ElementoViaCurva || t == ElementoViaTransicao
+}
+
+// ehArco indica se o elemento deve ser tratado como arco (curva com raio válido).
+func (el Elemento) ehArco() bool {
+	return el.Tipo == ElementoViaCurva && el.Raio > 0 && math.Abs(el.Varredura) >= CurvaVarreduraMinima
+}
+
+// centroCurva devolve o centro do arco, o raio (Unid. Mundo) e o ângulo polar
+// do ponto inicial em relação ao centro (radianos).
+func (el Elemento) centroCurva() (cx, cy, raio, anguloInicial float64) {
+	raio = el.Raio * PixelsPerMeter
+	rad := el.Rotacao * math.Pi / 180.0
+	lado := 1.0 // Centro à direita do rumo (eixo Y para baixo)
+	if el.Varredura < 0 {
+		lado = -1.0
+	}
+	cx = el.X - math.Sin(rad)*raio*lado
+	cy = el.Y + math.Cos(rad)*raio*lado
+	return cx, cy, raio, math.Atan2(el.Y-cy, el.X-cx)
+}
+
+// PontoNaVia devolve o ponto e o rumo (graus) na fração t ∈ [0, 1] do
+// comprimento de uma via reta, curva ou de transição.
+func (el Elemento) PontoNaVia(t float64) (Ponto, float64) {
+	if el.ehTransicao() {
+		return el.pontoTransicao(t)
+	}
+	if el.ehArco() {
+		cx, cy, raio, a0 := el.centroCurva()
+		a := a0 + el.Varredura*t*math.Pi/180.0
+		return Ponto{cx + raio*math.Cos(a), cy + raio*math.Sin(a)}, el.Rotacao + el.Varredura*t
+	}
+	comprimentoWorldUnits := el.Comprimento * PixelsPerMeter * t
+	rad := el.Rotacao * math.Pi / 180.0
+	return Ponto{el.X + comprimentoWorldUnits*math.Cos(rad), el.Y + comprimentoWorldUnits*math.Sin(rad)}, el.Rotacao
+}
+
+// PolilinhaVia devolve pontos ao longo da via: as duas extremidades para uma
+// reta, um ponto a cada curvaPassoGraus para uma curva ou transição.
+func (el Elemento) PolilinhaVia() []Ponto {
+	passos := 1
+	if el.ehArco() {
+		passos = int(math.Ceil(math.Abs(el.Varredura) / curvaPassoGraus))
+	} else if el.ehTransicao() {
+		passos = el.passosTransicao()
+	}
+	pontos := make([]Ponto, 0, passos+1)
+	for k := 0; k <= passos; k++ {
+		p, _ := el.PontoNaVia(float64(k) / float64(passos))
+		pontos = append(pontos, p)
+	}
+	return pontos
+}
+
+// ProjetarNaVia devolve o ponto da via mais próximo de (x, y) e sua fração t
+// ao longo dela.
+func ProjetarNaVia(el Elemento, x, y float64) (px, py, t float64) {
+	if el.ehTransicao() {
+		return projetarNaTransicao(el, x, y)
+	}
+	if !el.ehArco() {
+		x1, y1, x2, y2 := el.Extremidades()
+		return ClosestPointOnSegment(x, y, x1, y1, x2, y2)
+	}
+	cx, cy, _, a0 := el.centroCurva()
+	varredura := el.Varredura * math.Pi / 180.0
+	delta := math.Atan2(y-cy, x-cx) - a0
+	if varredura > 0 {
+		delta = math.Mod(delta+4*math.Pi, 2*math.Pi)
+	} else {
+		delta = -math.Mod(-delta+4*math.Pi, 2*math.Pi)
+	}
+	if t = delta / varredura; t > 1 { // Fora do arco: vale a extremidade mais próxima
+		ini, _ := el.PontoNaVia(0)
+		fim, _ := el.PontoNaVia(1)
+		if math.Hypot(x-ini.X, y-ini.Y) < math.Hypot(x-fim.X, y-fim.Y) {
+			return ini.X, ini.Y, 0
+		}
+		return fim.X, fim.Y, 1
+	}
+	p, _ := el.PontoNaVia(t)
+	return p.X, p.Y, t
+}
+
+// RumoSaindo devolve o rumo (graus) que continua a via a partir da
+// extremidade (x, y), afastando-se dela.
+func (el Elemento) RumoSaindo(x, y float64) float64 {
+	ini, rumoInicial := el.PontoNaVia(0)
+	if math.Hypot(x-ini.X, y-ini.Y) <= ToleranciaNo {
+		return rumoInicial + 180
+	}
+	_, rumoFinal := el.PontoNaVia(1)
+	return rumoFinal
+}
+
+// CurvaTangente calcula o arco que parte de (x1, y1) com o rumo dado (graus) e
+// termina em (x2, y2). Devolve raio (metros) e varredura (graus); ok é false
+// se o ponto final estiver praticamente na direção do rumo (seria uma reta) ou
+// atrás do ponto inicial.
+func CurvaTangente(x1, y1, rumo, x2, y2 float64) (raio, varredura float64, ok bool) {
+	corda := math.Hypot(x2-x1, y2-y1)
+	if corda == 0 {
+		return 0, 0, false
+	}
+	alfa := math.Mod(math.Atan2(y2-y1, x2-x1)*180/math.Pi-rumo+540, 360) - 180 // (-180, 180]
+	varredura = 2 * alfa
+	if math.Abs(varredura) < CurvaVarreduraMinima || math.Abs(varredura) > CurvaVarreduraMaxima {
+		return 0, 0, false
+	}
+	raio = corda / (2 * math.Sin(math.Abs(alfa)*math.Pi/180)) / PixelsPerMeter
+	return raio, varredura, true
+}
@@ -0,0 +1,228 @@
+package malha
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"time"
+)
+
+// --- Documento (Formato de Arquivo Versionado) ---
+// O arquivo é um envelope JSON com versão, escala e metadados. Arquivos de
+// versões anteriores (incluindo o array simples de Elemento da versão 0) são
+// atualizados na carga pela cadeia de migrações.
+
+// VersaoFormato é a versão gravada por SaveDocumento.
+const VersaoFormato = 2
+
+// Camera guarda a posição de visualização salva junto com a malha.
+type Camera struct {
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+	Zoom float64 `json:"zoom"`
+}
+
+// Documento é o conteúdo completo de um arquivo de malha.
+type Documento struct {
+	Versao         int        `json:"versao"`
+	PixelsPerMeter float64    `json:"pixelsPerMeter"`
+	Camera         Camera     `json:"camera"`
+	CorFundo       color.RGBA `json:"corFundo"`
+	Autor          string     `json:"autor,omitempty"`
+	Criado         time.Time  `json:"criado"`
+	Modificado     time.Time  `json:"modificado"`
+	Elementos      []Elemento `json:"elementos"`
+}
+
+// NewDocumento cria um documento na versão atual com os valores padrão.
+func NewDocumento(elementos []Elemento) *Documento {
+	agora := time.Now().UTC().Truncate(time.Second)
+	return &Documento{
+		Versao:         VersaoFormato,
+		PixelsPerMeter: PixelsPerMeter,
+		Camera:         Camera{Zoom: 1.0},
+		CorFundo:       color.RGBA{R: 0, G: 0, B: 0, A: 255},
+		Criado:         agora,
+		Modificado:     agora,
+		Elementos:      elementos,
+	}
+}
+
+// documentoBruto é o documento ainda não tipado, como visto pelas migrações.
+type documentoBruto map[string]json.RawMessage
+
+// migracoes[v] converte um documento da versão v para a versão v+1.
+var migracoes = []func(documentoBruto) error{
+	migrarV0ParaV1,
+	migrarV1ParaV2,
+}
+
+// migrarV0ParaV1 completa os metadados ausentes no array simples de elementos.
+func migrarV0ParaV1(doc documentoBruto) error {
+	padrao := NewDocumento(nil)
+	padrao.Criado, padrao.Modificado = time.Time{}, time.Time{}
+	for campo, valor := range map[string]any{
+		"pixelsPerMeter": padrao.PixelsPerMeter,
+		"camera":         padrao.Camera,
+		"corFundo":       padrao.CorFundo,
+		"criado":         padrao.Criado,
+		"modificado":     padrao.Modificado,
+	} {
+		if _, ok := doc[campo]; ok {
+			continue
+		}
+		raw, err := json.Marshal(valor)
+		if err != nil {
+			return err
+		}
+		doc[campo] = raw
+	}
+	return nil
+}
+
+// migrarV1ParaV2 converte as chaves antigas (apenas um círculo) no modelo com
+// ponta e ramos normal/reverso, usando os valores padrão.
+func migrarV1ParaV2(doc documentoBruto) error {
+	var elementos []map[string]any
+	if err := json.Unmarshal(doc["elementos"], &elementos); err != nil {
+		return err
+	}
+	for _, el := range elementos {
+		if tipo, _ := el["tipo"].(float64); ElementType(tipo) != ElementoChaveSimples {
+			continue
+		}
+		if comprimento, _ := el["comprimento"].(float64); comprimento <= 0 {
+			el["comprimento"] = ChaveComprimentoPadrao
+		}
+		if _, ok := el["anguloDesvio"]; !ok {
+			el["anguloDesvio"] = ChaveAnguloDesvioPadrao
+		}
+		if largura, _ := el["largura"].(float64); largura <= 0 {
+			el["largura"] = ChaveBitolaPadrao
+		}
+		if _, ok := el["posicaoChave"]; !ok {
+			el["posicaoChave"] = PosicaoNormal
+		}
+	}
+	raw, err := json.Marshal(elementos)
+	if err != nil {
+		return err
+	}
+	doc["elementos"] = raw
+	return nil
+}
+
+// SaveDocumento grava o documento como JSON indentado na versão atual.
+func SaveDocumento(w io.Writer, doc *Documento) error {
+	doc.Versao = VersaoFormato
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("codificar documento JSON: %w", err)
+	}
+	return nil
+}
+
+// LoadDocumento lê um documento de qualquer versão conhecida, aplicando as
+// migrações necessárias e convertendo a escala para PixelsPerMeter.
+func LoadDocumento(r io.Reader) (*Documento, error) {
+	dados, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	dados = bytes.TrimSpace(dados)
+	bruto := documentoBruto{}
+	if len(dados) > 0 && dados[0] == '[' {
+		bruto["versao"] = json.RawMessage("0")
+		bruto["elementos"] = dados
+	} else if err := json.Unmarshal(dados, &bruto); err != nil {
+		return nil, fmt.Errorf("decodificar documento JSON: %w", err)
+	}
+	if _, ok := bruto["elementos"]; !ok {
+		return nil, fmt.Errorf("documento sem campo 'elementos'")
+	}
+	versao := 0
+	if raw, ok := bruto["versao"]; ok {
+		if err := json.Unmarshal(raw, &versao); err != nil {
+			return nil, fmt.Errorf("campo 'versao' inválido: %w", err)
+		}
+	}
+	if versao < 0 || versao > VersaoFormato {
+		return nil, fmt.Errorf("versão de formato %d não suportada (máx. %d)", versao, VersaoFormato)
+	}
+	for ; versao < VersaoFormato; versao++ {
+		if err := migracoes[versao](bruto); err != nil {
+			return nil, fmt.Errorf("migrar versão %d -> %d: %w", versao, versao+1, err)
+		}
+		bruto["versao"] = json.RawMessage(fmt.Sprint(versao + 1))
+	}
+	normalizado, err := json.Marshal(bruto)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Documento{}
+	if err := json.Unmarshal(normalizado, doc); err != nil {
+		return nil, fmt.Errorf("decodificar documento JSON: %w", err)
+	}
+	for _, el := range doc.Elementos {
+		if !TipoValido(el.Tipo) {
+			return nil, fmt.Errorf("elemento ID %d com tipo desconhecido (%d)", el.ID, el.Tipo)
+		}
+	}
+	doc.converterEscala()
+	return doc, nil
+}
+
+// converterEscala reescala as medidas em Unid. Mundo quando o arquivo foi salvo
+// com outra relação unidades/metro. Comprimentos em metros não mudam; o zoom
+// da câmera compensa a escala, para a mesma região continuar enquadrada.
+func (doc *Documento) converterEscala() {
+	if doc.PixelsPerMeter <= 0 || doc.PixelsPerMeter == PixelsPerMeter {
+		doc.PixelsPerMeter = PixelsPerMeter
+		return
+	}
+	f := PixelsPerMeter / doc.PixelsPerMeter
+	for i := range doc.Elementos {
+		el := &doc.Elementos[i]
+		el.X *= f
+		el.Y *= f
+		el.Largura *= f
+		el.Espessura *= f
+	}
+	doc.Camera.X *= f
+	doc.Camera.Y *= f
+	if doc.Camera.Zoom > 0 {
+		doc.Camera.Zoom /= f
+	}
+	doc.PixelsPerMeter = PixelsPerMeter
+}
+
+// SaveDocumentoFile grava o documento no arquivo informado, atualizando Modificado.
+func SaveDocumentoFile(path string, doc *Documento) error {
+	doc.Modificado = time.Now().UTC().Truncate(time.Second)
+	if doc.Criado.IsZero() {
+		doc.Criado = doc.Modificado
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := SaveDocumento(file, doc); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// LoadDocumentoFile lê o documento do arquivo informado.
+func LoadDocumentoFile(path string) (*Documento, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return LoadDocumento(file)
+}
@@ -0,0 +1,123 @@
+package malha
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadDocumentoMigracoes(t *testing.T) {
+	for _, tc := range []struct {
+		nome    string
+		arquivo string
+		camera  Camera
+		via     Elemento // Elemento ID 1 esperado após a carga
+		chave   Elemento // Elemento ID 2 esperado após a carga
+	}{
+		{
+			nome: "v0 array simples",
+			arquivo: `[
+				{"tipo": 0, "id": 1, "x": 10, "y": 20, "comprimento": 1500, "rotacao": 30, "espessura": 2},
+				{"tipo": 2, "id": 2, "x": 5, "y": 5, "largura": 0, "espessura": 1}
+			]`,
+			camera: Camera{Zoom: 1},
+			via:    Elemento{Tipo: ElementoViaReta, ID: 1, X: 10, Y: 20, Comprimento: 1500, Rotacao: 30, Espessura: 2},
+			chave:  Elemento{Tipo: ElementoChaveSimples, ID: 2, X: 5, Y: 5, Comprimento: ChaveComprimentoPadrao, AnguloDesvio: ChaveAnguloDesvioPadrao, Largura: ChaveBitolaPadrao, PosicaoChave: PosicaoNormal, Espessura: 1},
+		},
+		{
+			nome: "v1 envelope",
+			arquivo: `{"versao": 1, "pixelsPerMeter": 0.01, "camera": {"x": 3, "y": 4, "zoom": 2.5}, "autor": "Ana",
+				"elementos": [
+					{"tipo": 0, "id": 1, "x": 10, "y": 20, "comprimento": 1500, "rotacao": 30, "espessura": 2, "nome": "Linha 1"},
+					{"tipo": 2, "id": 2, "x": 5, "y": 5, "comprimento": 800, "anguloDesvio": 12, "largura": 6, "posicaoChave": "Reversa", "espessura": 1}
+				]}`,
+			camera: Camera{X: 3, Y: 4, Zoom: 2.5},
+			via:    Elemento{Tipo: ElementoViaReta, ID: 1, X: 10, Y: 20, Comprimento: 1500, Rotacao: 30, Espessura: 2, Nome: "Linha 1"},
+			chave:  Elemento{Tipo: ElementoChaveSimples, ID: 2, X: 5, Y: 5, Comprimento: 800, AnguloDesvio: 12, Largura: 6, PosicaoChave: PosicaoReversa, Espessura: 1},
+		},
+		{
+			// Escala antiga: medidas em Unid. Mundo são convertidas, metros não; o
+			// zoom compensa, mantendo o enquadramento.
+			nome: "v1 com outra escala",
+			arquivo: `{"versao": 1, "pixelsPerMeter": 0.02, "camera": {"x": 30, "y": 40, "zoom": 1.5},
+				"elementos": [
+					{"tipo": 0, "id": 1, "x": 10, "y": 20, "comprimento": 1500, "rotacao": 30, "espessura": 2},
+					{"tipo": 2, "id": 2, "x": 5, "y": 5, "comprimento": 800, "anguloDesvio": 12, "largura": 6, "espessura": 1}
+				]}`,
+			camera: Camera{X: 15, Y: 20, Zoom: 3},
+			via:    Elemento{Tipo: ElementoViaReta, ID: 1, X: 5, Y: 10, Comprimento: 1500, Rotacao: 30, Espessura: 1},
+			chave:  Elemento{Tipo: ElementoChaveSimples, ID: 2, X: 2.5, Y: 2.5, Comprimento: 800, AnguloDesvio: 12, Largura: 3, PosicaoChave: PosicaoNormal, Espessura: 0.5},
+		},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			doc, err := LoadDocumento(strings.NewReader(tc.arquivo))
+			if err != nil {
+				t.Fatalf("LoadDocumento: %v", err)
+			}
+			if doc.Versao != VersaoFormato || doc.PixelsPerMeter != PixelsPerMeter {
+				t.Errorf("versão/escala = %d/%g, quer %d/%g", doc.Versao, doc.PixelsPerMeter, VersaoFormato, PixelsPerMeter)
+			}
+			if doc.Camera != tc.camera {
+				t.Errorf("câmera = %+v, quer %+v", doc.Camera, tc.camera)
+			}
+			if len(doc.Elementos) != 2 {
+				t.Fatalf("elementos = %d, quer 2", len(doc.Elementos))
+			}
+			for _, quer := range []Elemento{tc.via, tc.chave} {
+				if got := elementoPorID(t, doc.Elementos, quer.ID); fmt.Sprintf("%+v", got) != fmt.Sprintf("%+v", quer) {
+					t.Errorf("elemento %d =\n%+v\nquer\n%+v", quer.ID, got, quer)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveLoadDocumento(t *testing.T) {
+	elementos := []Elemento{
+		viaReta(1, 0, 0, 1000, 0),
+		viaCurva(2, 10, 0, 0, 1000, 90),
+		chave(3, 0, 50, 0, 1000, PosicaoReversa, "W1"),
+		sinal(4, 1, 500, SentidoDecrescente, "S1"),
+		circuito(5, 10, 0),
+	}
+	doc := NewDocumento(elementos)
+	doc.Camera = Camera{X: 12.5, Y: -3, Zoom: 4}
+	doc.Autor = "Ana"
+	doc.Criado = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	doc.Versao = 0 // SaveDocumento grava sempre a versão atual
+
+	var buf bytes.Buffer
+	if err := SaveDocumento(&buf, doc); err != nil {
+		t.Fatalf("SaveDocumento: %v", err)
+	}
+	lido, err := LoadDocumento(&buf)
+	if err != nil {
+		t.Fatalf("LoadDocumento: %v", err)
+	}
+	if lido.Versao != VersaoFormato || lido.Camera != doc.Camera || lido.Autor != doc.Autor || !lido.Criado.Equal(doc.Criado) || !lido.Modificado.Equal(doc.Modificado) || lido.CorFundo != doc.CorFundo {
+		t.Errorf("metadados =\n%+v\nquer\n%+v", *lido, *doc)
+	}
+	if fmt.Sprintf("%+v", lido.Elementos) != fmt.Sprintf("%+v", elementos) {
+		t.Errorf("elementos =\n%+v\nquer\n%+v", lido.Elementos, elementos)
+	}
+}
+
+func TestLoadDocumentoInvalido(t *testing.T) {
+	for _, tc := range []struct {
+		nome, arquivo, erro string
+	}{
+		{"versão mais nova", fmt.Sprintf(`{"versao": %d, "elementos": []}`, VersaoFormato+1), "não suportada"},
+		{"versão negativa", `{"versao": -1, "elementos": []}`, "não suportada"},
+		{"sem elementos", `{"versao": 2}`, "sem campo 'elementos'"},
+		{"tipo desconhecido", `[{"tipo": 99, "id": 7}]`, "tipo desconhecido"},
+		{"JSON inválido", `{"versao": `, "decodificar"},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			if _, err := LoadDocumento(strings.NewReader(tc.arquivo)); err == nil || !strings.Contains(err.Error(), tc.erro) {
+				t.Errorf("LoadDocumento = %v, quer erro com %q", err, tc.erro)
+			}
+		})
+	}
+}
@@ -0,0 +1,500 @@
+package malha
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --- DXF (Importação e Exportação) ---
+// A troca com CAD usa o eixo das vias. Na exportação (DXF R12, ASCII), vias
+// retas e ramos de chave viram LINE, vias curvas viram ARC, transições a sua
+// polilinha em LINE (o DXF não tem clotoide), circuitos de via o glifo em
+// duas LINE e sinais um CIRCLE na base, em camadas TIPO_RRGGBB (uma por tipo
+// e cor). Na importação, LINE e os trechos retos de
+// LWPOLYLINE viram ViaReta; ARC e trechos com bulge viram ViaCurva. Camadas
+// gravadas pelo próprio editor são reconhecidas: os pares de LINE de CHAVE
+// voltam a ser chaves e os glifos de CIRCUITO_VIA e SINAL são ignorados; as
+// LINE de VIA_TRANSICAO voltam como retas encadeadas. O
+// DXF tem o eixo Y para cima; as coordenadas são espelhadas em Y nos dois
+// sentidos.
+
+// OpcoesDXF define a escala e o filtro de camada da troca DXF.
+type OpcoesDXF struct {
+	MetrosPorUnidade float64    // Metros por unidade do desenho (0: $INSUNITS do arquivo, ou metros)
+	Camada           string     // Importação: só entidades desta camada (vazio: todas)
+	Espessura        float64    // Importação: bitola das vias criadas (Unid. Mundo)
+	CorPadrao        color.RGBA // Importação: cor de entidades sem cor própria
+}
+
+// metrosPorINSUNITS converte os códigos de $INSUNITS mais comuns.
+var metrosPorINSUNITS = map[int]float64{1: 0.0254, 2: 0.3048, 4: 0.001, 5: 0.01, 6: 1, 7: 1000}
+
+// coresACI são as cores básicas do AutoCAD Color Index.
+var coresACI = map[int]color.RGBA{
+	1: {R: 255, A: 255}, 2: {R: 255, G: 255, A: 255}, 3: {G: 255, A: 255}, 4: {G: 255, B: 255, A: 255},
+	5: {B: 255, A: 255}, 6: {R: 255, B: 255, A: 255}, 7: {R: 255, G: 255, B: 255, A: 255},
+	8: {R: 128, G: 128, B: 128, A: 255}, 9: {R: 192, G: 192, B: 192, A: 255},
+}
+
+// aciMaisProxima devolve o índice ACI básico mais próximo da cor.
+func aciMaisProxima(c color.RGBA) int {
+	melhor, melhorDist := 7, math.MaxFloat64
+	for aci := 1; aci <= 9; aci++ {
+		r := coresACI[aci]
+		d := math.Pow(float64(r.R)-float64(c.R), 2) + math.Pow(float64(r.G)-float64(c.G), 2) + math.Pow(float64(r.B)-float64(c.B), 2)
+		if d < melhorDist {
+			melhor, melhorDist = aci, d
+		}
+	}
+	return melhor
+}
+
+// --- Exportação ---
+
+var prefixoCamadaDXF = map[ElementType]string{
+	ElementoViaReta: "VIA_RETA", ElementoViaCurva: "VIA_CURVA", ElementoViaTransicao: "VIA_TRANSICAO", ElementoChaveSimples: "CHAVE",
+	ElementoCircuitoVia: "CIRCUITO_VIA", ElementoSinal: "SINAL",
+}
+
+func camadaDXF(el Elemento) string {
+	return fmt.Sprintf("%s_%02X%02X%02X", prefixoCamadaDXF[el.Tipo], el.Cor.R, el.Cor.G, el.Cor.B)
+}
+
+// tipoDaCamadaDXF reconhece uma camada no formato de camadaDXF.
+func tipoDaCamadaDXF(camada string) (ElementType, bool) {
+	for tipo, prefixo := range prefixoCamadaDXF {
+		cor, ok := strings.CutPrefix(strings.ToUpper(camada), prefixo+"_")
+		if _, err := strconv.ParseUint(cor, 16, 32); ok && len(cor) == 6 && err == nil {
+			return tipo, true
+		}
+	}
+	return 0, false
+}
+
+// escritorDXF grava pares código/valor.
+type escritorDXF struct {
+	w      *bufio.Writer
+	escala float64 // Unidades do desenho por Unid. Mundo
+}
+
+func (e *escritorDXF) par(codigo int, valor any) {
+	if v, ok := valor.(float64); ok {
+		valor = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	fmt.Fprintf(e.w, "%d\n%v\n", codigo, valor)
+}
+
+// ponto grava as coordenadas de p (Unid. Mundo) nos códigos x e x+10.
+func (e *escritorDXF) ponto(codigo int, p Ponto) {
+	e.par(codigo, p.X*e.escala)
+	e.par(codigo+10, -p.Y*e.escala)
+}
+
+func (e *escritorDXF) linha(camada string, a, b Ponto) {
+	e.par(0, "LINE")
+	e.par(8, camada)
+	e.ponto(10, a)
+	e.ponto(11, b)
+}
+
+// ExportarDXF grava o eixo da malha como DXF R12.
+func ExportarDXF(w io.Writer, elementos []Elemento, op OpcoesDXF) error {
+	mpu := op.MetrosPorUnidade
+	if mpu <= 0 {
+		mpu = 1
+	}
+	e := &escritorDXF{w: bufio.NewWriter(w), escala: 1 / PixelsPerMeter / mpu}
+	camadas := map[string]int{}
+	for _, el := range elementos {
+		if _, ok := prefixoCamadaDXF[el.Tipo]; ok {
+			camadas[camadaDXF(el)] = aciMaisProxima(el.Cor)
+		}
+	}
+	nomes := make([]string, 0, len(camadas))
+	for nome := range camadas {
+		nomes = append(nomes, nome)
+	}
+	sort.Strings(nomes)
+
+	e.par(0, "SECTION")
+	e.par(2, "HEADER")
+	e.par(9, "$ACADVER")
+	e.par(1, "AC1009")
+	e.par(0, "ENDSEC")
+	e.par(0, "SECTION")
+	e.par(2, "TABLES")
+	e.par(0, "TABLE")
+	e.par(2, "LTYPE")
+	e.par(70, 1)
+	e.par(0, "LTYPE")
+	e.par(2, "CONTINUOUS")
+	e.par(70, 0)
+	e.par(3, "Solid line")
+	e.par(72, 65)
+	e.par(73, 0)
+	e.par(40, 0.0)
+	e.par(0, "ENDTAB")
+	e.par(0, "TABLE")
+	e.par(2, "LAYER")
+	e.par(70, len(nomes))
+	for _, nome := range nomes {
+		e.par(0, "LAYER")
+		e.par(2, nome)
+		e.par(70, 0)
+		e.par(62, camadas[nome])
+		e.par(6, "CONTINUOUS")
+	}
+	e.par(0, "ENDTAB")
+	e.par(0, "ENDSEC")
+
+	e.par(0, "SECTION")
+	e.par(2, "ENTITIES")
+	for _, el := range elementos {
+		camada := camadaDXF(el)
+		switch el.Tipo {
+		case ElementoViaReta:
+			x1, y1, x2, y2 := el.Extremidades()
+			e.linha(camada, Ponto{x1, y1}, Ponto{x2, y2})
+		case ElementoViaCurva:
+			if !el.ehArco() {
+				x1, y1, x2, y2 := el.Extremidades()
+				e.linha(camada, Ponto{x1, y1}, Ponto{x2, y2})
+				continue
+			}
+			cx, cy, raio, a0 := el.centroCurva()
+			// Rumo crescente gira no sentido horário com Y para cima; o ARC é anti-horário
+			ini := -a0 * 180 / math.Pi
+			fim := ini - el.Varredura
+			if el.Varredura < 0 {
+				ini, fim = fim, ini
+			}
+			e.par(0, "ARC")
+			e.par(8, camada)
+			e.ponto(10, Ponto{cx, cy})
+			e.par(40, raio*e.escala)
+			e.par(50, math.Mod(fim+720, 360))
+			e.par(51, math.Mod(ini+720, 360))
+		case ElementoViaTransicao:
+			pontos := el.PolilinhaVia()
+			for k := 1; k < len(pontos); k++ {
+				e.linha(camada, pontos[k-1], pontos[k])
+			}
+		case ElementoChaveSimples:
+			ponta, normal, reversa := el.PontasChave()
+			e.linha(camada, ponta, normal)
+			e.linha(camada, ponta, reversa)
+		case ElementoCircuitoVia:
+			haste := el.Largura / 2
+			if el.OrientacaoTC == "Invertido" {
+				haste = -haste
+			}
+			e.linha(camada, Ponto{el.X, el.Y - el.Largura/2}, Ponto{el.X, el.Y + el.Largura/2})
+			e.linha(camada, Ponto{el.X, el.Y}, Ponto{el.X + haste, el.Y})
+		case ElementoSinal: // Mastro da base ao cabeçote e um círculo por lâmpada
+			raio := el.Espessura
+			if raio <= 0 {
+				raio = SinalRaioLampadaPadrao
+			}
+			base, cabecote, lampadas := el.GeometriaSinal()
+			e.linha(camada, base, cabecote)
+			for _, l := range lampadas {
+				e.par(0, "CIRCLE")
+				e.par(8, camada)
+				e.ponto(10, l)
+				e.par(40, raio*e.escala)
+			}
+		}
+	}
+	e.par(0, "ENDSEC")
+	e.par(0, "EOF")
+	return e.w.Flush()
+}
+
+// --- Importação ---
+
+// parDXF é um par código de grupo / valor.
+type parDXF struct {
+	codigo int
+	valor  string
+}
+
+// entidadeDXF é um registro iniciado por um código 0 (entidade, camada, ...).
+type entidadeDXF struct {
+	tipo  string
+	pares []parDXF
+}
+
+// num devolve o primeiro valor numérico do código, ou padrao se ausente.
+func (en entidadeDXF) num(codigo int, padrao float64) float64 {
+	for _, p := range en.pares {
+		if p.codigo == codigo {
+			if v, err := strconv.ParseFloat(p.valor, 64); err == nil {
+				return v
+			}
+		}
+	}
+	return padrao
+}
+
+func (en entidadeDXF) texto(codigo int) string {
+	for _, p := range en.pares {
+		if p.codigo == codigo {
+			return p.valor
+		}
+	}
+	return ""
+}
+
+// lerSecoesDXF lê um DXF ASCII e devolve os registros de cada seção pelo nome
+// (HEADER, TABLES, ENTITIES...).
+func lerSecoesDXF(r io.Reader) (map[string][]entidadeDXF, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	secoes := map[string][]entidadeDXF{}
+	secao := ""
+	var atual *entidadeDXF
+	fechar := func() {
+		if atual != nil && secao != "" {
+			secoes[secao] = append(secoes[secao], *atual)
+		}
+		atual = nil
+	}
+	for linha := 1; sc.Scan(); linha += 2 {
+		textoCodigo := strings.TrimPrefix(strings.TrimSpace(sc.Text()), "\ufeff")
+		if !sc.Scan() {
+			return nil, fmt.Errorf("linha %d: código de grupo sem valor", linha)
+		}
+		codigo, err := strconv.Atoi(textoCodigo)
+		if err != nil {
+			return nil, fmt.Errorf("linha %d: código de grupo '%s' inválido (só DXF ASCII é suportado)", linha, textoCodigo)
+		}
+		valor := strings.TrimSpace(sc.Text())
+		switch {
+		case codigo == 0 && valor == "EOF":
+			fechar()
+			return secoes, nil
+		case codigo == 0 && valor == "ENDSEC":
+			fechar()
+			secao = ""
+		case codigo == 0 && valor == "SECTION":
+			fechar()
+			secao = "?"
+		case codigo == 2 && secao == "?":
+			secao = valor
+		case codigo == 0:
+			fechar()
+			atual = &entidadeDXF{tipo: valor}
+		case codigo == 9 && secao == "HEADER": // Variáveis do cabeçalho viram registros próprios
+			fechar()
+			atual = &entidadeDXF{tipo: valor}
+		case atual != nil:
+			atual.pares = append(atual.pares, parDXF{codigo, valor})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	fechar()
+	return secoes, nil
+}
+
+// importadorDXF converte entidades em vias, acumulando-as em elementos.
+type importadorDXF struct {
+	escala      float64 // Unid. Mundo por unidade do desenho
+	op          OpcoesDXF
+	coresCamada map[string]color.RGBA
+	proxID      int
+	elementos   []Elemento
+	ignoradas   int
+	ramo        []Ponto // Primeiro ramo (ponta, fim) de uma chave à espera do segundo
+	corRamo     color.RGBA
+}
+
+// mundo converte um ponto do desenho (Y para cima) em Unid. Mundo.
+func (im *importadorDXF) mundo(x, y float64) Ponto {
+	return Ponto{x * im.escala, -y * im.escala}
+}
+
+// cor resolve a cor da entidade: cor verdadeira (420), índice ACI (62) ou a
+// cor da camada.
+func (im *importadorDXF) cor(en entidadeDXF) color.RGBA {
+	if rgb := int(en.num(420, -1)); rgb >= 0 {
+		return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 255}
+	}
+	if c, ok := coresACI[int(math.Abs(en.num(62, 256)))]; ok {
+		return c
+	}
+	if c, ok := im.coresCamada[en.texto(8)]; ok {
+		return c
+	}
+	return im.op.CorPadrao
+}
+
+func (im *importadorDXF) reta(a, b Ponto, cor color.RGBA) {
+	comprimento := CalculateLengthMeters(a.X, a.Y, b.X, b.Y)
+	if !(comprimento > 0) || math.IsInf(comprimento, 0) {
+		im.ignoradas++
+		return
+	}
+	im.elementos = append(im.elementos, Elemento{Tipo: ElementoViaReta, ID: im.proxID, X: a.X, Y: a.Y, Comprimento: comprimento,
+		Rotacao: math.Atan2(b.Y-a.Y, b.X-a.X) * 180 / math.Pi, Cor: cor, Espessura: im.op.Espessura})
+	im.proxID++
+}
+
+// ramoChave junta as duas LINE de uma chave exportada pelo editor (ponta ao
+// fim do ramo normal, depois ao do reverso) numa ChaveSimples. Um ramo sem par
+// vira via reta.
+func (im *importadorDXF) ramoChave(a, b Ponto, cor color.RGBA) {
+	if im.ramo == nil {
+		im.ramo, im.corRamo = []Ponto{a, b}, cor
+		return
+	}
+	ponta, normal := im.ramo[0], im.ramo[1]
+	if math.Hypot(a.X-ponta.X, a.Y-ponta.Y) > ToleranciaNo {
+		im.terminarChave()
+		im.ramoChave(a, b, cor)
+		return
+	}
+	im.ramo = nil
+	rumo := math.Atan2(normal.Y-ponta.Y, normal.X-ponta.X) * 180 / math.Pi
+	desvio := math.Mod(math.Atan2(b.Y-a.Y, b.X-a.X)*180/math.Pi-rumo+540, 360) - 180
+	im.elementos = append(im.elementos, Elemento{Tipo: ElementoChaveSimples, ID: im.proxID, X: ponta.X, Y: ponta.Y, Rotacao: rumo,
+		Comprimento: CalculateLengthMeters(ponta.X, ponta.Y, normal.X, normal.Y), AnguloDesvio: desvio, PosicaoChave: PosicaoNormal,
+		Largura: im.op.Espessura, Espessura: 10, Cor: im.corRamo})
+	im.proxID++
+}
+
+// terminarChave converte em via reta o ramo de chave que ficou sem par.
+func (im *importadorDXF) terminarChave() {
+	if im.ramo != nil {
+		a, b := im.ramo[0], im.ramo[1]
+		im.ramo = nil
+		im.reta(a, b, im.corRamo)
+	}
+}
+
+// arco cria a curva de a até b que parte com o rumo dado (graus, Unid.
+// Mundo); arcos quase retos viram reta.
+func (im *importadorDXF) arco(a, b Ponto, rumo float64, cor color.RGBA) {
+	raio, varredura, ok := CurvaTangente(a.X, a.Y, rumo, b.X, b.Y)
+	if !ok {
+		im.reta(a, b, cor)
+		return
+	}
+	im.elementos = append(im.elementos, Elemento{Tipo: ElementoViaCurva, ID: im.proxID, X: a.X, Y: a.Y, Rotacao: rumo, Raio: raio, Varredura: varredura,
+		Comprimento: ComprimentoArco(raio, varredura), Cor: cor, Espessura: im.op.Espessura})
+	im.proxID++
+}
+
+// polilinha converte os trechos de uma LWPOLYLINE. O bulge de cada vértice é
+// a tangente de um quarto do ângulo do trecho seguinte (positivo = anti-horário,
+// com o rumo inicial girado de metade do ângulo para a direita da corda).
+func (im *importadorDXF) polilinha(en entidadeDXF, cor color.RGBA) {
+	type vertice struct{ x, y, bulge float64 }
+	var vs []vertice
+	for _, p := range en.pares {
+		v, err := strconv.ParseFloat(p.valor, 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case p.codigo == 10:
+			vs = append(vs, vertice{x: v})
+		case p.codigo == 20 && len(vs) > 0:
+			vs[len(vs)-1].y = v
+		case p.codigo == 42 && len(vs) > 0:
+			vs[len(vs)-1].bulge = v
+		}
+	}
+	n := len(vs) - 1
+	if int(en.num(70, 0))&1 != 0 {
+		n = len(vs)
+	}
+	for i := 0; i < n; i++ {
+		v, w := vs[i], vs[(i+1)%len(vs)]
+		a, b := im.mundo(v.x, v.y), im.mundo(w.x, w.y)
+		if v.bulge == 0 {
+			im.reta(a, b, cor)
+			continue
+		}
+		angulo := 4 * math.Atan(v.bulge) * 180 / math.Pi
+		cordaDXF := math.Atan2(w.y-v.y, w.x-v.x) * 180 / math.Pi
+		im.arco(a, b, angulo/2-cordaDXF, cor)
+	}
+}
+
+// ImportarDXF lê as entidades LINE, LWPOLYLINE e ARC de um DXF ASCII como
+// vias (e chaves, na camada CHAVE do editor), com IDs a partir de proxID. As
+// demais entidades, e as das camadas de circuitos e sinais do editor, são
+// ignoradas e contadas em ignoradas. Sem op.MetrosPorUnidade, a unidade vem
+// de $INSUNITS (metros se ausente).
+func ImportarDXF(r io.Reader, proxID int, op OpcoesDXF) (elementos []Elemento, ignoradas int, err error) {
+	secoes, err := lerSecoesDXF(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	mpu := op.MetrosPorUnidade
+	if mpu <= 0 {
+		mpu = 1
+		for _, v := range secoes["HEADER"] {
+			if m, ok := metrosPorINSUNITS[int(v.num(70, 0))]; ok && v.tipo == "$INSUNITS" {
+				mpu = m
+			}
+		}
+	}
+	if op.Espessura <= 0 {
+		op.Espessura = ChaveBitolaPadrao
+	}
+	if op.CorPadrao.A == 0 {
+		op.CorPadrao = coresACI[7]
+	}
+	im := &importadorDXF{escala: mpu * PixelsPerMeter, op: op, coresCamada: map[string]color.RGBA{}, proxID: proxID}
+	for _, t := range secoes["TABLES"] {
+		if c, ok := coresACI[int(math.Abs(t.num(62, 7)))]; ok && t.tipo == "LAYER" {
+			im.coresCamada[t.texto(2)] = c
+		}
+	}
+	for _, en := range secoes["ENTITIES"] {
+		if op.Camada != "" && !strings.EqualFold(en.texto(8), op.Camada) {
+			continue
+		}
+		cor := im.cor(en)
+		tipoCamada, doEditor := tipoDaCamadaDXF(en.texto(8))
+		if !doEditor || tipoCamada != ElementoChaveSimples || en.tipo != "LINE" {
+			im.terminarChave()
+		}
+		switch {
+		case doEditor && (tipoCamada == ElementoCircuitoVia || tipoCamada == ElementoSinal): // Glifos, não vias
+			im.ignoradas++
+			continue
+		case doEditor && tipoCamada == ElementoChaveSimples && en.tipo == "LINE":
+			im.ramoChave(im.mundo(en.num(10, 0), en.num(20, 0)), im.mundo(en.num(11, 0), en.num(21, 0)), cor)
+			continue
+		}
+		switch en.tipo {
+		case "LINE":
+			im.reta(im.mundo(en.num(10, 0), en.num(20, 0)), im.mundo(en.num(11, 0), en.num(21, 0)), cor)
+		case "LWPOLYLINE":
+			im.polilinha(en, cor)
+		case "ARC": // Anti-horário (Y para cima) de 50 a 51 graus
+			cx, cy, raio := en.num(10, 0), en.num(20, 0), en.num(40, 0)
+			ini, fim := en.num(50, 0)*math.Pi/180, en.num(51, 0)*math.Pi/180
+			a := im.mundo(cx+raio*math.Cos(ini), cy+raio*math.Sin(ini))
+			b := im.mundo(cx+raio*math.Cos(fim), cy+raio*math.Sin(fim))
+			im.arco(a, b, -(en.num(50, 0) + 90), cor)
+		default:
+			im.ignoradas++
+		}
+	}
+	im.terminarChave()
+	if len(im.elementos) == 0 {
+		return nil, im.ignoradas, fmt.Errorf("nenhuma LINE, LWPOLYLINE ou ARC encontrada")
+	}
+	return im.elementos, im.ignoradas, nil
+}
@@ -0,0 +1,150 @@
+package malha
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// mesmoTrecho compara duas vias pelas extremidades (em qualquer ordem) e pelo
+// ponto médio, que distingue um arco do seu complementar ou do espelhado.
+func mesmoTrecho(a, b Elemento, tol float64) bool {
+	ax1, ay1, ax2, ay2 := a.Extremidades()
+	bx1, by1, bx2, by2 := b.Extremidades()
+	mesmaOrdem := math.Hypot(ax1-bx1, ay1-by1) < tol && math.Hypot(ax2-bx2, ay2-by2) < tol
+	invertida := math.Hypot(ax1-bx2, ay1-by2) < tol && math.Hypot(ax2-bx1, ay2-by1) < tol
+	ma, _ := a.PontoNaVia(0.5)
+	mb, _ := b.PontoNaVia(0.5)
+	return (mesmaOrdem || invertida) && math.Hypot(ma.X-mb.X, ma.Y-mb.Y) < tol
+}
+
+func TestDXFIdaEVolta(t *testing.T) {
+	originais := []Elemento{
+		viaReta(1, 0, 0, 1000, 30),
+		viaCurva(2, 10, 0, 0, 1000, 90),   // À direita
+		viaCurva(3, 20, 10, 90, 800, -60), // À esquerda
+		viaCurva(4, -5, 5, 200, 500, 135),
+		chave(5, 30, -10, 160, 1200, PosicaoReversa, "W1"),
+	}
+	// Glifos do editor que não são vias: a importação os descarta
+	glifos := []Elemento{sinal(6, 1, 500, SentidoCrescente, "S1"), circuito(7, 10, 0)}
+	ReposicionarSinal(originais[0], &glifos[0])
+	entidadesGlifos := 1 + len(LampadasSinal(SinalPrincipal)) + 2
+	for _, metrosPorUnidade := range []float64{1, 0.001, 0.3048} {
+		t.Run(fmt.Sprint(metrosPorUnidade), func(t *testing.T) {
+			op := OpcoesDXF{MetrosPorUnidade: metrosPorUnidade}
+			var buf bytes.Buffer
+			if err := ExportarDXF(&buf, append(slices.Clone(originais), glifos...), op); err != nil {
+				t.Fatalf("ExportarDXF: %v", err)
+			}
+			importados, ignoradas, err := ImportarDXF(&buf, 10, op)
+			if err != nil {
+				t.Fatalf("ImportarDXF: %v", err)
+			}
+			if ignoradas != entidadesGlifos || len(importados) != len(originais) {
+				t.Fatalf("importados %d (ignoradas %d), quer %d (ignoradas %d)", len(importados), ignoradas, len(originais), entidadesGlifos)
+			}
+			for i, orig := range originais {
+				imp := importados[i]
+				if orig.Tipo == ElementoChaveSimples {
+					p0, n0, r0 := orig.PontasChave()
+					p1, n1, r1 := imp.PontasChave()
+					if imp.Tipo != orig.Tipo || !pertoPonto(p0, p1) || !pertoPonto(n0, n1) || !pertoPonto(r0, r1) {
+						t.Errorf("chave %d importada como %+v", orig.ID, imp)
+					}
+					continue
+				}
+				if imp.Tipo != orig.Tipo || !mesmoTrecho(imp, orig, 1e-6) {
+					t.Errorf("elemento %d importado como %+v", orig.ID, imp)
+				}
+				if math.Abs(imp.Comprimento-orig.Comprimento) > 1e-3 || math.Abs(imp.Raio-orig.Raio) > 1e-3 {
+					t.Errorf("elemento %d: comprimento/raio = %.3f/%.3f, quer %.3f/%.3f", orig.ID, imp.Comprimento, imp.Raio, orig.Comprimento, orig.Raio)
+				}
+			}
+		})
+	}
+}
+
+func TestDXFTransicao(t *testing.T) {
+	via := viaTransicao(1, 0, 0, 30, 2000, 0, 1000, 1)
+	op := OpcoesDXF{MetrosPorUnidade: 1}
+	var buf bytes.Buffer
+	if err := ExportarDXF(&buf, []Elemento{via}, op); err != nil {
+		t.Fatalf("ExportarDXF: %v", err)
+	}
+	if !strings.Contains(buf.String(), "VIA_TRANSICAO_000000") {
+		t.Error("DXF sem a camada VIA_TRANSICAO")
+	}
+	importados, ignoradas, err := ImportarDXF(&buf, 10, op)
+	if err != nil {
+		t.Fatalf("ImportarDXF: %v", err)
+	}
+	// A polilinha volta como retas encadeadas de ponta a ponta da transição.
+	pontos := via.PolilinhaVia()
+	if ignoradas != 0 || len(importados) != len(pontos)-1 {
+		t.Fatalf("importados %d (ignoradas %d), quer %d retas", len(importados), ignoradas, len(pontos)-1)
+	}
+	for k, imp := range importados {
+		x1, y1, x2, y2 := imp.Extremidades()
+		if imp.Tipo != ElementoViaReta || !pertoPonto(Ponto{x1, y1}, pontos[k]) || !pertoPonto(Ponto{x2, y2}, pontos[k+1]) {
+			t.Errorf("trecho %d importado como %+v, quer reta de %v a %v", k, imp, pontos[k], pontos[k+1])
+		}
+	}
+}
+
+// dxfPolilinha monta um DXF mínimo com $INSUNITS e uma LWPOLYLINE aberta de
+// (0,0) a (100,0) unidades, com o bulge informado no primeiro vértice.
+func dxfPolilinha(insunits int, unidades, bulge float64) string {
+	return strings.Join([]string{
+		"0", "SECTION", "2", "HEADER", "9", "$INSUNITS", "70", fmt.Sprint(insunits), "0", "ENDSEC",
+		"0", "SECTION", "2", "ENTITIES",
+		"0", "LWPOLYLINE", "8", "EIXO", "90", "2", "70", "0",
+		"10", "0", "20", "0", "42", fmt.Sprint(bulge),
+		"10", fmt.Sprint(unidades), "20", "0",
+		"0", "ENDSEC", "0", "EOF",
+	}, "\n")
+}
+
+func TestImportarDXFPolilinha(t *testing.T) {
+	for _, tc := range []struct {
+		nome      string
+		insunits  int
+		unidades  float64 // Comprimento da corda nas unidades do desenho (100 m)
+		bulge     float64
+		tipo      ElementType
+		meio      Ponto // Ponto médio esperado (Unid. Mundo, Y para baixo)
+		varredura float64
+	}{
+		{"reta em metros", 6, 100, 0, ElementoViaReta, Ponto{0.5, 0}, 0},
+		{"reta em milímetros", 4, 100000, 0, ElementoViaReta, Ponto{0.5, 0}, 0},
+		// Bulge positivo: anti-horário, logo curva à esquerda (Varredura
+		// negativa); passa abaixo da corda no desenho (Y para cima), isto é,
+		// em Y positivo nas Unid. Mundo.
+		{"semicírculo anti-horário", 6, 100, 1, ElementoViaCurva, Ponto{0.5, 0.5}, -180},
+		{"semicírculo horário", 6, 100, -1, ElementoViaCurva, Ponto{0.5, -0.5}, 180},
+		{"quarto de círculo em pés", 2, 100 / 0.3048, math.Tan(math.Pi / 8), ElementoViaCurva, Ponto{0.5, (math.Sqrt2 - 1) / 2}, -90},
+		{"quarto de círculo horário", 6, 100, -math.Tan(math.Pi / 8), ElementoViaCurva, Ponto{0.5, -(math.Sqrt2 - 1) / 2}, 90},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			importados, _, err := ImportarDXF(strings.NewReader(dxfPolilinha(tc.insunits, tc.unidades, tc.bulge)), 1, OpcoesDXF{})
+			if err != nil {
+				t.Fatalf("ImportarDXF: %v", err)
+			}
+			if len(importados) != 1 {
+				t.Fatalf("importados %d elementos, quer 1", len(importados))
+			}
+			via := importados[0]
+			x1, y1, x2, y2 := via.Extremidades()
+			meio, _ := via.PontoNaVia(0.5)
+			if via.Tipo != tc.tipo || math.Hypot(x1, y1) > 1e-6 || math.Hypot(x2-1, y2) > 1e-6 {
+				t.Errorf("via %d de (%.4f,%.4f) a (%.4f,%.4f), quer %d de (0,0) a (1,0)", via.Tipo, x1, y1, x2, y2, tc.tipo)
+			}
+			if math.Hypot(meio.X-tc.meio.X, meio.Y-tc.meio.Y) > 1e-6 || math.Abs(via.Varredura-tc.varredura) > 1e-6 {
+				t.Errorf("meio (%.4f,%.4f) varredura %.2f, quer (%.4f,%.4f) varredura %.2f", meio.X, meio.Y, via.Varredura, tc.meio.X, tc.meio.Y, tc.varredura)
+			}
+		})
+	}
+}
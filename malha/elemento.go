@@ -0,0 +1,171 @@
+// Package malha contém o modelo da malha ferroviária (elementos, geometria,
+// topologia e persistência) sem dependência de janela ou GPU. O editor Ebiten
+// é apenas um cliente deste pacote.
+package malha
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// PixelsPerMeter é a escala base: unidades de mundo por metro.
+const PixelsPerMeter = 0.01
+
+// --- Tipos de Elementos ---
+type ElementType int
+
+const (
+	ElementoViaReta ElementType = iota
+	ElementoCircuitoVia
+	ElementoChaveSimples
+	ElementoSinal
+	ElementoViaCurva
+	ElementoViaTransicao
+)
+
+// TipoValido indica se t é um tipo de elemento conhecido.
+func TipoValido(t ElementType) bool {
+	return t >= ElementoViaReta && t <= ElementoViaTransicao
+}
+
+// NomeTipo devolve o nome do tipo exibido ao usuário.
+func NomeTipo(t ElementType) string {
+	switch t {
+	case ElementoViaReta:
+		return "Via Reta"
+	case ElementoViaCurva:
+		return "Via Curva"
+	case ElementoViaTransicao:
+		return "Via Transicao"
+	case ElementoCircuitoVia:
+		return "Circ. Via"
+	case ElementoChaveSimples:
+		return "Chave Simples"
+	case ElementoSinal:
+		return "Sinal"
+	}
+	return "Desconhecido"
+}
+
+// --- Estrutura Elemento ---
+type Elemento struct {
+	Tipo         ElementType `json:"tipo"`
+	ID           int         `json:"id"`
+	X            float64     `json:"x"`
+	Y            float64     `json:"y"`
+	Comprimento  float64     `json:"comprimento"`
+	Largura      float64     `json:"largura"`
+	Rotacao      float64     `json:"rotacao"`
+	Cor          color.RGBA  `json:"cor"`
+	Espessura    float64     `json:"espessura"`
+	ModoCheio    bool        `json:"modoCheio,omitempty"`
+	Estado       string      `json:"estado,omitempty"`
+	OrientacaoTC string      `json:"orientacaoTC,omitempty"`
+	Conexoes     []int       `json:"conexoes,omitempty"`     // IDs das vias conectadas (derivado da topologia)
+	AnguloDesvio float64     `json:"anguloDesvio,omitempty"` // Chave: ângulo do ramo reverso em relação ao normal (graus)
+	PosicaoChave string      `json:"posicaoChave,omitempty"` // Chave: PosicaoNormal ou PosicaoReversa
+	Nome         string      `json:"nome,omitempty"`         // Nome de exibição (ex.: nome da seção de via, do sinal)
+	ViaID        int         `json:"viaID,omitempty"`        // Sinal: ID da via a que está preso
+	Distancia    float64     `json:"distancia,omitempty"`    // Sinal: metros desde o início da via
+	Sentido      string      `json:"sentido,omitempty"`      // Sinal: SentidoCrescente ou SentidoDecrescente
+	TipoSinal    string      `json:"tipoSinal,omitempty"`    // Sinal: SinalPrincipal, SinalManobra ou SinalDistante
+	Aspecto      string      `json:"aspecto,omitempty"`      // Sinal: aspecto exibido (AspectoVermelho...)
+	Raio         float64     `json:"raio,omitempty"`         // ViaCurva: raio em metros; ViaTransicao: raio final (0 = reta)
+	Varredura    float64     `json:"varredura,omitempty"`    // ViaCurva/ViaTransicao: ângulo varrido (graus; positivo = à direita)
+	RaioInicial  float64     `json:"raioInicial,omitempty"`  // ViaTransicao: raio no início em metros (0 = reta)
+}
+
+// Posições de uma chave (aparelho de mudança de via).
+const (
+	PosicaoNormal  = "Normal"
+	PosicaoReversa = "Reversa"
+)
+
+// Valores padrão de uma chave nova (ou migrada do antigo círculo simples).
+const (
+	ChaveComprimentoPadrao  = 3000.0 // Metros de cada ramo
+	ChaveAnguloDesvioPadrao = 20.0   // Graus
+	ChaveBitolaPadrao       = 8.0    // Largura dos ramos (Unid. Mundo)
+)
+
+// Ponto é uma posição em Unid. Mundo.
+type Ponto struct {
+	X, Y float64
+}
+
+// CalculateLengthMeters converte a distância entre dois pontos do mundo em metros.
+func CalculateLengthMeters(x1, y1, x2, y2 float64) float64 {
+	dx := x2 - x1
+	dy := y2 - y1
+	worldUnitsLen := math.Sqrt(dx*dx + dy*dy)
+	if PixelsPerMeter <= 0 {
+		return worldUnitsLen
+	}
+	return worldUnitsLen / PixelsPerMeter
+}
+
+// Extremidades devolve os pontos inicial e final (Unid. Mundo) de uma via.
+func (el Elemento) Extremidades() (x1, y1, x2, y2 float64) {
+	if el.ehArco() || el.ehTransicao() {
+		ini, _ := el.PontoNaVia(0)
+		fim, _ := el.PontoNaVia(1)
+		return ini.X, ini.Y, fim.X, fim.Y
+	}
+	comprimentoWorldUnits := el.Comprimento * PixelsPerMeter
+	rad := el.Rotacao * math.Pi / 180.0
+	return el.X, el.Y, el.X + comprimentoWorldUnits*math.Cos(rad), el.Y + comprimentoWorldUnits*math.Sin(rad)
+}
+
+// PontasChave devolve a ponta (agulha) e as extremidades dos ramos normal e
+// reverso de uma chave. O ramo normal segue Rotacao e o reverso diverge
+// AnguloDesvio graus dele.
+func (el Elemento) PontasChave() (ponta, normal, reversa Ponto) {
+	comprimentoWorldUnits := el.Comprimento * PixelsPerMeter
+	radNormal := el.Rotacao * math.Pi / 180.0
+	radReversa := (el.Rotacao + el.AnguloDesvio) * math.Pi / 180.0
+	ponta = Ponto{el.X, el.Y}
+	normal = Ponto{el.X + comprimentoWorldUnits*math.Cos(radNormal), el.Y + comprimentoWorldUnits*math.Sin(radNormal)}
+	reversa = Ponto{el.X + comprimentoWorldUnits*math.Cos(radReversa), el.Y + comprimentoWorldUnits*math.Sin(radReversa)}
+	return ponta, normal, reversa
+}
+
+// PosicaoAtual devolve a posição da chave, considerando vazio como normal.
+func (el Elemento) PosicaoAtual() string {
+	if el.PosicaoChave == PosicaoReversa {
+		return PosicaoReversa
+	}
+	return PosicaoNormal
+}
+
+// PontosConexao devolve os pontos onde o elemento se liga a outras vias.
+func (el Elemento) PontosConexao() []Ponto {
+	switch el.Tipo {
+	case ElementoViaReta, ElementoViaCurva, ElementoViaTransicao:
+		x1, y1, x2, y2 := el.Extremidades()
+		return []Ponto{{x1, y1}, {x2, y2}}
+	case ElementoChaveSimples:
+		ponta, normal, reversa := el.PontasChave()
+		return []Ponto{ponta, normal, reversa}
+	}
+	return nil
+}
+
+// Rotulo devolve o nome do elemento ou, sem nome, "ID n".
+func (el Elemento) Rotulo() string {
+	if el.Nome != "" {
+		return el.Nome
+	}
+	return fmt.Sprintf("ID %d", el.ID)
+}
+
+// NextID devolve o próximo ID livre (maior ID + 1, mínimo 1).
+func NextID(elementos []Elemento) int {
+	proxID := 1
+	for _, el := range elementos {
+		if el.ID >= proxID {
+			proxID = el.ID + 1
+		}
+	}
+	return proxID
+}
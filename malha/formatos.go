@@ -0,0 +1,92 @@
+package malha
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --- Formatos de Arquivo ---
+// O formato é escolhido pela extensão do arquivo, na exportação e na
+// importação; o editor (tecla P, Ctrl+I) e o comando malha usam as mesmas
+// funções. A importação de DXF traz as vias do desenho; a de railML, a
+// infraestrutura numa disposição esquemática. CSV e HTML não desenham a
+// malha: gravam a tabela de rotas gerada dela.
+
+// OpcoesExportacao reúne as opções de todos os formatos; cada exportador usa
+// as suas.
+type OpcoesExportacao struct {
+	Imagem OpcoesImagem
+	DXF    OpcoesDXF
+}
+
+// exportadores associa cada extensão aceita à função que grava o formato.
+var exportadores = map[string]func(io.Writer, []Elemento, OpcoesExportacao) error{
+	".png": func(w io.Writer, els []Elemento, op OpcoesExportacao) error {
+		return ExportarPNG(w, els, op.Imagem)
+	},
+	".svg": func(w io.Writer, els []Elemento, op OpcoesExportacao) error {
+		return ExportarSVG(w, els, op.Imagem)
+	},
+	".dxf": func(w io.Writer, els []Elemento, op OpcoesExportacao) error {
+		return ExportarDXF(w, els, op.DXF)
+	},
+	".railml": func(w io.Writer, els []Elemento, _ OpcoesExportacao) error {
+		return ExportarRailML(w, els)
+	},
+	".csv": func(w io.Writer, els []Elemento, _ OpcoesExportacao) error {
+		return ExportarTabelaRotasCSV(w, els)
+	},
+	".html": func(w io.Writer, els []Elemento, _ OpcoesExportacao) error {
+		return ExportarTabelaRotasHTML(w, els)
+	},
+}
+
+// FormatosExportacao lista as extensões aceitas, na ordem exibida ao usuário.
+var FormatosExportacao = []string{".png", ".svg", ".dxf", ".railml", ".csv", ".html"}
+
+// FormatosImportacao lista as extensões aceitas por ImportarArquivo.
+var FormatosImportacao = []string{".dxf", ".railml", ".xml"}
+
+// ExportarArquivo grava os elementos em destino no formato da extensão. Em
+// caso de erro, o arquivo incompleto é apagado.
+func ExportarArquivo(destino string, elementos []Elemento, op OpcoesExportacao) error {
+	ext := strings.ToLower(filepath.Ext(destino))
+	exportar, ok := exportadores[ext]
+	if !ok {
+		return fmt.Errorf("formato '%s' não suportado (use %s)", ext, strings.Join(FormatosExportacao, ", "))
+	}
+	arquivo, err := os.Create(destino)
+	if err != nil {
+		return err
+	}
+	if err := exportar(arquivo, elementos, op); err != nil {
+		arquivo.Close()
+		os.Remove(destino)
+		return err
+	}
+	return arquivo.Close()
+}
+
+// ImportarArquivo lê os elementos de origem no formato da extensão, com IDs a
+// partir de proxID. resumo descreve o que ficou de fora, para o log.
+func ImportarArquivo(origem string, proxID int, dxf OpcoesDXF, cor color.RGBA) (elementos []Elemento, resumo string, err error) {
+	arquivo, err := os.Open(origem)
+	if err != nil {
+		return nil, "", err
+	}
+	defer arquivo.Close()
+	switch ext := strings.ToLower(filepath.Ext(origem)); ext {
+	case ".dxf":
+		elementos, ignoradas, err := ImportarDXF(arquivo, proxID, dxf)
+		return elementos, fmt.Sprintf("%d entidade(s) DXF ignorada(s)", ignoradas), err
+	case ".railml", ".xml":
+		elementos, err := ImportarRailML(arquivo, proxID, cor)
+		return elementos, "disposição esquemática", err
+	default:
+		return nil, "", fmt.Errorf("formato '%s' não suportado (use %s)", ext, strings.Join(FormatosImportacao, ", "))
+	}
+}
@@ -0,0 +1,74 @@
+package malha
+
+import "math"
+
+// --- Hit Testing e Geometria ---
+
+// PointSegmentDistance devolve a distância de (px, py) ao segmento AB.
+func PointSegmentDistance(px, py, ax, ay, bx, by float64) float64 {
+	cx, cy, _ := ClosestPointOnSegment(px, py, ax, ay, bx, by)
+	return math.Hypot(px-cx, py-cy)
+}
+
+// ClosestPointOnSegment projeta (px, py) no segmento AB; t é a fração ao longo de AB.
+func ClosestPointOnSegment(px, py, ax, ay, bx, by float64) (cx, cy, t float64) {
+	dx, dy := bx-ax, by-ay
+	lengthSq := dx*dx + dy*dy
+	if lengthSq == 0 {
+		return ax, ay, 0
+	}
+	t = math.Max(0, math.Min(1, ((px-ax)*dx+(py-ay)*dy)/lengthSq))
+	return ax + t*dx, ay + t*dy, t
+}
+
+// DistanceToEdge devolve a distância (Unid. Mundo) de (worldX, worldY) à borda
+// desenhada do elemento; valores negativos indicam ponto dentro do traço.
+func DistanceToEdge(el Elemento, worldX, worldY float64) float64 {
+	switch el.Tipo {
+	case ElementoViaReta:
+		startX, startY, endX, endY := el.Extremidades()
+		return PointSegmentDistance(worldX, worldY, startX, startY, endX, endY) - el.Espessura/2.0
+	case ElementoViaCurva, ElementoViaTransicao:
+		px, py, _ := ProjetarNaVia(el, worldX, worldY)
+		return math.Hypot(worldX-px, worldY-py) - el.Espessura/2.0
+	case ElementoCircuitoVia:
+		vertBarLenWorld := el.Largura
+		horizStemLenWorld := el.Largura / 2.0
+		distVert := PointSegmentDistance(worldX, worldY, el.X, el.Y-vertBarLenWorld/2.0, el.X, el.Y+vertBarLenWorld/2.0)
+		hStemEndX := el.X + horizStemLenWorld
+		if el.OrientacaoTC == "Invertido" {
+			hStemEndX = el.X - horizStemLenWorld
+		}
+		distHoriz := PointSegmentDistance(worldX, worldY, el.X, el.Y, hStemEndX, el.Y)
+		return math.Min(distVert, distHoriz) - el.Espessura/2.0
+	case ElementoChaveSimples:
+		ponta, normal, reversa := el.PontasChave()
+		dist := math.Hypot(worldX-el.X, worldY-el.Y) - el.Espessura
+		for _, fim := range []Ponto{normal, reversa} {
+			dist = math.Min(dist, PointSegmentDistance(worldX, worldY, ponta.X, ponta.Y, fim.X, fim.Y)-el.Largura/2.0)
+		}
+		return dist
+	case ElementoSinal:
+		base, cabecote, lampadas := el.GeometriaSinal()
+		raio := math.Hypot(lampadas[0].X-cabecote.X, lampadas[0].Y-cabecote.Y) // Igual ao raio da lâmpada
+		ultima := lampadas[len(lampadas)-1]
+		return math.Min(PointSegmentDistance(worldX, worldY, base.X, base.Y, cabecote.X, cabecote.Y),
+			PointSegmentDistance(worldX, worldY, cabecote.X, cabecote.Y, ultima.X, ultima.Y)-raio)
+	}
+	return math.MaxFloat64
+}
+
+// FindClosestElement devolve o índice do elemento mais próximo de (worldX, worldY)
+// cuja borda esteja a menos de limiar (Unid. Mundo), ou -1. Em caso de empate,
+// prevalece o elemento desenhado por último.
+func FindClosestElement(elementos []Elemento, worldX, worldY, limiar float64) int {
+	closestIndex := -1
+	minDist := limiar
+	for i := len(elementos) - 1; i >= 0; i-- {
+		if d := DistanceToEdge(elementos[i], worldX, worldY); d < minDist {
+			minDist = d
+			closestIndex = i
+		}
+	}
+	return closestIndex
+}
@@ -1 +0,0 @@
-go 1.24
\ No newline at end of file
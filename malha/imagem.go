@@ -0,0 +1,302 @@
+package malha
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"golang.org/x/image/vector"
+)
+
+// --- Exportação para Imagem ---
+// Rasterização sem janela nem GPU (golang.org/x/image/vector) com as mesmas
+// regras de desenho do editor: vias cheias ou vazadas com os trilhos afastados
+// na vertical, circuitos de via como barra e haste, chaves com o ramo
+// posicionado destacado e sinais com a lâmpada do aspecto acesa. As medidas
+// em tela do editor (zoom × Unid. Mundo) viram pixels × Unid. Mundo.
+
+const (
+	TracoTrilho        = 1.0 // Espessura do traço dos trilhos e mastros (Unid. Mundo)
+	ImagemMargemPadrao = 20  // Pixels
+	imagemLadoMaximo   = 16384
+)
+
+// Cores compartilhadas pelo editor e pela exportação.
+var (
+	CorSecaoOcupada   = color.RGBA{R: 255, G: 0, B: 0, A: 255} // Sobrepõe a cor das vias da seção
+	CorSecaoFalha     = color.RGBA{R: 255, G: 0, B: 255, A: 255}
+	CorRamoLivre      = color.RGBA{R: 110, G: 110, B: 110, A: 255} // Ramo da chave não posicionado
+	CorLampadaApagada = color.RGBA{R: 40, G: 40, B: 40, A: 255}
+	CorCabecoteSinal  = color.RGBA{R: 15, G: 15, B: 15, A: 255}
+	CorAspecto        = map[string]color.RGBA{
+		AspectoVermelho: {R: 255, G: 0, B: 0, A: 255},
+		AspectoAmarelo:  {R: 255, G: 200, B: 0, A: 255},
+		AspectoVerde:    {R: 0, G: 220, B: 0, A: 255},
+	}
+)
+
+// OpcoesImagem define o enquadramento da exportação. Com Escala, o tamanho
+// não informado é o do conteúdo mais as margens; sem Escala, o conteúdo é
+// ajustado ao tamanho (um lado zerado segue a proporção do conteúdo).
+type OpcoesImagem struct {
+	Largura, Altura int     // Pixels
+	Escala          float64 // Pixels por metro (0: ajustar ao tamanho)
+	Margem          int     // Pixels em volta do conteúdo
+	Fundo           color.RGBA
+}
+
+// enquadrar calcula o tamanho da imagem, os pixels por Unid. Mundo e a origem
+// (canto superior esquerdo, Unid. Mundo) que centraliza a caixa.
+func (op OpcoesImagem) enquadrar(caixa Caixa) (largura, altura int, zoom, origemX, origemY float64, err error) {
+	if math.IsInf(caixa.MinX, 0) { // Malha vazia
+		caixa = Caixa{}
+	}
+	w, h := math.Max(caixa.MaxX-caixa.MinX, 1e-6), math.Max(caixa.MaxY-caixa.MinY, 1e-6)
+	largura, altura, m := op.Largura, op.Altura, float64(2*op.Margem)
+	switch {
+	case op.Escala > 0:
+		zoom = op.Escala / PixelsPerMeter
+		if largura <= 0 {
+			largura = int(math.Ceil(w*zoom + m))
+		}
+		if altura <= 0 {
+			altura = int(math.Ceil(h*zoom + m))
+		}
+	case largura > 0 && altura > 0:
+		zoom = math.Min((float64(largura)-m)/w, (float64(altura)-m)/h)
+	case largura > 0:
+		zoom = (float64(largura) - m) / w
+		altura = int(math.Ceil(h*zoom + m))
+	case altura > 0:
+		zoom = (float64(altura) - m) / h
+		largura = int(math.Ceil(w*zoom + m))
+	default:
+		return 0, 0, 0, 0, 0, fmt.Errorf("informe a largura, a altura ou a escala da imagem")
+	}
+	if zoom <= 0 || math.IsNaN(zoom) || math.IsInf(zoom, 0) {
+		return 0, 0, 0, 0, 0, fmt.Errorf("margem de %d pixels não deixa espaço para o conteúdo", op.Margem)
+	}
+	if largura <= 0 || altura <= 0 || largura > imagemLadoMaximo || altura > imagemLadoMaximo {
+		return 0, 0, 0, 0, 0, fmt.Errorf("imagem de %dx%d pixels fora do limite (1 a %d por lado)", largura, altura, imagemLadoMaximo)
+	}
+	origemX = (caixa.MinX+caixa.MaxX)/2 - float64(largura)/2/zoom
+	origemY = (caixa.MinY+caixa.MaxY)/2 - float64(altura)/2/zoom
+	return largura, altura, zoom, origemX, origemY, nil
+}
+
+// rasterizador acumula polígonos (em pixels) e os pinta de uma vez, sem
+// emendas entre as partes de uma mesma forma.
+type rasterizador struct {
+	dst              *image.RGBA
+	r                *vector.Rasterizer
+	zoom             float64 // Pixels por Unid. Mundo
+	origemX, origemY float64
+}
+
+func (rz *rasterizador) tela(p Ponto) (float64, float64) {
+	return (p.X - rz.origemX) * rz.zoom, (p.Y - rz.origemY) * rz.zoom
+}
+
+// poligono acrescenta um polígono fechado em pixels. Todos são acumulados
+// com a mesma orientação, para que sobreposições somem em vez de se anular.
+func (rz *rasterizador) poligono(xy ...[2]float64) {
+	if len(xy) < 3 {
+		return
+	}
+	area := 0.0
+	for k := range xy {
+		a, b := xy[k], xy[(k+1)%len(xy)]
+		area += a[0]*b[1] - b[0]*a[1]
+	}
+	if area < 0 {
+		for i, j := 0, len(xy)-1; i < j; i, j = i+1, j-1 {
+			xy[i], xy[j] = xy[j], xy[i]
+		}
+	}
+	rz.r.MoveTo(float32(xy[0][0]), float32(xy[0][1]))
+	for _, p := range xy[1:] {
+		rz.r.LineTo(float32(p[0]), float32(p[1]))
+	}
+	rz.r.ClosePath()
+}
+
+// linha acrescenta um segmento de largura dada (pixels) com pontas retas.
+func (rz *rasterizador) linha(ax, ay, bx, by, largura float64) {
+	d := math.Hypot(bx-ax, by-ay)
+	if d == 0 {
+		return
+	}
+	nx, ny := -(by-ay)/d*largura/2, (bx-ax)/d*largura/2
+	rz.poligono([2]float64{ax + nx, ay + ny}, [2]float64{bx + nx, by + ny}, [2]float64{bx - nx, by - ny}, [2]float64{ax - nx, ay - ny})
+}
+
+// disco acrescenta um círculo preenchido (pixels).
+func (rz *rasterizador) disco(cx, cy, raio float64) {
+	lados := int(math.Max(12, math.Min(64, raio*2)))
+	xy := make([][2]float64, lados)
+	for k := range xy {
+		a := float64(k) * 2 * math.Pi / float64(lados)
+		xy[k] = [2]float64{cx + raio*math.Cos(a), cy + raio*math.Sin(a)}
+	}
+	rz.poligono(xy...)
+}
+
+// anel acrescenta o contorno de um círculo com a largura dada (pixels).
+func (rz *rasterizador) anel(cx, cy, raio, largura float64) {
+	const lados = 32
+	for k := 0; k < lados; k++ {
+		a0, a1 := float64(k)*2*math.Pi/lados, float64(k+1)*2*math.Pi/lados
+		rz.linha(cx+raio*math.Cos(a0), cy+raio*math.Sin(a0), cx+raio*math.Cos(a1), cy+raio*math.Sin(a1), largura)
+	}
+}
+
+// pintar preenche com a cor tudo o que foi acumulado e recomeça.
+func (rz *rasterizador) pintar(cor color.Color) {
+	b := rz.dst.Bounds()
+	rz.r.DrawOp = draw.Over
+	rz.r.Draw(rz.dst, b, image.NewUniform(cor), image.Point{})
+	rz.r.Reset(b.Dx(), b.Dy())
+}
+
+// faixaVia desenha a via ao longo da polilinha como no editor: trilhos a meia
+// bitola acima e abaixo (vertical da tela) ou a faixa entre eles preenchida.
+func (rz *rasterizador) faixaVia(pontos []Ponto, espessura float64, cheio bool, cor color.RGBA) {
+	if len(pontos) < 2 {
+		return
+	}
+	meia := math.Max(math.Max(espessura*rz.zoom, 1)/2, 0.5)
+	traco := math.Max(TracoTrilho*rz.zoom, 0.5)
+	xy := make([][2]float64, len(pontos))
+	for k, p := range pontos {
+		xy[k][0], xy[k][1] = rz.tela(p)
+	}
+	for k := 1; k < len(xy); k++ {
+		a, b := xy[k-1], xy[k]
+		if cheio {
+			rz.poligono([2]float64{a[0], a[1] - meia}, [2]float64{b[0], b[1] - meia}, [2]float64{b[0], b[1] + meia}, [2]float64{a[0], a[1] + meia})
+		} else {
+			rz.linha(a[0], a[1]-meia, b[0], b[1]-meia, traco)
+			rz.linha(a[0], a[1]+meia, b[0], b[1]+meia, traco)
+		}
+	}
+	if !cheio {
+		for _, p := range [][2]float64{xy[0], xy[len(xy)-1]} {
+			rz.linha(p[0], p[1]-meia, p[0], p[1]+meia, traco)
+		}
+	}
+	rz.pintar(cor)
+}
+
+func (rz *rasterizador) circuitoVia(el Elemento, cor color.RGBA) {
+	x, y := rz.tela(Ponto{el.X, el.Y})
+	barra := el.Largura * rz.zoom
+	traco := math.Max(el.Espessura*rz.zoom, 0.5)
+	rz.linha(x, y-barra/2, x, y+barra/2, traco)
+	haste := barra / 2
+	if el.OrientacaoTC == "Invertido" {
+		haste = -haste
+	}
+	rz.linha(x, y, x+haste, y, traco)
+	rz.pintar(cor)
+}
+
+func (rz *rasterizador) chave(el Elemento, cor color.RGBA) {
+	ponta, posicionado, livre := el.PontasChave()
+	if el.PosicaoAtual() == PosicaoReversa {
+		posicionado, livre = livre, posicionado
+	}
+	px, py := rz.tela(ponta)
+	lx, ly := rz.tela(livre)
+	rz.linha(px, py, lx, ly, math.Max(TracoTrilho*rz.zoom, 0.5))
+	rz.pintar(CorRamoLivre)
+	ox, oy := rz.tela(posicionado)
+	rz.linha(px, py, ox, oy, math.Max(el.Largura*rz.zoom, 1))
+	rz.disco(px, py, math.Max(el.Espessura*rz.zoom, 1))
+	rz.pintar(cor)
+}
+
+// sinal desenha mastro, cabeçote e lâmpadas; a piscante é exportada acesa.
+func (rz *rasterizador) sinal(el Elemento, cor color.RGBA) {
+	base, cabecote, lampadas := el.GeometriaSinal()
+	bx, by := rz.tela(base)
+	cx, cy := rz.tela(cabecote)
+	traco := math.Max(TracoTrilho*rz.zoom, 1)
+	rz.linha(bx, by, cx, cy, traco)
+	tipo := el.TipoSinalAtual()
+	raio := el.Espessura * rz.zoom
+	if tipo == SinalManobra {
+		raio *= 0.75
+	}
+	raio = math.Max(raio, 1.5)
+	if tipo == SinalDistante { // Barra transversal no meio do mastro
+		rad := el.Rotacao * math.Pi / 180
+		mx, my := (bx+cx)/2, (by+cy)/2
+		meia := el.Espessura * rz.zoom
+		rz.linha(mx-math.Cos(rad)*meia, my-math.Sin(rad)*meia, mx+math.Cos(rad)*meia, my+math.Sin(rad)*meia, traco)
+	}
+	rz.pintar(cor)
+	ux, uy := rz.tela(lampadas[len(lampadas)-1])
+	rz.linha(cx, cy, ux, uy, raio*2.6)
+	rz.disco(ux, uy, raio*1.3)
+	rz.pintar(CorCabecoteSinal)
+	acesa, _ := CorLampada(el.Aspecto)
+	for k, c := range LampadasSinal(tipo) {
+		lx, ly := rz.tela(lampadas[k])
+		rz.disco(lx, ly, raio)
+		if c == acesa {
+			rz.pintar(CorAspecto[c])
+		} else {
+			rz.pintar(CorLampadaApagada)
+		}
+		rz.anel(lx, ly, raio, 1)
+		rz.pintar(cor)
+	}
+}
+
+// RenderizarImagem desenha a malha conforme as opções. Vias de seções
+// ocupadas ou com falha recebem as cores de estado, como no editor.
+func RenderizarImagem(elementos []Elemento, op OpcoesImagem) (*image.RGBA, error) {
+	largura, altura, zoom, origemX, origemY, err := op.enquadrar(CaixaDe(elementos))
+	if err != nil {
+		return nil, err
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, largura, altura))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(op.Fundo), image.Point{}, draw.Src)
+	rz := &rasterizador{dst: dst, r: vector.NewRasterizer(largura, altura), zoom: zoom, origemX: origemX, origemY: origemY}
+	secoes := BuildSecoes(elementos, BuildTopologia(elementos))
+	for _, el := range elementos {
+		cor := el.Cor
+		if idx := secoes.SecaoDoElemento(el.ID); idx != -1 {
+			switch secoes.Lista[idx].Estado {
+			case EstadoOcupado:
+				cor = CorSecaoOcupada
+			case EstadoFalha:
+				cor = CorSecaoFalha
+			}
+		}
+		switch el.Tipo {
+		case ElementoViaReta, ElementoViaCurva, ElementoViaTransicao:
+			rz.faixaVia(el.PolilinhaVia(), el.Espessura, el.ModoCheio, cor)
+		case ElementoCircuitoVia:
+			rz.circuitoVia(el, cor)
+		case ElementoChaveSimples:
+			rz.chave(el, cor)
+		case ElementoSinal:
+			rz.sinal(el, cor)
+		}
+	}
+	return dst, nil
+}
+
+// ExportarPNG grava a malha como PNG conforme as opções.
+func ExportarPNG(w io.Writer, elementos []Elemento, op OpcoesImagem) error {
+	img, err := RenderizarImagem(elementos, op)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
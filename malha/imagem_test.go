@@ -0,0 +1,132 @@
+package malha
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+)
+
+func TestEnquadrar(t *testing.T) {
+	caixa := Caixa{0, -1, 10, 1} // Via de 1000 m com espessura 2
+	for _, tc := range []struct {
+		nome             string
+		op               OpcoesImagem
+		largura, altura  int
+		zoom             float64
+		origemX, origemY float64
+		erro             bool
+	}{
+		{nome: "escala", op: OpcoesImagem{Escala: 1, Margem: 10}, largura: 1020, altura: 220, zoom: 100, origemX: -0.1, origemY: -1.1},
+		{nome: "largura e altura", op: OpcoesImagem{Largura: 220, Altura: 220, Margem: 10}, largura: 220, altura: 220, zoom: 20, origemX: -0.5, origemY: -5.5},
+		{nome: "só largura", op: OpcoesImagem{Largura: 120, Margem: 10}, largura: 120, altura: 40, zoom: 10, origemX: -1, origemY: -2},
+		{nome: "só altura", op: OpcoesImagem{Altura: 42, Margem: 1}, largura: 202, altura: 42, zoom: 20, origemX: -0.05, origemY: -1.05},
+		{nome: "sem tamanho nem escala", op: OpcoesImagem{Margem: 10}, erro: true},
+		{nome: "margem maior que a imagem", op: OpcoesImagem{Largura: 100, Altura: 100, Margem: 60}, erro: true},
+		{nome: "grande demais", op: OpcoesImagem{Escala: 100}, erro: true},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			largura, altura, zoom, origemX, origemY, err := tc.op.enquadrar(caixa)
+			if (err != nil) != tc.erro {
+				t.Fatalf("erro = %v, quer erro: %v", err, tc.erro)
+			}
+			if tc.erro {
+				return
+			}
+			if largura != tc.largura || altura != tc.altura || !perto(zoom, tc.zoom) || !perto(origemX, tc.origemX) || !perto(origemY, tc.origemY) {
+				t.Errorf("enquadrar = %dx%d zoom %v origem (%v,%v), quer %dx%d zoom %v origem (%v,%v)",
+					largura, altura, zoom, origemX, origemY, tc.largura, tc.altura, tc.zoom, tc.origemX, tc.origemY)
+			}
+		})
+	}
+}
+
+func TestExportarPNG(t *testing.T) {
+	azul := color.RGBA{B: 255, A: 255}
+	branco := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	// A caixa da via (12 × 2 Unid. Mundo com a margem da espessura) dá zoom
+	// 200/12: o eixo fica na linha 110 e os trilhos perto das linhas 93 e 127
+	op := OpcoesImagem{Largura: 220, Altura: 220, Margem: 10, Fundo: branco}
+	for _, tc := range []struct {
+		nome           string
+		cheia          bool
+		estado         string
+		centro, trilho color.RGBA
+	}{
+		{nome: "cheia", cheia: true, centro: azul, trilho: azul},
+		{nome: "vazada", centro: branco, trilho: azul},
+		{nome: "ocupada", cheia: true, estado: EstadoOcupado, centro: CorSecaoOcupada, trilho: CorSecaoOcupada},
+		{nome: "em falha", estado: EstadoFalha, centro: branco, trilho: CorSecaoFalha},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			via := viaReta(1, 0, 0, 1000, 0)
+			via.Cor, via.ModoCheio, via.Estado = azul, tc.cheia, tc.estado
+			var buf bytes.Buffer
+			if err := ExportarPNG(&buf, []Elemento{via}, op); err != nil {
+				t.Fatalf("ExportarPNG: %v", err)
+			}
+			img, err := png.Decode(&buf)
+			if err != nil {
+				t.Fatalf("PNG inválido: %v", err)
+			}
+			if b := img.Bounds(); b.Dx() != 220 || b.Dy() != 220 {
+				t.Fatalf("imagem de %dx%d, quer 220x220", b.Dx(), b.Dy())
+			}
+			for _, p := range []struct {
+				x, y int
+				quer color.RGBA
+			}{{110, 110, tc.centro}, {110, 95, tc.trilho}, {110, 125, tc.trilho}, {5, 5, branco}, {110, 60, branco}} {
+				if got := color.RGBAModel.Convert(img.At(p.x, p.y)).(color.RGBA); !mesmaCor(got, p.quer) {
+					t.Errorf("pixel (%d,%d) = %v, quer %v", p.x, p.y, got, p.quer)
+				}
+			}
+		})
+	}
+}
+
+func TestExportarPNGTransicao(t *testing.T) {
+	azul := color.RGBA{B: 255, A: 255}
+	branco := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	via := viaTransicao(1, 0, 0, 0, 2000, 0, 2000, 1)
+	via.Cor, via.ModoCheio, via.Espessura = azul, true, 1
+	op := OpcoesImagem{Largura: 400, Altura: 400, Margem: 10, Fundo: branco}
+	var buf bytes.Buffer
+	if err := ExportarPNG(&buf, []Elemento{via}, op); err != nil {
+		t.Fatalf("ExportarPNG: %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("PNG inválido: %v", err)
+	}
+	_, _, zoom, origemX, origemY, _ := op.enquadrar(via.Caixa())
+	pixel := func(p Ponto) color.RGBA {
+		return color.RGBAModel.Convert(img.At(int((p.X-origemX)*zoom), int((p.Y-origemY)*zoom))).(color.RGBA)
+	}
+	// Pontos da clotoide são pintados; o meio da corda, por dentro da curva, não.
+	for _, frac := range []float64{0.1, 0.5, 0.9} {
+		if p, _ := via.PontoNaVia(frac); !mesmaCor(pixel(p), azul) {
+			t.Errorf("pixel da via em t=%.1f = %v, quer %v", frac, pixel(p), azul)
+		}
+	}
+	x1, y1, x2, y2 := via.Extremidades()
+	if got := pixel(Ponto{(x1 + x2) / 2, (y1 + y2) / 2}); !mesmaCor(got, branco) {
+		t.Errorf("pixel no meio da corda = %v, quer %v", got, branco)
+	}
+}
+
+func TestExportarPNGMalhaVazia(t *testing.T) {
+	var buf bytes.Buffer
+	if err := ExportarPNG(&buf, nil, OpcoesImagem{Largura: 10, Altura: 10}); err != nil {
+		t.Fatalf("ExportarPNG sem elementos: %v", err)
+	}
+	if _, err := png.Decode(&buf); err != nil {
+		t.Fatalf("PNG inválido: %v", err)
+	}
+}
+
+// mesmaCor tolera o arredondamento do rasterizador.
+func mesmaCor(a, b color.RGBA) bool {
+	d := func(x, y uint8) bool { return math.Abs(float64(x)-float64(y)) <= 2 }
+	return d(a.R, b.R) && d(a.G, b.G) && d(a.B, b.B) && d(a.A, b.A)
+}
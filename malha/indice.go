@@ -0,0 +1,247 @@
+package malha
+
+import (
+	"math"
+	"slices"
+	"sort"
+)
+
+// --- Índice Espacial ---
+// Grade uniforme de células quadradas com os índices (posição em elementos)
+// dos elementos cuja caixa envolvente toca cada célula. Elementos que cobririam
+// células demais ficam numa lista à parte, sempre consultada. O índice
+// acompanha as edições elemento a elemento (Adicionar, Remover, Atualizar),
+// sem ser refeito a cada mudança.
+
+const (
+	IndiceCelulaPadrao = 50.0 // Lado da célula (Unid. Mundo)
+	indiceMaxCelulas   = 1024 // Acima disso o elemento vai para a lista de grandes
+)
+
+// Caixa é um retângulo alinhado aos eixos (Unid. Mundo).
+type Caixa struct {
+	MinX, MinY, MaxX, MaxY float64
+}
+
+// Intersecta indica se as caixas se sobrepõem.
+func (c Caixa) Intersecta(o Caixa) bool {
+	return c.MinX <= o.MaxX && o.MinX <= c.MaxX && c.MinY <= o.MaxY && o.MinY <= c.MaxY
+}
+
+// caixaDePontos devolve a caixa que envolve os pontos com a margem dada.
+func caixaDePontos(pontos []Ponto, margem float64) Caixa {
+	c := Caixa{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range pontos {
+		c.MinX, c.MinY = math.Min(c.MinX, p.X-margem), math.Min(c.MinY, p.Y-margem)
+		c.MaxX, c.MaxY = math.Max(c.MaxX, p.X+margem), math.Max(c.MaxY, p.Y+margem)
+	}
+	return c
+}
+
+// CaixaDe devolve a caixa que envolve todos os elementos (infinita invertida se vazio).
+func CaixaDe(elementos []Elemento) Caixa {
+	c := Caixa{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, el := range elementos {
+		e := el.Caixa()
+		c.MinX, c.MinY = math.Min(c.MinX, e.MinX), math.Min(c.MinY, e.MinY)
+		c.MaxX, c.MaxY = math.Max(c.MaxX, e.MaxX), math.Max(c.MaxY, e.MaxY)
+	}
+	return c
+}
+
+// Caixa devolve a caixa envolvente do elemento como desenhado.
+func (el Elemento) Caixa() Caixa {
+	switch el.Tipo {
+	case ElementoViaReta, ElementoViaCurva, ElementoViaTransicao:
+		margem := el.Espessura / 2.0
+		raio := el.Raio // Na transição vale o trecho mais fechado
+		if el.Tipo == ElementoViaTransicao && el.RaioInicial > 0 && (raio == 0 || el.RaioInicial < raio) {
+			raio = el.RaioInicial
+		}
+		if el.Tipo != ElementoViaReta { // A polilinha corta o arco por dentro; cobre a flecha
+			margem += raio * PixelsPerMeter * (1 - math.Cos(curvaPassoGraus*math.Pi/360))
+		}
+		return caixaDePontos(el.PolilinhaVia(), margem)
+	case ElementoCircuitoVia:
+		return caixaDePontos([]Ponto{{el.X, el.Y}}, el.Largura/2.0+el.Espessura)
+	case ElementoChaveSimples:
+		return caixaDePontos(el.PontosConexao(), math.Max(el.Espessura, el.Largura/2.0))
+	case ElementoSinal:
+		base, cabecote, lampadas := el.GeometriaSinal()
+		raio := math.Hypot(lampadas[0].X-cabecote.X, lampadas[0].Y-cabecote.Y)
+		return caixaDePontos(append([]Ponto{base, cabecote}, lampadas...), raio*1.5)
+	}
+	return caixaDePontos([]Ponto{{el.X, el.Y}}, el.Espessura)
+}
+
+// IndiceEspacial acelera a busca de elementos por região.
+type IndiceEspacial struct {
+	celula  float64
+	grade   map[[2]int][]int
+	grandes []int
+	caixas  []Caixa // Caixa registrada de cada índice (para remover ao atualizar)
+}
+
+// NewIndiceEspacial indexa todos os elementos com células de lado celula.
+func NewIndiceEspacial(elementos []Elemento, celula float64) *IndiceEspacial {
+	if celula <= 0 {
+		celula = IndiceCelulaPadrao
+	}
+	ix := &IndiceEspacial{celula: celula, grade: map[[2]int][]int{}}
+	for i := range elementos {
+		ix.Adicionar(elementos, i)
+	}
+	return ix
+}
+
+// celulas devolve o intervalo de células coberto pela caixa.
+func (ix *IndiceEspacial) celulas(c Caixa) (x0, y0, x1, y1 int) {
+	return int(math.Floor(c.MinX / ix.celula)), int(math.Floor(c.MinY / ix.celula)),
+		int(math.Floor(c.MaxX / ix.celula)), int(math.Floor(c.MaxY / ix.celula))
+}
+
+// Adicionar indexa o elemento de índice i, recém-inserido em elementos; os
+// índices a partir de i avançam uma posição.
+func (ix *IndiceEspacial) Adicionar(elementos []Elemento, i int) {
+	if i < len(ix.caixas) {
+		ix.deslocar(i, 1)
+		ix.caixas = slices.Insert(ix.caixas, i, Caixa{})
+	}
+	ix.indexar(elementos, i)
+}
+
+// Atualizar reindexa o elemento de índice i após ele ser movido ou alterado.
+func (ix *IndiceEspacial) Atualizar(elementos []Elemento, i int) {
+	if i >= len(ix.caixas) {
+		ix.Adicionar(elementos, i)
+		return
+	}
+	ix.desindexar(i)
+	ix.indexar(elementos, i)
+}
+
+// Remover tira do índice o elemento de índice i, já removido de elementos; os
+// índices seguintes recuam uma posição.
+func (ix *IndiceEspacial) Remover(i int) {
+	if i >= len(ix.caixas) {
+		return
+	}
+	ix.desindexar(i)
+	ix.caixas = slices.Delete(ix.caixas, i, i+1)
+	ix.deslocar(i+1, -1)
+}
+
+// indexar registra a caixa do elemento de índice i nas células que ela toca.
+func (ix *IndiceEspacial) indexar(elementos []Elemento, i int) {
+	for len(ix.caixas) <= i {
+		ix.caixas = append(ix.caixas, Caixa{})
+	}
+	c := elementos[i].Caixa()
+	ix.caixas[i] = c
+	x0, y0, x1, y1 := ix.celulas(c)
+	if (x1-x0+1)*(y1-y0+1) > indiceMaxCelulas || x1 < x0 || y1 < y0 {
+		ix.grandes = append(ix.grandes, i)
+		return
+	}
+	for cx := x0; cx <= x1; cx++ {
+		for cy := y0; cy <= y1; cy++ {
+			ix.grade[[2]int{cx, cy}] = append(ix.grade[[2]int{cx, cy}], i)
+		}
+	}
+}
+
+// desindexar tira o índice i das células da caixa registrada para ele.
+func (ix *IndiceEspacial) desindexar(i int) {
+	ix.grandes = removerIndice(ix.grandes, i)
+	x0, y0, x1, y1 := ix.celulas(ix.caixas[i])
+	if (x1-x0+1)*(y1-y0+1) <= indiceMaxCelulas {
+		for cx := x0; cx <= x1; cx++ {
+			for cy := y0; cy <= y1; cy++ {
+				chave := [2]int{cx, cy}
+				if restante := removerIndice(ix.grade[chave], i); len(restante) > 0 {
+					ix.grade[chave] = restante
+				} else {
+					delete(ix.grade, chave)
+				}
+			}
+		}
+	}
+}
+
+// deslocar soma delta aos índices registrados a partir de inicio.
+func (ix *IndiceEspacial) deslocar(inicio, delta int) {
+	for k, v := range ix.grandes {
+		if v >= inicio {
+			ix.grandes[k] = v + delta
+		}
+	}
+	for _, lista := range ix.grade {
+		for k, v := range lista {
+			if v >= inicio {
+				lista[k] = v + delta
+			}
+		}
+	}
+}
+
+func removerIndice(lista []int, i int) []int {
+	for k, v := range lista {
+		if v == i {
+			return append(lista[:k], lista[k+1:]...)
+		}
+	}
+	return lista
+}
+
+// Consultar devolve, em ordem crescente, os índices dos elementos cuja caixa
+// toca a região.
+func (ix *IndiceEspacial) Consultar(regiao Caixa) []int {
+	vistos := map[int]bool{}
+	resultado := []int{}
+	incluir := func(i int) {
+		if !vistos[i] && ix.caixas[i].Intersecta(regiao) {
+			vistos[i] = true
+			resultado = append(resultado, i)
+		}
+	}
+	for _, i := range ix.grandes {
+		incluir(i)
+	}
+	x0, y0, x1, y1 := ix.celulas(regiao)
+	if (x1-x0+1)*(y1-y0+1) > len(ix.grade) { // Região maior que a malha: varre as células ocupadas
+		for _, indices := range ix.grade {
+			for _, i := range indices {
+				incluir(i)
+			}
+		}
+	} else {
+		for cx := x0; cx <= x1; cx++ {
+			for cy := y0; cy <= y1; cy++ {
+				for _, i := range ix.grade[[2]int{cx, cy}] {
+					incluir(i)
+				}
+			}
+		}
+	}
+	sort.Ints(resultado)
+	return resultado
+}
+
+// FindClosestElementIndexado é FindClosestElement restrito aos candidatos do
+// índice próximos de (worldX, worldY).
+func FindClosestElementIndexado(elementos []Elemento, ix *IndiceEspacial, worldX, worldY, limiar float64) int {
+	candidatos := ix.Consultar(Caixa{worldX - limiar, worldY - limiar, worldX + limiar, worldY + limiar})
+	closestIndex := -1
+	minDist := limiar
+	for k := len(candidatos) - 1; k >= 0; k-- {
+		i := candidatos[k]
+		if i >= len(elementos) {
+			continue
+		}
+		if d := DistanceToEdge(elementos[i], worldX, worldY); d < minDist {
+			minDist = d
+			closestIndex = i
+		}
+	}
+	return closestIndex
+}
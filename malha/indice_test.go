@@ -0,0 +1,103 @@
+package malha
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// consultaBruta devolve os índices dos elementos cuja caixa toca a região,
+// sem o índice.
+func consultaBruta(elementos []Elemento, regiao Caixa) []int {
+	indices := []int{}
+	for i, el := range elementos {
+		if el.Caixa().Intersecta(regiao) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// conferirIndice compara o índice com a busca bruta numa grade de regiões.
+func conferirIndice(t *testing.T, ix *IndiceEspacial, elementos []Elemento) {
+	t.Helper()
+	regioes := []Caixa{{-1e9, -1e9, 1e9, 1e9}}
+	for x := -100.0; x <= 300; x += 70 {
+		for y := -100.0; y <= 300; y += 70 {
+			regioes = append(regioes, Caixa{x, y, x + 40, y + 40})
+		}
+	}
+	for _, r := range regioes {
+		if got, quer := ix.Consultar(r), consultaBruta(elementos, r); !slices.Equal(got, quer) {
+			t.Fatalf("Consultar(%v) = %v, quer %v", r, got, quer)
+		}
+	}
+}
+
+func malhaIndice() []Elemento {
+	return []Elemento{
+		viaReta(1, 0, 0, 10000, 0),
+		viaReta(2, 100, 0, 15000, 90),
+		viaReta(3, -50, 200, 30000, -30),
+		viaReta(4, 0, 0, 1e8, 45), // Cobre células demais: vai para a lista de grandes
+		circuito(5, 100, 0),
+		circuito(6, 250, 250),
+	}
+}
+
+func TestIndiceConsultar(t *testing.T) {
+	elementos := malhaIndice()
+	ix := NewIndiceEspacial(elementos, IndiceCelulaPadrao)
+	conferirIndice(t, ix, elementos)
+	if got := ix.Consultar(Caixa{240, 240, 260, 260}); !slices.Equal(got, []int{3, 5}) {
+		t.Errorf("Consultar em volta do circuito 6 = %v, quer [3 5]", got)
+	}
+	if got := ix.Consultar(Caixa{1000, -500, 1100, -400}); len(got) != 0 {
+		t.Errorf("Consultar longe da malha = %v, quer vazio", got)
+	}
+}
+
+func TestIndiceAtualizar(t *testing.T) {
+	elementos := malhaIndice()
+	ix := NewIndiceEspacial(elementos, IndiceCelulaPadrao)
+	elementos[5].X, elementos[5].Y = -80, -80
+	ix.Atualizar(elementos, 5)
+	conferirIndice(t, ix, elementos)
+	if got := ix.Consultar(Caixa{240, 240, 260, 260}); !slices.Equal(got, []int{3}) {
+		t.Errorf("Consultar na posição antiga = %v, quer [3]", got)
+	}
+	elementos[3].Comprimento = 1000 // Sai da lista de grandes
+	ix.Atualizar(elementos, 3)
+	conferirIndice(t, ix, elementos)
+}
+
+func TestIndiceAdicionarRemover(t *testing.T) {
+	elementos := malhaIndice()
+	ix := NewIndiceEspacial(elementos, IndiceCelulaPadrao)
+	r := rand.New(rand.NewPCG(1, 2))
+	for passo := range 200 {
+		if len(elementos) > 0 && r.IntN(2) == 0 {
+			i := r.IntN(len(elementos))
+			elementos = slices.Delete(elementos, i, i+1)
+			ix.Remover(i)
+		} else {
+			i := r.IntN(len(elementos) + 1)
+			el := viaReta(100+passo, r.Float64()*300-100, r.Float64()*300-100, r.Float64()*20000, r.Float64()*360)
+			elementos = slices.Insert(elementos, i, el)
+			ix.Adicionar(elementos, i)
+		}
+		conferirIndice(t, ix, elementos)
+	}
+}
+
+func TestCaixaTransicao(t *testing.T) {
+	// A caixa cobre a clotoide inteira, não só os vértices da polilinha.
+	via := viaTransicao(1, 0, 0, 0, 3000, 0, 500, 1)
+	c := via.Caixa()
+	for k := 0; k <= 200; k++ {
+		p, _ := via.PontoNaVia(float64(k) / 200)
+		if !c.Intersecta(Caixa{p.X, p.Y, p.X, p.Y}) {
+			t.Fatalf("ponto %v da transição fora da caixa %v", p, c)
+		}
+	}
+}
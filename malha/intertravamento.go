@@ -0,0 +1,364 @@
+package malha
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// --- Intertravamento ---
+// Uma Rota vai de um sinal (ou via) de origem até um sinal ou via de destino,
+// pelo menor caminho na topologia em que o trem respeitaria o sentido dos
+// sinais. A via do sinal de origem é a via de espera do trem e não faz parte
+// da rota; a via do sinal de destino entra até o sinal.
+// Estabelecer a rota exige todas as seções do percurso livres e nenhum
+// elemento travado por outra rota; as chaves são então movidas para as
+// posições exigidas e ficam travadas. A rota é liberada por seção: cada seção,
+// na ordem do percurso, destrava quando o trem a ocupou e a deixou livre.
+// O estado não é persistido: fica só na sessão do editor.
+
+// PosicaoExigida é a posição de uma chave no percurso de uma rota.
+type PosicaoExigida struct {
+	ChaveID int
+	Posicao string
+}
+
+// Rota é um itinerário calculado (ainda não estabelecido).
+type Rota struct {
+	Nome        string
+	OrigemID    int
+	DestinoID   int
+	Elementos   []int // Vias e chaves na ordem do percurso
+	Chaves      []PosicaoExigida
+	Comprimento float64 // Metros do sinal (ou fim da via) de origem ao destino
+}
+
+// partidasRota devolve os passos iniciais a partir da origem: do sinal, no
+// seu sentido (custando o resto da via de espera); da via, por qualquer das
+// extremidades.
+func partidasRota(t *Topologia, origem Elemento) []Partida {
+	switch origem.Tipo {
+	case ElementoSinal:
+		arestas := t.ArestasDoElemento(origem.ViaID)
+		if len(arestas) == 0 {
+			return nil
+		}
+		a := t.Arestas[arestas[0]]
+		distancia := math.Max(0, math.Min(a.Comprimento, origem.Distancia))
+		if origem.Sentido == SentidoDecrescente {
+			return []Partida{{PassoCaminho{arestas[0], a.NoB}, distancia}}
+		}
+		return []Partida{{PassoCaminho{arestas[0], a.NoA}, a.Comprimento - distancia}}
+	case ElementoViaReta, ElementoViaCurva, ElementoViaTransicao:
+		partidas := []Partida{}
+		for _, a := range t.ArestasDoElemento(origem.ID) {
+			partidas = append(partidas, Partida{PassoCaminho{a, t.Arestas[a].NoA}, 0}, Partida{PassoCaminho{a, t.Arestas[a].NoB}, 0})
+		}
+		return partidas
+	}
+	return nil
+}
+
+// chegadaRota aceita a entrada na via do destino: num sinal, só no sentido
+// dele e até ele; numa via, por qualquer lado e até o fim.
+func chegadaRota(t *Topologia, destino Elemento) func(PassoCaminho) (float64, bool) {
+	return func(p PassoCaminho) (float64, bool) {
+		a := t.Arestas[p.Aresta]
+		switch destino.Tipo {
+		case ElementoSinal:
+			if a.ElementoID != destino.ViaID {
+				return 0, false
+			}
+			distancia := math.Max(0, math.Min(a.Comprimento, destino.Distancia))
+			if destino.Sentido == SentidoDecrescente {
+				return a.Comprimento - distancia, p.Entrada == a.NoB
+			}
+			return distancia, p.Entrada == a.NoA
+		case ElementoViaReta, ElementoViaCurva, ElementoViaTransicao:
+			return a.Comprimento, a.ElementoID == destino.ID
+		}
+		return 0, false
+	}
+}
+
+// CalcularRota acha o percurso da origem (sinal ou via) ao destino (sinal ou via).
+func CalcularRota(elementos []Elemento, t *Topologia, origemID, destinoID int) (Rota, error) {
+	var origem, destino Elemento
+	achouOrigem, achouDestino := false, false
+	for _, el := range elementos {
+		if el.ID == origemID {
+			origem, achouOrigem = el, true
+		}
+		if el.ID == destinoID {
+			destino, achouDestino = el, true
+		}
+	}
+	ehExtremo := func(el Elemento) bool { return el.Tipo == ElementoSinal || el.Tipo.EhVia() }
+	switch {
+	case !achouOrigem || !ehExtremo(origem):
+		return Rota{}, fmt.Errorf("origem ID %d não é sinal nem via", origemID)
+	case !achouDestino || !ehExtremo(destino):
+		return Rota{}, fmt.Errorf("destino ID %d não é sinal nem via", destinoID)
+	case origemID == destinoID:
+		return Rota{}, fmt.Errorf("origem e destino são o mesmo elemento")
+	}
+	partidas := partidasRota(t, origem)
+	if len(partidas) == 0 {
+		return Rota{}, fmt.Errorf("origem %s não está numa via", origem.Rotulo())
+	}
+	passos, comprimento, ok := t.MenorCaminho(partidas, chegadaRota(t, destino), false)
+	if !ok {
+		return Rota{}, fmt.Errorf("não há percurso de %s até %s", origem.Rotulo(), destino.Rotulo())
+	}
+	return rotaDoPercurso(t, origem, destino, passos, comprimento)
+}
+
+// rotaDoPercurso monta a rota a partir dos passos (o primeiro na via de origem).
+func rotaDoPercurso(t *Topologia, origem, destino Elemento, passos []PassoCaminho, comprimento float64) (Rota, error) {
+	viaOrigem := origem.ID
+	if origem.Tipo == ElementoSinal {
+		viaOrigem = origem.ViaID
+	}
+	rota := Rota{Nome: origem.Rotulo() + "-" + destino.Rotulo(), OrigemID: origem.ID, DestinoID: destino.ID, Comprimento: comprimento}
+	for _, p := range passos {
+		a := t.Arestas[p.Aresta]
+		if a.ElementoID == viaOrigem {
+			continue // Via de espera
+		}
+		rota.Elementos = append(rota.Elementos, a.ElementoID)
+		if a.Ramo != "" {
+			rota.Chaves = append(rota.Chaves, PosicaoExigida{ChaveID: a.ElementoID, Posicao: a.Ramo})
+		}
+	}
+	if len(rota.Elementos) == 0 {
+		return Rota{}, fmt.Errorf("destino %s está na via de origem", destino.Rotulo())
+	}
+	return rota, nil
+}
+
+// RotaTravada é uma rota estabelecida. Grupos reúne os elementos do percurso
+// por seção, na ordem; os Liberados primeiros grupos já foram destravados.
+type RotaTravada struct {
+	Rota
+	Grupos     [][]int
+	Ocupado    []bool // O grupo já foi ocupado pelo trem
+	Liberados  int
+	Percorrida bool // O trem entrou na rota (o sinal de origem fecha)
+}
+
+// Intertravamento guarda as rotas estabelecidas.
+type Intertravamento struct {
+	Rotas []RotaTravada
+}
+
+// gruposPorSecao agrupa elementos consecutivos da mesma seção.
+func gruposPorSecao(elementos []int, s *Secoes) [][]int {
+	grupos := [][]int{}
+	ultima := -2
+	for _, id := range elementos {
+		if idx := s.SecaoDoElemento(id); idx != ultima || idx == -1 {
+			grupos = append(grupos, nil)
+			ultima = idx
+		}
+		grupos[len(grupos)-1] = append(grupos[len(grupos)-1], id)
+	}
+	return grupos
+}
+
+// secaoOcupada indica se a seção do elemento tem trem (ocupados) ou estado ocupado/falha.
+func secaoOcupada(s *Secoes, id int, ocupados map[int]bool) bool {
+	idx := s.SecaoDoElemento(id)
+	if idx == -1 {
+		return ocupados[id]
+	}
+	if s.Lista[idx].Estado != EstadoLivre {
+		return true
+	}
+	for _, membro := range s.Lista[idx].Elementos {
+		if ocupados[membro] {
+			return true
+		}
+	}
+	return false
+}
+
+// Travados devolve os IDs de elementos travados e o nome da rota que os trava.
+func (it *Intertravamento) Travados() map[int]string {
+	travados := map[int]string{}
+	for _, r := range it.Rotas {
+		for _, grupo := range r.Grupos[r.Liberados:] {
+			for _, id := range grupo {
+				travados[id] = r.Nome
+			}
+		}
+	}
+	return travados
+}
+
+// ChaveTravada devolve o nome da rota que trava a chave, ou vazio.
+func (it *Intertravamento) ChaveTravada(id int) string {
+	return it.Travados()[id]
+}
+
+// Verificar confere se a rota pode ser estabelecida: seções livres e nenhum
+// elemento travado por outra rota.
+func (it *Intertravamento) Verificar(rota Rota, s *Secoes, ocupados map[int]bool) error {
+	travados := it.Travados()
+	motivos := []string{}
+	secoesVistas := map[int]bool{}
+	for _, id := range rota.Elementos {
+		if nome, ok := travados[id]; ok {
+			motivos = append(motivos, fmt.Sprintf("ID %d travado pela rota %s", id, nome))
+		}
+		if idx := s.SecaoDoElemento(id); secaoOcupada(s, id, ocupados) && !secoesVistas[idx] {
+			secoesVistas[idx] = true
+			nome := fmt.Sprintf("ID %d", id)
+			if idx != -1 {
+				nome = s.Lista[idx].Nome
+			}
+			motivos = append(motivos, fmt.Sprintf("seção %s ocupada", nome))
+		}
+	}
+	if len(motivos) > 0 {
+		return fmt.Errorf("rota %s: %s", rota.Nome, strings.Join(motivos, "; "))
+	}
+	return nil
+}
+
+// Travar registra a rota como estabelecida (as chaves já devem estar nas
+// posições exigidas).
+func (it *Intertravamento) Travar(rota Rota, s *Secoes) {
+	grupos := gruposPorSecao(rota.Elementos, s)
+	it.Rotas = append(it.Rotas, RotaTravada{Rota: rota, Grupos: grupos, Ocupado: make([]bool, len(grupos))})
+}
+
+// Cancelar desfaz a rota de índice i, se o trem ainda não entrou nela.
+func (it *Intertravamento) Cancelar(i int) error {
+	if it.Rotas[i].Percorrida {
+		return fmt.Errorf("rota %s já percorrida: aguarde a liberação", it.Rotas[i].Nome)
+	}
+	it.Rotas = append(it.Rotas[:i], it.Rotas[i+1:]...)
+	return nil
+}
+
+// RotaDaOrigem devolve o índice da rota estabelecida a partir do elemento, ou -1.
+func (it *Intertravamento) RotaDaOrigem(origemID int) int {
+	for i, r := range it.Rotas {
+		if r.OrigemID == origemID {
+			return i
+		}
+	}
+	return -1
+}
+
+// Liberar acompanha a ocupação e destrava as seções que o trem já deixou, na
+// ordem do percurso. Devolve os nomes das rotas inteiramente liberadas.
+func (it *Intertravamento) Liberar(s *Secoes, ocupados map[int]bool) []string {
+	liberadas := []string{}
+	mantidas := it.Rotas[:0]
+	for _, r := range it.Rotas {
+		for k, grupo := range r.Grupos {
+			if k >= r.Liberados && secaoOcupada(s, grupo[0], ocupados) {
+				r.Ocupado[k] = true
+				r.Percorrida = true
+			}
+		}
+		for r.Liberados < len(r.Grupos) && r.Ocupado[r.Liberados] && !secaoOcupada(s, r.Grupos[r.Liberados][0], ocupados) {
+			r.Liberados++
+		}
+		if r.Liberados == len(r.Grupos) {
+			liberadas = append(liberadas, r.Nome)
+			continue
+		}
+		mantidas = append(mantidas, r)
+	}
+	it.Rotas = mantidas
+	return liberadas
+}
+
+// percursoLigado indica se cada elemento do percurso compartilha um nó ativo
+// com o seguinte.
+func percursoLigado(t *Topologia, ids []int) bool {
+	for k := 1; k < len(ids); k++ {
+		if !slices.Contains(t.Neighbors(ids[k-1]), ids[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Atualizar refaz os grupos por seção depois de uma edição da malha e
+// descarta as rotas com elementos apagados, chaves fora da posição exigida ou
+// elementos que deixaram de se ligar (incluindo a via de origem, enquanto o
+// trem não entrou na rota). Devolve os nomes das rotas descartadas.
+func (it *Intertravamento) Atualizar(elementos []Elemento, t *Topologia, s *Secoes) []string {
+	porID := map[int]Elemento{}
+	for _, el := range elementos {
+		porID[el.ID] = el
+	}
+	descartadas := []string{}
+	mantidas := it.Rotas[:0]
+	for _, r := range it.Rotas {
+		valida := true
+		for _, grupo := range r.Grupos[r.Liberados:] {
+			for _, id := range grupo {
+				if _, ok := porID[id]; !ok {
+					valida = false
+				}
+			}
+		}
+		for _, c := range r.Chaves {
+			if el, ok := porID[c.ChaveID]; ok && el.PosicaoAtual() != c.Posicao && slices.ContainsFunc(r.Grupos[r.Liberados:], func(g []int) bool { return slices.Contains(g, c.ChaveID) }) {
+				valida = false
+			}
+		}
+		restantes := []int{}
+		for _, grupo := range r.Grupos[r.Liberados:] {
+			restantes = append(restantes, grupo...)
+		}
+		percurso := restantes
+		if !r.Percorrida { // O trem ainda espera na via de origem
+			origem, ok := porID[r.OrigemID]
+			viaOrigem := origem.ID
+			if origem.Tipo == ElementoSinal {
+				viaOrigem = origem.ViaID
+			}
+			valida = valida && ok
+			percurso = append([]int{viaOrigem}, restantes...)
+		}
+		if !valida || !percursoLigado(t, percurso) {
+			descartadas = append(descartadas, r.Nome)
+			continue
+		}
+		ocupado := r.Ocupado[r.Liberados:]
+		r.Grupos = gruposPorSecao(restantes, s)
+		r.Ocupado = make([]bool, len(r.Grupos))
+		if len(ocupado) > 0 && ocupado[0] {
+			r.Ocupado[0] = true
+		}
+		r.Liberados = 0
+		mantidas = append(mantidas, r)
+	}
+	it.Rotas = mantidas
+	return descartadas
+}
+
+// AspectoRota devolve o aspecto imposto pelo intertravamento ao sinal: via
+// livre enquanto a rota que parte dele não foi percorrida, vermelho depois.
+func (it *Intertravamento) AspectoRota(sinal Elemento) (string, bool) {
+	i := it.RotaDaOrigem(sinal.ID)
+	if i == -1 {
+		return "", false
+	}
+	if it.Rotas[i].Percorrida {
+		if sinal.TipoSinalAtual() == SinalDistante {
+			return AspectoAmarelo, true
+		}
+		return AspectoVermelho, true
+	}
+	if sinal.TipoSinalAtual() == SinalManobra {
+		return AspectoAmarelo, true
+	}
+	return AspectoVerde, true
+}
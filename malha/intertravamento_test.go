@@ -0,0 +1,195 @@
+package malha
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// rotaTravessao calcula a rota entre os sinais da malhaTravessao ou falha o teste.
+func rotaTravessao(t *testing.T, elementos []Elemento, topo *Topologia, origemID, destinoID int) Rota {
+	t.Helper()
+	rota, err := CalcularRota(elementos, topo, origemID, destinoID)
+	if err != nil {
+		t.Fatalf("CalcularRota(%d, %d): %v", origemID, destinoID, err)
+	}
+	return rota
+}
+
+func TestCalcularRota(t *testing.T) {
+	elementos := malhaTravessao()
+	topo := BuildTopologia(elementos)
+	for _, tc := range []struct {
+		origem, destino int
+		nome            string
+		elementos       []int
+		chaves          []PosicaoExigida
+		comprimento     float64
+	}{
+		{10, 11, "S1-S2", []int{5, 2}, []PosicaoExigida{{5, PosicaoNormal}}, 100 + 1000 + 5900},
+		{10, 12, "S1-S3", []int{5, 6, 4}, []PosicaoExigida{{5, PosicaoReversa}, {6, PosicaoReversa}}, 100 + 2000 + 5000},
+		{14, 15, "S5-S6", []int{5, 1}, []PosicaoExigida{{5, PosicaoNormal}}, 100 + 1000 + 4900},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			rota := rotaTravessao(t, elementos, topo, tc.origem, tc.destino)
+			if rota.Nome != tc.nome || !slices.Equal(rota.Elementos, tc.elementos) || !slices.Equal(rota.Chaves, tc.chaves) {
+				t.Errorf("rota = %s %v %v, quer %s %v %v", rota.Nome, rota.Elementos, rota.Chaves, tc.nome, tc.elementos, tc.chaves)
+			}
+			if !perto(rota.Comprimento, tc.comprimento) {
+				t.Errorf("comprimento = %.1f, quer %.1f", rota.Comprimento, tc.comprimento)
+			}
+		})
+	}
+	if _, err := CalcularRota(elementos, topo, 11, 10); err == nil {
+		t.Errorf("CalcularRota(S2, S1) contra o sentido dos sinais não falhou")
+	}
+}
+
+func TestCalcularRotaTransicao(t *testing.T) {
+	elementos := []Elemento{
+		viaReta(1, 0, 0, 1000, 0),
+		viaTransicao(2, 10, 0, 0, 1000, 0, 1000, 1),
+		sinal(3, 1, 100, SentidoCrescente, "S1"),
+	}
+	topo := BuildTopologia(elementos)
+	rota := rotaTravessao(t, elementos, topo, 3, 2) // Sinal até a transição
+	if !slices.Contains(rota.Elementos, 2) || !perto(rota.Comprimento, 900+1000) {
+		t.Errorf("rota S1 até a transição = %v com %.1f m, quer a transição e 1900 m", rota.Elementos, rota.Comprimento)
+	}
+	rota = rotaTravessao(t, elementos, topo, 2, 1) // Da transição para a reta
+	if !slices.Contains(rota.Elementos, 1) {
+		t.Errorf("rota da transição até a via 1 = %v, quer a via 1", rota.Elementos)
+	}
+}
+
+func TestVerificarRota(t *testing.T) {
+	for _, tc := range []struct {
+		nome     string
+		estados  map[int]string // ID do elemento -> Estado
+		ocupados map[int]bool   // Elementos com trem
+		travadas [][2]int       // Rotas já estabelecidas (origem, destino)
+		erro     string         // Vazio se a rota S1-S2 pode ser estabelecida
+	}{
+		{nome: "malha livre"},
+		{nome: "seção ocupada", estados: map[int]string{2: EstadoOcupado}, erro: "seção CDV-2 ocupada"},
+		{nome: "seção em falha", estados: map[int]string{5: EstadoFalha}, erro: "seção W1 ocupada"},
+		{nome: "trem na seção", ocupados: map[int]bool{2: true}, erro: "seção CDV-2 ocupada"},
+		{nome: "ocupação fora do percurso", estados: map[int]string{4: EstadoOcupado}, ocupados: map[int]bool{1: true}},
+		{nome: "conflito com rota travada", travadas: [][2]int{{14, 15}}, erro: "ID 5 travado pela rota S5-S6"},
+		{nome: "rota travada independente", travadas: [][2]int{{13, 12}}},
+		{nome: "mesma rota já travada", travadas: [][2]int{{10, 11}}, erro: "ID 5 travado pela rota S1-S2; ID 2 travado pela rota S1-S2"},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			elementos := malhaTravessao()
+			for i := range elementos {
+				elementos[i].Estado = tc.estados[elementos[i].ID]
+			}
+			topo := BuildTopologia(elementos)
+			s := BuildSecoes(elementos, topo)
+			it := &Intertravamento{}
+			for _, r := range tc.travadas {
+				it.Travar(rotaTravessao(t, elementos, topo, r[0], r[1]), s)
+			}
+			err := it.Verificar(rotaTravessao(t, elementos, topo, 10, 11), s, tc.ocupados)
+			switch {
+			case tc.erro == "" && err != nil:
+				t.Errorf("Verificar = %v, quer nil", err)
+			case tc.erro != "" && (err == nil || !strings.Contains(err.Error(), tc.erro)):
+				t.Errorf("Verificar = %v, quer erro com %q", err, tc.erro)
+			}
+		})
+	}
+}
+
+func TestLiberarPorSecao(t *testing.T) {
+	elementos := malhaTravessao()
+	topo := BuildTopologia(elementos)
+	s := BuildSecoes(elementos, topo)
+	it := &Intertravamento{}
+	it.Travar(rotaTravessao(t, elementos, topo, 10, 12), s) // S1-S3: W1, W2, via 4
+
+	// O trem avança pelo percurso; cada seção destrava ao ser deixada.
+	for _, passo := range []struct {
+		ocupados  []int
+		travados  []int
+		liberadas []string
+	}{
+		{nil, []int{4, 5, 6}, nil},
+		{[]int{1}, []int{4, 5, 6}, nil},
+		{[]int{1, 5}, []int{4, 5, 6}, nil},
+		{[]int{5, 6}, []int{4, 5, 6}, nil},
+		{[]int{6}, []int{4, 6}, nil},
+		{[]int{6, 4}, []int{4, 6}, nil},
+		{[]int{4}, []int{4}, nil},
+		{nil, []int{}, []string{"S1-S3"}},
+	} {
+		ocupados := map[int]bool{}
+		for _, id := range passo.ocupados {
+			ocupados[id] = true
+		}
+		liberadas := it.Liberar(s, ocupados)
+		travados := slices.Sorted(maps.Keys(it.Travados()))
+		if !slices.Equal(travados, passo.travados) || fmt.Sprint(liberadas) != fmt.Sprint(passo.liberadas) {
+			t.Fatalf("ocupados %v: travados %v, liberadas %v; quer %v, %v", passo.ocupados, travados, liberadas, passo.travados, passo.liberadas)
+		}
+	}
+	if len(it.Rotas) != 0 {
+		t.Errorf("rotas restantes: %+v", it.Rotas)
+	}
+}
+
+func TestCancelarRota(t *testing.T) {
+	elementos := malhaTravessao()
+	topo := BuildTopologia(elementos)
+	s := BuildSecoes(elementos, topo)
+	it := &Intertravamento{}
+	it.Travar(rotaTravessao(t, elementos, topo, 10, 11), s)
+	it.Travar(rotaTravessao(t, elementos, topo, 13, 12), s)
+
+	it.Liberar(s, map[int]bool{5: true}) // Trem entra em S1-S2
+	if err := it.Cancelar(it.RotaDaOrigem(10)); err == nil {
+		t.Errorf("Cancelar de rota percorrida não falhou")
+	}
+	if err := it.Cancelar(it.RotaDaOrigem(13)); err != nil {
+		t.Errorf("Cancelar(S7-S3) = %v", err)
+	}
+	if len(it.Rotas) != 1 || it.Rotas[0].Nome != "S1-S2" {
+		t.Errorf("rotas após cancelar = %+v", it.Rotas)
+	}
+}
+
+func TestAtualizarRotas(t *testing.T) {
+	for _, tc := range []struct {
+		nome    string
+		editar  func(elementos []Elemento) []Elemento
+		mantida bool
+	}{
+		{"sem edição", func(els []Elemento) []Elemento { return els }, true},
+		{"edição fora do percurso", func(els []Elemento) []Elemento { els[1].Y += 10; return els }, true},
+		{"via apagada", func(els []Elemento) []Elemento { return slices.Delete(els, 3, 4) }, false},
+		{"sinal de origem apagado", func(els []Elemento) []Elemento { return slices.Delete(els, 6, 7) }, false},
+		{"chave fora da posição", func(els []Elemento) []Elemento { els[4].PosicaoChave = PosicaoNormal; return els }, false},
+		{"via do percurso afastada", func(els []Elemento) []Elemento { els[3].X += 10; return els }, false},
+		{"via de origem afastada", func(els []Elemento) []Elemento { els[0].Y -= 10; return els }, false},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			elementos := malhaTravessao()
+			elementos[4].PosicaoChave, elementos[5].PosicaoChave = PosicaoReversa, PosicaoReversa
+			topo := BuildTopologia(elementos)
+			it := &Intertravamento{}
+			it.Travar(rotaTravessao(t, elementos, topo, 10, 12), BuildSecoes(elementos, topo)) // S1-S3: W1, W2, via 4
+
+			elementos = tc.editar(elementos)
+			topo = BuildTopologia(elementos)
+			descartadas := it.Atualizar(elementos, topo, BuildSecoes(elementos, topo))
+			if tc.mantida && (len(descartadas) != 0 || len(it.Rotas) != 1) {
+				t.Errorf("descartadas = %v, rotas = %d; quer a rota mantida", descartadas, len(it.Rotas))
+			}
+			if !tc.mantida && (fmt.Sprint(descartadas) != "[S1-S3]" || len(it.Rotas) != 0) {
+				t.Errorf("descartadas = %v, rotas = %d; quer [S1-S3] descartada", descartadas, len(it.Rotas))
+			}
+		})
+	}
+}
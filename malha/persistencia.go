@@ -0,0 +1,35 @@
+package malha
+
+import "io"
+
+// --- Salvar/Carregar Elementos ---
+// Atalhos para quem só precisa dos elementos; o arquivo é sempre gravado no
+// formato versionado de Documento.
+
+// SaveElements grava os elementos num documento com metadados padrão.
+func SaveElements(w io.Writer, elementos []Elemento) error {
+	return SaveDocumento(w, NewDocumento(elementos))
+}
+
+// LoadElements lê os elementos de um documento de qualquer versão conhecida.
+func LoadElements(r io.Reader) ([]Elemento, error) {
+	doc, err := LoadDocumento(r)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Elementos, nil
+}
+
+// SaveFile grava os elementos no arquivo informado.
+func SaveFile(path string, elementos []Elemento) error {
+	return SaveDocumentoFile(path, NewDocumento(elementos))
+}
+
+// LoadFile lê os elementos do arquivo informado.
+func LoadFile(path string) ([]Elemento, error) {
+	doc, err := LoadDocumentoFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Elementos, nil
+}
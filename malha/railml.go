@@ -0,0 +1,295 @@
+package malha
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// --- railML ---
+// Troca da infraestrutura com as ferramentas de sinalização em railML 2.4.
+// Cada aresta da topologia vira um <track> (a via inteira, ou um ramo de
+// chave): o ramo normal de uma chave leva o <switch> na posição 0, ligado ao
+// início do ramo reverso. Extremidades que se encontram num nó são ligadas aos
+// pares por <connection>; um nó com mais de duas extremidades fora de chave
+// (junção em T feita por snap) não tem representação e a exportação falha.
+// Circuitos de via viram <trackCircuitBorder> na extremidade do trilho e
+// sinais são posicionados por Distancia na sua via.
+// A importação está em railml_esquema.go.
+
+const (
+	RailMLVersao  = "2.4"
+	railMLEspaco  = "https://www.railml.org/schemas/2018"
+	railMLPrefixo = "tr"
+)
+
+type railML struct {
+	XMLName        xml.Name             `xml:"railml"`
+	Xmlns          string               `xml:"xmlns,attr,omitempty"`
+	Versao         string               `xml:"version,attr,omitempty"`
+	Infraestrutura railMLInfraestrutura `xml:"infrastructure"`
+}
+
+type railMLInfraestrutura struct {
+	ID      string         `xml:"id,attr"`
+	Trilhos []railMLTrilho `xml:"tracks>track"`
+}
+
+type railMLTrilho struct {
+	ID        string          `xml:"id,attr"`
+	Nome      string          `xml:"name,attr,omitempty"`
+	Topologia railMLTopologia `xml:"trackTopology"`
+	Ocs       *railMLOcs      `xml:"ocsElements"`
+}
+
+type railMLTopologia struct {
+	Inicio   railMLExtremidade `xml:"trackBegin"`
+	Fim      railMLExtremidade `xml:"trackEnd"`
+	Conexoes *railMLConexoes   `xml:"connections"`
+}
+
+// As listas opcionais ficam em ponteiros para não gravar elementos vazios.
+type railMLConexoes struct {
+	Chaves []railMLChave `xml:"switch"`
+}
+
+type railMLOcs struct {
+	Sinais   *railMLSinais   `xml:"signals"`
+	Deteccao *railMLDeteccao `xml:"trainDetectionElements"`
+}
+
+type railMLSinais struct {
+	Lista []railMLSinal `xml:"signal"`
+}
+
+type railMLDeteccao struct {
+	Juntas []railMLJunta `xml:"trackCircuitBorder"`
+}
+
+// chaves, sinais e juntas leem as listas opcionais do trilho.
+func (t railMLTrilho) chaves() []railMLChave {
+	if t.Topologia.Conexoes == nil {
+		return nil
+	}
+	return t.Topologia.Conexoes.Chaves
+}
+
+func (t railMLTrilho) sinais() []railMLSinal {
+	if t.Ocs == nil || t.Ocs.Sinais == nil {
+		return nil
+	}
+	return t.Ocs.Sinais.Lista
+}
+
+func (t railMLTrilho) juntas() []railMLJunta {
+	if t.Ocs == nil || t.Ocs.Deteccao == nil {
+		return nil
+	}
+	return t.Ocs.Deteccao.Juntas
+}
+
+// railMLExtremidade é um trackBegin/trackEnd: ligado a outro trilho (ou a uma
+// chave) por connection, ou livre (openEnd/bufferStop).
+type railMLExtremidade struct {
+	ID         string         `xml:"id,attr"`
+	Pos        string         `xml:"pos,attr"`
+	Conexao    *railMLConexao `xml:"connection"`
+	FimAberto  *railMLMarco   `xml:"openEnd"`
+	FimDeLinha *railMLMarco   `xml:"bufferStop"`
+}
+
+type railMLMarco struct {
+	ID string `xml:"id,attr"`
+}
+
+type railMLConexao struct {
+	ID         string `xml:"id,attr"`
+	Ref        string `xml:"ref,attr"`
+	Orientacao string `xml:"orientation,attr,omitempty"` // Chave: outgoing (pos crescente) ou incoming
+	Curso      string `xml:"course,attr,omitempty"`      // Chave: left ou right, no sentido da orientação
+}
+
+type railMLChave struct {
+	ID            string          `xml:"id,attr"`
+	Nome          string          `xml:"name,attr,omitempty"`
+	Pos           string          `xml:"pos,attr"`
+	CursoContinuo string          `xml:"trackContinueCourse,attr,omitempty"`
+	Conexoes      []railMLConexao `xml:"connection"`
+}
+
+type railMLSinal struct {
+	ID      string `xml:"id,attr"`
+	Nome    string `xml:"name,attr,omitempty"`
+	Pos     string `xml:"pos,attr"`
+	Sentido string `xml:"dir,attr,omitempty"`  // up (pos crescente) ou down
+	Tipo    string `xml:"type,attr,omitempty"` // main, distant, shunting...
+}
+
+type railMLJunta struct {
+	ID            string `xml:"id,attr"`
+	Pos           string `xml:"pos,attr"`
+	TrilhoIsolado string `xml:"insulatedRail,attr,omitempty"`
+}
+
+// tiposSinalRailML associa o tipo de sinal do editor ao atributo type do railML.
+var tiposSinalRailML = map[string]string{SinalPrincipal: "main", SinalManobra: "shunting", SinalDistante: "distant"}
+
+// posRailML formata uma posição em metros (xs:decimal, sem expoente).
+func posRailML(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e4)/1e4, 'f', -1, 64)
+}
+
+// lerPosRailML interpreta uma posição; ausente ou inválida vale 0.
+func lerPosRailML(texto string) float64 {
+	v, err := strconv.ParseFloat(texto, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
+
+// extremoTrilho identifica uma ponta de aresta: lado 0 = NoA (trackBegin), 1 = NoB (trackEnd).
+type extremoTrilho struct {
+	aresta, lado int
+}
+
+// ExportarRailML grava a infraestrutura da malha como railML 2.4.
+func ExportarRailML(w io.Writer, elementos []Elemento) error {
+	t := BuildTopologia(elementos)
+	porID := map[int]Elemento{}
+	for _, el := range elementos {
+		porID[el.ID] = el
+	}
+
+	trilhos := make([]railMLTrilho, len(t.Arestas))
+	chaves := make([][]railMLChave, len(t.Arestas))
+	sinais := make([][]railMLSinal, len(t.Arestas))
+	juntas := make([][]railMLJunta, len(t.Arestas))
+	extremos := make([][]extremoTrilho, len(t.Nos))
+	for i, a := range t.Arestas {
+		el := porID[a.ElementoID]
+		id := fmt.Sprintf("%s%d", railMLPrefixo, a.ElementoID)
+		nome := el.Nome
+		switch a.Ramo {
+		case PosicaoNormal:
+			id += "n"
+		case PosicaoReversa:
+			id += "r"
+		}
+		if a.Ramo != "" && nome != "" {
+			nome += " " + a.Ramo
+		}
+		trilhos[i] = railMLTrilho{ID: id, Nome: nome, Topologia: railMLTopologia{Inicio: railMLExtremidade{ID: id + "_ini", Pos: "0"}, Fim: railMLExtremidade{ID: id + "_fim", Pos: posRailML(a.Comprimento)}}}
+		extremos[a.NoA] = append(extremos[a.NoA], extremoTrilho{i, 0})
+		extremos[a.NoB] = append(extremos[a.NoB], extremoTrilho{i, 1})
+	}
+	extremidade := func(e extremoTrilho) *railMLExtremidade {
+		if e.lado == 0 {
+			return &trilhos[e.aresta].Topologia.Inicio
+		}
+		return &trilhos[e.aresta].Topologia.Fim
+	}
+	idConexao := func(e extremoTrilho) string { return extremidade(e).ID + "_c" }
+
+	for no, lista := range extremos {
+		livres := []extremoTrilho{}
+		for _, e := range lista {
+			a := t.Arestas[e.aresta]
+			if a.Ramo != PosicaoReversa || e.lado != 0 {
+				livres = append(livres, e)
+				continue
+			}
+			// Ponta de chave: o ramo reverso sai do <switch> do ramo normal
+			chave := porID[a.ElementoID]
+			curso := "right"
+			if chave.AnguloDesvio < 0 {
+				curso = "left"
+			}
+			idChave := fmt.Sprintf("sw%d", chave.ID)
+			for _, n := range t.ArestasDoElemento(chave.ID) {
+				if t.Arestas[n].Ramo == PosicaoNormal {
+					chaves[n] = append(chaves[n], railMLChave{ID: idChave, Nome: chave.Nome, Pos: "0", CursoContinuo: "straight",
+						Conexoes: []railMLConexao{{ID: idChave + "_c", Ref: idConexao(e), Orientacao: "outgoing", Curso: curso}}})
+				}
+			}
+			extremidade(e).Conexao = &railMLConexao{ID: idConexao(e), Ref: idChave + "_c"}
+		}
+		if len(livres) > 2 {
+			return fmt.Errorf("nó em (%.1f, %.1f) liga %d extremidades de via sem chave: o railML só liga trilhos aos pares (use uma chave)", t.Nos[no].X, t.Nos[no].Y, len(livres))
+		}
+		for i := 0; i+1 < len(livres); i += 2 {
+			a, b := livres[i], livres[i+1]
+			extremidade(a).Conexao = &railMLConexao{ID: idConexao(a), Ref: idConexao(b)}
+			extremidade(b).Conexao = &railMLConexao{ID: idConexao(b), Ref: idConexao(a)}
+		}
+		if len(livres)%2 == 1 {
+			e := livres[len(livres)-1]
+			marco := &railMLMarco{ID: extremidade(e).ID + "_livre"}
+			if len(lista) == 1 {
+				extremidade(e).FimDeLinha = marco
+			} else {
+				extremidade(e).FimAberto = marco
+			}
+		}
+	}
+
+	for _, el := range elementos {
+		switch el.Tipo {
+		case ElementoCircuitoVia: // Junta na extremidade de um dos trilhos do nó (vias antes de chaves)
+			no := t.FindNo(el.X, el.Y, ToleranciaNo)
+			if no == -1 || len(extremos[no]) == 0 {
+				continue
+			}
+			e := extremos[no][0]
+			for _, o := range extremos[no] {
+				if t.Arestas[o.aresta].Ramo == "" {
+					e = o
+					break
+				}
+			}
+			juntas[e.aresta] = append(juntas[e.aresta], railMLJunta{ID: fmt.Sprintf("tcb%d", el.ID), Pos: extremidade(e).Pos, TrilhoIsolado: "both"})
+		case ElementoSinal:
+			arestas := t.ArestasDoElemento(el.ViaID)
+			if len(arestas) == 0 {
+				continue
+			}
+			a := arestas[0]
+			sentido := "up"
+			if el.Sentido == SentidoDecrescente {
+				sentido = "down"
+			}
+			pos := math.Max(0, math.Min(t.Arestas[a].Comprimento, el.Distancia))
+			sinais[a] = append(sinais[a], railMLSinal{ID: fmt.Sprintf("sig%d", el.ID), Nome: el.Nome, Pos: posRailML(pos), Sentido: sentido, Tipo: tiposSinalRailML[el.TipoSinalAtual()]})
+		}
+	}
+
+	for i := range trilhos {
+		tr := &trilhos[i]
+		if len(chaves[i]) > 0 {
+			tr.Topologia.Conexoes = &railMLConexoes{chaves[i]}
+		}
+		if len(sinais[i]) > 0 || len(juntas[i]) > 0 {
+			tr.Ocs = &railMLOcs{}
+		}
+		if len(sinais[i]) > 0 {
+			tr.Ocs.Sinais = &railMLSinais{sinais[i]}
+		}
+		if len(juntas[i]) > 0 {
+			tr.Ocs.Deteccao = &railMLDeteccao{juntas[i]}
+		}
+	}
+
+	doc := railML{Xmlns: railMLEspaco, Versao: RailMLVersao, Infraestrutura: railMLInfraestrutura{ID: "inf1", Trilhos: trilhos}}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,408 @@
+package malha
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// --- railML: Importação com Disposição Esquemática ---
+// Um arquivo railML 2.x não traz geometria utilizável, só trilhos com
+// comprimento e as ligações entre eles. Cada trilho é posto na horizontal com
+// o seu comprimento real, a partir do primeiro trilho de cada componente;
+// ligações extremidade-extremidade continuam na mesma linha e cada <switch>
+// vira uma ChaveSimples cujo ramo reverso leva o trilho desviado a uma nova
+// linha. Os ramos da chave consomem o início do trilho desviado e um trecho do
+// trilho principal, de modo que os comprimentos somados se mantêm. Num laço,
+// o trilho que fecha o laço já está posicionado e a ligação fica só na
+// topologia do arquivo (sem continuidade no desenho).
+
+// railMLTrechoMinimo é o menor trecho de via (metros) deixado entre ramos de
+// chave; trechos menores juntariam nós distintos (ToleranciaNo).
+const railMLTrechoMinimo = 4 * ToleranciaNo / PixelsPerMeter
+
+// chaveEsquema é um <switch> já resolvido.
+type chaveEsquema struct {
+	id, nome     string
+	conexao, ref string // connection da chave e a extremidade a que ela se liga
+	pos          float64
+	face         float64       // +1: o ramo desviado sai no sentido de pos crescente (outgoing)
+	direita      bool          // Desvia à direita no sentido da face
+	alvo         extremoTrilho // Trilho desviado e o lado ligado à chave (aresta -1: não resolvido)
+	comprimento  float64       // Metros de cada ramo (0: sem ChaveSimples)
+}
+
+// trilhoEsquema é um <track> e a sua posição na disposição.
+type trilhoEsquema struct {
+	id, nome    string
+	comprimento float64
+	ligacoes    [2]string // Ref da connection do início e do fim
+	chaves      []chaveEsquema
+	sinais      []railMLSinal
+	juntas      []float64
+	posicionado bool
+	origem      Ponto   // Ponto da posição 0 (Unid. Mundo)
+	sentido     float64 // +1: pos crescente para +X; -1: para -X
+}
+
+// donoConexao diz a quem pertence uma connection: extremidade (lado 0/1) ou chave (lado -1).
+type donoConexao struct {
+	trilho, lado, chave int
+}
+
+func (tr *trilhoEsquema) ponto(pos float64) Ponto {
+	return Ponto{tr.origem.X + tr.sentido*pos*PixelsPerMeter, tr.origem.Y}
+}
+
+// posLado devolve a posição da extremidade: 0 no início, o comprimento no fim.
+func (tr *trilhoEsquema) posLado(lado int) float64 {
+	if lado == 0 {
+		return 0
+	}
+	return tr.comprimento
+}
+
+// posicionar fixa o trilho de modo que a posição pos caia em p.
+func (tr *trilhoEsquema) posicionar(pos float64, p Ponto, sentido float64) {
+	tr.posicionado, tr.sentido = true, sentido
+	tr.origem = Ponto{p.X - sentido*pos*PixelsPerMeter, p.Y}
+}
+
+// rumoChave devolve o rumo do ramo normal (0 ou 180) e o desvio do reverso.
+func (c chaveEsquema) rumoChave(direcaoX float64) (rumo, desvio float64) {
+	if direcaoX < 0 {
+		rumo = 180
+	}
+	desvio = -ChaveAnguloDesvioPadrao
+	if c.direita {
+		desvio = ChaveAnguloDesvioPadrao
+	}
+	return rumo, desvio
+}
+
+// vetorReverso é o deslocamento da ponta à extremidade do ramo reverso.
+func (c chaveEsquema) vetorReverso(direcaoX float64) Ponto {
+	rumo, desvio := c.rumoChave(direcaoX)
+	rad := (rumo + desvio) * math.Pi / 180
+	return Ponto{c.comprimento * PixelsPerMeter * math.Cos(rad), c.comprimento * PixelsPerMeter * math.Sin(rad)}
+}
+
+// posConsumida devolve a posição, no trilho desviado, onde termina o ramo reverso.
+func (c chaveEsquema) posConsumida(u *trilhoEsquema) float64 {
+	if c.alvo.lado == 0 {
+		return c.comprimento
+	}
+	return u.comprimento - c.comprimento
+}
+
+// ImportarRailML lê a infraestrutura de um railML 2.x e gera vias, chaves,
+// circuitos de via e sinais com IDs a partir de proxID, numa disposição
+// esquemática. A bitola é escolhida pelo comprimento típico dos trilhos.
+func ImportarRailML(r io.Reader, proxID int, cor color.RGBA) ([]Elemento, error) {
+	var doc railML
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("railML inválido: %w", err)
+	}
+	if strings.HasPrefix(doc.Versao, "3") {
+		return nil, fmt.Errorf("railML %s não suportado (use 2.x)", doc.Versao)
+	}
+	if len(doc.Infraestrutura.Trilhos) == 0 {
+		return nil, fmt.Errorf("nenhum <track> na infraestrutura")
+	}
+
+	trilhos := make([]trilhoEsquema, len(doc.Infraestrutura.Trilhos))
+	donos := map[string]donoConexao{}
+	for i, t := range doc.Infraestrutura.Trilhos {
+		tr := &trilhos[i]
+		tr.id, tr.nome, tr.sinais = t.ID, t.Nome, t.sinais()
+		inicio, fim := lerPosRailML(t.Topologia.Inicio.Pos), lerPosRailML(t.Topologia.Fim.Pos)
+		tr.comprimento = math.Abs(fim - inicio)
+		for lado, ext := range []railMLExtremidade{t.Topologia.Inicio, t.Topologia.Fim} {
+			if ext.Conexao != nil {
+				tr.ligacoes[lado] = ext.Conexao.Ref
+				donos[ext.Conexao.ID] = donoConexao{i, lado, -1}
+			}
+		}
+		for _, j := range t.juntas() {
+			tr.juntas = append(tr.juntas, lerPosRailML(j.Pos)-inicio)
+		}
+		for k := range tr.sinais {
+			tr.sinais[k].Pos = posRailML(lerPosRailML(tr.sinais[k].Pos) - inicio)
+		}
+		for _, ch := range t.chaves() {
+			if len(ch.Conexoes) == 0 { // Chaves triplas: só a primeira connection é usada
+				continue
+			}
+			con := ch.Conexoes[0]
+			c := chaveEsquema{id: ch.ID, nome: ch.Nome, conexao: con.ID, ref: con.Ref, pos: lerPosRailML(ch.Pos) - inicio, face: 1, direita: con.Curso == "right", alvo: extremoTrilho{-1, 0}}
+			if con.Orientacao == "incoming" {
+				c.face = -1
+			}
+			tr.chaves = append(tr.chaves, c)
+		}
+	}
+
+	// Uma chave na extremidade do trilho com os ramos para fora dele passa ao
+	// trilho ligado a essa extremidade, onde fica o seu ramo normal.
+	for i := range trilhos {
+		ficam := trilhos[i].chaves[:0]
+		for _, c := range trilhos[i].chaves {
+			lado := -1
+			if c.face > 0 && c.pos >= trilhos[i].comprimento-1e-6 {
+				lado = 1
+			} else if c.face < 0 && c.pos <= 1e-6 {
+				lado = 0
+			}
+			if d, ok := donos[trilhos[i].ligacoes[lado&1]]; lado != -1 && ok && d.lado >= 0 && d.trilho != i {
+				c.pos, c.face = trilhos[d.trilho].posLado(d.lado), 1-2*float64(d.lado)
+				trilhos[d.trilho].chaves = append(trilhos[d.trilho].chaves, c)
+				continue
+			}
+			ficam = append(ficam, c)
+		}
+		trilhos[i].chaves = ficam
+	}
+	for i := range trilhos {
+		for k, c := range trilhos[i].chaves {
+			donos[c.conexao] = donoConexao{i, -1, k}
+		}
+	}
+
+	// Resolve o trilho desviado de cada chave; as extremidades ligadas a chaves
+	// e as posições das chaves limitam o comprimento dos ramos.
+	alvoDeChave := map[extremoTrilho]bool{}
+	for i := range trilhos {
+		for k, c := range trilhos[i].chaves {
+			if d, ok := donos[c.ref]; ok && d.lado >= 0 && d.trilho != i {
+				trilhos[i].chaves[k].alvo = extremoTrilho{d.trilho, d.lado}
+				alvoDeChave[extremoTrilho{d.trilho, d.lado}] = true
+			}
+		}
+	}
+	// livre devolve o trecho livre a partir de pos no sentido dir, dividido ao
+	// meio quando o limite é outra chave (que também precisa de espaço).
+	livre := func(i int, pos, dir float64, ignorar int) float64 {
+		tr := &trilhos[i]
+		limite, dividir := tr.comprimento-pos, alvoDeChave[extremoTrilho{i, 1}]
+		if dir < 0 {
+			limite, dividir = pos, alvoDeChave[extremoTrilho{i, 0}]
+		}
+		for k, c := range tr.chaves {
+			if d := (c.pos - pos) * dir; k != ignorar && d > 1e-6 && d <= limite {
+				limite, dividir = d, true
+			}
+		}
+		if dividir {
+			return limite / 2
+		}
+		return limite
+	}
+	for i := range trilhos {
+		for k := range trilhos[i].chaves {
+			c := &trilhos[i].chaves[k]
+			if c.alvo.aresta == -1 {
+				continue
+			}
+			dirAlvo := 1.0
+			if c.alvo.lado == 1 {
+				dirAlvo = -1
+			}
+			livres := []float64{livre(i, c.pos, c.face, k), livre(c.alvo.aresta, trilhos[c.alvo.aresta].posLado(c.alvo.lado), dirAlvo, -1)}
+			c.comprimento = math.Min(ChaveComprimentoPadrao, math.Min(livres[0], livres[1]))
+			for _, l := range livres { // Sem sobras menores que railMLTrechoMinimo depois dos ramos
+				if sobra := l - c.comprimento; sobra > 1e-6 && sobra < railMLTrechoMinimo {
+					c.comprimento = math.Max(0, l-railMLTrechoMinimo)
+				}
+			}
+		}
+	}
+
+	comprimentos := make([]float64, 0, len(trilhos))
+	for _, tr := range trilhos {
+		comprimentos = append(comprimentos, tr.comprimento)
+	}
+	sort.Float64s(comprimentos)
+	bitola := math.Max(0.05, math.Min(ChaveBitolaPadrao, comprimentos[len(comprimentos)/2]*PixelsPerMeter/25))
+	escalaSimbolo := bitola / ChaveBitolaPadrao
+
+	// Disposição: busca em largura a partir do primeiro trilho de cada componente
+	proximaLinha := 0.0
+	for inicio := range trilhos {
+		if trilhos[inicio].posicionado {
+			continue
+		}
+		trilhos[inicio].posicionar(0, Ponto{0, proximaLinha}, 1)
+		maiorY := proximaLinha
+		fila := []int{inicio}
+		for len(fila) > 0 {
+			i := fila[0]
+			fila = fila[1:]
+			t := &trilhos[i]
+			maiorY = math.Max(maiorY, t.origem.Y)
+			for lado, ref := range t.ligacoes {
+				d, ok := donos[ref]
+				if !ok {
+					continue
+				}
+				p := t.ponto(t.posLado(lado))
+				if d.lado >= 0 { // Extremidade com extremidade: mesma linha
+					u := &trilhos[d.trilho]
+					if u.posicionado {
+						continue
+					}
+					sentido := t.sentido
+					if lado == d.lado {
+						sentido = -sentido
+					}
+					u.posicionar(u.posLado(d.lado), p, sentido)
+					fila = append(fila, d.trilho)
+					continue
+				}
+				// Este trilho é o desviado de uma chave de outro trilho
+				v := &trilhos[d.trilho]
+				c := v.chaves[d.chave]
+				if v.posicionado || c.alvo != (extremoTrilho{i, lado}) {
+					continue
+				}
+				direcaoX := t.sentido
+				if lado == 1 {
+					direcaoX = -direcaoX
+				}
+				reversa := t.ponto(c.posConsumida(t))
+				vetor := c.vetorReverso(direcaoX)
+				v.posicionar(c.pos, Ponto{reversa.X - vetor.X, reversa.Y - vetor.Y}, direcaoX*c.face)
+				fila = append(fila, d.trilho)
+			}
+			for _, c := range t.chaves {
+				if c.alvo.aresta == -1 || trilhos[c.alvo.aresta].posicionado {
+					continue
+				}
+				u := &trilhos[c.alvo.aresta]
+				direcaoX := t.sentido * c.face
+				ponta, vetor := t.ponto(c.pos), c.vetorReverso(direcaoX)
+				sentido := direcaoX
+				if c.alvo.lado == 1 {
+					sentido = -sentido
+				}
+				u.posicionar(c.posConsumida(u), Ponto{ponta.X + vetor.X, ponta.Y + vetor.Y}, sentido)
+				fila = append(fila, c.alvo.aresta)
+			}
+		}
+		proximaLinha = maiorY + 20*bitola
+	}
+
+	// Elementos: cada trilho é cortado nas chaves e juntas; os trechos fora dos
+	// ramos de chave viram vias retas.
+	elementos := []Elemento{}
+	novoID := func() int { proxID++; return proxID - 1 }
+	ocupados := make([][][2]float64, len(trilhos)) // Trechos de cada trilho cobertos por ramos de chave
+	for i := range trilhos {
+		for _, c := range trilhos[i].chaves {
+			if c.comprimento <= 0 {
+				continue
+			}
+			ocupados[i] = append(ocupados[i], [2]float64{math.Min(c.pos, c.pos+c.face*c.comprimento), math.Max(c.pos, c.pos+c.face*c.comprimento)})
+			u := &trilhos[c.alvo.aresta]
+			fim := c.posConsumida(u)
+			ocupados[c.alvo.aresta] = append(ocupados[c.alvo.aresta], [2]float64{math.Min(u.posLado(c.alvo.lado), fim), math.Max(u.posLado(c.alvo.lado), fim)})
+			t := &trilhos[i]
+			direcaoX := t.sentido * c.face
+			rumo, desvio := c.rumoChave(direcaoX)
+			ponta := t.ponto(c.pos)
+			nome := c.nome
+			if nome == "" {
+				nome = c.id
+			}
+			elementos = append(elementos, Elemento{Tipo: ElementoChaveSimples, ID: novoID(), Nome: nome, X: ponta.X, Y: ponta.Y, Rotacao: rumo, Comprimento: c.comprimento,
+				AnguloDesvio: desvio, PosicaoChave: PosicaoNormal, Largura: bitola, Espessura: 10 * escalaSimbolo, Cor: cor})
+		}
+	}
+	// foraDosRamos leva uma posição dentro de um ramo de chave ao limite mais próximo.
+	foraDosRamos := func(i int, pos float64) float64 {
+		for _, o := range ocupados[i] {
+			if pos > o[0] && pos < o[1] {
+				if pos-o[0] < o[1]-pos {
+					return o[0]
+				}
+				return o[1]
+			}
+		}
+		return pos
+	}
+	for i := range trilhos {
+		t := &trilhos[i]
+		cortes := []float64{0, t.comprimento}
+		for _, o := range ocupados[i] {
+			cortes = append(cortes, o[0], o[1])
+		}
+		for _, c := range t.chaves {
+			cortes = append(cortes, c.pos)
+		}
+		juntas := make([]float64, len(t.juntas))
+		for k, pos := range t.juntas {
+			juntas[k] = foraDosRamos(i, math.Max(0, math.Min(t.comprimento, pos)))
+			cortes = append(cortes, juntas[k])
+		}
+		sort.Float64s(cortes)
+		type trecho struct {
+			ini, fim float64
+			via      Elemento
+		}
+		trechos := []trecho{}
+		for k := 1; k < len(cortes); k++ {
+			ini, fim := math.Max(0, cortes[k-1]), math.Min(t.comprimento, cortes[k])
+			if fim-ini < 1e-6 || foraDosRamos(i, (ini+fim)/2) != (ini+fim)/2 {
+				continue
+			}
+			p := t.ponto(ini)
+			rumo := 0.0
+			if t.sentido < 0 {
+				rumo = 180
+			}
+			nome := t.nome
+			if nome == "" {
+				nome = t.id
+			}
+			via := Elemento{Tipo: ElementoViaReta, ID: novoID(), Nome: nome, X: p.X, Y: p.Y, Comprimento: fim - ini, Rotacao: rumo, Cor: cor, Espessura: bitola}
+			elementos = append(elementos, via)
+			trechos = append(trechos, trecho{ini, fim, via})
+		}
+		for _, pos := range juntas {
+			p := t.ponto(pos)
+			elementos = append(elementos, Elemento{Tipo: ElementoCircuitoVia, ID: novoID(), X: p.X, Y: p.Y, Largura: 30 * escalaSimbolo, Espessura: 3 * escalaSimbolo, OrientacaoTC: "Normal", Cor: cor})
+		}
+		for _, s := range t.sinais {
+			pos := lerPosRailML(s.Pos)
+			melhor, melhorDist := -1, math.Inf(1)
+			for k, tr := range trechos { // Trecho que contém a posição (ou o mais próximo)
+				if d := math.Max(tr.ini-pos, pos-tr.fim); d < melhorDist {
+					melhor, melhorDist = k, d
+				}
+			}
+			if melhor == -1 {
+				continue
+			}
+			tr := trechos[melhor]
+			sinal := Elemento{Tipo: ElementoSinal, ID: novoID(), Nome: s.Nome, ViaID: tr.via.ID, Distancia: math.Max(0, math.Min(tr.fim-tr.ini, pos-tr.ini)),
+				Sentido: SentidoCrescente, TipoSinal: SinalPrincipal, Aspecto: AspectoVermelho, Espessura: SinalRaioLampadaPadrao * escalaSimbolo, Cor: cor}
+			if s.Sentido == "down" {
+				sinal.Sentido = SentidoDecrescente
+			}
+			for tipo, valor := range tiposSinalRailML {
+				if s.Tipo == valor {
+					sinal.TipoSinal = tipo
+				}
+			}
+			if sinal.Nome == "" {
+				sinal.Nome = s.ID
+			}
+			ReposicionarSinal(tr.via, &sinal)
+			elementos = append(elementos, sinal)
+		}
+	}
+	return elementos, nil
+}
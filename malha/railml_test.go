@@ -0,0 +1,120 @@
+package malha
+
+import (
+	"bytes"
+	"image/color"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Malha horizontal a partir da origem: a importação esquemática a redesenha
+// nas mesmas coordenadas, então a volta completa pode comparar a geometria.
+func malhaRailML() []Elemento {
+	return []Elemento{
+		viaReta(1, 0, 0, 1000, 0),
+		chave(2, 10, 0, 0, 1000, PosicaoNormal, "W1"),
+		viaReta(3, 20, 0, 1000, 0),
+		viaReta(4, 19.396926207859085, 3.420201433256687, 1000, 0),
+		sinal(5, 1, 500, SentidoCrescente, "S1"),
+		circuito(6, 10, 0),
+	}
+}
+
+func TestRailMLIdaEVolta(t *testing.T) {
+	originais := malhaRailML()
+	var buf bytes.Buffer
+	if err := ExportarRailML(&buf, originais); err != nil {
+		t.Fatalf("ExportarRailML: %v", err)
+	}
+	importados, err := ImportarRailML(&buf, 100, color.RGBA{A: 255})
+	if err != nil {
+		t.Fatalf("ImportarRailML: %v", err)
+	}
+
+	porNome := map[string]Elemento{}
+	circuitos := []Elemento{}
+	for _, el := range importados {
+		if el.Tipo == ElementoCircuitoVia {
+			circuitos = append(circuitos, el)
+			continue
+		}
+		porNome[el.Nome] = el
+	}
+	if len(porNome)+len(circuitos) != len(importados) {
+		t.Fatalf("nomes repetidos na importação: %+v", importados)
+	}
+
+	for _, tc := range []struct {
+		nome string
+		id   int
+	}{
+		{"tr1", 1},
+		{"W1", 2},
+		{"tr3", 3},
+		{"tr4", 4},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			orig := elementoPorID(t, originais, tc.id)
+			imp, ok := porNome[tc.nome]
+			if !ok {
+				t.Fatalf("elemento %q não importado", tc.nome)
+			}
+			if imp.Tipo != orig.Tipo || !perto(imp.Comprimento, orig.Comprimento) {
+				t.Errorf("tipo/comprimento = %d/%.1f, quer %d/%.1f", imp.Tipo, imp.Comprimento, orig.Tipo, orig.Comprimento)
+			}
+			ox1, oy1, ox2, oy2 := orig.Extremidades()
+			ix1, iy1, ix2, iy2 := imp.Extremidades()
+			if math.Hypot(ix1-ox1, iy1-oy1) > 1e-6 || math.Hypot(ix2-ox2, iy2-oy2) > 1e-6 {
+				t.Errorf("extremidades = (%.3f,%.3f)-(%.3f,%.3f), quer (%.3f,%.3f)-(%.3f,%.3f)", ix1, iy1, ix2, iy2, ox1, oy1, ox2, oy2)
+			}
+		})
+	}
+
+	topo := BuildTopologia(importados)
+	ponta, normal, reversa := porNome["W1"].PontasChave()
+	for _, tc := range []struct {
+		no     Ponto
+		trilho string
+	}{
+		{ponta, "tr1"},
+		{normal, "tr3"},
+		{reversa, "tr4"},
+	} {
+		no := topo.FindNo(tc.no.X, tc.no.Y, ToleranciaNo)
+		if no == -1 {
+			t.Fatalf("sem nó na ponta de W1 em (%.2f,%.2f)", tc.no.X, tc.no.Y)
+		}
+		ligados := []int{}
+		for _, a := range topo.Nos[no].Arestas {
+			ligados = append(ligados, topo.Arestas[a].ElementoID)
+		}
+		if !slices.Contains(ligados, porNome[tc.trilho].ID) {
+			t.Errorf("%s não está ligado a W1 em (%.2f,%.2f): %v", tc.trilho, tc.no.X, tc.no.Y, ligados)
+		}
+	}
+
+	s, ok := porNome["S1"]
+	if !ok {
+		t.Fatalf("sinal S1 não importado")
+	}
+	if s.ViaID != porNome["tr1"].ID || !perto(s.Distancia, 500) || s.Sentido != SentidoCrescente || s.TipoSinal != SinalPrincipal {
+		t.Errorf("S1 = via %d, %.1f m, %s, %s; quer via %d, 500 m, %s, %s", s.ViaID, s.Distancia, s.Sentido, s.TipoSinal, porNome["tr1"].ID, SentidoCrescente, SinalPrincipal)
+	}
+	if len(circuitos) != 1 || math.Hypot(circuitos[0].X-10, circuitos[0].Y) > 1e-6 {
+		t.Errorf("circuitos = %+v, quer um em (10,0)", circuitos)
+	}
+}
+
+func TestRailMLJuncaoSemChave(t *testing.T) {
+	elementos := []Elemento{
+		viaReta(1, 0, 0, 1000, 0),
+		viaReta(2, 10, 0, 1000, 0),
+		viaReta(3, 10, 0, 1000, 90), // Junção em T feita por snap
+	}
+	err := ExportarRailML(&bytes.Buffer{}, elementos)
+	if err == nil || !strings.Contains(err.Error(), "3 extremidades") {
+		t.Fatalf("ExportarRailML = %v, quer erro de junção com 3 extremidades", err)
+	}
+}
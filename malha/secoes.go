@@ -0,0 +1,151 @@
+package malha
+
+import (
+	"fmt"
+	"sort"
+)
+
+// --- Seções de Via (Circuitos de Via) ---
+// Cada ElementoCircuitoVia posicionado sobre um nó da topologia é uma junta
+// isolada: as vias e chaves dos dois lados pertencem a seções diferentes. O
+// estado de ocupação de uma seção fica no campo Estado dos seus elementos.
+
+// Estados de ocupação de uma seção.
+const (
+	EstadoLivre   = "Livre"
+	EstadoOcupado = "Ocupado"
+	EstadoFalha   = "Falha"
+)
+
+// Secao é um trecho da malha delimitado por juntas isoladas.
+type Secao struct {
+	Nome      string
+	Elementos []int // IDs das vias e chaves da seção, em ordem crescente
+	Estado    string
+}
+
+// Secoes é o resultado da divisão da malha em seções.
+type Secoes struct {
+	Lista       []Secao
+	Juntas      map[int]int // ID do circuito de via -> nó da topologia onde está a junta
+	porElemento map[int]int // ID da via/chave -> índice em Lista
+}
+
+// gravidadeEstado ordena os estados para agregar uma seção: falha prevalece
+// sobre ocupado, que prevalece sobre livre.
+func gravidadeEstado(estado string) int {
+	switch estado {
+	case EstadoFalha:
+		return 2
+	case EstadoOcupado:
+		return 1
+	}
+	return 0
+}
+
+// EstadoNormalizado devolve o estado de ocupação, tratando vazio como livre.
+func (el Elemento) EstadoNormalizado() string {
+	if el.Estado == EstadoOcupado || el.Estado == EstadoFalha {
+		return el.Estado
+	}
+	return EstadoLivre
+}
+
+// BuildSecoes divide a malha em seções usando as juntas dos circuitos de via.
+func BuildSecoes(elementos []Elemento, t *Topologia) *Secoes {
+	s := &Secoes{Juntas: map[int]int{}, porElemento: map[int]int{}}
+	nosJunta := map[int]bool{}
+	for _, el := range elementos {
+		if el.Tipo != ElementoCircuitoVia {
+			continue
+		}
+		if no := t.FindNo(el.X, el.Y, ToleranciaNo); no != -1 {
+			s.Juntas[el.ID] = no
+			nosJunta[no] = true
+		}
+	}
+
+	pai := make([]int, len(t.Arestas))
+	for i := range pai {
+		pai[i] = i
+	}
+	var raiz func(int) int
+	raiz = func(a int) int {
+		if pai[a] != a {
+			pai[a] = raiz(pai[a])
+		}
+		return pai[a]
+	}
+	unir := func(a, b int) { pai[raiz(a)] = raiz(b) }
+	for _, no := range t.Nos {
+		if nosJunta[no.ID] {
+			continue
+		}
+		for i := 1; i < len(no.Arestas); i++ {
+			unir(no.Arestas[i], no.Arestas[0])
+		}
+	}
+	for _, arestas := range t.porElemento {
+		for _, a := range arestas[1:] {
+			unir(a, arestas[0])
+		}
+	}
+
+	porRaiz := map[int]int{}
+	porID := map[int]Elemento{}
+	for _, el := range elementos {
+		porID[el.ID] = el
+	}
+	ids := make([]int, 0, len(t.porElemento))
+	for id := range t.porElemento {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		r := raiz(t.porElemento[id][0])
+		idx, ok := porRaiz[r]
+		if !ok {
+			idx = len(s.Lista)
+			porRaiz[r] = idx
+			s.Lista = append(s.Lista, Secao{Estado: EstadoLivre})
+		}
+		secao := &s.Lista[idx]
+		secao.Elementos = append(secao.Elementos, id)
+		el := porID[id]
+		if secao.Nome == "" && el.Nome != "" {
+			secao.Nome = el.Nome
+		}
+		if estado := el.EstadoNormalizado(); gravidadeEstado(estado) > gravidadeEstado(secao.Estado) {
+			secao.Estado = estado
+		}
+		s.porElemento[id] = idx
+	}
+	for i := range s.Lista {
+		if s.Lista[i].Nome == "" {
+			s.Lista[i].Nome = fmt.Sprintf("CDV-%d", s.Lista[i].Elementos[0])
+		}
+	}
+	return s
+}
+
+// SecaoDoElemento devolve o índice em Lista da seção que contém a via/chave, ou -1.
+func (s *Secoes) SecaoDoElemento(elementoID int) int {
+	if idx, ok := s.porElemento[elementoID]; ok {
+		return idx
+	}
+	return -1
+}
+
+// SetEstadoSecao grava o estado em todos os elementos da seção de índice idx.
+func (s *Secoes) SetEstadoSecao(elementos []Elemento, idx int, estado string) {
+	membros := map[int]bool{}
+	for _, id := range s.Lista[idx].Elementos {
+		membros[id] = true
+	}
+	for i := range elementos {
+		if membros[elementos[i].ID] {
+			elementos[i].Estado = estado
+		}
+	}
+	s.Lista[idx].Estado = estado
+}
@@ -0,0 +1,79 @@
+package malha
+
+import (
+	"slices"
+	"testing"
+)
+
+// malhaSecoes monta uma linha de vias 1-2-3, a chave W1 (4) e a via 5 no ramo
+// normal, com juntas em (10,0) e na ponta da chave, um circuito fora da malha
+// e uma via isolada (6).
+func malhaSecoes() []Elemento {
+	elementos := []Elemento{
+		viaReta(1, 0, 0, 1000, 0),
+		viaReta(2, 10, 0, 1000, 0),
+		viaReta(3, 20, 0, 1000, 0),
+		chave(4, 30, 0, 0, 1000, PosicaoNormal, "W1"),
+		viaReta(5, 40, 0, 1000, 0),
+		viaReta(6, 0, 50, 1000, 0),
+		circuito(7, 10, 0),
+		circuito(8, 30, 0),
+		circuito(9, 5, 20), // Longe de qualquer nó: não é junta
+	}
+	elementos[1].Nome = "T2"
+	return elementos
+}
+
+func TestBuildSecoes(t *testing.T) {
+	elementos := malhaSecoes()
+	elementos[2].Estado = EstadoOcupado
+	elementos[4].Estado = EstadoFalha
+	topo := BuildTopologia(elementos)
+	s := BuildSecoes(elementos, topo)
+
+	quer := []Secao{
+		{Nome: "CDV-1", Elementos: []int{1}, Estado: EstadoLivre},
+		{Nome: "T2", Elementos: []int{2, 3}, Estado: EstadoOcupado},
+		{Nome: "W1", Elementos: []int{4, 5}, Estado: EstadoFalha},
+		{Nome: "CDV-6", Elementos: []int{6}, Estado: EstadoLivre},
+	}
+	if !slices.EqualFunc(s.Lista, quer, func(a, b Secao) bool {
+		return a.Nome == b.Nome && a.Estado == b.Estado && slices.Equal(a.Elementos, b.Elementos)
+	}) {
+		t.Fatalf("seções = %+v, quer %+v", s.Lista, quer)
+	}
+	if len(s.Juntas) != 2 || s.Juntas[7] != topo.FindNo(10, 0, ToleranciaNo) || s.Juntas[8] != topo.FindNo(30, 0, ToleranciaNo) {
+		t.Errorf("juntas = %v, quer os circuitos 7 e 8 nos nós de (10,0) e (30,0)", s.Juntas)
+	}
+	for id, idx := range map[int]int{1: 0, 3: 1, 5: 2, 6: 3, 7: -1, 99: -1} {
+		if got := s.SecaoDoElemento(id); got != idx {
+			t.Errorf("SecaoDoElemento(%d) = %d, quer %d", id, got, idx)
+		}
+	}
+}
+
+func TestBuildSecoesSemJuntas(t *testing.T) {
+	elementos := malhaSecoes()[:6]
+	s := BuildSecoes(elementos, BuildTopologia(elementos))
+	if len(s.Lista) != 2 || !slices.Equal(s.Lista[0].Elementos, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("seções = %+v, quer a linha inteira numa só e a via isolada na outra", s.Lista)
+	}
+}
+
+func TestSetEstadoSecao(t *testing.T) {
+	elementos := malhaSecoes()
+	s := BuildSecoes(elementos, BuildTopologia(elementos))
+	s.SetEstadoSecao(elementos, 1, EstadoOcupado)
+	if s.Lista[1].Estado != EstadoOcupado {
+		t.Errorf("estado da seção = %s, quer %s", s.Lista[1].Estado, EstadoOcupado)
+	}
+	for _, el := range elementos {
+		quer := ""
+		if el.ID == 2 || el.ID == 3 {
+			quer = EstadoOcupado
+		}
+		if el.Estado != quer {
+			t.Errorf("elemento %d com estado %q, quer %q", el.ID, el.Estado, quer)
+		}
+	}
+}
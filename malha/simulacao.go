@@ -0,0 +1,349 @@
+package malha
+
+import (
+	"fmt"
+	"math"
+)
+
+// --- Simulação de Trens ---
+// Trens percorrem as arestas da topologia seguindo as ligações e a posição
+// atual das chaves: um ramo não posicionado não pode ser tomado (o trem para
+// antes dele, como num fim de linha). O estado avança em passos fixos de
+// PassoSimulacao segundos, independentes da taxa de quadros do editor. A cada
+// passo o trem acelera até VelocidadeMax, ou freia se a via livre à frente não
+// for maior que a sua distância de frenagem.
+// O trem guarda as arestas sob ele por elemento e ramo, não por índice, para
+// sobreviver à reconstrução da topologia a cada edição (Atualizar).
+
+const (
+	PassoSimulacao        = 0.1  // Segundos simulados por passo
+	simulacaoMargemParada = 10.0 // Metros mantidos antes do fim da via livre
+	simulacaoPassoCurva   = 5.0  // Graus entre pontos do corpo do trem em curvas
+)
+
+// ModeloTrem reúne as características de um trem.
+type ModeloTrem struct {
+	Nome          string
+	Comprimento   float64 // Metros
+	VelocidadeMax float64 // m/s
+	Aceleracao    float64 // m/s²
+	Frenagem      float64 // m/s² (desaceleração de serviço)
+}
+
+// ModelosTrem são os modelos oferecidos pelo editor.
+var ModelosTrem = []ModeloTrem{
+	{Nome: "Carga", Comprimento: 1500, VelocidadeMax: 60 / 3.6, Aceleracao: 0.15, Frenagem: 0.3},
+	{Nome: "Passageiros", Comprimento: 200, VelocidadeMax: 120 / 3.6, Aceleracao: 0.8, Frenagem: 1.0},
+	{Nome: "Manobra", Comprimento: 100, VelocidadeMax: 25 / 3.6, Aceleracao: 0.5, Frenagem: 0.8},
+}
+
+// TrechoTrem é uma aresta sob o trem; Direto indica que o trem a percorre de NoA para NoB.
+type TrechoTrem struct {
+	ElementoID int
+	Ramo       string
+	Direto     bool
+}
+
+// Trem é um trem na malha. Trechos vai da cabeça para a cauda; Avanco é
+// quanto a cabeça já percorreu do primeiro trecho.
+type Trem struct {
+	ID int
+	ModeloTrem
+	Velocidade float64 // m/s
+	Trechos    []TrechoTrem
+	Avanco     float64 // Metros
+	Parado     bool    // Sem via livre à frente
+}
+
+// Simulacao guarda os trens e a malha sobre a qual andam.
+type Simulacao struct {
+	Trens  []Trem
+	Tempo  float64 // Segundos simulados
+	proxID int
+	t      *Topologia
+	porID  map[int]Elemento
+}
+
+// NovaSimulacao cria uma simulação vazia sobre a malha.
+func NovaSimulacao(elementos []Elemento, t *Topologia) *Simulacao {
+	s := &Simulacao{proxID: 1}
+	s.Atualizar(elementos, t)
+	return s
+}
+
+// Atualizar troca a malha da simulação (após uma edição) e descarta os trens
+// cujas arestas deixaram de existir ou de estar ligadas. Devolve quantos foram
+// descartados.
+func (s *Simulacao) Atualizar(elementos []Elemento, t *Topologia) int {
+	s.t = t
+	s.porID = make(map[int]Elemento, len(elementos))
+	for _, el := range elementos {
+		s.porID[el.ID] = el
+	}
+	mantidos := s.Trens[:0]
+	for _, tr := range s.Trens {
+		if s.continuo(tr) {
+			tr.Avanco = math.Min(tr.Avanco, s.comprimento(s.aresta(tr.Trechos[0])))
+			mantidos = append(mantidos, tr)
+		}
+	}
+	descartados := len(s.Trens) - len(mantidos)
+	s.Trens = mantidos
+	return descartados
+}
+
+// continuo indica se todos os trechos do trem existem e se encadeiam.
+func (s *Simulacao) continuo(tr Trem) bool {
+	for i, trecho := range tr.Trechos {
+		if s.aresta(trecho) == -1 {
+			return false
+		}
+		if i > 0 {
+			entrada, _ := s.nosTrecho(tr.Trechos[i-1])
+			if _, saida := s.nosTrecho(trecho); saida != entrada {
+				return false
+			}
+		}
+	}
+	return len(tr.Trechos) > 0
+}
+
+// aresta devolve o índice da aresta do trecho, ou -1.
+func (s *Simulacao) aresta(trecho TrechoTrem) int {
+	for _, a := range s.t.ArestasDoElemento(trecho.ElementoID) {
+		if s.t.Arestas[a].Ramo == trecho.Ramo {
+			return a
+		}
+	}
+	return -1
+}
+
+func (s *Simulacao) comprimento(a int) float64 {
+	return s.t.Arestas[a].Comprimento
+}
+
+// nosTrecho devolve os nós por onde o trem entra e sai do trecho.
+func (s *Simulacao) nosTrecho(trecho TrechoTrem) (entrada, saida int) {
+	a := s.t.Arestas[s.aresta(trecho)]
+	if trecho.Direto {
+		return a.NoA, a.NoB
+	}
+	return a.NoB, a.NoA
+}
+
+// trechoDe monta o trecho da aresta a percorrida a partir do nó de entrada.
+func (s *Simulacao) trechoDe(a, entrada int) TrechoTrem {
+	aresta := s.t.Arestas[a]
+	return TrechoTrem{ElementoID: aresta.ElementoID, Ramo: aresta.Ramo, Direto: aresta.NoA == entrada}
+}
+
+// seguinte escolhe a aresta pela qual continua quem chega ao nó pela aresta
+// a, respeitando a posição das chaves; -1 se a via acaba.
+func (s *Simulacao) seguinte(a, no int) int {
+	for _, prox := range s.t.Seguintes(a, no, true) {
+		if s.t.Arestas[prox].NoA != s.t.Arestas[prox].NoB {
+			return prox
+		}
+	}
+	return -1
+}
+
+// Adicionar coloca um trem do modelo com a cabeça no ponto da via (ou ramo de
+// chave) mais próximo de (x, y), seguindo no sentido do elemento (ou da ponta
+// para o ramo). A cauda se estende para trás; se faltar via atrás, o trem é
+// empurrado para a frente.
+func (s *Simulacao) Adicionar(modelo ModeloTrem, elementoID int, x, y float64) (Trem, error) {
+	el, ok := s.porID[elementoID]
+	if !ok || (!el.Tipo.EhVia() && el.Tipo != ElementoChaveSimples) {
+		return Trem{}, fmt.Errorf("trem deve ser posicionado sobre uma via ou chave")
+	}
+	a, _, fracao := projetarNaAresta(s.t, el, x, y)
+	if a == -1 || s.t.Arestas[a].NoA == s.t.Arestas[a].NoB {
+		return Trem{}, fmt.Errorf("elemento ID %d não tem via utilizável", elementoID)
+	}
+	tr := Trem{ID: s.proxID, ModeloTrem: modelo, Trechos: []TrechoTrem{s.trechoDe(a, s.t.Arestas[a].NoA)}, Avanco: fracao * s.comprimento(a)}
+	cobertura := tr.Avanco
+	atual, no := a, s.t.Arestas[a].NoA
+	for cobertura < tr.Comprimento {
+		ant := s.seguinte(atual, no)
+		if ant == -1 {
+			break
+		}
+		no = s.t.OutroNo(ant, no)
+		tr.Trechos = append(tr.Trechos, s.trechoDe(ant, no))
+		cobertura += s.comprimento(ant)
+		atual = ant
+	}
+	if falta := tr.Comprimento - cobertura; falta > 0 {
+		if andado := s.avancar(&tr, falta); andado < falta-1e-6 {
+			return Trem{}, fmt.Errorf("via livre de %.0f m, curta para o trem de %.0f m", cobertura+andado, tr.Comprimento)
+		}
+	}
+	s.proxID++
+	s.Trens = append(s.Trens, tr)
+	return tr, nil
+}
+
+// Reiniciar descarta os trens e zera o relógio (a malha foi trocada).
+func (s *Simulacao) Reiniciar() {
+	s.Trens, s.Tempo, s.proxID = nil, 0, 1
+}
+
+// Remover tira o trem de índice i.
+func (s *Simulacao) Remover(i int) {
+	s.Trens = append(s.Trens[:i], s.Trens[i+1:]...)
+}
+
+// Inverter troca a cabeça pela cauda do trem de índice i; o trem para.
+func (s *Simulacao) Inverter(i int) {
+	tr := &s.Trens[i]
+	cobertura := tr.Avanco
+	for _, trecho := range tr.Trechos[1:] {
+		cobertura += s.comprimento(s.aresta(trecho))
+	}
+	ultimo := tr.Trechos[len(tr.Trechos)-1]
+	cauda := math.Max(0, cobertura-tr.Comprimento) // Distância da cauda à entrada do último trecho
+	invertidos := make([]TrechoTrem, 0, len(tr.Trechos))
+	for k := len(tr.Trechos) - 1; k >= 0; k-- {
+		trecho := tr.Trechos[k]
+		trecho.Direto = !trecho.Direto
+		invertidos = append(invertidos, trecho)
+	}
+	tr.Trechos = invertidos
+	tr.Avanco = s.comprimento(s.aresta(ultimo)) - cauda
+	tr.Velocidade, tr.Parado = 0, false
+}
+
+// Passo avança a simulação em dt segundos.
+func (s *Simulacao) Passo(dt float64) {
+	s.Tempo += dt
+	for i := range s.Trens {
+		tr := &s.Trens[i]
+		frenagem := tr.Velocidade * tr.Velocidade / (2 * tr.Frenagem)
+		livre := s.distanciaLivre(*tr, frenagem+tr.Velocidade*dt+simulacaoMargemParada+1) - simulacaoMargemParada
+		if livre <= frenagem+tr.Velocidade*dt {
+			tr.Velocidade = math.Max(0, tr.Velocidade-tr.Frenagem*dt)
+		} else {
+			tr.Velocidade = math.Min(tr.VelocidadeMax, tr.Velocidade+tr.Aceleracao*dt)
+		}
+		distancia := tr.Velocidade * dt
+		if distancia >= livre {
+			distancia, tr.Velocidade = math.Max(0, livre), 0
+		}
+		s.avancar(tr, distancia)
+		tr.Parado = tr.Velocidade == 0 && livre <= 0
+	}
+}
+
+// distanciaLivre mede a via à frente da cabeça até o fim (ou até limite).
+func (s *Simulacao) distanciaLivre(tr Trem, limite float64) float64 {
+	atual := s.aresta(tr.Trechos[0])
+	_, no := s.nosTrecho(tr.Trechos[0])
+	livre := s.comprimento(atual) - tr.Avanco
+	for passos := 0; livre < limite && passos < len(s.t.Arestas); passos++ {
+		prox := s.seguinte(atual, no)
+		if prox == -1 {
+			break
+		}
+		livre += s.comprimento(prox)
+		atual, no = prox, s.t.OutroNo(prox, no)
+	}
+	return livre
+}
+
+// avancar move a cabeça d metros (até o fim da via), acrescentando os trechos
+// em que entra e descartando os que a cauda deixou. Devolve o quanto andou.
+func (s *Simulacao) avancar(tr *Trem, d float64) float64 {
+	andado := d
+	tr.Avanco += d
+	for {
+		atual := s.aresta(tr.Trechos[0])
+		comp := s.comprimento(atual)
+		if tr.Avanco <= comp {
+			break
+		}
+		_, no := s.nosTrecho(tr.Trechos[0])
+		prox := s.seguinte(atual, no)
+		if prox == -1 {
+			andado -= tr.Avanco - comp
+			tr.Avanco = comp
+			break
+		}
+		tr.Avanco -= comp
+		tr.Trechos = append([]TrechoTrem{s.trechoDe(prox, no)}, tr.Trechos...)
+	}
+	cobertura := tr.Avanco
+	for k := 1; k < len(tr.Trechos); k++ {
+		if cobertura >= tr.Comprimento {
+			tr.Trechos = tr.Trechos[:k]
+			break
+		}
+		cobertura += s.comprimento(s.aresta(tr.Trechos[k]))
+	}
+	return andado
+}
+
+// pontoNaAresta devolve o ponto a d metros de NoA ao longo da aresta a.
+func (s *Simulacao) pontoNaAresta(a int, d float64) Ponto {
+	return pontoDaAresta(s.t, s.porID[s.t.Arestas[a].ElementoID], a, d)
+}
+
+// Corpo devolve a polilinha do trem da cabeça à cauda (Unid. Mundo).
+func (s *Simulacao) Corpo(tr Trem) []Ponto {
+	pontos := []Ponto{}
+	restante := tr.Comprimento
+	for k, trecho := range tr.Trechos {
+		a := s.aresta(trecho)
+		comp := s.comprimento(a)
+		fim := comp // Distâncias desde a entrada do trecho
+		if k == 0 {
+			fim = tr.Avanco
+		}
+		ini := math.Max(0, fim-restante)
+		restante -= fim - ini
+		passos := 1
+		if el := s.porID[trecho.ElementoID]; el.ehArco() && comp > 0 {
+			passos = max(1, int(math.Ceil(math.Abs(el.Varredura)*(fim-ini)/comp/simulacaoPassoCurva)))
+		} else if el.ehTransicao() && comp > 0 {
+			passos = max(1, int(math.Ceil(el.giroTransicao()*(fim-ini)/comp/simulacaoPassoCurva)))
+		}
+		for p := 0; p <= passos; p++ {
+			if p == 0 && k > 0 {
+				continue // Já incluído como último ponto do trecho anterior
+			}
+			d := fim - (fim-ini)*float64(p)/float64(passos)
+			if !trecho.Direto {
+				d = comp - d
+			}
+			pontos = append(pontos, s.pontoNaAresta(a, d))
+		}
+		if restante <= 0 {
+			break
+		}
+	}
+	return pontos
+}
+
+// TremEm devolve o índice do trem cujo corpo passa a menos de tol de (x, y), ou -1.
+func (s *Simulacao) TremEm(x, y, tol float64) int {
+	for i, tr := range s.Trens {
+		corpo := s.Corpo(tr)
+		for k := 1; k < len(corpo); k++ {
+			if PointSegmentDistance(x, y, corpo[k-1].X, corpo[k-1].Y, corpo[k].X, corpo[k].Y) <= tol {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// ElementosOcupados devolve os IDs das vias e chaves sob algum trem.
+func (s *Simulacao) ElementosOcupados() map[int]bool {
+	ocupados := map[int]bool{}
+	for _, tr := range s.Trens {
+		for _, trecho := range tr.Trechos {
+			ocupados[trecho.ElementoID] = true
+		}
+	}
+	return ocupados
+}
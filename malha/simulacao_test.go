@@ -0,0 +1,213 @@
+package malha
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// modeloTeste tem números redondos para conferir a cinemática à mão.
+var modeloTeste = ModeloTrem{Nome: "Teste", Comprimento: 100, VelocidadeMax: 10, Aceleracao: 1, Frenagem: 2}
+
+// simulacaoDe monta a simulação sobre os elementos.
+func simulacaoDe(elementos []Elemento) *Simulacao {
+	return NovaSimulacao(elementos, BuildTopologia(elementos))
+}
+
+func TestAdicionarTrem(t *testing.T) {
+	elementos := []Elemento{
+		viaReta(1, 0, 0, 1000, 0),
+		viaReta(2, 10, 0, 1000, 0),
+		viaReta(3, 0, 50, 50, 0), // Curta demais para o trem
+		circuito(4, 10, 0),
+	}
+	for _, tc := range []struct {
+		nome       string
+		elementoID int
+		x, y       float64
+		trechos    []TrechoTrem
+		avanco     float64
+		erro       bool
+	}{
+		{nome: "no meio da via", elementoID: 2, x: 15, y: 1, trechos: []TrechoTrem{{2, "", true}}, avanco: 500},
+		{nome: "cauda na via anterior", elementoID: 2, x: 10.5, trechos: []TrechoTrem{{2, "", true}, {1, "", true}}, avanco: 50},
+		{nome: "empurrado para a frente", elementoID: 1, x: 0.3, trechos: []TrechoTrem{{1, "", true}}, avanco: 100},
+		{nome: "via curta", elementoID: 3, x: 0.2, y: 50, erro: true},
+		{nome: "fora da via", elementoID: 4, x: 10, erro: true},
+		{nome: "elemento inexistente", elementoID: 99, erro: true},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			s := simulacaoDe(elementos)
+			tr, err := s.Adicionar(modeloTeste, tc.elementoID, tc.x, tc.y)
+			if (err != nil) != tc.erro {
+				t.Fatalf("Adicionar: erro %v, quer erro: %v", err, tc.erro)
+			}
+			if tc.erro {
+				if len(s.Trens) != 0 {
+					t.Errorf("trem acrescentado apesar do erro: %+v", s.Trens)
+				}
+				return
+			}
+			if tr.ID != 1 || !slices.Equal(tr.Trechos, tc.trechos) || math.Abs(tr.Avanco-tc.avanco) > 1e-6 || tr.Velocidade != 0 {
+				t.Errorf("trem %+v, quer ID 1 parado com trechos %v e avanço %.1f", tr, tc.trechos, tc.avanco)
+			}
+		})
+	}
+}
+
+func TestPassoAceleracao(t *testing.T) {
+	s := simulacaoDe([]Elemento{viaReta(1, 0, 0, 100000, 0)})
+	if _, err := s.Adicionar(modeloTeste, 1, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	for range 10 {
+		s.Passo(PassoSimulacao)
+	}
+	// 1 m/s² por 1 s em passos de 0,1 s: 0,1 + 0,2 + ... + 1,0 m/s × 0,1 s
+	if tr := s.Trens[0]; !perto(tr.Velocidade, 1) || !perto(tr.Avanco, 100.55) || !perto(s.Tempo, 1) {
+		t.Errorf("após 1 s: %.4f m/s, avanço %.4f m, tempo %.2f s; quer 1 m/s, 100,55 m, 1 s", tr.Velocidade, tr.Avanco, s.Tempo)
+	}
+	for range 200 {
+		s.Passo(PassoSimulacao)
+	}
+	if tr := s.Trens[0]; tr.Velocidade != modeloTeste.VelocidadeMax || tr.Parado {
+		t.Errorf("após 21 s: %.4f m/s (parado: %v), quer a velocidade máxima %v", tr.Velocidade, tr.Parado, modeloTeste.VelocidadeMax)
+	}
+}
+
+func TestPassoFrenagem(t *testing.T) {
+	s := simulacaoDe([]Elemento{viaReta(1, 0, 0, 1000, 0)})
+	if _, err := s.Adicionar(modeloTeste, 1, 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	anterior := 0.0
+	for passo := range 1000 {
+		s.Passo(PassoSimulacao)
+		tr := s.Trens[0]
+		// Só a parada no ponto exato pode frear além do modelo, e a baixa velocidade
+		dv := tr.Velocidade - anterior
+		parada := tr.Velocidade == 0 && anterior <= 2*modeloTeste.Frenagem*PassoSimulacao
+		if dv > modeloTeste.Aceleracao*PassoSimulacao+1e-9 || (-dv > modeloTeste.Frenagem*PassoSimulacao+1e-9 && !parada) {
+			t.Fatalf("passo %d: velocidade de %.4f para %.4f m/s, além dos limites do modelo", passo, anterior, tr.Velocidade)
+		}
+		if tr.Avanco > 1000-simulacaoMargemParada+1e-9 {
+			t.Fatalf("passo %d: cabeça a %.4f m, além da margem antes do fim da via", passo, tr.Avanco)
+		}
+		anterior = tr.Velocidade
+	}
+	if tr := s.Trens[0]; !tr.Parado || tr.Velocidade != 0 || tr.Avanco < 1000-simulacaoMargemParada-1 {
+		t.Errorf("trem %+v, quer parado a menos de 1 m da margem antes do fim da via", tr)
+	}
+}
+
+func TestPassoChaveContra(t *testing.T) {
+	// O trem vem da via 2 (de x = 30 para x = 20) e entra na chave pelo ramo
+	// normal; a chave segue para a via 1, que acaba em x = 0.
+	for _, tc := range []struct {
+		posicao  string
+		ocupados []int
+		avanco   float64 // Na via 1 (passou) ou na via 2 (parou antes da chave)
+	}{
+		{posicao: PosicaoNormal, ocupados: []int{1}, avanco: 1000 - simulacaoMargemParada},
+		{posicao: PosicaoReversa, ocupados: []int{2}, avanco: 1000 - simulacaoMargemParada},
+	} {
+		t.Run(tc.posicao, func(t *testing.T) {
+			s := simulacaoDe([]Elemento{
+				viaReta(1, 0, 0, 1000, 0),
+				viaReta(2, 30, 0, 1000, 180),
+				chave(3, 10, 0, 0, 1000, tc.posicao, "W1"),
+			})
+			if _, err := s.Adicionar(modeloTeste, 2, 28, 0); err != nil {
+				t.Fatal(err)
+			}
+			for range 3000 {
+				s.Passo(PassoSimulacao)
+			}
+			tr := s.Trens[0]
+			if !tr.Parado || tr.Trechos[0].ElementoID != tc.ocupados[0] || math.Abs(tr.Avanco-tc.avanco) > 1 {
+				t.Errorf("trem %+v, quer parado no elemento %d a %.0f m", tr, tc.ocupados[0], tc.avanco)
+			}
+			if ocupados := s.ElementosOcupados(); len(ocupados) != len(tc.ocupados) {
+				t.Errorf("ocupados %v, quer %v", ocupados, tc.ocupados)
+			}
+		})
+	}
+}
+
+func TestInverterTrem(t *testing.T) {
+	s := simulacaoDe([]Elemento{viaReta(1, 0, 0, 1000, 0), viaReta(2, 10, 0, 1000, 0)})
+	if _, err := s.Adicionar(modeloTeste, 2, 10.5, 0); err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		s.Passo(PassoSimulacao)
+	}
+	s.Inverter(0)
+	tr := s.Trens[0]
+	// Cabeça a 50,15 m na via 2 e 100 m de trem: a cauda estava a 950,15 m da
+	// entrada da via 1, ou a 49,85 m da sua saída no sentido invertido
+	quer := []TrechoTrem{{1, "", false}, {2, "", false}}
+	if !slices.Equal(tr.Trechos, quer) || !perto(tr.Avanco, 49.85) || tr.Velocidade != 0 {
+		t.Fatalf("invertido: %+v, quer trechos %v, avanço 49,85 m e parado", tr, quer)
+	}
+	if cabeca := s.Corpo(tr)[0]; !pertoPonto(cabeca, Ponto{9.5015, 0}) {
+		t.Errorf("cabeça em %v, quer (9.5015, 0)", cabeca)
+	}
+	for range 10 {
+		s.Passo(PassoSimulacao)
+	}
+	if cabeca := s.Corpo(s.Trens[0])[0]; cabeca.X >= 9.5015 {
+		t.Errorf("depois de inverter, a cabeça foi para %v: quer o sentido de x decrescente", cabeca)
+	}
+}
+
+func TestCorpoNaTransicao(t *testing.T) {
+	via := viaTransicao(1, 0, 0, 0, 1000, 0, 200, 1)
+	s := simulacaoDe([]Elemento{via})
+	p, _ := via.PontoNaVia(0.9)
+	tr, err := s.Adicionar(modeloTeste, 1, p.X, p.Y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// O corpo segue a clotoide em vários pontos, não a corda de 100 m.
+	corpo := s.Corpo(tr)
+	if len(corpo) < 4 || !pertoPonto(corpo[0], p) {
+		t.Fatalf("corpo %v, quer vários pontos a partir de %v", corpo, p)
+	}
+	for _, c := range corpo {
+		if px, py, _ := ProjetarNaVia(via, c.X, c.Y); math.Hypot(px-c.X, py-c.Y) > 1e-6 {
+			t.Errorf("ponto %v do corpo fora da transição", c)
+		}
+	}
+}
+
+func TestAtualizarSimulacao(t *testing.T) {
+	elementos := []Elemento{viaReta(1, 0, 0, 1000, 0), viaReta(2, 10, 0, 1000, 0), viaReta(3, 0, 50, 1000, 0)}
+	s := simulacaoDe(elementos)
+	if _, err := s.Adicionar(modeloTeste, 2, 10.5, 0); err != nil { // Cauda na via 1
+		t.Fatal(err)
+	}
+	if _, err := s.Adicionar(modeloTeste, 3, 5, 50); err != nil {
+		t.Fatal(err)
+	}
+
+	elementos[1].Comprimento = 30 // Via encurtada sob a cabeça: o trem fica no fim dela
+	if n := s.Atualizar(elementos, BuildTopologia(elementos)); n != 0 || len(s.Trens) != 2 || s.Trens[0].Avanco != 30 {
+		t.Fatalf("via encurtada: %d descartados, trens %+v; quer os dois mantidos, o primeiro com avanço 30 m", n, s.Trens)
+	}
+
+	elementos = slices.Delete(elementos, 0, 1) // Apaga a via 1, sob a cauda do primeiro trem
+	if n := s.Atualizar(elementos, BuildTopologia(elementos)); n != 1 || len(s.Trens) != 1 || s.Trens[0].ID != 2 {
+		t.Fatalf("via apagada: %d descartados, trens %+v; quer só o trem 2", n, s.Trens)
+	}
+
+	elementos[0].X = 12 // Via 2 afastada da via 1, agora sem trem: nada muda
+	if n := s.Atualizar(elementos, BuildTopologia(elementos)); n != 0 || len(s.Trens) != 1 {
+		t.Errorf("edição fora dos trens: %d descartados, %d trens", n, len(s.Trens))
+	}
+
+	s.Reiniciar()
+	if tr, err := s.Adicionar(modeloTeste, 3, 5, 50); err != nil || tr.ID != 1 || len(s.Trens) != 1 || s.Tempo != 0 {
+		t.Errorf("após Reiniciar: trem %+v (erro %v), %d trens, tempo %v; quer o trem 1 sozinho e tempo 0", tr, err, len(s.Trens), s.Tempo)
+	}
+}
@@ -0,0 +1,141 @@
+package malha
+
+import "math"
+
+// --- Sinais ---
+// Um sinal fica preso a uma via (ViaID, Distancia em metros a partir do início
+// da via) e governa um sentido de circulação. Rotacao guarda o rumo do sentido
+// governado; o cabeçote é desenhado à direita da via.
+
+// Sentidos de circulação em relação à orientação da via (início -> fim).
+const (
+	SentidoCrescente   = "Crescente"
+	SentidoDecrescente = "Decrescente"
+)
+
+// Tipos de sinal.
+const (
+	SinalPrincipal = "Principal"
+	SinalManobra   = "Manobra"
+	SinalDistante  = "Distante"
+)
+
+// Aspectos de sinal.
+const (
+	AspectoVermelho        = "Vermelho"
+	AspectoAmarelo         = "Amarelo"
+	AspectoVerde           = "Verde"
+	AspectoAmareloPiscante = "AmareloPiscante"
+	AspectoVerdePiscante   = "VerdePiscante"
+)
+
+// Dimensões padrão do sinal (Unid. Mundo).
+const (
+	SinalRaioLampadaPadrao = 3.0
+	sinalAfastamento       = 4.0 // Afastamento do cabeçote em relação à via, em raios de lâmpada
+	sinalEspacamento       = 2.4 // Distância entre centros de lâmpadas, em raios de lâmpada
+)
+
+// TiposSinal lista os tipos na ordem usada para alternar no editor.
+var TiposSinal = []string{SinalPrincipal, SinalManobra, SinalDistante}
+
+// LampadasSinal devolve as cores das lâmpadas do cabeçote, da base para a ponta.
+func LampadasSinal(tipoSinal string) []string {
+	switch tipoSinal {
+	case SinalManobra:
+		return []string{AspectoVermelho, AspectoAmarelo}
+	case SinalDistante:
+		return []string{AspectoAmarelo, AspectoVerde}
+	}
+	return []string{AspectoVermelho, AspectoAmarelo, AspectoVerde}
+}
+
+// AspectosPermitidos devolve os aspectos que o tipo de sinal pode exibir.
+func AspectosPermitidos(tipoSinal string) []string {
+	switch tipoSinal {
+	case SinalManobra:
+		return []string{AspectoVermelho, AspectoAmarelo, AspectoAmareloPiscante}
+	case SinalDistante:
+		return []string{AspectoAmarelo, AspectoVerde, AspectoAmareloPiscante}
+	}
+	return []string{AspectoVermelho, AspectoAmarelo, AspectoVerde, AspectoAmareloPiscante, AspectoVerdePiscante}
+}
+
+// CorLampada devolve a lâmpada acesa para o aspecto e se ela pisca.
+func CorLampada(aspecto string) (lampada string, piscante bool) {
+	switch aspecto {
+	case AspectoAmareloPiscante:
+		return AspectoAmarelo, true
+	case AspectoVerdePiscante:
+		return AspectoVerde, true
+	}
+	return aspecto, false
+}
+
+// TipoSinalAtual devolve o tipo do sinal, considerando vazio como principal.
+func (el Elemento) TipoSinalAtual() string {
+	if el.TipoSinal == "" {
+		return SinalPrincipal
+	}
+	return el.TipoSinal
+}
+
+// GeometriaSinal devolve a base do mastro (sobre a via), o ponto de fixação do
+// cabeçote e os centros das lâmpadas (Unid. Mundo).
+func (el Elemento) GeometriaSinal() (base, cabecote Ponto, lampadas []Ponto) {
+	raio := el.Espessura
+	if raio <= 0 {
+		raio = SinalRaioLampadaPadrao
+	}
+	rad := el.Rotacao * math.Pi / 180.0
+	dx, dy := math.Cos(rad), math.Sin(rad)
+	nx, ny := -dy, dx // À direita do sentido de circulação (eixo Y para baixo)
+	base = Ponto{el.X, el.Y}
+	cabecote = Ponto{el.X + nx*raio*sinalAfastamento, el.Y + ny*raio*sinalAfastamento}
+	for k := range LampadasSinal(el.TipoSinalAtual()) {
+		desloc := raio * (1 + sinalEspacamento*float64(k))
+		lampadas = append(lampadas, Ponto{cabecote.X - dx*desloc, cabecote.Y - dy*desloc})
+	}
+	return base, cabecote, lampadas
+}
+
+// AnexarSinal prende o sinal à via mais próxima dentro de raio (Unid. Mundo),
+// atualizando posição, ViaID, Distancia e o rumo conforme o Sentido.
+// Devolve false (sem alterar o sinal) se não houver via próxima.
+func AnexarSinal(elementos []Elemento, sinal *Elemento, raio float64) bool {
+	melhor, melhorDist := -1, raio
+	var fracao float64
+	for i, el := range elementos {
+		if !el.Tipo.EhVia() {
+			continue
+		}
+		cx, cy, t := ProjetarNaVia(el, sinal.X, sinal.Y)
+		if d := math.Hypot(sinal.X-cx, sinal.Y-cy); d <= melhorDist {
+			melhor, melhorDist, fracao = i, d, t
+		}
+	}
+	if melhor == -1 {
+		return false
+	}
+	if sinal.Sentido != SentidoDecrescente {
+		sinal.Sentido = SentidoCrescente
+	}
+	sinal.ViaID = elementos[melhor].ID
+	sinal.Distancia = elementos[melhor].Comprimento * fracao
+	ReposicionarSinal(elementos[melhor], sinal)
+	return true
+}
+
+// ReposicionarSinal recalcula a posição e o rumo do sinal a partir da via a
+// que está preso (ex.: depois de a via ser movida).
+func ReposicionarSinal(via Elemento, sinal *Elemento) {
+	t := 0.0
+	if via.Comprimento > 0 {
+		t = math.Max(0, math.Min(1, sinal.Distancia/via.Comprimento))
+	}
+	p, rumo := via.PontoNaVia(t)
+	sinal.X, sinal.Y, sinal.Rotacao = p.X, p.Y, rumo
+	if sinal.Sentido == SentidoDecrescente {
+		sinal.Rotacao = math.Mod(rumo+180, 360)
+	}
+}
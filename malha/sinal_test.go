@@ -0,0 +1,106 @@
+package malha
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAnexarSinal(t *testing.T) {
+	elementos := []Elemento{
+		viaReta(1, 0, 0, 1000, 0),
+		viaReta(2, 0, 3, 1000, 0),
+		circuito(3, 4, 1), // Não é via: nunca recebe o sinal
+	}
+	for _, tc := range []struct {
+		nome         string
+		x, y         float64
+		sentido      string
+		ok           bool
+		viaID        int
+		dist         float64
+		pos          Ponto
+		rotacao      float64
+		sentidoFinal string
+	}{
+		{nome: "via mais próxima", x: 4, y: 1, ok: true, viaID: 1, dist: 400, pos: Ponto{4, 0}, rotacao: 0, sentidoFinal: SentidoCrescente},
+		{nome: "outra via", x: 7.5, y: 2, ok: true, viaID: 2, dist: 750, pos: Ponto{7.5, 3}, rotacao: 0, sentidoFinal: SentidoCrescente},
+		{nome: "decrescente", x: 2, y: -1, sentido: SentidoDecrescente, ok: true, viaID: 1, dist: 200, pos: Ponto{2, 0}, rotacao: 180, sentidoFinal: SentidoDecrescente},
+		{nome: "além do fim", x: 12, y: 0, ok: true, viaID: 1, dist: 1000, pos: Ponto{10, 0}, rotacao: 0, sentidoFinal: SentidoCrescente},
+		{nome: "longe demais", x: 4, y: 8, ok: false},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			s := Elemento{Tipo: ElementoSinal, ID: 9, X: tc.x, Y: tc.y, Sentido: tc.sentido}
+			if ok := AnexarSinal(elementos, &s, 3); ok != tc.ok {
+				t.Fatalf("AnexarSinal = %v, quer %v", ok, tc.ok)
+			}
+			if !tc.ok {
+				if s.ViaID != 0 || s.X != tc.x || s.Y != tc.y || s.Sentido != tc.sentido {
+					t.Errorf("sinal alterado sem via próxima: %+v", s)
+				}
+				return
+			}
+			if s.ViaID != tc.viaID || !perto(s.Distancia, tc.dist) || s.Sentido != tc.sentidoFinal {
+				t.Errorf("preso à via %d a %.3f m (%s), quer via %d a %.3f m (%s)", s.ViaID, s.Distancia, s.Sentido, tc.viaID, tc.dist, tc.sentidoFinal)
+			}
+			if !pertoPonto(Ponto{s.X, s.Y}, tc.pos) || !perto(s.Rotacao, tc.rotacao) {
+				t.Errorf("em (%.3f,%.3f) rumo %.1f, quer (%.3f,%.3f) rumo %.1f", s.X, s.Y, s.Rotacao, tc.pos.X, tc.pos.Y, tc.rotacao)
+			}
+		})
+	}
+}
+
+func TestReposicionarSinal(t *testing.T) {
+	s := sinal(9, 1, 250, SentidoDecrescente, "S1")
+	ReposicionarSinal(viaReta(1, 10, 20, 1000, 90), &s) // Via movida e girada
+	if !pertoPonto(Ponto{s.X, s.Y}, Ponto{10, 22.5}) || !perto(s.Rotacao, 270) {
+		t.Errorf("reta: em (%.3f,%.3f) rumo %.1f, quer (10,22.5) rumo 270", s.X, s.Y, s.Rotacao)
+	}
+	s.Sentido = SentidoCrescente
+	curva := viaCurva(1, 0, 0, 0, 1000, 90)
+	ReposicionarSinal(curva, &s)
+	p, rumo := curva.PontoNaVia(250 / curva.Comprimento)
+	if !pertoPonto(Ponto{s.X, s.Y}, p) || !perto(s.Rotacao, rumo) {
+		t.Errorf("curva: em (%.3f,%.3f) rumo %.1f, quer (%.3f,%.3f) rumo %.1f", s.X, s.Y, s.Rotacao, p.X, p.Y, rumo)
+	}
+	s.Distancia = -50 // Fora da via: fica no início
+	ReposicionarSinal(viaReta(1, 10, 20, 1000, 90), &s)
+	if !pertoPonto(Ponto{s.X, s.Y}, Ponto{10, 20}) {
+		t.Errorf("distância negativa: em (%.3f,%.3f), quer (10,20)", s.X, s.Y)
+	}
+}
+
+func TestGeometriaSinal(t *testing.T) {
+	for _, tc := range []struct {
+		nome     string
+		sinal    Elemento
+		cabecote Ponto
+		lampadas []Ponto
+	}{
+		{
+			// Rumo 0 com Y para baixo: a direita do sentido é +Y
+			nome:     "principal",
+			sinal:    Elemento{Tipo: ElementoSinal, X: 10, Y: 5},
+			cabecote: Ponto{10, 17},
+			lampadas: []Ponto{{7, 17}, {-0.2, 17}, {-7.4, 17}},
+		},
+		{
+			nome:     "manobra girada com raio próprio",
+			sinal:    Elemento{Tipo: ElementoSinal, TipoSinal: SinalManobra, X: 0, Y: 0, Rotacao: 90, Espessura: 1},
+			cabecote: Ponto{-4, 0},
+			lampadas: []Ponto{{-4, -1}, {-4, -3.4}},
+		},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			base, cabecote, lampadas := tc.sinal.GeometriaSinal()
+			if base != (Ponto{tc.sinal.X, tc.sinal.Y}) || !pertoPonto(cabecote, tc.cabecote) {
+				t.Errorf("base %v cabeçote %v, quer (%v,%v) e %v", base, cabecote, tc.sinal.X, tc.sinal.Y, tc.cabecote)
+			}
+			if !slices.EqualFunc(lampadas, tc.lampadas, pertoPonto) {
+				t.Errorf("lâmpadas = %v, quer %v", lampadas, tc.lampadas)
+			}
+			if len(lampadas) != len(LampadasSinal(tc.sinal.TipoSinalAtual())) {
+				t.Errorf("%d lâmpadas para %s", len(lampadas), tc.sinal.TipoSinalAtual())
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package malha
+
+import "math"
+
+// --- Snap (Atração Magnética) ---
+
+type TipoSnap int
+
+const (
+	SnapExtremidade TipoSnap = iota
+	SnapChave
+	SnapSobreVia
+)
+
+// AlvoSnap é um ponto para o qual uma extremidade de via pode ser atraída.
+type AlvoSnap struct {
+	Tipo       TipoSnap
+	X, Y       float64
+	ElementoID int
+}
+
+// FindSnapTarget procura o alvo de snap mais próximo de (worldX, worldY) dentro
+// de raio (Unid. Mundo), ignorando o elemento de índice ignorarIndex.
+// Pontos notáveis (extremidades de vias e pontas/ramos de chaves) têm prioridade sobre pontos ao longo das vias.
+func FindSnapTarget(elementos []Elemento, worldX, worldY, raio float64, ignorarIndex int) (AlvoSnap, bool) {
+	melhor, melhorDist, achou := AlvoSnap{}, raio, false
+	for i, el := range elementos {
+		if i == ignorarIndex {
+			continue
+		}
+		tipo := SnapExtremidade
+		if el.Tipo == ElementoChaveSimples {
+			tipo = SnapChave
+		}
+		for _, p := range el.PontosConexao() {
+			if d := math.Hypot(worldX-p.X, worldY-p.Y); d <= melhorDist {
+				melhor, melhorDist, achou = AlvoSnap{Tipo: tipo, X: p.X, Y: p.Y, ElementoID: el.ID}, d, true
+			}
+		}
+	}
+	if achou {
+		return melhor, true
+	}
+	for i, el := range elementos {
+		if i == ignorarIndex || !el.Tipo.EhVia() {
+			continue
+		}
+		cx, cy, t := ProjetarNaVia(el, worldX, worldY)
+		if t <= 0 || t >= 1 {
+			continue
+		}
+		if d := math.Hypot(worldX-cx, worldY-cy); d <= melhorDist {
+			melhor, melhorDist, achou = AlvoSnap{Tipo: SnapSobreVia, X: cx, Y: cy, ElementoID: el.ID}, d, true
+		}
+	}
+	return melhor, achou
+}
+
+// FindViaToSplit devolve o índice da via cujo interior contém (x, y). A via de
+// ID viaID tem preferência; se o ponto já não estiver nela (ex.: ela foi
+// dividida antes), usa qualquer outra via adequada. Devolve -1 se não houver.
+func FindViaToSplit(elementos []Elemento, viaID int, x, y float64) int {
+	index := -1
+	for i, el := range elementos {
+		if !el.Tipo.EhVia() {
+			continue
+		}
+		x1, y1, x2, y2 := el.Extremidades()
+		cx, cy, _ := ProjetarNaVia(el, x, y)
+		if math.Hypot(x-cx, y-cy) > ToleranciaNo || math.Hypot(x-x1, y-y1) <= ToleranciaNo || math.Hypot(x-x2, y-y2) <= ToleranciaNo {
+			continue
+		}
+		if index == -1 || el.ID == viaID {
+			index = i
+		}
+	}
+	return index
+}
+
+// SplitVia divide a via em (x, y): a primeira parte mantém o ID original e a
+// segunda recebe novoID, herdando as demais propriedades.
+func SplitVia(el Elemento, x, y float64, novoID int) (primeira, segunda Elemento) {
+	if el.Tipo == ElementoViaCurva {
+		return splitCurva(el, x, y, novoID)
+	}
+	if el.ehTransicao() {
+		return splitTransicao(el, x, y, novoID)
+	}
+	x1, y1, x2, y2 := el.Extremidades()
+	primeira = el
+	primeira.Comprimento = CalculateLengthMeters(x1, y1, x, y)
+	segunda = el
+	segunda.ID = novoID
+	segunda.X, segunda.Y = x, y
+	segunda.Comprimento = CalculateLengthMeters(x, y, x2, y2)
+	segunda.Conexoes = nil
+	return primeira, segunda
+}
+
+// splitCurva divide uma curva no ponto do arco mais próximo de (x, y); a
+// segunda parte começa ali, com o rumo tangente.
+func splitCurva(el Elemento, x, y float64, novoID int) (primeira, segunda Elemento) {
+	_, _, t := ProjetarNaVia(el, x, y)
+	inicio, rumo := el.PontoNaVia(t)
+	primeira = el
+	primeira.Varredura = el.Varredura * t
+	primeira.Comprimento = ComprimentoArco(el.Raio, primeira.Varredura)
+	segunda = el
+	segunda.ID = novoID
+	segunda.X, segunda.Y, segunda.Rotacao = inicio.X, inicio.Y, rumo
+	segunda.Varredura = el.Varredura - primeira.Varredura
+	segunda.Comprimento = ComprimentoArco(el.Raio, segunda.Varredura)
+	segunda.Conexoes = nil
+	return primeira, segunda
+}
@@ -0,0 +1,102 @@
+package malha
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestSplitVia(t *testing.T) {
+	for _, tc := range []struct {
+		nome                   string
+		via                    Elemento
+		x, y                   float64
+		meio                   Ponto   // Início esperado da segunda parte
+		rumo                   float64 // Rotação esperada da segunda parte
+		comprimento1           float64
+		comprimento2           float64
+		varredura1, varredura2 float64
+	}{
+		{
+			nome: "reta", via: viaReta(1, 0, 0, 1000, 0), x: 4, y: 0,
+			meio: Ponto{4, 0}, rumo: 0, comprimento1: 400, comprimento2: 600,
+		},
+		{
+			nome: "reta inclinada", via: viaReta(1, 0, 0, 1000, 90), x: 0, y: 2.5,
+			meio: Ponto{0, 2.5}, rumo: 90, comprimento1: 250, comprimento2: 750,
+		},
+		{
+			// Ponto fora do arco: a divisão usa a projeção no arco.
+			nome: "curva à direita", via: viaCurva(1, 0, 0, 0, 1000, 90), x: 8, y: 2,
+			meio: Ponto{10 * math.Sin(math.Pi/4), 10 - 10*math.Cos(math.Pi/4)}, rumo: 45,
+			comprimento1: 250 * math.Pi, comprimento2: 250 * math.Pi, varredura1: 45, varredura2: 45,
+		},
+		{
+			nome: "curva à esquerda", via: viaCurva(1, 0, 0, 0, 1000, -60), x: 5, y: -1.339745962155614,
+			meio: Ponto{5, -1.339745962155614}, rumo: -30,
+			comprimento1: 1000 * math.Pi / 6, comprimento2: 1000 * math.Pi / 6, varredura1: -30, varredura2: -30,
+		},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			tc.via.Conexoes = []int{7}
+			primeira, segunda := SplitVia(tc.via, tc.x, tc.y, 2)
+			if primeira.ID != 1 || segunda.ID != 2 {
+				t.Errorf("IDs = %d/%d, quer 1/2", primeira.ID, segunda.ID)
+			}
+			if primeira.X != tc.via.X || primeira.Y != tc.via.Y || primeira.Rotacao != tc.via.Rotacao {
+				t.Errorf("primeira parte mudou de início: %+v", primeira)
+			}
+			if math.Hypot(segunda.X-tc.meio.X, segunda.Y-tc.meio.Y) > 1e-6 || math.Abs(segunda.Rotacao-tc.rumo) > 1e-6 {
+				t.Errorf("segunda parte começa em (%.4f,%.4f) rumo %.2f, quer (%.4f,%.4f) rumo %.2f", segunda.X, segunda.Y, segunda.Rotacao, tc.meio.X, tc.meio.Y, tc.rumo)
+			}
+			if math.Abs(primeira.Comprimento-tc.comprimento1) > 1e-6 || math.Abs(segunda.Comprimento-tc.comprimento2) > 1e-6 {
+				t.Errorf("comprimentos = %.3f/%.3f, quer %.3f/%.3f", primeira.Comprimento, segunda.Comprimento, tc.comprimento1, tc.comprimento2)
+			}
+			if !perto(primeira.Varredura, tc.varredura1) || !perto(segunda.Varredura, tc.varredura2) {
+				t.Errorf("varreduras = %.3f/%.3f, quer %.3f/%.3f", primeira.Varredura, segunda.Varredura, tc.varredura1, tc.varredura2)
+			}
+			if segunda.Conexoes != nil {
+				t.Errorf("segunda parte herdou Conexoes %v", segunda.Conexoes)
+			}
+
+			// As duas partes reproduzem as extremidades da via e ficam ligadas.
+			x1, y1, x2, y2 := tc.via.Extremidades()
+			ax1, ay1, ax2, ay2 := primeira.Extremidades()
+			bx1, by1, bx2, by2 := segunda.Extremidades()
+			if math.Hypot(ax1-x1, ay1-y1) > 1e-6 || math.Hypot(ax2-bx1, ay2-by1) > 1e-6 || math.Hypot(bx2-x2, by2-y2) > 1e-6 {
+				t.Errorf("partes (%.3f,%.3f)-(%.3f,%.3f) e (%.3f,%.3f)-(%.3f,%.3f) não cobrem (%.3f,%.3f)-(%.3f,%.3f)", ax1, ay1, ax2, ay2, bx1, by1, bx2, by2, x1, y1, x2, y2)
+			}
+			if got := BuildTopologia([]Elemento{primeira, segunda}).Neighbors(1); !slices.Equal(got, []int{2}) {
+				t.Errorf("Neighbors(1) após dividir = %v, quer [2]", got)
+			}
+		})
+	}
+}
+
+func TestFindViaToSplit(t *testing.T) {
+	elementos := []Elemento{
+		viaReta(1, 0, 0, 1000, 0),
+		viaCurva(2, 10, 0, 0, 1000, 90),
+		viaReta(3, 0, 0, 1000, 0), // Sobreposta à via 1
+		circuito(4, 5, 0),
+	}
+	for _, tc := range []struct {
+		nome  string
+		viaID int
+		x, y  float64
+		quer  int // Índice em elementos
+	}{
+		{"meio da reta", 1, 5, 0, 0},
+		{"preferência pela via informada", 3, 5, 0, 2},
+		{"via informada já não contém o ponto", 2, 5, 0, 0},
+		{"meio da curva", 2, 10 + 10*math.Sin(math.Pi/4), 10 - 10*math.Cos(math.Pi/4), 1},
+		{"extremidade não divide", 1, 10, 0, -1},
+		{"fora de qualquer via", 1, 5, 3, -1},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			if got := FindViaToSplit(elementos, tc.viaID, tc.x, tc.y); got != tc.quer {
+				t.Errorf("FindViaToSplit(%d, %.2f, %.2f) = %d, quer %d", tc.viaID, tc.x, tc.y, got, tc.quer)
+			}
+		})
+	}
+}
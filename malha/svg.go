@@ -0,0 +1,232 @@
+package malha
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+)
+
+// --- Exportação SVG ---
+// Um <g> por tipo de elemento (camada no Inkscape) e, dentro dele, um <g> por
+// elemento com ID, tipo e propriedades em atributos data-*. As coordenadas
+// são Unid. Mundo; o enquadramento (tamanho, escala, margem, fundo) segue as
+// mesmas OpcoesImagem da exportação PNG. Ao contrário do desenho em tela, as
+// vias usam a largura real: trilhos afastados Espessura na perpendicular e
+// curvas como arcos verdadeiros.
+
+// camadasSVG define a ordem de desenho e o nome de cada camada.
+var camadasSVG = []struct {
+	tipo       ElementType
+	id, rotulo string
+}{
+	{ElementoViaReta, "via-reta", "Vias Retas"},
+	{ElementoViaCurva, "via-curva", "Vias Curvas"},
+	{ElementoViaTransicao, "via-transicao", "Vias de Transicao"},
+	{ElementoChaveSimples, "chave-simples", "Chaves"},
+	{ElementoCircuitoVia, "circuito-via", "Circuitos de Via"},
+	{ElementoSinal, "sinal", "Sinais"},
+}
+
+// corSVG devolve a cor como #rrggbb e a opacidade (1 se opaca).
+func corSVG(c color.RGBA) (string, float64) {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B), float64(c.A) / 255
+}
+
+func numSVG(v float64) string {
+	s := strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.4f", v), "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// tracoSVG devolve os atributos de contorno com a cor e a largura (Unid. Mundo).
+func tracoSVG(c color.RGBA, largura float64) string {
+	hex, opacidade := corSVG(c)
+	if opacidade < 1 {
+		return fmt.Sprintf(`fill="none" stroke="%s" stroke-opacity="%s" stroke-width="%s"`, hex, numSVG(opacidade), numSVG(largura))
+	}
+	return fmt.Sprintf(`fill="none" stroke="%s" stroke-width="%s"`, hex, numSVG(largura))
+}
+
+func preenchimentoSVG(c color.RGBA) string {
+	hex, opacidade := corSVG(c)
+	if opacidade < 1 {
+		return fmt.Sprintf(`fill="%s" fill-opacity="%s"`, hex, numSVG(opacidade))
+	}
+	return fmt.Sprintf(`fill="%s"`, hex)
+}
+
+// caminhoVia devolve o atributo d do eixo da via deslocado lateralmente
+// (positivo = à direita do rumo), como segmento, arco ou, na transição,
+// polilinha (o SVG não tem clotoide).
+func caminhoVia(el Elemento, desloc float64) (d string, ini, fim Ponto) {
+	deslocar := func(t float64) Ponto {
+		p, rumo := el.PontoNaVia(t)
+		rad := rumo * math.Pi / 180
+		return Ponto{p.X - math.Sin(rad)*desloc, p.Y + math.Cos(rad)*desloc}
+	}
+	ini, fim = deslocar(0), deslocar(1)
+	if el.ehTransicao() {
+		var b strings.Builder
+		fmt.Fprintf(&b, "M%s,%s", numSVG(ini.X), numSVG(ini.Y))
+		for k, passos := 1, el.passosTransicao(); k <= passos; k++ {
+			p := deslocar(float64(k) / float64(passos))
+			fmt.Fprintf(&b, " L%s,%s", numSVG(p.X), numSVG(p.Y))
+		}
+		return b.String(), ini, fim
+	}
+	if !el.ehArco() {
+		return fmt.Sprintf("M%s,%s L%s,%s", numSVG(ini.X), numSVG(ini.Y), numSVG(fim.X), numSVG(fim.Y)), ini, fim
+	}
+	cx, cy, _, _ := el.centroCurva()
+	raio := math.Hypot(ini.X-cx, ini.Y-cy)
+	grande, sentido := 0, 0
+	if math.Abs(el.Varredura) > 180 {
+		grande = 1
+	}
+	if el.Varredura > 0 { // Rumo crescente: horário na tela (Y para baixo)
+		sentido = 1
+	}
+	return fmt.Sprintf("M%s,%s A%s,%s 0 %d %d %s,%s", numSVG(ini.X), numSVG(ini.Y), numSVG(raio), numSVG(raio), grande, sentido, numSVG(fim.X), numSVG(fim.Y)), ini, fim
+}
+
+// atributosSVG devolve os atributos data-* com as propriedades do elemento.
+func atributosSVG(el Elemento, tipoID string) string {
+	attrs := [][2]string{{"id", fmt.Sprint(el.ID)}, {"tipo", tipoID}}
+	if el.Nome != "" {
+		attrs = append(attrs, [2]string{"nome", el.Nome})
+	}
+	attrs = append(attrs, [2]string{"x", numSVG(el.X)}, [2]string{"y", numSVG(el.Y)})
+	switch el.Tipo {
+	case ElementoViaReta, ElementoViaCurva, ElementoViaTransicao:
+		attrs = append(attrs, [2]string{"comprimento-m", numSVG(el.Comprimento)}, [2]string{"rotacao", numSVG(el.Rotacao)}, [2]string{"espessura", numSVG(el.Espessura)}, [2]string{"cheia", fmt.Sprint(el.ModoCheio)})
+		if el.Tipo == ElementoViaTransicao {
+			attrs = append(attrs, [2]string{"raio-inicial-m", numSVG(el.RaioInicial)})
+		}
+		if el.Tipo != ElementoViaReta {
+			attrs = append(attrs, [2]string{"raio-m", numSVG(el.Raio)}, [2]string{"varredura", numSVG(el.Varredura)})
+		}
+	case ElementoCircuitoVia:
+		orientacao := el.OrientacaoTC
+		if orientacao == "" {
+			orientacao = "Normal"
+		}
+		attrs = append(attrs, [2]string{"largura", numSVG(el.Largura)}, [2]string{"espessura", numSVG(el.Espessura)}, [2]string{"orientacao", orientacao})
+	case ElementoChaveSimples:
+		attrs = append(attrs, [2]string{"comprimento-m", numSVG(el.Comprimento)}, [2]string{"rotacao", numSVG(el.Rotacao)}, [2]string{"desvio", numSVG(el.AnguloDesvio)}, [2]string{"posicao", el.PosicaoAtual()})
+	case ElementoSinal:
+		attrs = append(attrs, [2]string{"via-id", fmt.Sprint(el.ViaID)}, [2]string{"distancia-m", numSVG(el.Distancia)}, [2]string{"sentido", el.Sentido}, [2]string{"tipo-sinal", el.TipoSinalAtual()}, [2]string{"aspecto", el.Aspecto})
+	}
+	if el.Tipo != ElementoSinal {
+		attrs = append(attrs, [2]string{"estado", el.EstadoNormalizado()})
+	}
+	if len(el.Conexoes) > 0 {
+		ids := make([]string, len(el.Conexoes))
+		for k, c := range el.Conexoes {
+			ids[k] = fmt.Sprint(c)
+		}
+		attrs = append(attrs, [2]string{"conexoes", strings.Join(ids, " ")})
+	}
+	var b strings.Builder
+	for _, a := range attrs {
+		fmt.Fprintf(&b, ` data-%s="%s"`, a[0], html.EscapeString(a[1]))
+	}
+	return b.String()
+}
+
+// formasSVG escreve as formas do elemento (sem o <g> que as envolve).
+func formasSVG(w io.Writer, el Elemento, cor color.RGBA) {
+	switch el.Tipo {
+	case ElementoViaReta, ElementoViaCurva, ElementoViaTransicao:
+		if el.ModoCheio {
+			d, _, _ := caminhoVia(el, 0)
+			fmt.Fprintf(w, "      <path d=\"%s\" %s/>\n", d, tracoSVG(cor, el.Espessura))
+			return
+		}
+		esq, iniE, fimE := caminhoVia(el, -el.Espessura/2)
+		dir, iniD, fimD := caminhoVia(el, el.Espessura/2)
+		fmt.Fprintf(w, "      <path d=\"%s M%s,%s L%s,%s M%s,%s L%s,%s\" %s/>\n", esq+" "+dir,
+			numSVG(iniE.X), numSVG(iniE.Y), numSVG(iniD.X), numSVG(iniD.Y), numSVG(fimE.X), numSVG(fimE.Y), numSVG(fimD.X), numSVG(fimD.Y), tracoSVG(cor, TracoTrilho))
+	case ElementoCircuitoVia: // ├ (Normal) ou ┤ (Invertido): barra de junta e haste
+		haste := el.Largura / 2
+		if el.OrientacaoTC == "Invertido" {
+			haste = -haste
+		}
+		fmt.Fprintf(w, "      <path d=\"M%s,%s V%s M%s,%s H%s\" %s/>\n", numSVG(el.X), numSVG(el.Y-el.Largura/2), numSVG(el.Y+el.Largura/2),
+			numSVG(el.X), numSVG(el.Y), numSVG(el.X+haste), tracoSVG(cor, el.Espessura))
+	case ElementoChaveSimples:
+		ponta, posicionado, livre := el.PontasChave()
+		if el.PosicaoAtual() == PosicaoReversa {
+			posicionado, livre = livre, posicionado
+		}
+		fmt.Fprintf(w, "      <path d=\"M%s,%s L%s,%s\" %s/>\n", numSVG(ponta.X), numSVG(ponta.Y), numSVG(livre.X), numSVG(livre.Y), tracoSVG(CorRamoLivre, TracoTrilho))
+		fmt.Fprintf(w, "      <path d=\"M%s,%s L%s,%s\" %s/>\n", numSVG(ponta.X), numSVG(ponta.Y), numSVG(posicionado.X), numSVG(posicionado.Y), tracoSVG(cor, el.Largura))
+		fmt.Fprintf(w, "      <circle cx=\"%s\" cy=\"%s\" r=\"%s\" %s/>\n", numSVG(ponta.X), numSVG(ponta.Y), numSVG(el.Espessura), preenchimentoSVG(cor))
+	case ElementoSinal:
+		base, cabecote, lampadas := el.GeometriaSinal()
+		tipo := el.TipoSinalAtual()
+		raio := el.Espessura
+		if raio <= 0 {
+			raio = SinalRaioLampadaPadrao
+		}
+		if tipo == SinalManobra {
+			raio *= 0.75
+		}
+		fmt.Fprintf(w, "      <path d=\"M%s,%s L%s,%s\" %s/>\n", numSVG(base.X), numSVG(base.Y), numSVG(cabecote.X), numSVG(cabecote.Y), tracoSVG(cor, TracoTrilho))
+		ultima := lampadas[len(lampadas)-1]
+		fmt.Fprintf(w, "      <path d=\"M%s,%s L%s,%s\" %s/>\n", numSVG(cabecote.X), numSVG(cabecote.Y), numSVG(ultima.X), numSVG(ultima.Y), tracoSVG(CorCabecoteSinal, raio*2.6))
+		fmt.Fprintf(w, "      <circle cx=\"%s\" cy=\"%s\" r=\"%s\" %s/>\n", numSVG(ultima.X), numSVG(ultima.Y), numSVG(raio*1.3), preenchimentoSVG(CorCabecoteSinal))
+		acesa, _ := CorLampada(el.Aspecto)
+		contorno, _ := corSVG(cor)
+		for k, c := range LampadasSinal(tipo) {
+			preenchimento := CorLampadaApagada
+			if c == acesa {
+				preenchimento = CorAspecto[c]
+			}
+			fmt.Fprintf(w, "      <circle cx=\"%s\" cy=\"%s\" r=\"%s\" %s stroke=\"%s\" stroke-width=\"1\" vector-effect=\"non-scaling-stroke\" data-lampada=\"%s\"/>\n",
+				numSVG(lampadas[k].X), numSVG(lampadas[k].Y), numSVG(raio), preenchimentoSVG(preenchimento), contorno, c)
+		}
+	}
+}
+
+// ExportarSVG grava a malha como SVG enquadrado conforme as opções.
+func ExportarSVG(w io.Writer, elementos []Elemento, op OpcoesImagem) error {
+	largura, altura, zoom, origemX, origemY, err := op.enquadrar(CaixaDe(elementos))
+	if err != nil {
+		return err
+	}
+	secoes := BuildSecoes(elementos, BuildTopologia(elementos))
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>`)
+	fmt.Fprintf(b, "<svg xmlns=\"http://www.w3.org/2000/svg\" xmlns:inkscape=\"http://www.inkscape.org/namespaces/inkscape\" version=\"1.1\" width=\"%d\" height=\"%d\" viewBox=\"%s %s %s %s\">\n",
+		largura, altura, numSVG(origemX), numSVG(origemY), numSVG(float64(largura)/zoom), numSVG(float64(altura)/zoom))
+	fmt.Fprintf(b, "  <rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" %s/>\n", numSVG(origemX), numSVG(origemY), numSVG(float64(largura)/zoom), numSVG(float64(altura)/zoom), preenchimentoSVG(op.Fundo))
+	for _, camada := range camadasSVG {
+		fmt.Fprintf(b, "  <g id=\"%s\" inkscape:groupmode=\"layer\" inkscape:label=\"%s\" stroke-linecap=\"butt\">\n", camada.id, camada.rotulo)
+		for _, el := range elementos {
+			if el.Tipo != camada.tipo {
+				continue
+			}
+			cor := el.Cor
+			if idx := secoes.SecaoDoElemento(el.ID); idx != -1 {
+				switch secoes.Lista[idx].Estado {
+				case EstadoOcupado:
+					cor = CorSecaoOcupada
+				case EstadoFalha:
+					cor = CorSecaoFalha
+				}
+			}
+			fmt.Fprintf(b, "    <g%s>\n", atributosSVG(el, camada.id))
+			formasSVG(b, el, cor)
+			fmt.Fprintln(b, "    </g>")
+		}
+		fmt.Fprintln(b, "  </g>")
+	}
+	fmt.Fprintln(b, "</svg>")
+	return b.Flush()
+}
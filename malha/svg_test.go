@@ -0,0 +1,110 @@
+package malha
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/color"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// noSVG é um elemento XML genérico, para inspecionar o SVG exportado.
+type noSVG struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Filhos  []noSVG    `xml:",any"`
+}
+
+func (n noSVG) attr(nome string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == nome {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// dado devolve o atributo data-* de uma propriedade do elemento.
+func (n noSVG) dado(nome string) string {
+	return n.attr("data-" + nome)
+}
+
+func TestExportarSVG(t *testing.T) {
+	elementos := []Elemento{
+		viaReta(1, 0, 0, 1000, 0),
+		viaCurva(2, 10, 0, 0, 1000, 90),
+		chave(3, -10, 0, 0, 1000, PosicaoReversa, `<W&1>`),
+		circuito(4, 10, 0),
+		sinal(5, 1, 500, SentidoCrescente, "S1"),
+		viaTransicao(6, 0, 10, 0, 1000, 0, 1000, -1),
+	}
+	elementos[0].Estado = EstadoOcupado
+	elementos[1].Cor = color.RGBA{B: 255, A: 255}
+	elementos[4].Aspecto = AspectoVerde
+	ReposicionarSinal(elementos[0], &elementos[4])
+
+	var buf bytes.Buffer
+	if err := ExportarSVG(&buf, elementos, OpcoesImagem{Largura: 400, Margem: 10}); err != nil {
+		t.Fatalf("ExportarSVG: %v", err)
+	}
+	var raiz noSVG
+	if err := xml.Unmarshal(buf.Bytes(), &raiz); err != nil {
+		t.Fatalf("SVG inválido: %v\n%s", err, buf.String())
+	}
+	if raiz.XMLName.Local != "svg" || raiz.attr("width") != "400" || len(strings.Fields(raiz.attr("viewBox"))) != 4 {
+		t.Fatalf("raiz <%s width=%q viewBox=%q>", raiz.XMLName.Local, raiz.attr("width"), raiz.attr("viewBox"))
+	}
+
+	// Fundo e uma camada por tipo, na ordem de desenho
+	var camadas []string
+	grupos := map[string]noSVG{} // data-id -> <g> do elemento
+	for _, c := range raiz.Filhos[1:] {
+		camadas = append(camadas, c.attr("id"))
+		for _, g := range c.Filhos {
+			if g.dado("tipo") != c.attr("id") {
+				t.Errorf("elemento %s do tipo %s na camada %s", g.dado("id"), g.dado("tipo"), c.attr("id"))
+			}
+			grupos[g.dado("id")] = g
+		}
+	}
+	if quer := []string{"via-reta", "via-curva", "via-transicao", "chave-simples", "circuito-via", "sinal"}; !slices.Equal(camadas, quer) {
+		t.Errorf("camadas = %v, quer %v", camadas, quer)
+	}
+	if len(grupos) != len(elementos) {
+		t.Fatalf("%d elementos no SVG, quer %d", len(grupos), len(elementos))
+	}
+
+	if via := grupos["1"]; via.dado("estado") != EstadoOcupado || via.Filhos[0].attr("stroke") != "#ff0000" {
+		t.Errorf("via ocupada com estado %q e traço %q, quer %q e #ff0000", via.dado("estado"), via.Filhos[0].attr("stroke"), EstadoOcupado)
+	}
+	if curva := grupos["2"]; !strings.Contains(curva.Filhos[0].attr("d"), " A") || curva.Filhos[0].attr("stroke") != "#0000ff" || curva.dado("raio-m") != "1000" {
+		t.Errorf("curva desenhada como %q com traço %q e raio %q", curva.Filhos[0].attr("d"), curva.Filhos[0].attr("stroke"), curva.dado("raio-m"))
+	}
+	if tr := grupos["6"]; strings.Count(tr.Filhos[0].attr("d"), " L") < 2 || tr.dado("raio-inicial-m") != "0" || tr.dado("raio-m") != "1000" || !strings.HasPrefix(tr.dado("varredura"), "-") {
+		t.Errorf("transição desenhada como %q com raios %q/%q e varredura %q", tr.Filhos[0].attr("d"), tr.dado("raio-inicial-m"), tr.dado("raio-m"), tr.dado("varredura"))
+	}
+	if ch := grupos["3"]; ch.dado("nome") != `<W&1>` || ch.dado("posicao") != PosicaoReversa {
+		t.Errorf("chave com nome %q e posição %q", ch.dado("nome"), ch.dado("posicao"))
+	}
+	if s := grupos["5"]; s.dado("via-id") != "1" || s.dado("distancia-m") != "500" || s.dado("aspecto") != AspectoVerde {
+		t.Errorf("sinal com via %q, distância %q e aspecto %q", s.dado("via-id"), s.dado("distancia-m"), s.dado("aspecto"))
+	}
+	acesas := map[string]string{}
+	for _, f := range grupos["5"].Filhos {
+		if l := f.dado("lampada"); l != "" {
+			acesas[l] = f.attr("fill")
+		}
+	}
+	if quer := map[string]string{AspectoVermelho: "#282828", AspectoAmarelo: "#282828", AspectoVerde: "#00dc00"}; !maps.Equal(acesas, quer) {
+		t.Errorf("lâmpadas = %v, quer %v", acesas, quer)
+	}
+}
+
+func TestExportarSVGSemTamanho(t *testing.T) {
+	var buf bytes.Buffer
+	if err := ExportarSVG(&buf, []Elemento{viaReta(1, 0, 0, 1000, 0)}, OpcoesImagem{}); err == nil {
+		t.Error("ExportarSVG sem tamanho nem escala não falhou")
+	}
+}
@@ -0,0 +1,310 @@
+package malha
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"slices"
+	"strings"
+)
+
+// --- Tabela de Rotas ---
+// Gerada a partir da malha: de cada sinal principal ou de manobra, todos os
+// percursos (um por combinação de chaves) até o primeiro sinal principal ou de
+// manobra no mesmo sentido. Sinais distantes não iniciam nem terminam rotas.
+// Para cada rota: chaves e posições, circuitos de via (seções) percorridos,
+// proteção de flanco e rotas conflitantes. Proteção de flanco: pelo ramo não
+// usado de cada chave da rota, a primeira chave alcançada pelo lado dos ramos
+// fica no ramo que desvia da rota. Duas rotas conflitam se têm uma seção em
+// comum ou se a proteção de flanco de uma exige uma chave da outra na posição
+// contrária.
+
+// LinhaRota é uma linha da tabela de rotas.
+type LinhaRota struct {
+	Rota
+	Circuitos []string // Nomes das seções percorridas, na ordem
+	Flanco    []PosicaoExigida
+	Conflitos []string // Nomes das rotas conflitantes
+}
+
+// TabelaRotas é a tabela de rotas de uma malha.
+type TabelaRotas struct {
+	Linhas  []LinhaRota
+	Sinais  int            // Sinais principais e de manobra considerados
+	rotulos map[int]string // ID -> rótulo, para as chaves
+}
+
+// sinalDeRota indica se o sinal inicia e termina rotas.
+func sinalDeRota(el Elemento) bool {
+	return el.Tipo == ElementoSinal && el.TipoSinalAtual() != SinalDistante
+}
+
+// sinalAFrente devolve o primeiro sinal de rota, no sentido do passo, depois de
+// apos metros percorridos na aresta, e a distância até ele.
+func sinalAFrente(t *Topologia, p PassoCaminho, sinais []Elemento, apos float64) (Elemento, float64, bool) {
+	a := t.Arestas[p.Aresta]
+	sentido := SentidoCrescente
+	if p.Entrada == a.NoB {
+		sentido = SentidoDecrescente
+	}
+	var achado Elemento
+	melhor := math.Inf(1)
+	for _, s := range sinais {
+		if (s.Sentido == SentidoDecrescente) != (sentido == SentidoDecrescente) {
+			continue
+		}
+		d := math.Max(0, math.Min(a.Comprimento, s.Distancia))
+		if sentido == SentidoDecrescente {
+			d = a.Comprimento - d
+		}
+		if d > apos && d < melhor {
+			achado, melhor = s, d
+		}
+	}
+	return achado, melhor, !math.IsInf(melhor, 1)
+}
+
+// percursosDoSinal chama visitar para cada percurso da origem até o primeiro
+// sinal de rota no mesmo sentido. Um percurso não repete arestas.
+func percursosDoSinal(t *Topologia, origem Elemento, sinaisPorVia map[int][]Elemento, visitar func(destino Elemento, passos []PassoCaminho, comprimento float64)) {
+	partidas := partidasRota(t, origem)
+	if len(partidas) == 0 {
+		return
+	}
+	inicio := partidas[0]
+	a := t.Arestas[inicio.Aresta]
+	if _, _, ok := sinalAFrente(t, inicio.PassoCaminho, sinaisPorVia[a.ElementoID], a.Comprimento-inicio.Custo); ok {
+		return // Outro sinal na própria via de espera: nenhuma rota sai deste
+	}
+	passos := []PassoCaminho{inicio.PassoCaminho}
+	naPilha := map[int]bool{inicio.Aresta: true}
+	var seguir func(custo float64)
+	seguir = func(custo float64) {
+		atual := passos[len(passos)-1]
+		no := t.Saida(atual)
+		for _, prox := range t.Seguintes(atual.Aresta, no, false) {
+			if naPilha[prox] {
+				continue
+			}
+			p := PassoCaminho{Aresta: prox, Entrada: no}
+			passos = append(passos, p)
+			if destino, d, ok := sinalAFrente(t, p, sinaisPorVia[t.Arestas[prox].ElementoID], -1); ok {
+				visitar(destino, slices.Clone(passos), custo+d)
+			} else {
+				naPilha[prox] = true
+				seguir(custo + t.Arestas[prox].Comprimento)
+				naPilha[prox] = false
+			}
+			passos = passos[:len(passos)-1]
+		}
+	}
+	seguir(inicio.Custo)
+}
+
+// flancoDaRota devolve as chaves de proteção de flanco da rota.
+func flancoDaRota(t *Topologia, rota Rota) []PosicaoExigida {
+	naRota := map[int]bool{}
+	for _, id := range rota.Elementos {
+		naRota[id] = true
+	}
+	vistas := map[int]bool{}
+	flanco := []PosicaoExigida{}
+	for _, c := range rota.Chaves {
+		for _, ramo := range t.ArestasDoElemento(c.ChaveID) {
+			if t.Arestas[ramo].Ramo == c.Posicao {
+				continue
+			}
+			// Caminha pelo ramo não usado, afastando-se da chave, até uma bifurcação
+			p := PassoCaminho{Aresta: ramo, Entrada: t.Arestas[ramo].NoA}
+			percorridas := map[int]bool{ramo: true}
+			for {
+				seguintes := t.Seguintes(p.Aresta, t.Saida(p), false)
+				if len(seguintes) != 1 || percorridas[seguintes[0]] {
+					break // Fim de linha, ponta de chave ou junção ambígua: sem chave de flanco
+				}
+				p = PassoCaminho{Aresta: seguintes[0], Entrada: t.Saida(p)}
+				percorridas[p.Aresta] = true
+				a := t.Arestas[p.Aresta]
+				if a.Ramo == "" {
+					continue
+				}
+				if !naRota[a.ElementoID] && !vistas[a.ElementoID] {
+					vistas[a.ElementoID] = true
+					posicao := PosicaoNormal
+					if a.Ramo == PosicaoNormal {
+						posicao = PosicaoReversa
+					}
+					flanco = append(flanco, PosicaoExigida{ChaveID: a.ElementoID, Posicao: posicao})
+				}
+				break
+			}
+		}
+	}
+	return flanco
+}
+
+// conflitam indica se as rotas a e b não podem estar estabelecidas juntas.
+func conflitam(a, b LinhaRota, secoes *Secoes) bool {
+	for _, id := range a.Elementos {
+		idx := secoes.SecaoDoElemento(id)
+		if slices.ContainsFunc(b.Elementos, func(outro int) bool { return outro == id || (idx != -1 && secoes.SecaoDoElemento(outro) == idx) }) {
+			return true
+		}
+	}
+	contraria := func(flanco, chaves []PosicaoExigida) bool {
+		for _, f := range flanco {
+			for _, c := range chaves {
+				if f.ChaveID == c.ChaveID && f.Posicao != c.Posicao {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return contraria(a.Flanco, b.Chaves) || contraria(b.Flanco, a.Chaves)
+}
+
+// GerarTabelaRotas monta a tabela de rotas da malha, ordenada pela ordem dos
+// sinais de origem e, de cada origem, pelo comprimento. Percursos alternativos
+// entre os mesmos sinais recebem o sufixo "/2", "/3"...
+func GerarTabelaRotas(elementos []Elemento) TabelaRotas {
+	t := BuildTopologia(elementos)
+	secoes := BuildSecoes(elementos, t)
+	tab := TabelaRotas{rotulos: map[int]string{}}
+	sinaisPorVia := map[int][]Elemento{}
+	for _, el := range elementos {
+		tab.rotulos[el.ID] = el.Rotulo()
+		if sinalDeRota(el) {
+			sinaisPorVia[el.ViaID] = append(sinaisPorVia[el.ViaID], el)
+		}
+	}
+	for _, origem := range elementos {
+		if !sinalDeRota(origem) {
+			continue
+		}
+		tab.Sinais++
+		rotas := []Rota{}
+		percursosDoSinal(t, origem, sinaisPorVia, func(destino Elemento, passos []PassoCaminho, comprimento float64) {
+			if rota, err := rotaDoPercurso(t, origem, destino, passos, comprimento); err == nil {
+				rotas = append(rotas, rota)
+			}
+		})
+		slices.SortStableFunc(rotas, func(a, b Rota) int { return cmp.Compare(a.Comprimento, b.Comprimento) })
+		vezes := map[int]int{}
+		for _, rota := range rotas {
+			if vezes[rota.DestinoID]++; vezes[rota.DestinoID] > 1 {
+				rota.Nome += fmt.Sprintf("/%d", vezes[rota.DestinoID])
+			}
+			linha := LinhaRota{Rota: rota, Flanco: flancoDaRota(t, rota)}
+			for _, grupo := range gruposPorSecao(rota.Elementos, secoes) {
+				nome := fmt.Sprintf("ID %d", grupo[0])
+				if idx := secoes.SecaoDoElemento(grupo[0]); idx != -1 {
+					nome = secoes.Lista[idx].Nome
+				}
+				linha.Circuitos = append(linha.Circuitos, nome)
+			}
+			tab.Linhas = append(tab.Linhas, linha)
+		}
+	}
+	for i := range tab.Linhas {
+		for j := range tab.Linhas {
+			if i != j && conflitam(tab.Linhas[i], tab.Linhas[j], secoes) {
+				tab.Linhas[i].Conflitos = append(tab.Linhas[i].Conflitos, tab.Linhas[j].Nome)
+			}
+		}
+	}
+	return tab
+}
+
+// posicoes formata as posições exigidas como "W1 Normal, W2 Reversa".
+func (tab TabelaRotas) posicoes(lista []PosicaoExigida) string {
+	textos := make([]string, len(lista))
+	for i, p := range lista {
+		textos[i] = tab.rotulos[p.ChaveID] + " " + p.Posicao
+	}
+	return strings.Join(textos, ", ")
+}
+
+// colunasTabelaRotas são os cabeçalhos comuns ao CSV e ao HTML.
+var colunasTabelaRotas = []string{"Rota", "Origem", "Destino", "Comprimento (m)", "Chaves", "Circuitos de Via", "Proteção de Flanco", "Rotas Conflitantes"}
+
+// campos devolve as células da linha, na ordem de colunasTabelaRotas.
+func (tab TabelaRotas) campos(l LinhaRota) []string {
+	return []string{
+		l.Nome,
+		tab.rotulos[l.OrigemID],
+		tab.rotulos[l.DestinoID],
+		fmt.Sprintf("%.0f", l.Comprimento),
+		tab.posicoes(l.Chaves),
+		strings.Join(l.Circuitos, ", "),
+		tab.posicoes(l.Flanco),
+		strings.Join(l.Conflitos, ", "),
+	}
+}
+
+// ExportarTabelaRotasCSV grava a tabela de rotas da malha em CSV separado por
+// ponto e vírgula (abre direto no Excel em português), com cabeçalho.
+func ExportarTabelaRotasCSV(w io.Writer, elementos []Elemento) error {
+	tab := GerarTabelaRotas(elementos)
+	c := csv.NewWriter(w)
+	c.Comma = ';'
+	c.Write(colunasTabelaRotas)
+	for _, l := range tab.Linhas {
+		c.Write(tab.campos(l))
+	}
+	c.Flush()
+	return c.Error()
+}
+
+// ExportarTabelaRotasHTML grava a tabela de rotas da malha num relatório HTML
+// autocontido, pronto para impressão (paisagem).
+func ExportarTabelaRotasHTML(w io.Writer, elementos []Elemento) error {
+	tab := GerarTabelaRotas(elementos)
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, `<!DOCTYPE html>`)
+	fmt.Fprintln(b, `<html lang="pt-BR">`)
+	fmt.Fprintln(b, `<head>`)
+	fmt.Fprintln(b, `<meta charset="utf-8">`)
+	fmt.Fprintln(b, `<title>Tabela de Rotas</title>`)
+	fmt.Fprintln(b, `<style>
+body { font-family: sans-serif; font-size: 10pt; margin: 1.5em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #888; padding: 3px 6px; text-align: left; vertical-align: top; }
+th { background: #ddd; }
+tr:nth-child(even) td { background: #f4f4f4; }
+td.num { text-align: right; }
+@page { size: landscape; margin: 1cm; }
+@media print { body { margin: 0; } thead { display: table-header-group; } tr { break-inside: avoid; } }
+</style>`)
+	fmt.Fprintln(b, `</head>`)
+	fmt.Fprintln(b, `<body>`)
+	fmt.Fprintln(b, `<h1>Tabela de Rotas</h1>`)
+	fmt.Fprintf(b, "<p>%d rota(s) a partir de %d sinal(is) principal(is) e de manobra.</p>\n", len(tab.Linhas), tab.Sinais)
+	fmt.Fprintln(b, `<table>`)
+	fmt.Fprint(b, "<thead><tr>")
+	for _, col := range colunasTabelaRotas {
+		fmt.Fprintf(b, "<th>%s</th>", html.EscapeString(col))
+	}
+	fmt.Fprintln(b, "</tr></thead>")
+	fmt.Fprintln(b, `<tbody>`)
+	for _, l := range tab.Linhas {
+		fmt.Fprint(b, "<tr>")
+		for i, campo := range tab.campos(l) {
+			if i == 3 {
+				fmt.Fprintf(b, "<td class=\"num\">%s</td>", html.EscapeString(campo))
+				continue
+			}
+			fmt.Fprintf(b, "<td>%s</td>", html.EscapeString(campo))
+		}
+		fmt.Fprintln(b, "</tr>")
+	}
+	fmt.Fprintln(b, `</tbody>`)
+	fmt.Fprintln(b, `</table>`)
+	fmt.Fprintln(b, `</body>`)
+	fmt.Fprintln(b, `</html>`)
+	return b.Flush()
+}
@@ -0,0 +1,78 @@
+package malha
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGerarTabelaRotasTravessao(t *testing.T) {
+	tab := GerarTabelaRotas(malhaTravessao())
+	if tab.Sinais != 6 {
+		t.Errorf("Sinais = %d, quer 6", tab.Sinais)
+	}
+	quer := []struct {
+		nome        string
+		chaves      []PosicaoExigida
+		circuitos   []string
+		flanco      []PosicaoExigida
+		conflitos   []string
+		comprimento float64
+	}{
+		{"S1-S2", []PosicaoExigida{{5, PosicaoNormal}}, []string{"W1", "CDV-2"}, []PosicaoExigida{{6, PosicaoNormal}}, []string{"S1-S3", "S5-S6"}, 7000},
+		{"S1-S3", []PosicaoExigida{{5, PosicaoReversa}, {6, PosicaoReversa}}, []string{"W1", "W2", "CDV-4"}, []PosicaoExigida{}, []string{"S1-S2", "S7-S3", "S5-S6"}, 7100},
+		{"S7-S3", []PosicaoExigida{{6, PosicaoNormal}}, []string{"W2", "CDV-4"}, []PosicaoExigida{{5, PosicaoNormal}}, []string{"S1-S3"}, 6079.4},
+		{"S5-S6", []PosicaoExigida{{5, PosicaoNormal}}, []string{"W1", "CDV-1"}, []PosicaoExigida{{6, PosicaoNormal}}, []string{"S1-S2", "S1-S3"}, 6000},
+	}
+	nomes := []string{}
+	for _, l := range tab.Linhas {
+		nomes = append(nomes, l.Nome)
+	}
+	if len(tab.Linhas) != len(quer) {
+		t.Fatalf("linhas = %v, quer %d rotas", nomes, len(quer))
+	}
+	for i, q := range quer {
+		l := tab.Linhas[i]
+		t.Run(q.nome, func(t *testing.T) {
+			if l.Nome != q.nome {
+				t.Fatalf("linha %d = %s, quer %s (linhas %v)", i, l.Nome, q.nome, nomes)
+			}
+			if !slices.Equal(l.Chaves, q.chaves) {
+				t.Errorf("Chaves = %v, quer %v", l.Chaves, q.chaves)
+			}
+			if !slices.Equal(l.Circuitos, q.circuitos) {
+				t.Errorf("Circuitos = %v, quer %v", l.Circuitos, q.circuitos)
+			}
+			if !slices.Equal(l.Flanco, q.flanco) {
+				t.Errorf("Flanco = %v, quer %v", l.Flanco, q.flanco)
+			}
+			if !slices.Equal(l.Conflitos, q.conflitos) {
+				t.Errorf("Conflitos = %v, quer %v", l.Conflitos, q.conflitos)
+			}
+			if !perto(l.Comprimento, q.comprimento) {
+				t.Errorf("Comprimento = %.1f, quer %.1f", l.Comprimento, q.comprimento)
+			}
+		})
+	}
+}
+
+func TestExportarTabelaRotasCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := ExportarTabelaRotasCSV(&buf, malhaTravessao()); err != nil {
+		t.Fatalf("ExportarTabelaRotasCSV: %v", err)
+	}
+	leitor := csv.NewReader(&buf)
+	leitor.Comma = ';'
+	registros, err := leitor.ReadAll()
+	if err != nil {
+		t.Fatalf("CSV inválido: %v", err)
+	}
+	if len(registros) != 5 {
+		t.Fatalf("registros = %d, quer cabeçalho e 4 rotas", len(registros))
+	}
+	if linha := strings.Join(registros[2], ";"); !strings.Contains(linha, "S1-S3") || !strings.Contains(linha, "W1 Reversa") || !strings.Contains(linha, "W2 Reversa") {
+		t.Errorf("linha S1-S3 = %q", linha)
+	}
+}
@@ -0,0 +1,297 @@
+package malha
+
+import (
+	"container/heap"
+	"math"
+	"slices"
+	"sort"
+)
+
+// --- Topologia da Malha ---
+// A topologia é derivada dos elementos: cada ViaReta vira uma aresta, cada
+// chave vira duas (ramo normal e reverso, a partir da ponta) e as extremidades
+// que coincidem (dentro de ToleranciaNo) viram um único nó. Só o ramo em que a
+// chave está posicionada fica ativo para as consultas de conectividade.
+
+const ToleranciaNo = 0.5 // Distância máxima (Unid. Mundo) entre extremidades do mesmo nó
+
+// No é um ponto de conexão da malha (extremidade de uma ou mais vias).
+type No struct {
+	ID      int
+	X, Y    float64
+	Arestas []int // Índices em Topologia.Arestas
+}
+
+// Aresta representa um elemento de via (ou um ramo de chave) ligando dois nós.
+type Aresta struct {
+	ElementoID  int
+	NoA, NoB    int
+	Comprimento float64 // Metros
+	Ramo        string  // Chave: PosicaoNormal ou PosicaoReversa; vazio para vias
+	Ativa       bool    // Falso para o ramo de chave que não está posicionado
+}
+
+// Topologia guarda o grafo nós/arestas e índices auxiliares para consultas.
+type Topologia struct {
+	Nos         []No
+	Arestas     []Aresta
+	porElemento map[int][]int // ID do elemento -> índices de arestas
+	grade       map[[2]int][]int
+	componentes [][]int // Cache de ConnectedComponents (a topologia é imutável após construída)
+}
+
+// BuildTopologia cria o grafo a partir dos elementos de via.
+func BuildTopologia(elementos []Elemento) *Topologia {
+	t := &Topologia{porElemento: map[int][]int{}, grade: map[[2]int][]int{}}
+	for _, el := range elementos {
+		switch el.Tipo {
+		case ElementoViaReta, ElementoViaCurva, ElementoViaTransicao:
+			x1, y1, x2, y2 := el.Extremidades()
+			t.addAresta(Aresta{ElementoID: el.ID, NoA: t.noEm(x1, y1), NoB: t.noEm(x2, y2), Comprimento: el.Comprimento, Ativa: true})
+		case ElementoChaveSimples:
+			ponta, normal, reversa := el.PontasChave()
+			noPonta := t.noEm(ponta.X, ponta.Y)
+			t.addAresta(Aresta{ElementoID: el.ID, NoA: noPonta, NoB: t.noEm(normal.X, normal.Y), Comprimento: el.Comprimento, Ramo: PosicaoNormal, Ativa: el.PosicaoAtual() == PosicaoNormal})
+			t.addAresta(Aresta{ElementoID: el.ID, NoA: noPonta, NoB: t.noEm(reversa.X, reversa.Y), Comprimento: el.Comprimento, Ramo: PosicaoReversa, Ativa: el.PosicaoAtual() == PosicaoReversa})
+		}
+	}
+	return t
+}
+
+func (t *Topologia) addAresta(a Aresta) {
+	idx := len(t.Arestas)
+	t.Arestas = append(t.Arestas, a)
+	t.Nos[a.NoA].Arestas = append(t.Nos[a.NoA].Arestas, idx)
+	if a.NoB != a.NoA {
+		t.Nos[a.NoB].Arestas = append(t.Nos[a.NoB].Arestas, idx)
+	}
+	t.porElemento[a.ElementoID] = append(t.porElemento[a.ElementoID], idx)
+}
+
+// noEm devolve o nó existente na posição (dentro da tolerância) ou cria um novo.
+func (t *Topologia) noEm(x, y float64) int {
+	if id := t.FindNo(x, y, ToleranciaNo); id != -1 {
+		return id
+	}
+	id := len(t.Nos)
+	t.Nos = append(t.Nos, No{ID: id, X: x, Y: y})
+	c := celulaGrade(x, y)
+	t.grade[c] = append(t.grade[c], id)
+	return id
+}
+
+func celulaGrade(x, y float64) [2]int {
+	return [2]int{int(math.Floor(x / ToleranciaNo)), int(math.Floor(y / ToleranciaNo))}
+}
+
+// FindNo devolve o nó mais próximo de (x, y) dentro de tol, ou -1.
+func (t *Topologia) FindNo(x, y, tol float64) int {
+	melhor, melhorDist := -1, tol
+	c := celulaGrade(x, y)
+	alcance := int(math.Ceil(tol / ToleranciaNo))
+	for dx := -alcance; dx <= alcance; dx++ {
+		for dy := -alcance; dy <= alcance; dy++ {
+			for _, id := range t.grade[[2]int{c[0] + dx, c[1] + dy}] {
+				if d := math.Hypot(t.Nos[id].X-x, t.Nos[id].Y-y); d <= melhorDist {
+					melhor, melhorDist = id, d
+				}
+			}
+		}
+	}
+	return melhor
+}
+
+// Neighbors devolve os IDs dos elementos que compartilham um nó com o elemento
+// informado, considerando apenas arestas ativas (ramos de chave posicionados).
+func (t *Topologia) Neighbors(elementoID int) []int {
+	vistos := map[int]bool{elementoID: true}
+	vizinhos := []int{}
+	for _, a := range t.porElemento[elementoID] {
+		if !t.Arestas[a].Ativa {
+			continue
+		}
+		for _, no := range []int{t.Arestas[a].NoA, t.Arestas[a].NoB} {
+			for _, outra := range t.Nos[no].Arestas {
+				if !t.Arestas[outra].Ativa {
+					continue
+				}
+				id := t.Arestas[outra].ElementoID
+				if !vistos[id] {
+					vistos[id] = true
+					vizinhos = append(vizinhos, id)
+				}
+			}
+		}
+	}
+	sort.Ints(vizinhos)
+	return vizinhos
+}
+
+// OutroNo devolve o nó da aresta oposto a no.
+func (t *Topologia) OutroNo(aresta, no int) int {
+	if t.Arestas[aresta].NoA == no {
+		return t.Arestas[aresta].NoB
+	}
+	return t.Arestas[aresta].NoA
+}
+
+// ArestasDoElemento devolve os índices das arestas geradas pelo elemento.
+func (t *Topologia) ArestasDoElemento(elementoID int) []int {
+	return t.porElemento[elementoID]
+}
+
+// Seguintes devolve as arestas pelas quais um trajeto que chega ao nó no pela
+// aresta informada pode continuar. Um trajeto nunca passa de um ramo ao outro
+// da mesma chave; com respeitarPosicao, ramos não posicionados são excluídos.
+func (t *Topologia) Seguintes(aresta, no int, respeitarPosicao bool) []int {
+	chegada := t.Arestas[aresta]
+	seguintes := []int{}
+	for _, a := range t.Nos[no].Arestas {
+		prox := t.Arestas[a]
+		if a == aresta || (respeitarPosicao && !prox.Ativa) {
+			continue
+		}
+		if chegada.Ramo != "" && prox.Ramo != "" && prox.ElementoID == chegada.ElementoID {
+			continue
+		}
+		seguintes = append(seguintes, a)
+	}
+	return seguintes
+}
+
+// ConnectedComponents agrupa os IDs de vias e chaves em componentes conexas,
+// ordenadas pelo menor ID de cada uma.
+func (t *Topologia) ConnectedComponents() [][]int {
+	if t.componentes != nil {
+		return t.componentes
+	}
+	ids := make([]int, 0, len(t.porElemento))
+	for id := range t.porElemento {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	visitados := map[int]bool{}
+	componentes := [][]int{}
+	for _, inicio := range ids {
+		if visitados[inicio] {
+			continue
+		}
+		componente := []int{}
+		fila := []int{inicio}
+		visitados[inicio] = true
+		for len(fila) > 0 {
+			atual := fila[0]
+			fila = fila[1:]
+			componente = append(componente, atual)
+			for _, v := range t.Neighbors(atual) {
+				if !visitados[v] {
+					visitados[v] = true
+					fila = append(fila, v)
+				}
+			}
+		}
+		sort.Ints(componente)
+		componentes = append(componentes, componente)
+	}
+	t.componentes = componentes
+	return componentes
+}
+
+// ApplyConexoes grava em cada via e chave os IDs dos elementos conectados segundo t.
+func ApplyConexoes(elementos []Elemento, t *Topologia) {
+	for i := range elementos {
+		if !elementos[i].Tipo.EhVia() && elementos[i].Tipo != ElementoChaveSimples {
+			elementos[i].Conexoes = nil
+			continue
+		}
+		vizinhos := t.Neighbors(elementos[i].ID)
+		if len(vizinhos) == 0 {
+			vizinhos = nil
+		}
+		elementos[i].Conexoes = vizinhos
+	}
+}
+
+// PassoCaminho é uma aresta percorrida a partir do nó Entrada.
+type PassoCaminho struct {
+	Aresta, Entrada int
+}
+
+// Saida devolve o nó pelo qual o passo deixa a aresta.
+func (t *Topologia) Saida(p PassoCaminho) int {
+	return t.OutroNo(p.Aresta, p.Entrada)
+}
+
+// Partida é um passo inicial de MenorCaminho com o custo (metros) já gasto nele.
+type Partida struct {
+	PassoCaminho
+	Custo float64
+}
+
+// itemCaminho é um estado da fila de MenorCaminho; final indica que o trajeto
+// termina neste passo, vindo de de (o custo já inclui só a parte percorrida da
+// aresta de chegada).
+type itemCaminho struct {
+	passo, de PassoCaminho
+	custo     float64
+	final     bool
+}
+
+type filaCaminho []itemCaminho
+
+func (f filaCaminho) Len() int           { return len(f) }
+func (f filaCaminho) Less(i, j int) bool { return f[i].custo < f[j].custo }
+func (f filaCaminho) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f *filaCaminho) Push(x any)        { *f = append(*f, x.(itemCaminho)) }
+func (f *filaCaminho) Pop() any          { v := (*f)[len(*f)-1]; *f = (*f)[:len(*f)-1]; return v }
+
+// MenorCaminho procura (Dijkstra) o trajeto mais curto que sai de uma das
+// partidas e termina num passo aceito por chegada, que devolve quantos metros
+// da aresta de chegada são percorridos. Cada passo seguinte custa o
+// comprimento inteiro da aresta; o trajeto segue Seguintes (respeitarPosicao:
+// só ramos posicionados). Devolve os passos, da partida à chegada, e o custo.
+func (t *Topologia) MenorCaminho(partidas []Partida, chegada func(PassoCaminho) (float64, bool), respeitarPosicao bool) ([]PassoCaminho, float64, bool) {
+	fila := &filaCaminho{}
+	custos := map[PassoCaminho]float64{}
+	anterior := map[PassoCaminho]PassoCaminho{}
+	inicial := map[PassoCaminho]bool{}
+	for _, p := range partidas {
+		inicial[p.PassoCaminho] = true
+		if c, ok := custos[p.PassoCaminho]; !ok || p.Custo < c {
+			custos[p.PassoCaminho] = p.Custo
+			heap.Push(fila, itemCaminho{passo: p.PassoCaminho, custo: p.Custo})
+		}
+	}
+	fechados := map[PassoCaminho]bool{}
+	for fila.Len() > 0 {
+		item := heap.Pop(fila).(itemCaminho)
+		if item.final {
+			caminho := []PassoCaminho{item.passo, item.de}
+			for p := item.de; !inicial[p]; {
+				p = anterior[p]
+				caminho = append(caminho, p)
+			}
+			slices.Reverse(caminho)
+			return caminho, item.custo, true
+		}
+		if fechados[item.passo] || item.custo > custos[item.passo] {
+			continue
+		}
+		fechados[item.passo] = true
+		for _, a := range t.Seguintes(item.passo.Aresta, t.Saida(item.passo), respeitarPosicao) {
+			prox := PassoCaminho{Aresta: a, Entrada: t.Saida(item.passo)}
+			if fechados[prox] {
+				continue
+			}
+			if parcial, ok := chegada(prox); ok {
+				heap.Push(fila, itemCaminho{passo: prox, de: item.passo, custo: item.custo + parcial, final: true})
+			}
+			if c, ok := custos[prox]; !ok || item.custo+t.Arestas[a].Comprimento < c {
+				custos[prox] = item.custo + t.Arestas[a].Comprimento
+				anterior[prox] = item.passo
+				heap.Push(fila, itemCaminho{passo: prox, custo: custos[prox]})
+			}
+		}
+	}
+	return nil, 0, false
+}
@@ -0,0 +1,278 @@
+package malha
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// malhaTopologia monta três componentes: uma linha reta-curva-reta (1, 2, 3),
+// uma via isolada (4) e uma chave (5) com via de aproximação (6), via no ramo
+// normal (7) e via no ramo reverso (8); um circuito (9) fica fora do grafo.
+func malhaTopologia(posicao string) []Elemento {
+	return []Elemento{
+		viaReta(1, 0, 0, 1000, 0),
+		viaCurva(2, 10, 0, 0, 1000, 90), // Termina em (20, 10) com rumo 90°
+		viaReta(3, 20, 10, 1000, 90),
+		viaReta(4, 100, 100, 1000, 0),
+		chave(5, 0, 50, 0, 1000, posicao, "W1"),
+		viaReta(6, -10, 50, 1000, 0),
+		viaReta(7, 10, 50, 1000, 0),
+		viaReta(8, 9.396926207859085, 53.420201433256686, 1000, 20),
+		circuito(9, 10, 0),
+	}
+}
+
+func TestBuildTopologia(t *testing.T) {
+	topo := BuildTopologia(malhaTopologia(PosicaoNormal))
+	if len(topo.Arestas) != 9 {
+		t.Errorf("arestas = %d, quer 9 (7 vias + 2 ramos de chave)", len(topo.Arestas))
+	}
+	if len(topo.Nos) != 12 {
+		t.Errorf("nós = %d, quer 12", len(topo.Nos))
+	}
+	if a := topo.ArestasDoElemento(9); len(a) != 0 {
+		t.Errorf("circuito gerou arestas %v", a)
+	}
+
+	for _, tc := range []struct {
+		nome        string
+		elementoID  int
+		ramo        string
+		ativa       bool
+		comprimento float64
+		noA, noB    Ponto
+	}{
+		{"reta", 1, "", true, 1000, Ponto{0, 0}, Ponto{10, 0}},
+		{"curva", 2, "", true, 500 * math.Pi, Ponto{10, 0}, Ponto{20, 10}},
+		{"reta após curva", 3, "", true, 1000, Ponto{20, 10}, Ponto{20, 20}},
+		{"ramo normal", 5, PosicaoNormal, true, 1000, Ponto{0, 50}, Ponto{10, 50}},
+		{"ramo reverso", 5, PosicaoReversa, false, 1000, Ponto{0, 50}, Ponto{9.396926207859085, 53.420201433256686}},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			var aresta *Aresta
+			for _, a := range topo.ArestasDoElemento(tc.elementoID) {
+				if topo.Arestas[a].Ramo == tc.ramo {
+					aresta = &topo.Arestas[a]
+				}
+			}
+			if aresta == nil {
+				t.Fatalf("sem aresta do elemento %d no ramo %q", tc.elementoID, tc.ramo)
+			}
+			if aresta.Ativa != tc.ativa || !perto(aresta.Comprimento, tc.comprimento) {
+				t.Errorf("ativa/comprimento = %v/%.3f, quer %v/%.3f", aresta.Ativa, aresta.Comprimento, tc.ativa, tc.comprimento)
+			}
+			if no := topo.FindNo(tc.noA.X, tc.noA.Y, 1e-6); no != aresta.NoA {
+				t.Errorf("NoA = %d, quer o nó em %v (%d)", aresta.NoA, tc.noA, no)
+			}
+			if no := topo.FindNo(tc.noB.X, tc.noB.Y, 1e-6); no != aresta.NoB {
+				t.Errorf("NoB = %d, quer o nó em %v (%d)", aresta.NoB, tc.noB, no)
+			}
+		})
+	}
+}
+
+func TestBuildTopologiaToleranciaNo(t *testing.T) {
+	for _, tc := range []struct {
+		nome  string
+		folga float64 // Unid. Mundo entre o fim da via 1 e o início da via 2
+		nos   int
+	}{
+		{"encostadas", 0, 3},
+		{"dentro da tolerância", ToleranciaNo * 0.9, 3},
+		{"fora da tolerância", ToleranciaNo * 1.1, 4},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			topo := BuildTopologia([]Elemento{viaReta(1, 0, 0, 1000, 0), viaReta(2, 10+tc.folga, 0, 1000, 0)})
+			if len(topo.Nos) != tc.nos {
+				t.Errorf("nós = %d, quer %d", len(topo.Nos), tc.nos)
+			}
+		})
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	for _, tc := range []struct {
+		nome       string
+		posicao    string
+		elementoID int
+		quer       []int
+	}{
+		{"reta ligada à curva", PosicaoNormal, 1, []int{2}},
+		{"curva entre retas", PosicaoNormal, 2, []int{1, 3}},
+		{"reta após a curva", PosicaoNormal, 3, []int{2}},
+		{"via isolada", PosicaoNormal, 4, []int{}},
+		{"chave normal", PosicaoNormal, 5, []int{6, 7}},
+		{"aproximação da chave", PosicaoNormal, 6, []int{5}},
+		{"ramo reverso não posicionado", PosicaoNormal, 8, []int{}},
+		{"chave reversa", PosicaoReversa, 5, []int{6, 8}},
+		{"ramo normal não posicionado", PosicaoReversa, 7, []int{}},
+		{"ramo reverso posicionado", PosicaoReversa, 8, []int{5}},
+		{"elemento fora do grafo", PosicaoNormal, 9, []int{}},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			topo := BuildTopologia(malhaTopologia(tc.posicao))
+			if got := topo.Neighbors(tc.elementoID); !slices.Equal(got, tc.quer) {
+				t.Errorf("Neighbors(%d) = %v, quer %v", tc.elementoID, got, tc.quer)
+			}
+		})
+	}
+}
+
+func TestConnectedComponents(t *testing.T) {
+	for _, tc := range []struct {
+		posicao string
+		quer    [][]int
+	}{
+		{PosicaoNormal, [][]int{{1, 2, 3}, {4}, {5, 6, 7}, {8}}},
+		{PosicaoReversa, [][]int{{1, 2, 3}, {4}, {5, 6, 8}, {7}}},
+	} {
+		t.Run(tc.posicao, func(t *testing.T) {
+			topo := BuildTopologia(malhaTopologia(tc.posicao))
+			if got := topo.ConnectedComponents(); !slices.EqualFunc(got, tc.quer, slices.Equal) {
+				t.Errorf("ConnectedComponents() = %v, quer %v", got, tc.quer)
+			}
+		})
+	}
+}
+
+func TestConnectedComponentsCache(t *testing.T) {
+	elementos := malhaTopologia(PosicaoNormal)
+	topo := BuildTopologia(elementos)
+	primeira := topo.ConnectedComponents()
+	if segunda := topo.ConnectedComponents(); &segunda[0] != &primeira[0] {
+		t.Errorf("segunda chamada recalculou as componentes em vez de usar o cache")
+	}
+
+	// A topologia é imutável: mudar a malha exige reconstruí-la, e a nova
+	// topologia não pode herdar o cache da anterior.
+	elementos[4].PosicaoChave = PosicaoReversa
+	elementos = append(elementos, viaReta(10, 110, 100, 1000, 0))
+	nova := BuildTopologia(elementos)
+	quer := [][]int{{1, 2, 3}, {4, 10}, {5, 6, 8}, {7}}
+	if got := nova.ConnectedComponents(); !slices.EqualFunc(got, quer, slices.Equal) {
+		t.Errorf("após reconstruir, ConnectedComponents() = %v, quer %v", got, quer)
+	}
+	if got := topo.ConnectedComponents(); !slices.EqualFunc(got, primeira, slices.Equal) {
+		t.Errorf("a topologia antiga mudou: %v, era %v", got, primeira)
+	}
+}
+
+func TestApplyConexoes(t *testing.T) {
+	elementos := malhaTopologia(PosicaoNormal)
+	elementos[8].Conexoes = []int{1} // Circuito com conexões de uma versão antiga
+	elementos[7].Conexoes = []int{5} // Ramo reverso que já esteve posicionado
+	ApplyConexoes(elementos, BuildTopologia(elementos))
+	for _, tc := range []struct {
+		id   int
+		quer []int
+	}{
+		{1, []int{2}},
+		{2, []int{1, 3}},
+		{4, nil},
+		{5, []int{6, 7}},
+		{8, nil},
+		{9, nil},
+	} {
+		if got := elementoPorID(t, elementos, tc.id).Conexoes; !slices.Equal(got, tc.quer) || (got == nil) != (tc.quer == nil) {
+			t.Errorf("Conexoes do elemento %d = %#v, quer %#v", tc.id, got, tc.quer)
+		}
+	}
+}
+
+// arestaDe devolve o índice da aresta do elemento no ramo informado (vazio para vias).
+func arestaDe(t *testing.T, topo *Topologia, elementoID int, ramo string) int {
+	t.Helper()
+	for _, a := range topo.ArestasDoElemento(elementoID) {
+		if topo.Arestas[a].Ramo == ramo {
+			return a
+		}
+	}
+	t.Fatalf("sem aresta do elemento %d no ramo %q", elementoID, ramo)
+	return -1
+}
+
+func TestSeguintes(t *testing.T) {
+	topo := BuildTopologia(malhaTopologia(PosicaoNormal))
+	ponta := topo.FindNo(0, 50, ToleranciaNo)
+	fimNormal := topo.FindNo(10, 50, ToleranciaNo)
+	for _, tc := range []struct {
+		nome       string
+		elementoID int
+		ramo       string
+		no         int
+		respeitar  bool
+		quer       [][2]any // (elemento, ramo) das arestas seguintes
+	}{
+		{"aproximação para os dois ramos", 6, "", ponta, false, [][2]any{{5, PosicaoNormal}, {5, PosicaoReversa}}},
+		{"aproximação só para o ramo posicionado", 6, "", ponta, true, [][2]any{{5, PosicaoNormal}}},
+		{"ramo normal não volta pelo reverso", 5, PosicaoNormal, ponta, false, [][2]any{{6, ""}}},
+		{"ramo reverso não volta pelo normal", 5, PosicaoReversa, ponta, false, [][2]any{{6, ""}}},
+		{"ramo normal para a via seguinte", 5, PosicaoNormal, fimNormal, true, [][2]any{{7, ""}}},
+		{"via seguinte para o ramo normal", 7, "", fimNormal, true, [][2]any{{5, PosicaoNormal}}},
+		{"fim de linha", 3, "", topo.FindNo(20, 20, ToleranciaNo), false, [][2]any{}},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			got := [][2]any{}
+			for _, a := range topo.Seguintes(arestaDe(t, topo, tc.elementoID, tc.ramo), tc.no, tc.respeitar) {
+				got = append(got, [2]any{topo.Arestas[a].ElementoID, topo.Arestas[a].Ramo})
+			}
+			if !slices.Equal(got, tc.quer) {
+				t.Errorf("Seguintes = %v, quer %v", got, tc.quer)
+			}
+		})
+	}
+}
+
+func TestMenorCaminho(t *testing.T) {
+	for _, tc := range []struct {
+		nome        string
+		posicao     string // Posição das duas chaves do travessão
+		de          int    // Via de partida, percorrida de NoA para NoB (negativo: de NoB para NoA)
+		ate         int    // Via de chegada, percorrida inteira
+		respeitar   bool
+		elementos   []int // nil se não há caminho
+		comprimento float64
+	}{
+		{"pelo travessão ignorando a posição", PosicaoNormal, 1, 4, false, []int{1, 5, 6, 4}, 5000 + 2000 + 5120.6},
+		{"travessão fechado respeitando a posição", PosicaoNormal, 1, 4, true, nil, 0},
+		{"travessão aberto respeitando a posição", PosicaoReversa, 1, 4, true, []int{1, 5, 6, 4}, 5000 + 2000 + 5120.6},
+		{"linha reta", PosicaoNormal, 1, 2, true, []int{1, 5, 2}, 5000 + 1000 + 6000},
+		{"linha reta com a chave reversa", PosicaoReversa, 1, 2, true, nil, 0},
+		{"sentido decrescente", PosicaoReversa, -4, 1, false, []int{4, 6, 5, 1}, 5120.6 + 2000 + 5000},
+		// Da linha de baixo à via 3 só invertendo o sentido em W2 (de ramo a ramo).
+		{"sem passar de um ramo ao outro", PosicaoNormal, 1, 3, false, nil, 0},
+		{"contra o sentido de partida", PosicaoNormal, 2, 1, false, nil, 0},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			elementos := malhaTravessao()
+			for i := range elementos {
+				if elementos[i].Tipo == ElementoChaveSimples {
+					elementos[i].PosicaoChave = tc.posicao
+				}
+			}
+			topo := BuildTopologia(elementos)
+			a := arestaDe(t, topo, max(tc.de, -tc.de), "")
+			partida := PassoCaminho{a, topo.Arestas[a].NoA}
+			if tc.de < 0 {
+				partida.Entrada = topo.Arestas[a].NoB
+			}
+			chegada := func(p PassoCaminho) (float64, bool) {
+				return topo.Arestas[p.Aresta].Comprimento, topo.Arestas[p.Aresta].ElementoID == tc.ate
+			}
+			passos, comprimento, ok := topo.MenorCaminho([]Partida{{partida, topo.Arestas[a].Comprimento}}, chegada, tc.respeitar)
+			if ok != (tc.elementos != nil) {
+				t.Fatalf("MenorCaminho achou = %v (passos %v), quer %v", ok, passos, tc.elementos != nil)
+			}
+			got := []int{}
+			for _, p := range passos {
+				if id := topo.Arestas[p.Aresta].ElementoID; len(got) == 0 || got[len(got)-1] != id {
+					got = append(got, id)
+				}
+			}
+			if ok && (!slices.Equal(got, tc.elementos) || !perto(comprimento, tc.comprimento)) {
+				t.Errorf("MenorCaminho = %v %.1f m, quer %v %.1f m", got, comprimento, tc.elementos, tc.comprimento)
+			}
+		})
+	}
+}
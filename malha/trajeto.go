@@ -0,0 +1,156 @@
+package malha
+
+import (
+	"fmt"
+	"math"
+)
+
+// --- Trajeto entre Pontos ---
+// Mede a distância pela via entre dois pontos da malha: o menor caminho
+// (MenorCaminho) de um ponto de via ou ramo de chave a outro, em qualquer
+// sentido, sem passar de um ramo ao outro da mesma chave. Com
+// respeitarPosicao, só os ramos posicionados podem ser percorridos, inclusive
+// os dos próprios pontos. O comprimento soma o Comprimento das arestas
+// percorridas inteiras e a parte percorrida das arestas dos pontos.
+
+// PontoMalha é um ponto sobre uma aresta da topologia, a Distancia metros de NoA.
+type PontoMalha struct {
+	Aresta    int
+	Distancia float64
+	X, Y      float64 // Posição (Unid. Mundo)
+}
+
+// Trajeto é o menor caminho entre dois pontos da malha.
+type Trajeto struct {
+	De, Ate     PontoMalha
+	Elementos   []int   // IDs das vias e chaves percorridas, na ordem
+	Comprimento float64 // Metros
+	Pontos      []Ponto // Polilinha de De até Ate (Unid. Mundo)
+}
+
+// projetarNaAresta devolve a aresta do elemento (via ou ramo de chave) mais
+// próxima de (x, y), a distância até ela (Unid. Mundo) e a fração do ponto
+// projetado, de NoA a NoB; a é -1 se o elemento não gera arestas.
+func projetarNaAresta(t *Topologia, el Elemento, x, y float64) (a int, distancia, fracao float64) {
+	a, distancia = -1, math.Inf(1)
+	for _, cand := range t.ArestasDoElemento(el.ID) {
+		var px, py, f float64
+		if el.Tipo.EhVia() {
+			px, py, f = ProjetarNaVia(el, x, y)
+		} else {
+			noA, noB := t.Nos[t.Arestas[cand].NoA], t.Nos[t.Arestas[cand].NoB]
+			px, py, f = ClosestPointOnSegment(x, y, noA.X, noA.Y, noB.X, noB.Y)
+		}
+		if d := math.Hypot(px-x, py-y); d < distancia {
+			a, distancia, fracao = cand, d, f
+		}
+	}
+	return a, distancia, fracao
+}
+
+// pontoDaAresta devolve o ponto a d metros de NoA ao longo da aresta a, que
+// pertence a el.
+func pontoDaAresta(t *Topologia, el Elemento, a int, d float64) Ponto {
+	aresta := t.Arestas[a]
+	fracao := 0.0
+	if aresta.Comprimento > 0 {
+		fracao = math.Max(0, math.Min(1, d/aresta.Comprimento))
+	}
+	if el.Tipo.EhVia() {
+		p, _ := el.PontoNaVia(fracao)
+		return p
+	}
+	noA, noB := t.Nos[aresta.NoA], t.Nos[aresta.NoB]
+	return Ponto{noA.X + (noB.X-noA.X)*fracao, noA.Y + (noB.Y-noA.Y)*fracao}
+}
+
+// LocalizarNaMalha devolve o ponto de via ou chave mais próximo de (x, y),
+// dentro de raio (Unid. Mundo).
+func LocalizarNaMalha(elementos []Elemento, t *Topologia, x, y, raio float64) (PontoMalha, bool) {
+	melhor, achou := PontoMalha{}, false
+	for _, el := range elementos {
+		if !el.Tipo.EhVia() && el.Tipo != ElementoChaveSimples {
+			continue
+		}
+		a, d, fracao := projetarNaAresta(t, el, x, y)
+		if a == -1 || d > raio {
+			continue
+		}
+		raio, achou = d, true
+		distancia := fracao * t.Arestas[a].Comprimento
+		p := pontoDaAresta(t, el, a, distancia)
+		melhor = PontoMalha{Aresta: a, Distancia: distancia, X: p.X, Y: p.Y}
+	}
+	return melhor, achou
+}
+
+// MedirTrajeto acha o menor caminho pela via de de até ate.
+func MedirTrajeto(elementos []Elemento, t *Topologia, de, ate PontoMalha, respeitarPosicao bool) (Trajeto, error) {
+	if respeitarPosicao && (!t.Arestas[de.Aresta].Ativa || !t.Arestas[ate.Aresta].Ativa) {
+		return Trajeto{}, fmt.Errorf("ponto num ramo de chave não posicionado")
+	}
+	tr := Trajeto{De: de, Ate: ate}
+	var passos []PassoCaminho
+	if de.Aresta == ate.Aresta {
+		entrada := t.Arestas[de.Aresta].NoA
+		if ate.Distancia < de.Distancia {
+			entrada = t.Arestas[de.Aresta].NoB
+		}
+		passos = []PassoCaminho{{Aresta: de.Aresta, Entrada: entrada}}
+		tr.Comprimento = math.Abs(ate.Distancia - de.Distancia)
+	} else {
+		origem := t.Arestas[de.Aresta]
+		partidas := []Partida{
+			{PassoCaminho{de.Aresta, origem.NoA}, origem.Comprimento - de.Distancia},
+			{PassoCaminho{de.Aresta, origem.NoB}, de.Distancia},
+		}
+		chegada := func(p PassoCaminho) (float64, bool) {
+			if p.Aresta != ate.Aresta {
+				return 0, false
+			}
+			if p.Entrada == t.Arestas[p.Aresta].NoA {
+				return ate.Distancia, true
+			}
+			return t.Arestas[p.Aresta].Comprimento - ate.Distancia, true
+		}
+		var ok bool
+		if passos, tr.Comprimento, ok = t.MenorCaminho(partidas, chegada, respeitarPosicao); !ok {
+			return Trajeto{}, fmt.Errorf("não há caminho pela via entre os pontos")
+		}
+	}
+
+	porID := map[int]Elemento{}
+	for _, el := range elementos {
+		porID[el.ID] = el
+	}
+	for k, p := range passos {
+		a := t.Arestas[p.Aresta]
+		if len(tr.Elementos) == 0 || tr.Elementos[len(tr.Elementos)-1] != a.ElementoID {
+			tr.Elementos = append(tr.Elementos, a.ElementoID)
+		}
+		ini, fim := 0.0, a.Comprimento // Metros desde NoA, no sentido do percurso
+		if p.Entrada == a.NoB {
+			ini, fim = fim, ini
+		}
+		if k == 0 {
+			ini = de.Distancia
+		}
+		if k == len(passos)-1 {
+			fim = ate.Distancia
+		}
+		el := porID[a.ElementoID]
+		n := 1
+		if el.ehArco() && a.Comprimento > 0 {
+			n = max(1, int(math.Ceil(math.Abs(el.Varredura)*math.Abs(fim-ini)/a.Comprimento/curvaPassoGraus)))
+		} else if el.ehTransicao() && a.Comprimento > 0 {
+			n = max(1, int(math.Ceil(el.giroTransicao()*math.Abs(fim-ini)/a.Comprimento/curvaPassoGraus)))
+		}
+		for i := 0; i <= n; i++ {
+			if i == 0 && k > 0 {
+				continue // Já incluído como último ponto do passo anterior
+			}
+			tr.Pontos = append(tr.Pontos, pontoDaAresta(t, el, p.Aresta, ini+(fim-ini)*float64(i)/float64(n)))
+		}
+	}
+	return tr, nil
+}
@@ -0,0 +1,91 @@
+package malha
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMedirTrajeto(t *testing.T) {
+	for _, tc := range []struct {
+		nome        string
+		posicao     string
+		de, ate     Ponto
+		respeitar   bool
+		elementos   []int
+		comprimento float64
+		erro        string
+	}{
+		{nome: "mesma via", posicao: PosicaoNormal, de: Ponto{10, 0}, ate: Ponto{40, 0}, elementos: []int{1}, comprimento: 3000},
+		{nome: "mesma via para trás", posicao: PosicaoNormal, de: Ponto{40, 0}, ate: Ponto{10, 0}, elementos: []int{1}, comprimento: 3000},
+		{nome: "pelo travessão", posicao: PosicaoNormal, de: Ponto{10, 0}, ate: Ponto{100, 6.84}, elementos: []int{1, 5, 6, 4}, comprimento: 4000 + 2000 + 3120.6},
+		{nome: "de volta pelo travessão", posicao: PosicaoNormal, de: Ponto{100, 6.84}, ate: Ponto{10, 0}, elementos: []int{4, 6, 5, 1}, comprimento: 4000 + 2000 + 3120.6},
+		{nome: "travessão fechado", posicao: PosicaoNormal, de: Ponto{10, 0}, ate: Ponto{100, 6.84}, respeitar: true, erro: "não há caminho"},
+		{nome: "travessão aberto", posicao: PosicaoReversa, de: Ponto{10, 0}, ate: Ponto{100, 6.84}, respeitar: true, elementos: []int{1, 5, 6, 4}, comprimento: 4000 + 2000 + 3120.6},
+		{nome: "ponto no ramo não posicionado", posicao: PosicaoNormal, de: Ponto{10, 0}, ate: Ponto{59.397, 3.42}, respeitar: true, erro: "não posicionado"},
+		{nome: "exigiria inverter o sentido", posicao: PosicaoNormal, de: Ponto{10, 0}, ate: Ponto{10, 6.84}, erro: "não há caminho"},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			elementos := malhaTravessao()
+			for i := range elementos {
+				if elementos[i].Tipo == ElementoChaveSimples {
+					elementos[i].PosicaoChave = tc.posicao
+				}
+			}
+			topo := BuildTopologia(elementos)
+			de, ok1 := LocalizarNaMalha(elementos, topo, tc.de.X, tc.de.Y, ToleranciaNo)
+			ate, ok2 := LocalizarNaMalha(elementos, topo, tc.ate.X, tc.ate.Y, ToleranciaNo)
+			if !ok1 || !ok2 {
+				t.Fatalf("pontos fora da malha: %v %v", ok1, ok2)
+			}
+			tr, err := MedirTrajeto(elementos, topo, de, ate, tc.respeitar)
+			if tc.erro != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.erro) {
+					t.Fatalf("MedirTrajeto = %v, quer erro com %q", err, tc.erro)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MedirTrajeto: %v", err)
+			}
+			if !slices.Equal(tr.Elementos, tc.elementos) || math.Abs(tr.Comprimento-tc.comprimento) > 1e-6 {
+				t.Errorf("trajeto = %v %.1f m, quer %v %.1f m", tr.Elementos, tr.Comprimento, tc.elementos, tc.comprimento)
+			}
+			ini, fim := tr.Pontos[0], tr.Pontos[len(tr.Pontos)-1]
+			if math.Hypot(ini.X-tc.de.X, ini.Y-tc.de.Y) > 1e-6 || math.Hypot(fim.X-tc.ate.X, fim.Y-tc.ate.Y) > 1e-6 {
+				t.Errorf("polilinha de %v a %v, quer de %v a %v", ini, fim, tc.de, tc.ate)
+			}
+		})
+	}
+}
+
+func TestMedirTrajetoTransicao(t *testing.T) {
+	elementos := []Elemento{viaReta(1, 0, 0, 1000, 0), viaTransicao(2, 10, 0, 0, 1000, 0, 200, 1)}
+	topo := BuildTopologia(elementos)
+	fim, _ := elementos[1].PontoNaVia(0.8)
+	de, ok1 := LocalizarNaMalha(elementos, topo, 5, 0, ToleranciaNo)
+	ate, ok2 := LocalizarNaMalha(elementos, topo, fim.X, fim.Y, ToleranciaNo)
+	if !ok1 || !ok2 {
+		t.Fatalf("pontos fora da malha: %v %v", ok1, ok2)
+	}
+	tr, err := MedirTrajeto(elementos, topo, de, ate, false)
+	if err != nil {
+		t.Fatalf("MedirTrajeto: %v", err)
+	}
+	if !slices.Equal(tr.Elementos, []int{1, 2}) || math.Abs(tr.Comprimento-1300) > 1e-3 {
+		t.Errorf("trajeto = %v %.3f m, quer [1 2] 1300 m", tr.Elementos, tr.Comprimento)
+	}
+	// A polilinha acompanha a clotoide em vez de cortar pela corda.
+	for _, p := range tr.Pontos {
+		if p.X <= 10 {
+			continue
+		}
+		if px, py, _ := ProjetarNaVia(elementos[1], p.X, p.Y); math.Hypot(px-p.X, py-p.Y) > 1e-6 {
+			t.Errorf("ponto %v da polilinha fora da transição", p)
+		}
+	}
+	if len(tr.Pontos) < 5 {
+		t.Errorf("polilinha com %d pontos, quer a transição amostrada", len(tr.Pontos))
+	}
+}
@@ -0,0 +1,227 @@
+package malha
+
+import "math"
+
+// --- Curvas de Transição ---
+// Uma ViaTransicao é uma clotoide (espiral de Euler): a curvatura varia
+// linearmente ao longo de Comprimento metros, de 1/RaioInicial no início a
+// 1/Raio no fim (raio zero = curvatura nula, como numa reta). Parte de (X, Y)
+// com rumo Rotacao; o sinal de Varredura dá o lado (positivo = à direita) e o
+// seu valor, derivado, é a mudança total de rumo. Ligada a uma reta e a uma
+// curva de mesmo raio, dá continuidade de rumo e de curvatura entre elas.
+
+const transicaoPainelSimpson = 64 // Painéis da integração de Simpson até um ponto
+
+// VarreduraTransicao devolve a mudança de rumo (graus, sem sinal) de uma
+// transição de comprimento (metros) entre os raios dados (metros, 0 = reta).
+func VarreduraTransicao(comprimento, raioInicial, raioFinal float64) float64 {
+	return comprimento * (curvaturaDoRaio(raioInicial) + curvaturaDoRaio(raioFinal)) / 2 * 180 / math.Pi
+}
+
+// curvaturaDoRaio devolve 1/raio, ou 0 para raio zero (reta).
+func curvaturaDoRaio(raio float64) float64 {
+	if raio > 0 {
+		return 1 / raio
+	}
+	return 0
+}
+
+// raioDaCurvatura devolve 1/|curvatura|, ou 0 para curvatura nula (reta).
+func raioDaCurvatura(k float64) float64 {
+	if k == 0 {
+		return 0
+	}
+	return 1 / math.Abs(k)
+}
+
+// ehTransicao indica se o elemento deve ser tratado como clotoide (transição
+// com alguma curvatura e varredura perceptível).
+func (el Elemento) ehTransicao() bool {
+	return el.Tipo == ElementoViaTransicao && el.Comprimento > 0 && (el.RaioInicial > 0 || el.Raio > 0) && math.Abs(el.Varredura) >= CurvaVarreduraMinima
+}
+
+// curvaturasTransicao devolve as curvaturas com sinal (1/Unid. Mundo) no
+// início e no fim da transição.
+func (el Elemento) curvaturasTransicao() (k0, k1 float64) {
+	lado := 1.0
+	if el.Varredura < 0 {
+		lado = -1.0
+	}
+	return lado * curvaturaDoRaio(el.RaioInicial) / PixelsPerMeter, lado * curvaturaDoRaio(el.Raio) / PixelsPerMeter
+}
+
+// pontoClotoide integra a clotoide que parte de (x, y) com rumo (radianos) e
+// curvaturas k0 -> k1 ao longo de comprimento (Unid. Mundo), até a distância
+// s. Devolve o ponto e o rumo (radianos) ali.
+func pontoClotoide(x, y, rumo, k0, k1, comprimento, s float64) (Ponto, float64) {
+	theta := func(u float64) float64 { return rumo + k0*u + (k1-k0)*u*u/(2*comprimento) }
+	h := s / transicaoPainelSimpson
+	sx, sy := 0.0, 0.0
+	for k := 0; k <= transicaoPainelSimpson; k++ {
+		peso := 2.0
+		switch {
+		case k == 0 || k == transicaoPainelSimpson:
+			peso = 1
+		case k%2 == 1:
+			peso = 4
+		}
+		a := theta(float64(k) * h)
+		sx += peso * math.Cos(a)
+		sy += peso * math.Sin(a)
+	}
+	return Ponto{x + sx*h/3, y + sy*h/3}, theta(s)
+}
+
+// pontoTransicao devolve o ponto e o rumo (graus) na fração t ∈ [0, 1].
+func (el Elemento) pontoTransicao(t float64) (Ponto, float64) {
+	k0, k1 := el.curvaturasTransicao()
+	comprimento := el.Comprimento * PixelsPerMeter
+	p, rumo := pontoClotoide(el.X, el.Y, el.Rotacao*math.Pi/180, k0, k1, comprimento, comprimento*t)
+	return p, rumo * 180 / math.Pi
+}
+
+// giroTransicao devolve o giro (graus) que a transição teria com a curvatura
+// do seu fim mais fechado em todo o comprimento: a varredura equivalente para
+// amostrar a clotoide com passos de rumo uniformes.
+func (el Elemento) giroTransicao() float64 {
+	k0, k1 := el.curvaturasTransicao()
+	return math.Max(math.Abs(k0), math.Abs(k1)) * el.Comprimento * PixelsPerMeter * 180 / math.Pi
+}
+
+// passosTransicao devolve quantos trechos retos aproximam a transição com no
+// máximo curvaPassoGraus de rumo cada (no fim mais fechado).
+func (el Elemento) passosTransicao() int {
+	return max(1, int(math.Ceil(el.giroTransicao()/curvaPassoGraus)))
+}
+
+// projetarNaTransicao devolve o ponto da transição mais próximo de (x, y) e
+// sua fração: o trecho mais próximo da polilinha e, nele, uma busca ternária
+// sobre a curva.
+func projetarNaTransicao(el Elemento, x, y float64) (px, py, t float64) {
+	pontos := el.PolilinhaVia()
+	n := len(pontos) - 1
+	melhor, melhorDist := 0, math.Inf(1)
+	for k := 1; k <= n; k++ {
+		if d := PointSegmentDistance(x, y, pontos[k-1].X, pontos[k-1].Y, pontos[k].X, pontos[k].Y); d < melhorDist {
+			melhor, melhorDist = k-1, d
+		}
+	}
+	dist := func(t float64) float64 {
+		p, _ := el.pontoTransicao(t)
+		return math.Hypot(x-p.X, y-p.Y)
+	}
+	a, b := math.Max(0, float64(melhor-1)/float64(n)), math.Min(1, float64(melhor+2)/float64(n))
+	for range 40 {
+		m1, m2 := a+(b-a)/3, b-(b-a)/3
+		if dist(m1) < dist(m2) {
+			b = m2
+		} else {
+			a = m1
+		}
+	}
+	t = (a + b) / 2
+	p, _ := el.pontoTransicao(t)
+	return p.X, p.Y, t
+}
+
+// splitTransicao divide a transição no ponto mais próximo de (x, y): a
+// curvatura ali passa a ser o fim da primeira parte e o início da segunda.
+func splitTransicao(el Elemento, x, y float64, novoID int) (primeira, segunda Elemento) {
+	_, _, t := projetarNaTransicao(el, x, y)
+	inicio, rumo := el.pontoTransicao(t)
+	k0, k1 := el.curvaturasTransicao()
+	raioMeio := raioDaCurvatura((k0 + (k1-k0)*t) * PixelsPerMeter)
+	lado := math.Copysign(1, el.Varredura)
+	primeira = el
+	primeira.Comprimento = el.Comprimento * t
+	primeira.Raio = raioMeio
+	primeira.Varredura = lado * VarreduraTransicao(primeira.Comprimento, primeira.RaioInicial, primeira.Raio)
+	segunda = el
+	segunda.ID = novoID
+	segunda.X, segunda.Y, segunda.Rotacao = inicio.X, inicio.Y, rumo
+	segunda.Comprimento = el.Comprimento - primeira.Comprimento
+	segunda.RaioInicial = raioMeio
+	segunda.Varredura = lado * VarreduraTransicao(segunda.Comprimento, segunda.RaioInicial, segunda.Raio)
+	segunda.Conexoes = nil
+	return primeira, segunda
+}
+
+// CurvaturaSaindo devolve a curvatura com sinal (1/metro, positivo = à
+// direita) de quem continua a via a partir da extremidade (x, y),
+// afastando-se dela: o par de RumoSaindo para emendar uma transição.
+func (el Elemento) CurvaturaSaindo(x, y float64) float64 {
+	var k0, k1 float64
+	switch {
+	case el.ehArco():
+		k0 = math.Copysign(1/el.Raio, el.Varredura)
+		k1 = k0
+	case el.ehTransicao():
+		k0, k1 = el.curvaturasTransicao()
+		k0, k1 = k0*PixelsPerMeter, k1*PixelsPerMeter
+	default:
+		return 0
+	}
+	if ini, _ := el.PontoNaVia(0); math.Hypot(x-ini.X, y-ini.Y) <= ToleranciaNo {
+		return -k0 // No sentido contrário o lado da curva se inverte
+	}
+	return k1
+}
+
+// TransicaoTangente calcula a transição que parte de (x1, y1) com o rumo
+// (graus) e a curvatura (1/metro, com sinal) dados e termina em (x2, y2).
+// Devolve comprimento e raios (metros) e a varredura (graus); ok é false se
+// não houver clotoide de um só lado que chegue ao ponto (ex.: ponto alinhado
+// ao rumo numa partida de reta, ou atrás do início).
+func TransicaoTangente(x1, y1, rumo, curvatura, x2, y2 float64) (comprimento, raioInicial, raio, varredura float64, ok bool) {
+	corda := math.Hypot(x2-x1, y2-y1)
+	if corda == 0 || math.IsNaN(corda) {
+		return 0, 0, 0, 0, false
+	}
+	theta0 := rumo * math.Pi / 180
+	k0 := curvatura / PixelsPerMeter
+	alfa := math.Mod(math.Atan2(y2-y1, x2-x1)-theta0+3*math.Pi, 2*math.Pi) - math.Pi
+	if math.Abs(alfa) >= math.Pi/2 {
+		return 0, 0, 0, 0, false
+	}
+	erro := func(l, k1 float64) (float64, float64) {
+		p, _ := pontoClotoide(x1, y1, theta0, k0, k1, l, l)
+		return p.X - x2, p.Y - y2
+	}
+	// Partida de pequenos ângulos: desvio lateral ≈ L²(2k0 + k1)/6
+	l, k1 := corda, 6*alfa/corda-2*k0
+	for range 50 {
+		ex, ey := erro(l, k1)
+		if math.Hypot(ex, ey) < 1e-9*corda {
+			break
+		}
+		dl, dk := 1e-7*l, 1e-7*math.Max(math.Abs(k1), 1/corda)
+		exL, eyL := erro(l+dl, k1)
+		exK, eyK := erro(l, k1+dk)
+		a, b, c, d := (exL-ex)/dl, (exK-ex)/dk, (eyL-ey)/dl, (eyK-ey)/dk
+		det := a*d - b*c
+		if det == 0 || math.IsNaN(det) {
+			return 0, 0, 0, 0, false
+		}
+		passoL, passoK := (d*ex-b*ey)/det, (a*ey-c*ex)/det
+		for l-passoL <= 0 { // Mantém o comprimento positivo
+			passoL, passoK = passoL/2, passoK/2
+		}
+		l, k1 = l-passoL, k1-passoK
+	}
+	if math.Abs(k1)*l < 1e-9 { // Resíduo da iteração num fim em reta
+		k1 = 0
+	}
+	if ex, ey := erro(l, k1); math.Hypot(ex, ey) > 1e-6*corda || k0*k1 < 0 {
+		return 0, 0, 0, 0, false
+	}
+	comprimento = l / PixelsPerMeter
+	raioInicial, raio = raioDaCurvatura(k0*PixelsPerMeter), raioDaCurvatura(k1*PixelsPerMeter)
+	varredura = VarreduraTransicao(comprimento, raioInicial, raio)
+	if k0+k1 < 0 {
+		varredura = -varredura
+	}
+	if math.Abs(varredura) < CurvaVarreduraMinima || math.Abs(varredura) > CurvaVarreduraMaxima {
+		return 0, 0, 0, 0, false
+	}
+	return comprimento, raioInicial, raio, varredura, true
+}
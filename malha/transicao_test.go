@@ -0,0 +1,152 @@
+package malha
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestPontoNaTransicao(t *testing.T) {
+	// Reta -> raio 200 m em 100 m: rumo final 0.25 rad e ponto final pelas
+	// integrais de Fresnel ∫cos(s²/4) e ∫sin(s²/4) de 0 a 1 (Unid. Mundo).
+	via := viaTransicao(1, 0, 0, 0, 100, 0, 200, 1)
+	if !perto(via.Varredura, 0.25*180/math.Pi) {
+		t.Errorf("Varredura = %.6f, quer %.6f", via.Varredura, 0.25*180/math.Pi)
+	}
+	fim, rumo := via.PontoNaVia(1)
+	if !pertoPonto(fim, Ponto{0.9937680584295855, 0.08296204853709475}) || !perto(rumo, via.Varredura) {
+		t.Errorf("fim = %v rumo %.6f, quer (0.993768, 0.082962) rumo %.6f", fim, rumo, via.Varredura)
+	}
+
+	// À esquerda o traçado é o espelho em torno do rumo inicial.
+	esquerda := viaTransicao(1, 0, 0, 0, 100, 0, 200, -1)
+	if fimE, rumoE := esquerda.PontoNaVia(1); !pertoPonto(fimE, Ponto{fim.X, -fim.Y}) || !perto(rumoE, -rumo) {
+		t.Errorf("fim à esquerda = %v rumo %.6f, quer espelho de %v rumo %.6f", fimE, rumoE, fim, rumo)
+	}
+
+	// A polilinha vai de ponta a ponta e as extremidades seguem a curva.
+	pontos := via.PolilinhaVia()
+	if len(pontos) < 3 || !pertoPonto(pontos[0], Ponto{0, 0}) || !pertoPonto(pontos[len(pontos)-1], fim) {
+		t.Errorf("PolilinhaVia = %v", pontos)
+	}
+	if _, _, x2, y2 := via.Extremidades(); !pertoPonto(Ponto{x2, y2}, fim) {
+		t.Errorf("Extremidades termina em (%.6f,%.6f), quer %v", x2, y2, fim)
+	}
+}
+
+func TestTransicaoTangente(t *testing.T) {
+	for _, tc := range []struct {
+		nome string
+		via  Elemento
+	}{
+		{"reta para curva", viaTransicao(1, 3, 4, 30, 100, 0, 200, 1)},
+		{"curva para reta", viaTransicao(1, 0, 0, -90, 150, 300, 0, -1)},
+		{"curva para curva", viaTransicao(1, 0, 0, 0, 120, 500, 250, 1)},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			fim, _ := tc.via.PontoNaVia(1)
+			curvatura := tc.via.CurvaturaSaindo(fim.X, fim.Y) // Só para conferir o sinal na saída
+			k0 := 0.0
+			if tc.via.RaioInicial > 0 {
+				k0 = math.Copysign(1/tc.via.RaioInicial, tc.via.Varredura)
+			}
+			comprimento, raioInicial, raio, varredura, ok := TransicaoTangente(tc.via.X, tc.via.Y, tc.via.Rotacao, k0, fim.X, fim.Y)
+			if !ok {
+				t.Fatal("TransicaoTangente não achou a transição")
+			}
+			if math.Abs(comprimento-tc.via.Comprimento) > 1e-4 || math.Abs(raioInicial-tc.via.RaioInicial) > 1e-4 ||
+				math.Abs(raio-tc.via.Raio) > 1e-3 || math.Abs(varredura-tc.via.Varredura) > 1e-4 {
+				t.Errorf("TransicaoTangente = %.4f m, raios %.4f/%.4f, varredura %.4f; quer %.4f m, raios %.4f/%.4f, varredura %.4f",
+					comprimento, raioInicial, raio, varredura, tc.via.Comprimento, tc.via.RaioInicial, tc.via.Raio, tc.via.Varredura)
+			}
+			if quer := math.Copysign(curvaturaDoRaio(tc.via.Raio), tc.via.Varredura); !perto(curvatura, quer) {
+				t.Errorf("CurvaturaSaindo no fim = %.6f, quer %.6f", curvatura, quer)
+			}
+		})
+	}
+
+	for _, tc := range []struct {
+		nome              string
+		curvatura, x2, y2 float64
+	}{
+		{"alinhado ao rumo", 0, 10, 0},
+		{"atrás do início", 0, -10, 1},
+		{"contra a curvatura", 1.0 / 200, 10, -2},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			if _, _, _, _, ok := TransicaoTangente(0, 0, 0, tc.curvatura, tc.x2, tc.y2); ok {
+				t.Error("TransicaoTangente aceitou um ponto sem clotoide de um só lado")
+			}
+		})
+	}
+}
+
+func TestCurvaturaSaindo(t *testing.T) {
+	for _, tc := range []struct {
+		nome           string
+		via            Elemento
+		inicial, final float64
+	}{
+		{"reta", viaReta(1, 0, 0, 1000, 0), 0, 0},
+		{"curva à direita", viaCurva(1, 0, 0, 0, 1000, 90), -1.0 / 1000, 1.0 / 1000},
+		{"curva à esquerda", viaCurva(1, 0, 0, 0, 1000, -90), 1.0 / 1000, -1.0 / 1000},
+		{"transição à esquerda", viaTransicao(1, 0, 0, 0, 100, 400, 200, -1), 1.0 / 400, -1.0 / 200},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			x1, y1, x2, y2 := tc.via.Extremidades()
+			if got := tc.via.CurvaturaSaindo(x1, y1); !perto(got, tc.inicial) {
+				t.Errorf("CurvaturaSaindo no início = %.6f, quer %.6f", got, tc.inicial)
+			}
+			if got := tc.via.CurvaturaSaindo(x2, y2); !perto(got, tc.final) {
+				t.Errorf("CurvaturaSaindo no fim = %.6f, quer %.6f", got, tc.final)
+			}
+		})
+	}
+}
+
+func TestSplitTransicao(t *testing.T) {
+	via := viaTransicao(1, 0, 0, 0, 200, 0, 100, 1)
+	alvo, rumoAlvo := via.PontoNaVia(0.5)
+	normal := (rumoAlvo + 90) * math.Pi / 180
+	primeira, segunda := SplitVia(via, alvo.X+0.01*math.Cos(normal), alvo.Y+0.01*math.Sin(normal), 2) // Fora da via: divide na projeção
+
+	if !perto(primeira.Comprimento, 100) || !perto(segunda.Comprimento, 100) {
+		t.Errorf("comprimentos = %.4f/%.4f, quer 100/100", primeira.Comprimento, segunda.Comprimento)
+	}
+	if !perto(primeira.Raio, 200) || !perto(segunda.RaioInicial, 200) || segunda.Raio != 100 || primeira.RaioInicial != 0 {
+		t.Errorf("raios = %.4f->%.4f e %.4f->%.4f, quer 0->200 e 200->100", primeira.RaioInicial, primeira.Raio, segunda.RaioInicial, segunda.Raio)
+	}
+	if !perto(primeira.Varredura+segunda.Varredura, via.Varredura) {
+		t.Errorf("varreduras %.4f + %.4f, quer %.4f", primeira.Varredura, segunda.Varredura, via.Varredura)
+	}
+	if !pertoPonto(Ponto{segunda.X, segunda.Y}, alvo) || !perto(segunda.Rotacao, rumoAlvo) || segunda.ID != 2 {
+		t.Errorf("segunda parte começa em (%.6f,%.6f) rumo %.4f, quer %v rumo %.4f", segunda.X, segunda.Y, segunda.Rotacao, alvo, rumoAlvo)
+	}
+
+	// As partes reproduzem a via: mesmo fim, mesmo rumo e curvatura contínua na emenda.
+	fim, rumoFim := via.PontoNaVia(1)
+	if fimB, rumoB := segunda.PontoNaVia(1); !pertoPonto(fimB, fim) || !perto(rumoB, rumoFim) {
+		t.Errorf("segunda parte termina em %v rumo %.4f, quer %v rumo %.4f", fimB, rumoB, fim, rumoFim)
+	}
+	if a, b := primeira.CurvaturaSaindo(alvo.X, alvo.Y), segunda.CurvaturaSaindo(alvo.X, alvo.Y); !perto(a, -b) {
+		t.Errorf("curvatura na emenda %.6f / %.6f, quer opostas", a, b)
+	}
+	if got := BuildTopologia([]Elemento{primeira, segunda}).Neighbors(1); !slices.Equal(got, []int{2}) {
+		t.Errorf("Neighbors(1) após dividir = %v, quer [2]", got)
+	}
+}
+
+func TestProjetarNaTransicao(t *testing.T) {
+	via := viaTransicao(1, 0, 0, 0, 300, 0, 150, 1)
+	for _, frac := range []float64{0, 0.1, 0.37, 0.8, 1} {
+		p, rumo := via.PontoNaVia(frac)
+		normal := (rumo + 90) * math.Pi / 180
+		px, py, tp := ProjetarNaVia(via, p.X+0.05*math.Cos(normal), p.Y+0.05*math.Sin(normal))
+		if math.Abs(tp-frac) > 1e-6 || !pertoPonto(Ponto{px, py}, p) {
+			t.Errorf("ProjetarNaVia ao lado de t=%.2f = (%.6f,%.6f) t=%.6f, quer %v", frac, px, py, tp, p)
+		}
+		if d := DistanceToEdge(via, p.X, p.Y); !perto(d, -via.Espessura/2) {
+			t.Errorf("DistanceToEdge sobre a via em t=%.2f = %.6f, quer %.2f", frac, d, -via.Espessura/2)
+		}
+	}
+}
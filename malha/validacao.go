@@ -0,0 +1,247 @@
+package malha
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// --- Validação da Malha ---
+// Cada Regra inspeciona os elementos (e a topologia derivada deles) e devolve
+// os problemas encontrados. Validar executa o catálogo Regras inteiro e
+// ordena o resultado por severidade (erros primeiro).
+
+// Severidade de um problema de validação.
+type Severidade int
+
+const (
+	SeveridadeAviso Severidade = iota
+	SeveridadeErro
+)
+
+func (s Severidade) String() string {
+	if s == SeveridadeErro {
+		return "ERRO"
+	}
+	return "AVISO"
+}
+
+// Problema é um achado da validação; IDs são os elementos envolvidos.
+type Problema struct {
+	Regra      string
+	Severidade Severidade
+	Mensagem   string
+	IDs        []int
+	Pontos     []Ponto // Locais a marcar (Unid. Mundo); vazio: a posição dos elementos
+}
+
+// Regra é uma verificação do catálogo.
+type Regra struct {
+	Nome       string
+	Descricao  string
+	Severidade Severidade
+	Verificar  func(elementos []Elemento, t *Topologia) []Problema
+}
+
+// Regras é o catálogo executado por Validar.
+var Regras = []Regra{
+	{Nome: "id-duplicado", Descricao: "Dois ou mais elementos com o mesmo ID", Severidade: SeveridadeErro, Verificar: verificarIDsDuplicados},
+	{Nome: "geometria-invalida", Descricao: "Coordenadas ou medidas NaN/infinitas, ou via de comprimento zero", Severidade: SeveridadeErro, Verificar: verificarGeometria},
+	{Nome: "referencia-invalida", Descricao: "Sinal preso a uma via inexistente", Severidade: SeveridadeErro, Verificar: verificarReferencias},
+	{Nome: "circuito-fora-da-via", Descricao: "Circuito de via fora de um nó da malha (não separa seções)", Severidade: SeveridadeErro, Verificar: verificarCircuitos},
+	{Nome: "vias-sobrepostas", Descricao: "Vias retas colineares que se sobrepõem", Severidade: SeveridadeErro, Verificar: verificarSobreposicao},
+	{Nome: "chave-incompleta", Descricao: "Chave sem ligação na ponta ou num dos ramos", Severidade: SeveridadeAviso, Verificar: verificarChaves},
+	{Nome: "ponta-solta", Descricao: "Extremidade de via sem ligação", Severidade: SeveridadeAviso, Verificar: verificarPontasSoltas},
+}
+
+// Validar executa todas as regras do catálogo.
+func Validar(elementos []Elemento) []Problema {
+	t := BuildTopologia(elementos)
+	problemas := []Problema{}
+	for _, r := range Regras {
+		for _, p := range r.Verificar(elementos, t) {
+			p.Regra, p.Severidade = r.Nome, r.Severidade
+			problemas = append(problemas, p)
+		}
+	}
+	sort.SliceStable(problemas, func(i, j int) bool { return problemas[i].Severidade > problemas[j].Severidade })
+	return problemas
+}
+
+// ContarErros devolve quantos problemas têm severidade de erro.
+func ContarErros(problemas []Problema) int {
+	n := 0
+	for _, p := range problemas {
+		if p.Severidade == SeveridadeErro {
+			n++
+		}
+	}
+	return n
+}
+
+func verificarIDsDuplicados(elementos []Elemento, _ *Topologia) []Problema {
+	contagem := map[int]int{}
+	for _, el := range elementos {
+		contagem[el.ID]++
+	}
+	ids := []int{}
+	for id, n := range contagem {
+		if n > 1 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	problemas := []Problema{}
+	for _, id := range ids {
+		problemas = append(problemas, Problema{Mensagem: fmt.Sprintf("ID %d usado por %d elementos", id, contagem[id]), IDs: []int{id}})
+	}
+	return problemas
+}
+
+func verificarGeometria(elementos []Elemento, _ *Topologia) []Problema {
+	problemas := []Problema{}
+	for _, el := range elementos {
+		for _, v := range []float64{el.X, el.Y, el.Rotacao, el.Comprimento, el.Largura, el.Espessura, el.Raio, el.RaioInicial, el.Varredura, el.AnguloDesvio, el.Distancia} {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				problemas = append(problemas, Problema{Mensagem: fmt.Sprintf("ID %d tem medida NaN/infinita", el.ID), IDs: []int{el.ID}})
+				break
+			}
+		}
+		if (el.Tipo.EhVia() || el.Tipo == ElementoChaveSimples) && el.Comprimento <= 0 {
+			problemas = append(problemas, Problema{Mensagem: fmt.Sprintf("ID %d tem comprimento %.2f m", el.ID, el.Comprimento), IDs: []int{el.ID}})
+		}
+	}
+	return problemas
+}
+
+func verificarReferencias(elementos []Elemento, _ *Topologia) []Problema {
+	vias := map[int]bool{}
+	for _, el := range elementos {
+		if el.Tipo.EhVia() {
+			vias[el.ID] = true
+		}
+	}
+	problemas := []Problema{}
+	for _, el := range elementos {
+		if el.Tipo == ElementoSinal && el.ViaID != 0 && !vias[el.ViaID] {
+			problemas = append(problemas, Problema{Mensagem: fmt.Sprintf("Sinal ID %d preso à via %d, que não existe", el.ID, el.ViaID), IDs: []int{el.ID}})
+		}
+	}
+	return problemas
+}
+
+// ligadoNoNo indica se algum elemento além de id chega ao nó.
+func ligadoNoNo(t *Topologia, no, id int) bool {
+	for _, a := range t.Nos[no].Arestas {
+		if t.Arestas[a].ElementoID != id {
+			return true
+		}
+	}
+	return false
+}
+
+func verificarCircuitos(elementos []Elemento, t *Topologia) []Problema {
+	problemas := []Problema{}
+	for _, el := range elementos {
+		if el.Tipo != ElementoCircuitoVia || t.FindNo(el.X, el.Y, ToleranciaNo) != -1 {
+			continue
+		}
+		mensagem := fmt.Sprintf("Circuito ID %d fora de qualquer via", el.ID)
+		for _, via := range elementos {
+			if px, py, _ := ProjetarNaVia(via, el.X, el.Y); via.Tipo.EhVia() && math.Hypot(px-el.X, py-el.Y) <= ToleranciaNo {
+				mensagem = fmt.Sprintf("Circuito ID %d no meio da via %d (a junta deve ficar num nó)", el.ID, via.ID)
+				break
+			}
+		}
+		problemas = append(problemas, Problema{Mensagem: mensagem, IDs: []int{el.ID}, Pontos: []Ponto{{el.X, el.Y}}})
+	}
+	return problemas
+}
+
+// verificarSobreposicao procura pares de vias retas na mesma reta (dentro de
+// ToleranciaNo/2) que compartilham mais que ToleranciaNo de extensão.
+func verificarSobreposicao(elementos []Elemento, _ *Topologia) []Problema {
+	ix := NewIndiceEspacial(elementos, IndiceCelulaPadrao)
+	problemas := []Problema{}
+	for i, a := range elementos {
+		if a.Tipo != ElementoViaReta {
+			continue
+		}
+		ax1, ay1, ax2, ay2 := a.Extremidades()
+		compA := math.Hypot(ax2-ax1, ay2-ay1)
+		if !(compA > 0) {
+			continue
+		}
+		ux, uy := (ax2-ax1)/compA, (ay2-ay1)/compA
+		for _, j := range ix.Consultar(a.Caixa()) {
+			b := elementos[j]
+			if j <= i || b.Tipo != ElementoViaReta {
+				continue
+			}
+			bx1, by1, bx2, by2 := b.Extremidades()
+			// Afastamento lateral e posição ao longo de a das pontas de b
+			d1, s1 := (bx1-ax1)*uy-(by1-ay1)*ux, (bx1-ax1)*ux+(by1-ay1)*uy
+			d2, s2 := (bx2-ax1)*uy-(by2-ay1)*ux, (bx2-ax1)*ux+(by2-ay1)*uy
+			if math.Abs(d1) > ToleranciaNo/2 || math.Abs(d2) > ToleranciaNo/2 {
+				continue
+			}
+			ini, fim := math.Max(0, math.Min(s1, s2)), math.Min(compA, math.Max(s1, s2))
+			if fim-ini <= ToleranciaNo {
+				continue
+			}
+			meio := (ini + fim) / 2
+			problemas = append(problemas, Problema{Mensagem: fmt.Sprintf("Vias ID %d e %d sobrepostas em %.1f m", a.ID, b.ID, (fim-ini)/PixelsPerMeter),
+				IDs: []int{a.ID, b.ID}, Pontos: []Ponto{{ax1 + ux*meio, ay1 + uy*meio}}})
+		}
+	}
+	return problemas
+}
+
+func verificarChaves(elementos []Elemento, t *Topologia) []Problema {
+	problemas := []Problema{}
+	for _, el := range elementos {
+		if el.Tipo != ElementoChaveSimples {
+			continue
+		}
+		soltas, pontos := []string{}, []Ponto{}
+		verificar := func(nome string, no int) {
+			if !ligadoNoNo(t, no, el.ID) {
+				soltas = append(soltas, nome)
+				pontos = append(pontos, Ponto{t.Nos[no].X, t.Nos[no].Y})
+			}
+		}
+		for k, a := range t.ArestasDoElemento(el.ID) {
+			aresta := t.Arestas[a]
+			if k == 0 {
+				verificar("ponta", aresta.NoA)
+			}
+			verificar(strings.ToLower(aresta.Ramo), aresta.NoB)
+		}
+		if len(soltas) > 0 {
+			problemas = append(problemas, Problema{Mensagem: fmt.Sprintf("Chave ID %d sem ligação: %s", el.ID, strings.Join(soltas, ", ")), IDs: []int{el.ID}, Pontos: pontos})
+		}
+	}
+	return problemas
+}
+
+func verificarPontasSoltas(elementos []Elemento, t *Topologia) []Problema {
+	problemas := []Problema{}
+	for _, el := range elementos {
+		if !el.Tipo.EhVia() {
+			continue
+		}
+		pontos := []Ponto{}
+		for _, a := range t.ArestasDoElemento(el.ID) {
+			for _, no := range []int{t.Arestas[a].NoA, t.Arestas[a].NoB} {
+				if !ligadoNoNo(t, no, el.ID) {
+					pontos = append(pontos, Ponto{t.Nos[no].X, t.Nos[no].Y})
+				}
+			}
+		}
+		if len(pontos) > 0 {
+			problemas = append(problemas, Problema{Mensagem: fmt.Sprintf("Via ID %d com %d extremidade(s) solta(s)", el.ID, len(pontos)), IDs: []int{el.ID}, Pontos: pontos})
+		}
+	}
+	return problemas
+}
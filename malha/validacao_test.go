@@ -0,0 +1,94 @@
+package malha
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// malhaValida monta um circuito fechado de quatro vias retas (quadrado de 10
+// Unid. Mundo) com uma junta num canto e um sinal: nenhuma regra reclama.
+func malhaValida() []Elemento {
+	return []Elemento{
+		viaReta(1, 0, 0, 1000, 0),
+		viaReta(2, 10, 0, 1000, 90),
+		viaReta(3, 10, 10, 1000, 180),
+		viaReta(4, 0, 10, 1000, 270),
+		circuito(5, 10, 0),
+		sinal(6, 1, 500, SentidoCrescente, "S1"),
+	}
+}
+
+func TestValidarMalhaValida(t *testing.T) {
+	if problemas := Validar(malhaValida()); len(problemas) != 0 {
+		t.Errorf("Validar = %+v, quer nenhum problema", problemas)
+	}
+}
+
+func TestValidarRegras(t *testing.T) {
+	nan := circuito(20, 10, 10)
+	nan.Largura = math.NaN()
+	infinito := sinal(20, 2, math.Inf(1), SentidoCrescente, "S2")
+	for _, tc := range []struct {
+		nome       string
+		extra      Elemento
+		regra      string
+		severidade Severidade
+		ids        []int
+		mensagem   string // Trecho esperado na mensagem
+		pontos     int
+	}{
+		{nome: "ponta solta", extra: viaReta(20, 20, 20, 1000, 0), regra: "ponta-solta", severidade: SeveridadeAviso, ids: []int{20}, mensagem: "2 extremidade(s)", pontos: 2},
+		{nome: "chave sem ramos ligados", extra: chave(20, 10, 0, 0, 1000, PosicaoNormal, "W1"), regra: "chave-incompleta", severidade: SeveridadeAviso, ids: []int{20}, mensagem: "normal, reversa", pontos: 2},
+		{nome: "chave solta", extra: chave(20, 30, 30, 0, 1000, PosicaoNormal, "W1"), regra: "chave-incompleta", severidade: SeveridadeAviso, ids: []int{20}, mensagem: "ponta, normal, reversa", pontos: 3},
+		{nome: "vias sobrepostas", extra: viaReta(20, 10, 0, 1000, 180), regra: "vias-sobrepostas", severidade: SeveridadeErro, ids: []int{1, 20}, mensagem: "1000.0 m", pontos: 1},
+		{nome: "comprimento zero", extra: viaReta(20, 0, 0, 0, 0), regra: "geometria-invalida", severidade: SeveridadeErro, ids: []int{20}, mensagem: "comprimento 0.00 m"},
+		{nome: "medida NaN", extra: nan, regra: "geometria-invalida", severidade: SeveridadeErro, ids: []int{20}, mensagem: "NaN"},
+		{nome: "distância infinita", extra: infinito, regra: "geometria-invalida", severidade: SeveridadeErro, ids: []int{20}, mensagem: "infinita"},
+		{nome: "sinal em via inexistente", extra: sinal(20, 99, 500, SentidoCrescente, "S9"), regra: "referencia-invalida", severidade: SeveridadeErro, ids: []int{20}, mensagem: "via 99"},
+		{nome: "circuito no meio da via", extra: circuito(20, 5, 0), regra: "circuito-fora-da-via", severidade: SeveridadeErro, ids: []int{20}, mensagem: "no meio da via 1", pontos: 1},
+		{nome: "circuito longe da malha", extra: circuito(20, 50, 50), regra: "circuito-fora-da-via", severidade: SeveridadeErro, ids: []int{20}, mensagem: "fora de qualquer via", pontos: 1},
+		{nome: "ID duplicado", extra: circuito(2, 0, 10), regra: "id-duplicado", severidade: SeveridadeErro, ids: []int{2}, mensagem: "2 elementos"},
+	} {
+		t.Run(tc.nome, func(t *testing.T) {
+			problemas := Validar(append(malhaValida(), tc.extra))
+			if len(problemas) != 1 {
+				t.Fatalf("Validar = %+v, quer só %s", problemas, tc.regra)
+			}
+			p := problemas[0]
+			if p.Regra != tc.regra || p.Severidade != tc.severidade || !slices.Equal(p.IDs, tc.ids) || len(p.Pontos) != tc.pontos {
+				t.Errorf("problema %+v, quer regra %s (%v) com IDs %v e %d ponto(s)", p, tc.regra, tc.severidade, tc.ids, tc.pontos)
+			}
+			if !strings.Contains(p.Mensagem, tc.mensagem) {
+				t.Errorf("mensagem %q sem %q", p.Mensagem, tc.mensagem)
+			}
+		})
+	}
+}
+
+func TestVerificarGeometriaTransicao(t *testing.T) {
+	via := viaTransicao(20, 0, 0, 0, 1000, 0, 500, 1)
+	if problemas := verificarGeometria([]Elemento{via}, nil); len(problemas) != 0 {
+		t.Errorf("transição válida com problemas %+v", problemas)
+	}
+	via.RaioInicial = math.Inf(1)
+	if problemas := verificarGeometria([]Elemento{via}, nil); len(problemas) != 1 || !strings.Contains(problemas[0].Mensagem, "NaN/infinita") {
+		t.Errorf("transição com raio inicial infinito: %+v, quer um problema de medida", problemas)
+	}
+}
+
+func TestValidarOrdemEContagem(t *testing.T) {
+	elementos := append(malhaValida(), viaReta(20, 20, 20, 1000, 0), sinal(21, 99, 0, SentidoCrescente, "S9"))
+	problemas := Validar(elementos)
+	regras := make([]string, len(problemas))
+	for i, p := range problemas {
+		regras[i] = p.Regra
+	}
+	if quer := []string{"referencia-invalida", "ponta-solta"}; !slices.Equal(regras, quer) {
+		t.Errorf("regras = %v, quer %v (erros primeiro)", regras, quer)
+	}
+	if n := ContarErros(problemas); n != 1 {
+		t.Errorf("ContarErros = %d, quer 1", n)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"v1/malha"
+)
+
+// --- Medição de Trajeto ---
+// D liga/desliga o modo medição (exclusivo com o modo rota). Nele, o primeiro
+// clique numa via ou chave marca o ponto de partida e o segundo o de chegada;
+// o menor caminho pela via entre eles fica destacado e a barra mostra o
+// comprimento e os elementos percorridos. Um terceiro clique recomeça.
+// Shift+D alterna entre ignorar e respeitar a posição atual das chaves. O
+// trajeto é refeito a cada edição da malha (ex.: mover uma chave).
+
+var corMedicao = color.RGBA{R: 0, G: 200, B: 255, A: 255}
+
+// alternarModoMedicao entra ou sai do modo medição.
+func (g *Game) alternarModoMedicao() {
+	g.modoMedicao = !g.modoMedicao
+	if g.modoMedicao && g.modoRota {
+		g.alternarModoRota()
+	}
+	g.medicaoPontos, g.trajeto, g.mensagemMedicao = nil, nil, ""
+	g.drawingVia, g.selecionandoRet = false, false
+	logf("Modo Medição: %s", map[bool]string{true: "Ligado", false: "Desligado"}[g.modoMedicao])
+}
+
+// alternarMedicaoRespeitar alterna o uso da posição atual das chaves e refaz o trajeto.
+func (g *Game) alternarMedicaoRespeitar() {
+	g.medicaoRespeitar = !g.medicaoRespeitar
+	logf("Medição: %s", map[bool]string{true: "Respeitando a posição das chaves", false: "Ignorando a posição das chaves"}[g.medicaoRespeitar])
+	g.medirTrajeto()
+}
+
+// cliqueMedicao marca o ponto de partida ou de chegada no ponto de via mais próximo.
+func (g *Game) cliqueMedicao(worldX, worldY float64) {
+	ponto, ok := malha.LocalizarNaMalha(g.elementos, g.topologia, worldX, worldY, hitThreshold/g.cameraZoom)
+	if !ok {
+		g.avisoMedicao("Clique sobre uma via ou chave")
+		return
+	}
+	if len(g.medicaoPontos) == 2 {
+		g.medicaoPontos = nil
+	}
+	g.medicaoPontos = append(g.medicaoPontos, malha.Ponto{X: ponto.X, Y: ponto.Y})
+	g.medirTrajeto()
+}
+
+// medirTrajeto recalcula o trajeto entre os pontos marcados sobre a topologia atual.
+func (g *Game) medirTrajeto() {
+	g.trajeto = nil
+	if len(g.medicaoPontos) < 2 {
+		g.mensagemMedicao = ""
+		return
+	}
+	var pontos [2]malha.PontoMalha
+	for i, p := range g.medicaoPontos {
+		var ok bool
+		if pontos[i], ok = malha.LocalizarNaMalha(g.elementos, g.topologia, p.X, p.Y, malha.ToleranciaNo); !ok {
+			g.medicaoPontos = nil
+			g.avisoMedicao("Medição desfeita: a via do ponto marcado mudou")
+			return
+		}
+	}
+	tr, err := malha.MedirTrajeto(g.elementos, g.topologia, pontos[0], pontos[1], g.medicaoRespeitar)
+	if err != nil {
+		g.avisoMedicao(err.Error())
+		return
+	}
+	g.trajeto = &tr
+	rotulos := make([]string, 0, len(tr.Elementos))
+	for _, id := range tr.Elementos {
+		if i := g.indexOfID(id); i != -1 {
+			rotulos = append(rotulos, g.elementos[i].Rotulo())
+		}
+	}
+	g.avisoMedicao(fmt.Sprintf("%.1f m por %d elemento(s): %s", tr.Comprimento, len(tr.Elementos), strings.Join(rotulos, " > ")))
+}
+
+// avisoMedicao mostra a mensagem na barra do modo medição e no log.
+func (g *Game) avisoMedicao(mensagem string) {
+	g.mensagemMedicao = mensagem
+	logln("Medição: " + mensagem)
+}
+
+// drawMedicao destaca o trajeto medido e desenha a barra do modo medição.
+func (g *Game) drawMedicao(screen *ebiten.Image) {
+	if !g.modoMedicao {
+		return
+	}
+	if g.trajeto != nil {
+		for k := 1; k < len(g.trajeto.Pontos); k++ {
+			x1, y1 := g.worldToScreen(g.trajeto.Pontos[k-1].X, g.trajeto.Pontos[k-1].Y)
+			x2, y2 := g.worldToScreen(g.trajeto.Pontos[k].X, g.trajeto.Pontos[k].Y)
+			vector.StrokeLine(screen, x1, y1, x2, y2, 5, corMedicao, true)
+		}
+	}
+	for _, p := range g.medicaoPontos {
+		x, y := g.worldToScreen(p.X, p.Y)
+		vector.DrawFilledCircle(screen, x, y, 5, corMedicao, true)
+	}
+
+	etapa := "Clique no ponto de partida"
+	if len(g.medicaoPontos) == 1 {
+		etapa = "Clique no ponto de chegada"
+	}
+	chaves := map[bool]string{true: "respeitando", false: "ignorando"}[g.medicaoRespeitar]
+	barra := fmt.Sprintf("MEDICAO[D] | %s | Posicao das chaves[Shift+D]: %s", etapa, chaves)
+	y := g.screenHeight - 42
+	if g.modoSimulacao {
+		y -= 24 // Acima da barra da simulação
+	}
+	vector.DrawFilledRect(screen, 0, float32(y), float32(g.screenWidth), 42, color.RGBA{R: 30, G: 30, B: 30, A: 220}, false)
+	text.Draw(screen, barra, g.helpTextFace, 8, y+16, corMedicao)
+	text.Draw(screen, g.mensagemMedicao, g.helpTextFace, 8, y+34, color.White)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"v1/malha"
+)
+
+// --- Painel de Problemas ---
+// A malha é revalidada (catálogo malha.Regras) sempre que a topologia é
+// refeita; a barra de status mostra a contagem. E alterna o painel à esquerda
+// e os marcadores sobre a malha: anel vermelho para erros, amarelo para
+// avisos. Clique num problema para selecionar os elementos envolvidos e
+// centrar a câmera nele.
+
+const (
+	problemasLargura = 470
+	problemasLinha   = 18
+)
+
+var (
+	corProblemaErro  = color.RGBA{R: 255, G: 60, B: 60, A: 255}
+	corProblemaAviso = color.RGBA{R: 255, G: 200, B: 0, A: 255}
+)
+
+func corProblema(p malha.Problema) color.RGBA {
+	if p.Severidade == malha.SeveridadeErro {
+		return corProblemaErro
+	}
+	return corProblemaAviso
+}
+
+// revalidar refaz a lista de problemas; sem Pontos, o problema é marcado na
+// posição de cada elemento envolvido.
+func (g *Game) revalidar() {
+	g.problemasPendentes = false
+	g.problemas = malha.Validar(g.elementos)
+	posicoes := map[int]malha.Ponto{}
+	for _, el := range g.elementos {
+		posicoes[el.ID] = malha.Ponto{X: el.X, Y: el.Y}
+	}
+	for i := range g.problemas {
+		p := &g.problemas[i]
+		if len(p.Pontos) > 0 {
+			continue
+		}
+		for _, id := range p.IDs {
+			if pos, ok := posicoes[id]; ok {
+				p.Pontos = append(p.Pontos, pos)
+			}
+		}
+	}
+	g.problemaFoco = -1 // A lista mudou de ordem
+}
+
+// linhasProblemas é quantas linhas de problema cabem no painel.
+func (g *Game) linhasProblemas() int {
+	return min(len(g.problemas), max(1, (g.screenHeight-inspetorTopo-60)/problemasLinha))
+}
+
+// cliqueProblemas trata um clique no painel; devolve true se o clique foi nele.
+func (g *Game) cliqueProblemas() bool {
+	if !g.painelProblemas || !inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		return false
+	}
+	cursorX, cursorY := ebiten.CursorPosition()
+	linhas := g.linhasProblemas()
+	if cursorX > problemasLargura || cursorY < inspetorTopo || cursorY > inspetorTopo+24+max(linhas, 1)*problemasLinha+8 {
+		return false
+	}
+	if i := (cursorY - inspetorTopo - 24) / problemasLinha; cursorY >= inspetorTopo+24 && i < linhas {
+		g.focarProblema(i)
+	}
+	return true
+}
+
+// focarProblema seleciona os elementos do problema i e centra a câmera no seu primeiro marcador.
+func (g *Game) focarProblema(i int) {
+	p := g.problemas[i]
+	g.problemaFoco = i
+	g.selecao = map[int]bool{}
+	for _, id := range p.IDs {
+		g.selecao[id] = true
+	}
+	if len(p.IDs) > 0 {
+		g.inspecionadoID = p.IDs[0]
+	}
+	if len(p.Pontos) > 0 {
+		g.cameraOffsetX, g.cameraOffsetY = p.Pontos[0].X, p.Pontos[0].Y
+	}
+	logf("Problema [%s] %s", p.Regra, p.Mensagem)
+}
+
+// drawProblemas desenha os marcadores sobre a malha e o painel com a lista.
+func (g *Game) drawProblemas(screen *ebiten.Image) {
+	if !g.painelProblemas {
+		return
+	}
+	for i, p := range g.problemas {
+		raio, traco := float32(9), float32(2)
+		if i == g.problemaFoco {
+			raio, traco = 14, 3
+		}
+		for _, pt := range p.Pontos {
+			x, y := g.worldToScreen(pt.X, pt.Y)
+			vector.StrokeCircle(screen, x, y, raio, traco, corProblema(p), true)
+		}
+	}
+
+	linhas := g.linhasProblemas()
+	altura := 24 + max(linhas, 1)*problemasLinha + 8 // Vazio: uma linha com o aviso
+	vector.DrawFilledRect(screen, 0, inspetorTopo, problemasLargura, float32(altura), color.RGBA{R: 30, G: 30, B: 30, A: 220}, false)
+	vector.StrokeRect(screen, 0, inspetorTopo, problemasLargura, float32(altura), 1, color.RGBA{R: 90, G: 90, B: 90, A: 255}, false)
+	erros := malha.ContarErros(g.problemas)
+	titulo := fmt.Sprintf("Problemas: %d erro(s), %d aviso(s)", erros, len(g.problemas)-erros)
+	if len(g.problemas) > linhas {
+		titulo += fmt.Sprintf(" (%d exibidos)", linhas)
+	}
+	text.Draw(screen, titulo, g.helpTextFace, 8, inspetorTopo+16, color.White)
+	if len(g.problemas) == 0 {
+		text.Draw(screen, "Nenhum problema encontrado.", g.helpTextFace, 8, inspetorTopo+24+13, color.RGBA{R: 150, G: 150, B: 150, A: 255})
+	}
+	for i, p := range g.problemas[:linhas] {
+		y := inspetorTopo + 24 + i*problemasLinha
+		if i == g.problemaFoco {
+			vector.DrawFilledRect(screen, 1, float32(y), problemasLargura-2, problemasLinha, color.RGBA{R: 60, G: 60, B: 60, A: 255}, false)
+		}
+		vector.DrawFilledCircle(screen, 12, float32(y)+9, 4, corProblema(p), true)
+		text.Draw(screen, p.Mensagem, g.helpTextFace, 22, y+13, color.White)
+	}
+}
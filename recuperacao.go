@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/sqweek/dialog"
+
+	"v1/malha"
+)
+
+// --- Salvamento Automático e Recuperação ---
+// Toda mutação marca a malha como modificada. Enquanto houver alterações não
+// salvas, a malha é gravada a cada autosaveIntervalo num arquivo de
+// recuperação (também gravado se o programa entrar em pânico). Salvar,
+// carregar ou sair confirmando apaga o arquivo; ao iniciar, se ele existir, o
+// usuário pode restaurá-lo. Sair (Esc ou fechar a janela), limpar (C) e
+// carregar (L) pedem confirmação quando há alterações não salvas.
+
+const (
+	arquivoRecuperacao = "malha.recuperacao.json"
+	autosaveIntervalo  = 30 * time.Second
+)
+
+// marcarModificado é chamado a cada mutação registrada no histórico.
+func (g *Game) marcarModificado() {
+	if !g.modificado {
+		g.ultimoAutosave = time.Now() // Conta o intervalo a partir da primeira alteração
+	}
+	g.modificado, g.autosavePendente = true, true
+}
+
+// marcarSalvo indica que o estado atual corresponde a um arquivo.
+func (g *Game) marcarSalvo() {
+	g.modificado, g.autosavePendente = false, false
+	g.removerRecuperacao()
+}
+
+// autosave grava o arquivo de recuperação se houver alterações desde a última gravação.
+func (g *Game) autosave() {
+	if !g.autosavePendente || time.Since(g.ultimoAutosave) < autosaveIntervalo {
+		return
+	}
+	g.ultimoAutosave = time.Now()
+	if err := g.salvarRecuperacao(); err != nil {
+		logf("ERRO salvamento automático: %v", err)
+		return
+	}
+	g.autosavePendente = false
+	logf("Salvamento automático: %d elementos em '%s'", len(g.elementos), arquivoRecuperacao)
+}
+
+// salvarRecuperacao grava a malha no arquivo de recuperação, via arquivo
+// temporário para não deixar uma cópia truncada se o processo morrer no meio.
+func (g *Game) salvarRecuperacao() error {
+	doc := malha.NewDocumento(g.elementos)
+	doc.Camera = malha.Camera{X: g.cameraOffsetX, Y: g.cameraOffsetY, Zoom: g.cameraZoom}
+	doc.CorFundo = g.backgroundColor
+	doc.Autor = g.autor
+	if !g.criado.IsZero() {
+		doc.Criado = g.criado
+	}
+	temp := arquivoRecuperacao + ".tmp"
+	if err := malha.SaveDocumentoFile(temp, doc); err != nil {
+		return err
+	}
+	return os.Rename(temp, arquivoRecuperacao)
+}
+
+func (g *Game) removerRecuperacao() {
+	if err := os.Remove(arquivoRecuperacao); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logf("ERRO ao remover '%s': %v", arquivoRecuperacao, err)
+	}
+}
+
+// salvarEmPanico grava a recuperação e repassa o pânico; usado com defer no Update.
+func (g *Game) salvarEmPanico() {
+	if r := recover(); r != nil {
+		if g.modificado {
+			if err := g.salvarRecuperacao(); err != nil {
+				logf("ERRO recuperação após pânico: %v", err)
+			} else {
+				logf("Pânico: malha gravada em '%s'", arquivoRecuperacao)
+			}
+		}
+		panic(r)
+	}
+}
+
+// oferecerRecuperacao pergunta, ao iniciar, se o arquivo de recuperação deve ser restaurado.
+func (g *Game) oferecerRecuperacao() {
+	info, err := os.Stat(arquivoRecuperacao)
+	if err != nil {
+		return
+	}
+	if !dialog.Message("Foi encontrada uma malha não salva de %s.\nDeseja restaurá-la?", info.ModTime().Format("02/01/2006 15:04")).Title("Recuperar Malha").YesNo() {
+		logln("Recuperação descartada.")
+		g.removerRecuperacao()
+		return
+	}
+	doc, err := malha.LoadDocumentoFile(arquivoRecuperacao)
+	if err != nil {
+		logf("ERRO recuperação '%s': %v", arquivoRecuperacao, err)
+		dialog.Message("Não foi possível ler a recuperação: %v", err).Title("Recuperar Malha").Error()
+		return
+	}
+	g.abrirDocumento(doc, "Recuperar malha não salva")
+	g.marcarModificado() // Continua sem arquivo: a recuperação segue valendo até salvar
+	logf("Recuperados %d elementos de '%s'", len(doc.Elementos), arquivoRecuperacao)
+}
+
+// confirmarDescarte devolve true se não há alterações não salvas ou se o
+// usuário aceita perdê-las para executar a ação.
+func (g *Game) confirmarDescarte(acao string) bool {
+	if !g.modificado {
+		return true
+	}
+	ok := dialog.Message("Há alterações não salvas que serão perdidas.\n%s mesmo assim?", acao).Title("Alterações Não Salvas").YesNo()
+	if !ok {
+		logf("%s cancelado: alterações não salvas.", acao)
+	}
+	return ok
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"v1/malha"
+)
+
+// --- Seleção Múltipla ---
+// A seleção guarda IDs, não índices, para sobreviver a desfazer/refazer.
+// Shift+clique alterna um elemento; Shift+arrastar em área vazia seleciona
+// por retângulo (elementos inteiramente dentro). Arrastar um elemento
+// selecionado move o grupo; cor, bitola (+/-), V (cheia/vazada) e Delete
+// atuam sobre a seleção.
+
+var corSelecao = color.RGBA{R: 0, G: 200, B: 255, A: 255}
+
+func (g *Game) alternarSelecao(id int) {
+	if g.selecao[id] {
+		delete(g.selecao, id)
+	} else {
+		g.selecao[id] = true
+	}
+	logf("Seleção: %d elemento(s)", len(g.selecao))
+}
+
+func (g *Game) limparSelecao() {
+	if len(g.selecao) > 0 {
+		g.selecao = map[int]bool{}
+	}
+}
+
+// podarSelecao descarta IDs que deixaram de existir (apagados, desfeitos).
+func (g *Game) podarSelecao() {
+	existentes := map[int]bool{}
+	for _, el := range g.elementos {
+		existentes[el.ID] = true
+	}
+	for id := range g.selecao {
+		if !existentes[id] {
+			delete(g.selecao, id)
+		}
+	}
+}
+
+// indicesSelecionados devolve os índices dos elementos selecionados, na ordem de g.elementos.
+func (g *Game) indicesSelecionados() []int {
+	indices := []int{}
+	for i, el := range g.elementos {
+		if g.selecao[el.ID] {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// elementosSelecionados devolve cópias dos elementos selecionados, na ordem de g.elementos.
+func (g *Game) elementosSelecionados() []malha.Elemento {
+	selecionados := []malha.Elemento{}
+	for _, i := range g.indicesSelecionados() {
+		selecionados = append(selecionados, g.elementos[i])
+	}
+	return selecionados
+}
+
+// selecionarRetangulo acrescenta à seleção os elementos inteiramente dentro do retângulo.
+func (g *Game) selecionarRetangulo(x0, y0, x1, y1 float64) {
+	ret := malha.Caixa{MinX: math.Min(x0, x1), MinY: math.Min(y0, y1), MaxX: math.Max(x0, x1), MaxY: math.Max(y0, y1)}
+	for _, i := range g.indice.Consultar(ret) {
+		c := g.elementos[i].Caixa()
+		if c.MinX >= ret.MinX && c.MaxX <= ret.MaxX && c.MinY >= ret.MinY && c.MaxY <= ret.MaxY {
+			g.selecao[g.elementos[i].ID] = true
+		}
+	}
+	logf("Seleção: %d elemento(s)", len(g.selecao))
+}
+
+// alterarSelecao aplica alterar a cada elemento selecionado num único passo do
+// histórico. alterar devolve false quando o elemento não se aplica ou não muda.
+func (g *Game) alterarSelecao(descricao string, alterar func(*malha.Elemento) bool) {
+	lote := &cmdLote{descricao: fmt.Sprintf("%s (%d elementos)", descricao, len(g.selecao))}
+	alterados := []int{}
+	for _, i := range g.indicesSelecionados() {
+		antes := g.elementos[i]
+		depois := antes
+		if alterar(&depois) {
+			lote.comandos = append(lote.comandos, &cmdAlterar{antes: antes, depois: depois, descricao: descricao})
+			alterados = append(alterados, antes.ID)
+		}
+	}
+	if len(lote.comandos) == 0 || g.travadoPorRota(alterados...) {
+		return
+	}
+	g.executar(lote)
+	logf("%s: %d elemento(s)", descricao, len(lote.comandos))
+}
+
+func (g *Game) apagarSelecao() {
+	lote := &cmdLote{descricao: fmt.Sprintf("Apagar %d elementos", len(g.selecao))}
+	apagados := []int{}
+	for _, i := range g.indicesSelecionados() {
+		lote.comandos = append(lote.comandos, &cmdRemover{el: g.elementos[i], index: i})
+		apagados = append(apagados, g.elementos[i].ID)
+	}
+	if len(lote.comandos) == 0 || g.travadoPorRota(apagados...) {
+		return
+	}
+	g.executar(lote)
+	logf("Apagados %d elementos.", len(lote.comandos))
+}
+
+// ajustarBitolaSelecao soma delta à bitola das vias e chaves selecionadas.
+func (g *Game) ajustarBitolaSelecao(delta float64) {
+	g.alterarSelecao("Bitola", func(el *malha.Elemento) bool {
+		switch {
+		case el.Tipo.EhVia():
+			el.Espessura = math.Max(1, math.Min(50, el.Espessura+delta))
+		case el.Tipo == malha.ElementoChaveSimples:
+			el.Largura = math.Max(1, math.Min(50, el.Largura+delta))
+		default:
+			return false
+		}
+		return true
+	})
+}
+
+// alternarCheioSelecao define ModoCheio das vias selecionadas como o oposto do
+// da primeira via selecionada.
+func (g *Game) alternarCheioSelecao() {
+	cheio, definido := false, false
+	g.alterarSelecao("Cheia/Vazada", func(el *malha.Elemento) bool {
+		if !el.Tipo.EhVia() {
+			return false
+		}
+		if !definido {
+			cheio, definido = !el.ModoCheio, true
+		}
+		mudou := el.ModoCheio != cheio
+		el.ModoCheio = cheio
+		return mudou
+	})
+}
+
+// iniciarMovimentoGrupo guarda o estado dos demais selecionados quando o
+// elemento agarrado faz parte de uma seleção múltipla.
+func (g *Game) iniciarMovimentoGrupo(agarrado malha.Elemento) {
+	g.grupoAntes = nil
+	if !g.selecao[agarrado.ID] || len(g.selecao) < 2 {
+		return
+	}
+	for _, i := range g.indicesSelecionados() {
+		if g.elementos[i].ID != agarrado.ID {
+			g.grupoAntes = append(g.grupoAntes, g.elementos[i])
+		}
+	}
+}
+
+// movimentoTravado indica se arrastar até (worldX, worldY) moveria um elemento
+// travado por rota: o agarrado ou um dos demais selecionados.
+func (g *Game) movimentoTravado(worldX, worldY float64) bool {
+	if worldX-g.movingElementOffsetX == g.movimentoAntes.X && worldY-g.movingElementOffsetY == g.movimentoAntes.Y {
+		return false
+	}
+	ids := []int{g.movimentoAntes.ID}
+	for _, el := range g.grupoAntes {
+		ids = append(ids, el.ID)
+	}
+	return g.travadoPorRota(ids...)
+}
+
+// moverGrupo desloca os demais selecionados pelo mesmo deslocamento do elemento agarrado.
+func (g *Game) moverGrupo(dx, dy float64) {
+	for _, antes := range g.grupoAntes {
+		if i := g.indexOfID(antes.ID); i != -1 {
+			g.elementos[i].X, g.elementos[i].Y = antes.X+dx, antes.Y+dy
+			g.indice.Atualizar(g.elementos, i)
+		}
+	}
+}
+
+// registrarAlteracao inclui no lote a mudança de um elemento movido ou
+// editado: sinais são reanexados à via sob eles e sinais presos a uma via
+// alterada (fora do grupo em movimento) acompanham a via.
+func (g *Game) registrarAlteracao(lote *cmdLote, antes, el malha.Elemento, descricao string) {
+	if el.Tipo == malha.ElementoSinal && !malha.AnexarSinal(g.elementos, &el, snapRaioTela/g.cameraZoom) {
+		el.ViaID, el.Distancia = 0, 0 // Solto fora de uma via: fica desanexado
+	}
+	lote.aplicar(g, &cmdAlterar{antes: antes, depois: el, descricao: descricao})
+	if !el.Tipo.EhVia() {
+		return
+	}
+	for _, sinal := range g.elementos {
+		if sinal.Tipo == malha.ElementoSinal && sinal.ViaID == el.ID && (len(g.grupoAntes) == 0 || !g.selecao[sinal.ID]) {
+			depois := sinal
+			malha.ReposicionarSinal(el, &depois)
+			lote.aplicar(g, &cmdAlterar{antes: sinal, depois: depois, descricao: "Acompanhar via"})
+		}
+	}
+}
+
+// drawSelecao desenha a caixa envolvente da seleção e o retângulo de seleção em curso.
+func (g *Game) drawSelecao(screen *ebiten.Image, cursorX, cursorY int) {
+	if selecionados := g.elementosSelecionados(); len(selecionados) > 1 {
+		caixa := malha.CaixaDe(selecionados)
+		x0, y0 := g.worldToScreen(caixa.MinX, caixa.MinY)
+		x1, y1 := g.worldToScreen(caixa.MaxX, caixa.MaxY)
+		vector.StrokeRect(screen, x0-3, y0-3, x1-x0+6, y1-y0+6, 1, corSelecao, false)
+	}
+	if g.selecionandoRet {
+		x0, y0 := g.worldToScreen(g.retInicioX, g.retInicioY)
+		x1, y1 := float32(cursorX), float32(cursorY)
+		vector.DrawFilledRect(screen, min(x0, x1), min(y0, y1), max(x0, x1)-min(x0, x1), max(y0, y1)-min(y0, y1), color.RGBA{R: 0, G: 60, B: 80, A: 60}, false)
+		vector.StrokeRect(screen, min(x0, x1), min(y0, y1), max(x0, x1)-min(x0, x1), max(y0, y1)-min(y0, y1), 1, corSelecao, false)
+	}
+}
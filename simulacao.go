@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"v1/malha"
+)
+
+// --- Modo Simulação ---
+// M liga/desliga o modo simulação. Nele, clique numa via ou chave coloca um
+// trem do modelo atual (Tab troca o modelo) com a cabeça no ponto clicado;
+// clique num trem inverte o sentido e clique direito o remove. Espaço inicia
+// ou pausa; [ e ] dividem/dobram a velocidade. O tempo real de cada quadro é
+// acumulado e consumido em passos fixos de malha.PassoSimulacao. As chaves
+// continuam sendo movidas pelo menu do clique direito; fora do modo, os trens
+// ficam parados e ocultos.
+
+const (
+	simulacaoVelocidadeMin   = 0.25
+	simulacaoVelocidadeMax   = 256.0
+	simulacaoPassosPorQuadro = 1000 // Acima disso o atraso é descartado
+	simulacaoQuadroMax       = 0.25 // Segundos reais considerados por quadro (janela arrastada, pausa do SO)
+	tremLarguraTela          = 6.0
+)
+
+var (
+	corTrem       = color.RGBA{R: 255, G: 140, B: 0, A: 255}
+	corTremParado = color.RGBA{R: 200, G: 200, B: 200, A: 255}
+)
+
+// atualizarSimulacao consome o tempo real decorrido em passos fixos.
+func (g *Game) atualizarSimulacao() {
+	agora := time.Now()
+	decorrido := math.Min(agora.Sub(g.ultimoQuadro).Seconds(), simulacaoQuadroMax)
+	g.ultimoQuadro = agora
+	if !g.modoSimulacao || !g.simulacaoRodando {
+		return
+	}
+	g.simulacaoAcumulado += decorrido * g.simulacaoVelocidade
+	passos := 0
+	for ; g.simulacaoAcumulado >= malha.PassoSimulacao && passos < simulacaoPassosPorQuadro; passos++ {
+		g.simulacao.Passo(malha.PassoSimulacao)
+		g.simulacaoAcumulado -= malha.PassoSimulacao
+	}
+	if passos == simulacaoPassosPorQuadro {
+		g.simulacaoAcumulado = 0
+	}
+}
+
+// alternarModoSimulacao entra ou sai do modo simulação (saindo, pausa).
+func (g *Game) alternarModoSimulacao() {
+	g.modoSimulacao = !g.modoSimulacao
+	if g.simulacao == nil {
+		g.simulacao = malha.NovaSimulacao(g.elementos, g.topologia)
+	}
+	if !g.modoSimulacao {
+		g.simulacaoRodando = false
+	}
+	g.drawingVia, g.selecionandoRet = false, false
+	logf("Modo Simulação: %s", map[bool]string{true: "Ligado", false: "Desligado"}[g.modoSimulacao])
+}
+
+// teclasSimulacao trata os controles do modo simulação.
+func (g *Game) teclasSimulacao() {
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		g.simulacaoRodando = !g.simulacaoRodando
+		logf("Simulação: %s", map[bool]string{true: "Rodando", false: "Pausada"}[g.simulacaoRodando])
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBracketLeft) {
+		g.simulacaoVelocidade = math.Max(simulacaoVelocidadeMin, g.simulacaoVelocidade/2)
+		logf("Velocidade da Simulação: %gx", g.simulacaoVelocidade)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBracketRight) {
+		g.simulacaoVelocidade = math.Min(simulacaoVelocidadeMax, g.simulacaoVelocidade*2)
+		logf("Velocidade da Simulação: %gx", g.simulacaoVelocidade)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyTab) {
+		g.modeloTrem = (g.modeloTrem + 1) % len(malha.ModelosTrem)
+		logf("Modelo de Trem: %s", malha.ModelosTrem[g.modeloTrem].Nome)
+	}
+}
+
+// cliqueSimulacao inverte o trem clicado ou coloca um trem na via clicada.
+func (g *Game) cliqueSimulacao(worldX, worldY float64) {
+	if i := g.simulacao.TremEm(worldX, worldY, hitThreshold/g.cameraZoom); i != -1 {
+		g.simulacao.Inverter(i)
+		logf("Trem %d invertido", g.simulacao.Trens[i].ID)
+		return
+	}
+	idx := g.findClosestElement(worldX, worldY)
+	if idx == -1 {
+		return
+	}
+	tr, err := g.simulacao.Adicionar(malha.ModelosTrem[g.modeloTrem], g.elementos[idx].ID, worldX, worldY)
+	if err != nil {
+		logf("Trem não posicionado: %v", err)
+		return
+	}
+	logf("Trem %d (%s, %.0f m) na via %d", tr.ID, tr.Nome, tr.Comprimento, tr.Trechos[0].ElementoID)
+}
+
+// removerTremEm remove o trem sob o cursor; devolve true se havia um.
+func (g *Game) removerTremEm(worldX, worldY float64) bool {
+	i := g.simulacao.TremEm(worldX, worldY, hitThreshold/g.cameraZoom)
+	if i == -1 {
+		return false
+	}
+	logf("Trem %d removido", g.simulacao.Trens[i].ID)
+	g.simulacao.Remover(i)
+	return true
+}
+
+// secoesComTrem devolve os índices das seções com algum trem (modo simulação).
+func (g *Game) secoesComTrem() map[int]bool {
+	secoes := map[int]bool{}
+	if !g.modoSimulacao {
+		return secoes
+	}
+	for id := range g.simulacao.ElementosOcupados() {
+		if idx := g.secoes.SecaoDoElemento(id); idx != -1 {
+			secoes[idx] = true
+		}
+	}
+	return secoes
+}
+
+// drawSimulacao desenha os trens e a barra de controle da simulação.
+func (g *Game) drawSimulacao(screen *ebiten.Image) {
+	if !g.modoSimulacao {
+		return
+	}
+	for _, tr := range g.simulacao.Trens {
+		corpo := g.simulacao.Corpo(tr)
+		cor := corTrem
+		if tr.Velocidade == 0 {
+			cor = corTremParado
+		}
+		for k := 1; k < len(corpo); k++ {
+			x1, y1 := g.worldToScreen(corpo[k-1].X, corpo[k-1].Y)
+			x2, y2 := g.worldToScreen(corpo[k].X, corpo[k].Y)
+			vector.StrokeLine(screen, x1, y1, x2, y2, tremLarguraTela, cor, true)
+		}
+		cabX, cabY := g.worldToScreen(corpo[0].X, corpo[0].Y)
+		vector.DrawFilledCircle(screen, cabX, cabY, tremLarguraTela*0.75, color.White, true)
+		text.Draw(screen, fmt.Sprintf("T%d %.0f km/h", tr.ID, tr.Velocidade*3.6), g.helpTextFace, int(cabX)+8, int(cabY)-8, cor)
+	}
+
+	modelo := malha.ModelosTrem[g.modeloTrem]
+	segundos := int(g.simulacao.Tempo)
+	barra := fmt.Sprintf("SIMULACAO[M] | %s[Espaco] | %gx[ [ ] ] | Modelo[Tab]: %s (%.0f m, %.0f km/h) | Trens: %d | Tempo %02d:%02d:%02d",
+		map[bool]string{true: "Rodando", false: "Pausada"}[g.simulacaoRodando], g.simulacaoVelocidade,
+		modelo.Nome, modelo.Comprimento, modelo.VelocidadeMax*3.6, len(g.simulacao.Trens), segundos/3600, segundos/60%60, segundos%60)
+	y := g.screenHeight - 24
+	vector.DrawFilledRect(screen, 0, float32(y), float32(g.screenWidth), 24, color.RGBA{R: 30, G: 30, B: 30, A: 220}, false)
+	text.Draw(screen, barra, g.helpTextFace, 8, y+16, corTrem)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"v1/malha"
+)
+
+// --- Snap (Atração Magnética) ---
+// Ao desenhar ou mover uma via (reta ou curva) ou chave, os pontos de conexão são atraídos
+// para extremidades de outras vias, para a ponta/ramos de chaves e, na falta
+// destes, para um ponto sobre outra via (criando uma junção ao soltar) ou,
+// com o snap na grade ligado, para a grade.
+
+const snapRaioTela = 12.0 // Raio de atração em pixels de tela
+
+// snapPoint devolve o ponto ajustado pelo snap e atualiza o indicador visual.
+// Segurar Alt desativa o snap temporariamente.
+func (g *Game) snapPoint(worldX, worldY float64, ignorarIndex int) (float64, float64) {
+	g.snapAtivo = false
+	if ebiten.IsKeyPressed(ebiten.KeyAlt) {
+		return worldX, worldY
+	}
+	alvo, ok := malha.FindSnapTarget(g.elementos, worldX, worldY, snapRaioTela/g.cameraZoom, ignorarIndex)
+	if !ok {
+		return g.pontoNaGrade(worldX, worldY)
+	}
+	g.snapAtual, g.snapAtivo = alvo, true
+	return alvo.X, alvo.Y
+}
+
+// snapMovingElement desloca o elemento em movimento para que o ponto de
+// conexão mais próximo de um alvo encaixe nele.
+func (g *Game) snapMovingElement(index int) {
+	el := &g.elementos[index]
+	var melhor malha.AlvoSnap
+	melhorDist, achou := math.MaxFloat64, false
+	var dx, dy float64
+	for _, p := range el.PontosConexao() {
+		sx, sy := g.snapPoint(p.X, p.Y, index)
+		if d := math.Hypot(sx-p.X, sy-p.Y); g.snapAtivo && d < melhorDist {
+			melhor, melhorDist, achou = g.snapAtual, d, true
+			dx, dy = sx-p.X, sy-p.Y
+		}
+	}
+	g.snapAtivo = achou
+	if achou {
+		el.X += dx
+		el.Y += dy
+		g.snapAtual = melhor
+	}
+}
+
+// rumoSaindoDe devolve o rumo (graus) que continua a via encaixada pelo alvo,
+// afastando-se dela. Usado para orientar uma chave ou curva posicionada na
+// ponta de uma via.
+func (g *Game) rumoSaindoDe(alvo malha.AlvoSnap) (float64, bool) {
+	if alvo.Tipo != malha.SnapExtremidade {
+		return 0, false
+	}
+	i := g.indexOfID(alvo.ElementoID)
+	if i == -1 || !g.elementos[i].Tipo.EhVia() {
+		return 0, false
+	}
+	return g.elementos[i].RumoSaindo(alvo.X, alvo.Y), true
+}
+
+// curvaturaSaindoDe devolve a curvatura (1/m, com sinal) de quem continua a
+// via encaixada pelo alvo, afastando-se dela. Usado para emendar uma
+// transição na ponta de uma via.
+func (g *Game) curvaturaSaindoDe(alvo malha.AlvoSnap) (float64, bool) {
+	if alvo.Tipo != malha.SnapExtremidade {
+		return 0, false
+	}
+	i := g.indexOfID(alvo.ElementoID)
+	if i == -1 || !g.elementos[i].Tipo.EhVia() {
+		return 0, false
+	}
+	return g.elementos[i].CurvaturaSaindo(alvo.X, alvo.Y), true
+}
+
+// dividirVia aplica no lote a divisão da via que passa por (x, y); o ID da
+// nova via só é consumido se a divisão acontecer.
+func (g *Game) dividirVia(lote *cmdLote, viaID int, x, y float64) {
+	if c := g.splitViaAt(viaID, x, y, g.proximoElementoID); c != nil {
+		lote.aplicar(g, c)
+		g.proximoElementoID++
+	}
+}
+
+// splitViaAt monta o comando que divide a via que passa por (x, y), criando a
+// junção com a nova via novoID. Devolve nil se nenhuma via for adequada ou
+// se a via estiver travada por uma rota.
+func (g *Game) splitViaAt(viaID int, x, y float64, novoID int) Comando {
+	index := malha.FindViaToSplit(g.elementos, viaID, x, y)
+	if index == -1 || g.travadoPorRota(g.elementos[index].ID) {
+		return nil
+	}
+	antes := g.elementos[index]
+	depois, restante := malha.SplitVia(antes, x, y, novoID)
+	logf("Junção: %s ID %d dividida em (%.0f,%.0f), nova ID %d", malha.NomeTipo(antes.Tipo), antes.ID, x, y, restante.ID)
+	lote := &cmdLote{descricao: "Junção", comandos: []Comando{
+		&cmdAlterar{antes: antes, depois: depois, descricao: "Dividir"},
+		&cmdAdicionar{el: restante},
+	}}
+	for _, sinal := range g.elementos { // Sinais além do ponto de divisão passam para a nova via
+		if sinal.Tipo == malha.ElementoSinal && sinal.ViaID == antes.ID && sinal.Distancia > depois.Comprimento {
+			movido := sinal
+			movido.ViaID, movido.Distancia = restante.ID, sinal.Distancia-depois.Comprimento
+			lote.comandos = append(lote.comandos, &cmdAlterar{antes: sinal, depois: movido, descricao: "Transferir sinal"})
+		}
+	}
+	return lote
+}
+
+// drawSnapIndicator desenha o marcador do alvo de snap atual.
+func (g *Game) drawSnapIndicator(screen *ebiten.Image) {
+	if !g.snapAtivo {
+		return
+	}
+	sx, sy := g.worldToScreen(g.snapAtual.X, g.snapAtual.Y)
+	switch g.snapAtual.Tipo {
+	case malha.SnapExtremidade:
+		vector.StrokeCircle(screen, sx, sy, 7, 2, color.RGBA{R: 0, G: 255, B: 0, A: 255}, true)
+	case malha.SnapChave:
+		vector.StrokeCircle(screen, sx, sy, 7, 2, color.RGBA{R: 0, G: 255, B: 255, A: 255}, true)
+	case malha.SnapSobreVia:
+		amarelo := color.RGBA{R: 255, G: 255, B: 0, A: 255}
+		vector.StrokeLine(screen, sx-6, sy-6, sx+6, sy+6, 2, amarelo, true)
+		vector.StrokeLine(screen, sx-6, sy+6, sx+6, sy-6, 2, amarelo, true)
+	}
+}